@@ -3,18 +3,29 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"ahavault/server/internal/api"
+	"ahavault/server/internal/api/handlers"
 	"ahavault/server/internal/config"
+	"ahavault/server/internal/crypto"
 	"ahavault/server/internal/database"
+	"ahavault/server/internal/middleware"
 	"ahavault/server/internal/models"
 	"ahavault/server/internal/services"
 	"ahavault/server/internal/storage"
 	"ahavault/server/internal/tasks"
 	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
 )
 
 func main() {
+	// 子命令：存储后端迁移
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage" {
+		runMigrateStorage(os.Args[2:])
+		return
+	}
+
 	// 加载配置
 	cfg, err := config.Load()
 	if err != nil {
@@ -58,6 +69,14 @@ func main() {
 		&models.UploadSession{},
 		&models.AuditLog{},
 		&models.SystemSetting{},
+		&models.ScrubReport{},
+		&models.StorageMigration{},
+		&models.UploadChallenge{},
+		&models.TusUploadJob{},
+		&models.QuotaReservation{},
+		&models.DownloadSlot{},
+		&models.SharePolicyOverride{},
+		&models.ShareRecipient{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
@@ -69,24 +88,56 @@ func main() {
 	defer database.CloseRedis()
 
 	// 初始化存储引擎
-	var storageEngine storage.Engine
-	switch cfg.Storage.Type {
-	case "local":
-		storageEngine, err = storage.NewLocalEngine(cfg.Storage.LocalPath)
+	storageEngine, err := newStorageEngine(cfg.Storage.Type, &cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", cfg.Storage.Type, err)
+	}
+
+	// 迁移期间：新文件写入新存储，读取时回退到旧存储
+	if cfg.Storage.MigrateFrom != "" {
+		sourceEngine, err := newStorageEngine(cfg.Storage.MigrateFrom, &cfg.Storage)
 		if err != nil {
-			log.Fatalf("Failed to initialize local storage: %v", err)
+			log.Fatalf("Failed to initialize %s storage: %v", cfg.Storage.MigrateFrom, err)
 		}
-	default:
-		log.Fatalf("Unsupported storage type: %s", cfg.Storage.Type)
+		storageEngine = storage.NewMigratingEngine(storageEngine, sourceEngine)
+		log.Printf("Storage migration mode: writing to %s, falling back to %s for reads",
+			cfg.Storage.Type, cfg.Storage.MigrateFrom)
+	}
+
+	// 初始化密钥环（当前主密钥 + 已退役密钥）
+	keyring, err := newKeyring(&cfg.Crypto)
+	if err != nil {
+		log.Fatalf("Failed to initialize keyring: %v", err)
 	}
 
 	// 创建服务实例
 	userService := services.NewUserService(database.DB, cfg.Crypto.JWTSecret)
-	fileService := services.NewFileService(database.DB, storageEngine, cfg.Crypto.MasterKey)
+	fileService := services.NewFileServiceWithKeyring(database.DB, storageEngine, keyring)
+	fileService.SetTempDir(cfg.Storage.TempPath)
 	shareService := services.NewShareService(database.DB, fileService)
+	shareService.SetPickupCodeGenerator(newPickupCodeGenerator(&cfg.Business))
+	shareService.SetVanityCodes(cfg.Business.VanityCodesEnabled)
+	shareService.SetDownloadCountThreshold(cfg.Business.DownloadCountThreshold)
+	shareService.SetDownloadTicket(cfg.Crypto.JWTSecret, cfg.Business.DownloadTicketTTL)
+	shareService.SetSharePolicy(services.SharePolicy{
+		DefaultExpiry:   cfg.Business.DefaultShareExpiry,
+		MaxExpiry:       cfg.Business.MaxShareExpiry,
+		MaxFiles:        cfg.Business.MaxFilesPerShare,
+		MaxActiveShares: cfg.Business.MaxActiveSharesUser,
+	})
+	uploadService := services.NewUploadService(database.DB, fileService, cfg.Storage.UploadPath)
+
+	// 存储巡检任务
+	scrubber := tasks.NewScrubber(database.DB, storageEngine, keyring, tasks.ScrubOptions{
+		RateLimit:   cfg.Business.ScrubRateLimit,
+		Quarantine:  cfg.Business.ScrubQuarantine,
+		OrphanGrace: cfg.Business.ScrubOrphanGrace,
+	})
 
 	// 启动后台任务调度器
 	scheduler := tasks.NewScheduler(database.DB, storageEngine)
+	scheduler.SetScrubber(scrubber, cfg.Business.ScrubSchedule)
+	scheduler.SetFragmentCleanup(cfg.Storage.TusPath, cfg.Business.GCFragmentRetention)
 	if err := scheduler.Start(); err != nil {
 		log.Printf("Warning: Failed to start background scheduler: %v", err)
 	} else {
@@ -94,11 +145,47 @@ func main() {
 	}
 	defer scheduler.Stop()
 
+	// Tus 上传入库任务队列（启动时恢复未完成的任务）
+	tusProcessor := tasks.NewTusProcessor(database.DB, fileService, cfg.Storage.TusPath, tasks.TusProcessorOptions{})
+	if err := tusProcessor.Start(); err != nil {
+		log.Fatalf("Failed to start tus upload processor: %v", err)
+	}
+	defer tusProcessor.Stop()
+
+	// 存在退役密钥时，后台将旧 DEK 轮换到主密钥
+	keyRotator := tasks.NewKeyRotator(database.DB, keyring)
+	if len(keyring.RetiredIDs()) > 0 {
+		go keyRotator.Run()
+	}
+
 	// 创建 Gin 路由
 	router := gin.Default()
 
+	// 上传准入策略（单文件大小上限与 MIME 白名单）
+	uploadPolicy := services.UploadPolicy{
+		MaxFileSize:      cfg.Business.MaxFileSize,
+		AllowedMimeTypes: cfg.Business.AllowedMimeTypes,
+	}
+	fileService.SetUploadPolicy(uploadPolicy)
+
+	// Tus 上传锁：多实例部署时通过 Redis 串行化同一上传的请求
+	var tusLocker tusd.Locker
+	if cfg.Storage.TusLocker == "redis" {
+		tusLocker = handlers.NewRedisTusLocker()
+	}
+
+	// 取件码与访问密码防暴力破解（失败计数保存在 Redis）
+	bruteForce := middleware.NewBruteForceGuard(database.DB, middleware.BruteForceConfig{
+		MaxFailures:     cfg.Business.BruteForceMaxFailures,
+		CodeMaxFailures: cfg.Business.BruteForceCodeMaxFailures,
+		Window:          cfg.Business.BruteForceWindow,
+		Lockout:         cfg.Business.BruteForceLockout,
+		MaxLockout:      cfg.Business.BruteForceMaxLockout,
+		AlertLevel:      cfg.Business.BruteForceAlertLevel,
+	})
+
 	// 设置路由
-	api.SetupRoutes(router, userService, fileService, shareService)
+	api.SetupRoutes(router, userService, fileService, shareService, uploadService, tusProcessor, uploadPolicy, tusLocker, keyRotator, scrubber, bruteForce)
 
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -108,3 +195,84 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// newKeyring 根据配置创建密钥环
+//
+// 主密钥来自环境变量、密钥文件或 Vault Transit；已退役的密钥总是本地 KEK。
+func newKeyring(cfg *config.CryptoConfig) (*crypto.Keyring, error) {
+	var primary crypto.KeyProvider
+	var err error
+	switch cfg.KeyProvider {
+	case "file":
+		primary, err = crypto.LoadLocalKeyFile(cfg.MasterKeyID, cfg.MasterKeyFile)
+	case "vault":
+		primary, err = crypto.NewVaultTransitProvider(crypto.VaultConfig{
+			Address:   cfg.Vault.Address,
+			Token:     cfg.Vault.Token,
+			Namespace: cfg.Vault.Namespace,
+			Mount:     cfg.Vault.Mount,
+			KeyName:   cfg.Vault.KeyName,
+			KeyID:     cfg.MasterKeyID,
+			Timeout:   cfg.Vault.Timeout,
+		})
+	default:
+		primary, err = crypto.NewLocalKeyProvider(cfg.MasterKeyID, cfg.MasterKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 启动时验证主密钥可用，避免在首次上传时才发现 KMS 配置错误
+	if err := crypto.CheckKeyProvider(primary); err != nil {
+		return nil, fmt.Errorf("key provider %q is not usable: %w", primary.KeyID(), err)
+	}
+
+	retired := make([]crypto.KeyProvider, 0, len(cfg.RetiredKeys))
+	for id, kek := range cfg.RetiredKeys {
+		provider, err := crypto.NewLocalKeyProvider(id, kek)
+		if err != nil {
+			return nil, err
+		}
+		retired = append(retired, provider)
+	}
+
+	return crypto.NewProviderKeyring(primary, retired...)
+}
+
+// newStorageEngine 根据存储类型创建存储引擎
+func newStorageEngine(engineType string, cfg *config.StorageConfig) (storage.Engine, error) {
+	switch engineType {
+	case "local":
+		return storage.NewLocalEngine(cfg.LocalPath)
+	case "s3":
+		s3Engine, err := storage.NewS3Engine(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+			PathStyle: cfg.S3PathStyle,
+			PartSize:  cfg.S3PartSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := s3Engine.EnsureBucket(); err != nil {
+			return nil, fmt.Errorf("failed to prepare S3 bucket: %w", err)
+		}
+		return s3Engine, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", engineType)
+	}
+}
+
+// newPickupCodeGenerator 根据配置创建取件码生成器
+func newPickupCodeGenerator(cfg *config.BusinessConfig) *services.PickupCodeGenerator {
+	codeGen := services.NewPickupCodeGenerator(cfg.ShareCodeLength)
+	if cfg.ShareCodeFormat == string(services.PickupCodeFormatWords) {
+		codeGen = services.NewWordCodeGenerator(cfg.ShareCodeWords)
+	}
+	codeGen.SetBlocklist(cfg.ShareCodeBlocklist)
+	return codeGen
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"ahavault/server/internal/config"
+	"ahavault/server/internal/database"
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/tasks"
+)
+
+// runMigrateStorage 执行存储后端迁移子命令
+//
+// 用法: ahavault migrate-storage [-from local] [-to s3] [-status]
+//
+// 默认从 STORAGE_MIGRATE_FROM 迁移到 STORAGE_TYPE。迁移期间服务端应以相同配置运行
+// （双读模式），迁移完成后移除 STORAGE_MIGRATE_FROM 并重启服务即可完成切换。
+// 命令可随时中断，再次执行会从上次的位置继续。
+func runMigrateStorage(args []string) {
+	fs := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	from := fs.String("from", "", "source storage type (local or s3), defaults to STORAGE_MIGRATE_FROM")
+	to := fs.String("to", "", "target storage type (local or s3), defaults to STORAGE_TYPE")
+	statusOnly := fs.Bool("status", false, "print the latest migration progress and exit")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *from == "" {
+		*from = cfg.Storage.MigrateFrom
+	}
+	if *to == "" {
+		*to = cfg.Storage.Type
+	}
+
+	if *from == "" || *from == *to {
+		log.Fatalf("Source storage must be set (-from or STORAGE_MIGRATE_FROM) and differ from target %q", *to)
+	}
+
+	if err := database.InitPostgreSQL(cfg); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := database.DB.AutoMigrate(&models.StorageMigration{}); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	source, err := newStorageEngine(*from, &cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", *from, err)
+	}
+	target, err := newStorageEngine(*to, &cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", *to, err)
+	}
+
+	migrator := tasks.NewStorageMigrator(database.DB, source, target, *from, *to)
+
+	if *statusOnly {
+		latest, err := migrator.Latest()
+		if err != nil {
+			log.Fatalf("Failed to query migration: %v", err)
+		}
+		if latest == nil {
+			fmt.Printf("No storage migration from %s to %s\n", *from, *to)
+			return
+		}
+		printMigration(latest)
+		return
+	}
+
+	migrator.SetProgressFunc(printMigration)
+	migration, err := migrator.Run()
+	if err != nil {
+		log.Fatalf("Storage migration failed: %v", err)
+	}
+	printMigration(migration)
+
+	if migration.Failed > 0 {
+		fmt.Printf("%d blobs failed to migrate, see storage_migrations.failures (id %s)\n", migration.Failed, migration.ID)
+		os.Exit(1)
+	}
+	fmt.Printf("Migration complete. Remove STORAGE_MIGRATE_FROM and restart the server to finish the cutover.\n")
+}
+
+// printMigration 输出迁移进度
+func printMigration(m *models.StorageMigration) {
+	done := m.Copied + m.Skipped + m.Failed
+	fmt.Printf("[%s] %s -> %s: %d/%d blobs (copied=%d, skipped=%d, failed=%d, bytes=%d)\n",
+		m.Status, m.Source, m.Target, done, m.TotalBlobs, m.Copied, m.Skipped, m.Failed, m.BytesCopied)
+}
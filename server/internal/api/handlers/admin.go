@@ -0,0 +1,312 @@
+// Package handlers 提供 HTTP 处理器
+//
+// 本文件实现管理员接口：
+//   - KEK 使用情况查询
+//   - 触发 KEK 轮换（重新加密 DEK）
+//   - 触发存储巡检、查询巡检报告
+//   - 按用户覆盖分享限制
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ahavault/server/internal/middleware"
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
+	"ahavault/server/internal/tasks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminHandler 管理员处理器
+type AdminHandler struct {
+	keyRotator   *tasks.KeyRotator
+	scrubber     *tasks.Scrubber
+	shareService *services.ShareService
+}
+
+// NewAdminHandler 创建管理员处理器
+func NewAdminHandler(keyRotator *tasks.KeyRotator, scrubber *tasks.Scrubber, shareService *services.ShareService) *AdminHandler {
+	return &AdminHandler{
+		keyRotator:   keyRotator,
+		scrubber:     scrubber,
+		shareService: shareService,
+	}
+}
+
+// StartScrubRequest 触发存储巡检请求
+type StartScrubRequest struct {
+	Quarantine *bool `json:"quarantine"` // 为空时使用 SCRUB_QUARANTINE 配置
+}
+
+// SharePolicyRequest 设置用户分享限制请求
+//
+// 字段为空时使用全局配置，0 表示对该用户不限制。
+type SharePolicyRequest struct {
+	MaxShareExpiry   *int64 `json:"max_share_expiry"` // 秒数
+	MaxFilesPerShare *int   `json:"max_files_per_share"`
+	MaxActiveShares  *int   `json:"max_active_shares"`
+}
+
+// ListKeys 查询各 KEK 的使用情况与轮换进度
+func (h *AdminHandler) ListKeys(c *gin.Context) {
+	usage, err := h.keyRotator.KeyUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to query key usage",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"keys":   usage,
+			"rewrap": h.keyRotator.Progress(),
+		},
+	})
+}
+
+// RewrapKeys 后台启动 KEK 轮换任务
+func (h *AdminHandler) RewrapKeys(c *gin.Context) {
+	if h.keyRotator.IsRunning() {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "Key rewrap is already running",
+			"data":    h.keyRotator.Progress(),
+		})
+		return
+	}
+
+	go func() {
+		result := h.keyRotator.Run()
+		if len(result.Errors) > 0 {
+			log.Printf("[Rewrap] Finished with %d errors", len(result.Errors))
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    0,
+		"message": "Key rewrap started",
+	})
+}
+
+// StartScrub 后台启动存储巡检
+func (h *AdminHandler) StartScrub(c *gin.Context) {
+	var req StartScrubRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid request parameters",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	if h.scrubber.IsRunning() {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "Storage scrub is already running",
+		})
+		return
+	}
+
+	quarantine := h.scrubber.DefaultQuarantine()
+	if req.Quarantine != nil {
+		quarantine = *req.Quarantine
+	}
+
+	go func() {
+		if _, err := h.scrubber.Run(tasks.ScrubTriggerManual, quarantine); err != nil {
+			log.Printf("[Scrub] Manual scrub failed: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    0,
+		"message": "Storage scrub started",
+		"data": gin.H{
+			"quarantine": quarantine,
+		},
+	})
+}
+
+// ListScrubReports 查询最近的巡检报告
+func (h *AdminHandler) ListScrubReports(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	reports, err := h.scrubber.LatestReports(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list scrub reports",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"reports": reports,
+			"running": h.scrubber.IsRunning(),
+		},
+	})
+}
+
+// GetScrubReport 查询巡检报告详情（含异常明细）
+func (h *AdminHandler) GetScrubReport(c *gin.Context) {
+	report, err := h.scrubber.GetReport(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "Scrub report not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get scrub report",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
+
+// GetUserSharePolicy 查询用户的分享限制覆盖及实际适用的限制
+func (h *AdminHandler) GetUserSharePolicy(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	h.respondSharePolicy(c, userUUID)
+}
+
+// SetUserSharePolicy 设置用户的分享限制覆盖（字段全部为空时恢复全局配置）
+func (h *AdminHandler) SetUserSharePolicy(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	var req SharePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	adminUUID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	override := &models.SharePolicyOverride{
+		MaxShareExpiry:   req.MaxShareExpiry,
+		MaxFilesPerShare: req.MaxFilesPerShare,
+		MaxActiveShares:  req.MaxActiveShares,
+	}
+	err = h.shareService.SetSharePolicyOverride(userUUID, override, adminUUID, services.AuditContext{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "User not found",
+			})
+		case errors.Is(err, services.ErrInvalidSharePolicy):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to update share policy",
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	h.respondSharePolicy(c, userUUID)
+}
+
+// respondSharePolicy 返回用户的分享限制覆盖及实际适用的限制（有效期以秒为单位）
+func (h *AdminHandler) respondSharePolicy(c *gin.Context, userID uuid.UUID) {
+	override, err := h.shareService.GetSharePolicyOverride(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get share policy",
+			"error":   err.Error(),
+		})
+		return
+	}
+	policy, err := h.shareService.EffectiveSharePolicy(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get share policy",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"override": override,
+			"effective": gin.H{
+				"default_share_expiry": int64(policy.DefaultExpiry / time.Second),
+				"max_share_expiry":     int64(policy.MaxExpiry / time.Second),
+				"max_files_per_share":  policy.MaxFiles,
+				"max_active_shares":    policy.MaxActiveShares,
+			},
+		},
+	})
+}
@@ -1,9 +1,12 @@
 // Package handlers 提供 HTTP 请求处理器
 //
 // 本文件实现了文件下载处理器，支持：
-//   - HTTP Range 请求（断点续传）
+//   - HTTP Range / If-Range 请求（断点续传）与多区间 multipart/byteranges
 //   - 流式解密传输（边解密边传输）
-//   - 下载次数统计
+//   - 按入库时识别的类型返回 Content-Type，安全类型可选内联预览
+//   - 多文件分享的单文件下载与 ZIP 打包下载
+//   - 下载凭证鉴权（访问密码不出现在下载地址中）
+//   - 下载次数统计（原子占用下载名额，传输完成才计数，同一会话续传不重复计数）
 //   - 访问日志记录
 //
 // 作者: AhaVault Team
@@ -11,14 +14,21 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 	"strings"
+	"time"
 
+	"ahavault/server/internal/models"
 	"ahavault/server/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // DownloadHandler 下载处理器
@@ -38,47 +48,122 @@ func NewDownloadHandler(shareService *services.ShareService, fileService *servic
 // DownloadByPickupCode 通过取件码下载文件
 //
 // 该函数实现文件下载的完整流程：
-//  1. 验证取件码有效性
-//  2. 检查访问密码（如果设置）
-//  3. 检查下载次数限制
-//  4. 支持 HTTP Range 请求（断点续传）
-//  5. 流式解密传输文件
-//  6. 更新下载统计
+//  1. 验证下载凭证（ticket 查询参数，由 POST /api/public/shares/:code 签发）
+//  2. 凭证绑定了文件时只能下载该文件
+//  3. 占用下载名额（下载次数用完时拒绝；携带下载会话 ID 的续传复用原名额）
+//  4. 单文件分享直接下载，支持 HTTP Range / If-Range 和多区间请求（断点续传）
+//  5. 多文件分享（或 format=zip）流式打包为 ZIP 下载，整体只计一次下载
+//  6. 传输完成（或达到计数阈值）时计入下载次数，中断时归还名额
 //
-// 端点: GET /api/download/:code
+// 响应通过 X-Download-Session 头和 Cookie 返回下载会话 ID，续传时通过 Cookie
+// 或 download_session 查询参数带回。凭证在有效期内可重复使用；过期后只能凭
+// 下载会话续传，不能开始新的下载。
+//
+// 端点: GET /api/public/download/:code 或 GET /api/public/links/:token/download
 //
 // 参数:
 //   - c: Gin 上下文对象
 //
 // 返回:
-//   - 200: 下载成功（全文件）
+//   - 200: 下载成功（全文件或 ZIP）
 //   - 206: 部分内容下载成功（Range 请求）
 //   - 400: 请求参数错误
-//   - 401: 需要访问密码
-//   - 403: 访问密码错误或下载次数超限
-//   - 404: 取件码不存在
-//   - 410: 分享已过期
+//   - 401: 缺少下载凭证
+//   - 403: 下载凭证无效或已过期，或下载次数超限
+//   - 404: 取件码不存在或分享已失效
+//   - 416: 请求的区间无法满足
 func (h *DownloadHandler) DownloadByPickupCode(c *gin.Context) {
-	pickupCode := c.Param("code")
-	if pickupCode == "" {
+	share, files, ticket, ok := h.resolveShare(c)
+	if !ok {
+		return
+	}
+
+	if len(files) > 1 || c.Query("format") == "zip" {
+		h.serveShareZip(c, share, ticket, files)
+		return
+	}
+
+	h.serveSharedFile(c, share, ticket, &files[0])
+}
+
+// DownloadSharedFile 下载分享中的指定文件
+//
+// 端点: GET /api/public/download/:code/:fileID 或 GET /api/public/links/:token/download/:fileID
+//
+// 参数:
+//   - c: Gin 上下文对象
+//
+// 返回:
+//   - 200 / 206 / 416: 同 DownloadByPickupCode
+//   - 400: 文件 ID 格式错误
+//   - 404: 取件码不存在，或文件不在该分享中（含凭证绑定了其他文件）
+func (h *DownloadHandler) DownloadSharedFile(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("fileID"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
-			"message": "Missing pickup code",
+			"message": "Invalid file ID",
 		})
 		return
 	}
 
-	// 获取访问密码（如果有）
-	password := c.Query("password")
+	share, files, ticket, ok := h.resolveShare(c)
+	if !ok {
+		return
+	}
+
+	for i := range files {
+		if files[i].ID == fileID {
+			h.serveSharedFile(c, share, ticket, &files[i])
+			return
+		}
+	}
 
-	// 验证取件码并获取分享信息
-	share, files, err := h.shareService.GetShareByCode(pickupCode, password)
+	c.JSON(http.StatusNotFound, gin.H{
+		"code":    404,
+		"message": "File not found in share",
+	})
+}
+
+// resolveShare 验证取件码（或分享链接）和下载凭证，返回分享及凭证可以下载的文件
+//
+// 验证失败时已写入错误响应，调用方直接返回即可。
+func (h *DownloadHandler) resolveShare(c *gin.Context) (*models.ShareSession, []models.FileMetadata, *services.DownloadTicket, bool) {
+	pickupCode := c.Param("code")
+	linkToken := c.Param("token")
+	if pickupCode == "" && linkToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Missing pickup code",
+		})
+		return nil, nil, nil, false
+	}
+
+	// 验证下载凭证并获取分享信息（下载次数在占用名额时检查）
+	var share *models.ShareSession
+	var files []models.FileMetadata
+	var ticket *services.DownloadTicket
+	var err error
+	if linkToken != "" {
+		share, files, ticket, err = h.shareService.GetShareByLinkTicket(linkToken, c.Query("ticket"), viewerID(c))
+	} else {
+		share, files, ticket, err = h.shareService.GetShareByTicket(pickupCode, c.Query("ticket"), viewerID(c))
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"code":    404,
+		recordAccessFailure(c, err)
+		status := http.StatusNotFound
+		switch {
+		case errors.Is(err, services.ErrTicketRequired), errors.Is(err, services.ErrRecipientRequired):
+			status = http.StatusUnauthorized
+		case errors.Is(err, services.ErrInvalidTicket), errors.Is(err, services.ErrTicketExpired),
+			errors.Is(err, services.ErrNotRecipient):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
 			"message": err.Error(),
 		})
-		return
+		return nil, nil, nil, false
 	}
 
 	// 如果没有文件，返回错误
@@ -87,14 +172,15 @@ func (h *DownloadHandler) DownloadByPickupCode(c *gin.Context) {
 			"code":    404,
 			"message": "No files in share",
 		})
-		return
+		return nil, nil, nil, false
 	}
 
-	// 获取第一个文件ID（当前版本只支持单文件分享）
-	fileID := files[0].ID
+	return share, files, ticket, true
+}
 
-	// 下载文件
-	reader, metadata, err := h.fileService.DownloadFile(fileID, share.CreatorID)
+// serveSharedFile 输出分享中的单个文件
+func (h *DownloadHandler) serveSharedFile(c *gin.Context, share *models.ShareSession, ticket *services.DownloadTicket, file *models.FileMetadata) {
+	metadata, err := h.fileService.GetFile(file.ID, share.CreatorID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
@@ -102,120 +188,330 @@ func (h *DownloadHandler) DownloadByPickupCode(c *gin.Context) {
 		})
 		return
 	}
-	defer reader.Close()
-
-	// 解析 Range 请求
-	rangeHeader := c.GetHeader("Range")
-	contentLength := metadata.Size
-	statusCode := http.StatusOK
 
-	var start, end int64
-	if rangeHeader != "" {
-		// 解析 Range 头: "bytes=0-1023"
-		ranges := parseRange(rangeHeader, contentLength)
-		if len(ranges) > 0 {
-			start = ranges[0].start
-			end = ranges[0].end
-			statusCode = http.StatusPartialContent
-
-			// 设置 Range 响应头
-			c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, contentLength))
-			c.Header("Accept-Ranges", "bytes")
-			contentLength = end - start + 1
-
-			// 跳过前面的数据
-			if start > 0 {
-				_, err := io.CopyN(io.Discard, reader, start)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"code":    500,
-						"message": "Failed to seek file",
-					})
-					return
-				}
+	// 只有从中间开始的 Range 请求可以续用已有的下载会话
+	var offset int64
+	if ranges, _ := requestedRanges(c, metadata); len(ranges) > 0 {
+		offset = ranges[0].start
+		for _, r := range ranges[1:] {
+			if r.start < offset {
+				offset = r.start
 			}
+		}
+	}
+	slot, ok := h.claimDownload(c, share, ticket, file.ID, offset, metadata.Size)
+	if !ok {
+		return
+	}
 
-			// 限制读取长度
-			reader = io.NopCloser(io.LimitReader(reader, contentLength))
+	var sent int64
+	open := func(offset, length int64) (io.ReadCloser, error) {
+		reader, _, err := h.fileService.OpenRange(file.ID, share.CreatorID, offset, length)
+		if err != nil {
+			return nil, err
 		}
+		return &countingReadCloser{ReadCloser: reader, n: &sent}, nil
 	}
+	completed := serveFileContent(c, metadata, open)
 
-	// 设置响应头
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", metadata.Filename))
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
-	c.Header("Accept-Ranges", "bytes")
-	c.Header("Cache-Control", "no-cache")
+	h.finishDownload(c, slot, sent, metadata.Size, completed)
+}
 
-	// 流式传输文件
-	c.Status(statusCode)
-	if _, err := io.Copy(c.Writer, reader); err != nil {
-		// 传输中断，记录日志（客户端可能主动断开）
+// serveShareZip 将分享中的所有文件流式打包为 ZIP 输出
+//
+// 响应长度未知，使用分块传输；打包中途失败时只能中断连接。
+// 整个 ZIP 只计一次下载。
+func (h *DownloadHandler) serveShareZip(c *gin.Context, share *models.ShareSession, ticket *services.DownloadTicket, files []models.FileMetadata) {
+	slot, ok := h.claimDownload(c, share, ticket, uuid.Nil, 0, -1)
+	if !ok {
 		return
 	}
 
-	// 更新下载统计
-	go func() {
-		// 异步更新，不影响下载速度
-		h.shareService.IncrementDownload(share.ID)
-	}()
+	// 通过分享链接下载时不在文件名中暴露取件码
+	zipName := "share.zip"
+	if c.Param("token") == "" {
+		zipName = fmt.Sprintf("share_%s.zip", share.PickupCode)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipName))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+
+	var sent int64
+	open := func(fileID uuid.UUID) (io.ReadCloser, error) {
+		reader, _, err := h.fileService.OpenRange(fileID, share.CreatorID, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		return &countingReadCloser{ReadCloser: reader, n: &sent}, nil
+	}
+	err := writeShareZip(c.Writer, files, open)
+	if err != nil {
+		// 响应已开始发送，只能记录日志（客户端可能主动断开）
+		log.Printf("Share %s zip download aborted: %v", share.ID, err)
+	}
+
+	h.finishDownload(c, slot, sent, -1, err == nil)
 }
 
-// DownloadPreview 预览文件信息（不下载）
+// downloadSessionCookie 保存下载会话 ID 的 Cookie 名称
+const downloadSessionCookie = "ahavault_download_session"
+
+// claimDownload 为本次请求占用下载名额，并返回下载会话 ID
 //
-// 该函数返回文件元数据，用于前端展示：
-//  1. 验证取件码
-//  2. 返回文件名、大小、MIME 类型等信息
-//  3. 不消耗下载次数
+// offset 为请求的起始字节，size 为内容总大小（未知时为 -1）。
+// 凭证已过期时只能续传已有的下载会话。失败时已写入错误响应，调用方直接返回即可。
+func (h *DownloadHandler) claimDownload(c *gin.Context, share *models.ShareSession, ticket *services.DownloadTicket, fileID uuid.UUID, offset, size int64) (*models.DownloadSlot, bool) {
+	sessionID := c.Query("download_session")
+	if sessionID == "" {
+		sessionID, _ = c.Cookie(downloadSessionCookie)
+	}
+
+	claim := h.shareService.ClaimDownload
+	if ticket.Expired {
+		claim = h.shareService.ResumeDownload
+	}
+	slot, err := claim(share, fileID, services.DownloadRequest{SessionID: sessionID, Offset: offset, Size: size})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrDownloadLimitReached), errors.Is(err, services.ErrTicketExpired):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrShareUnavailable):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	// Cookie 限定在当前下载地址，浏览器续传时自动带回
+	c.Header("X-Download-Session", slot.ID.String())
+	c.SetCookie(downloadSessionCookie, slot.ID.String(), int(services.DownloadSessionTTL.Seconds()),
+		c.Request.URL.Path, "", c.Request.TLS != nil, true)
+	return slot, true
+}
+
+// finishDownload 结束传输：达到计数点时计入下载次数，否则归还名额
+func (h *DownloadHandler) finishDownload(c *gin.Context, slot *models.DownloadSlot, sent, size int64, completed bool) {
+	// 先把已写出的数据发送给客户端，再更新计数
+	c.Writer.Flush()
+
+	if _, err := h.shareService.FinishDownload(slot, sent, size, completed); err != nil {
+		log.Printf("Download session %s: failed to update download count: %v", slot.ID, err)
+	}
+}
+
+// rangeOpener 打开文件指定区间的明文读取流
+type rangeOpener func(offset, length int64) (io.ReadCloser, error)
+
+// serveFileContent 输出文件内容，支持 Range / If-Range 和多区间请求
 //
-// 端点: GET /api/download/:code/preview
+// 处理规则（参考 RFC 9110）：
+//   - 无 Range 头，或 If-Range 与当前文件不匹配时，返回完整文件（200）
+//   - 单个区间返回 206 和 Content-Range
+//   - 多个区间返回 206 和 multipart/byteranges
+//   - 所有区间均无法满足时返回 416
 //
-// 参数:
-//   - c: Gin 上下文对象
+// 每个区间只解密覆盖该区间的密文分段。Content-Type 为入库时识别的文件类型；
+// 请求带 disposition=inline 且类型可以安全预览（见 services.IsInlineSafe）时以
+// inline 方式返回，供浏览器直接预览，否则始终作为附件下载。
 //
 // 返回:
-//   - 200: 成功返回文件信息
-//   - 400: 请求参数错误
-//   - 401: 需要访问密码
-//   - 404: 取件码不存在
-//   - 410: 分享已过期
-func (h *DownloadHandler) DownloadPreview(c *gin.Context) {
-	pickupCode := c.Param("code")
-	if pickupCode == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "Missing pickup code",
+//   - 文件内容是否已完整发送
+func serveFileContent(c *gin.Context, metadata *models.FileMetadata, open rangeOpener) bool {
+	size := metadata.Size
+	etag := fileETag(metadata)
+	contentType := metadata.ContentType()
+
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", contentDisposition(c, contentType), metadata.Filename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", metadata.CreatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+
+	ranges := []httpRange{{start: 0, end: size - 1}}
+	statusCode := http.StatusOK
+
+	parsed, satisfiable := requestedRanges(c, metadata)
+	if !satisfiable {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{
+			"code":    416,
+			"message": "Requested range not satisfiable",
 		})
-		return
+		return false
+	}
+	if parsed != nil {
+		ranges = parsed
+		statusCode = http.StatusPartialContent
 	}
 
-	// 获取访问密码（如果有）
-	password := c.Query("password")
+	if len(ranges) > 1 {
+		return serveMultipartRanges(c, ranges, size, contentType, open)
+	}
+
+	r := ranges[0]
+	length := r.length()
+	if size == 0 {
+		length = 0
+	}
 
-	// 验证取件码
-	share, files, err := h.shareService.GetShareByCode(pickupCode, password)
+	reader, err := open(r.start, length)
 	if err != nil {
-		// GetShareByCode 已经处理了密码验证
-		c.JSON(http.StatusNotFound, gin.H{
-			"code":    404,
-			"message": err.Error(),
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidRange) {
+			status = http.StatusRequestedRangeNotSatisfiable
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": "Failed to open file",
 		})
-		return
+		return false
+	}
+	defer reader.Close()
+
+	if statusCode == http.StatusPartialContent {
+		c.Header("Content-Range", r.contentRange(size))
 	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.FormatInt(length, 10))
 
-	// 返回文件预览信息
-	c.JSON(http.StatusOK, gin.H{
-		"code":    0,
-		"message": "Success",
-		"data": gin.H{
-			"pickup_code":       share.PickupCode,
-			"expires_at":        share.ExpiresAt,
-			"max_downloads":     share.MaxDownloads,
-			"download_count":    share.CurrentDownloads,
-			"password_required": share.HasPassword(),
-			"files":             files,
-		},
-	})
+	// 流式传输文件
+	c.Status(statusCode)
+	if _, err := io.CopyN(c.Writer, reader, length); err != nil {
+		// 传输中断，记录日志（客户端可能主动断开）
+		return false
+	}
+	return true
+}
+
+// requestedRanges 按 Range 和 If-Range 请求头返回要发送的区间
+//
+// 返回 nil 时发送完整文件：不是 Range 请求、Range 无效（单位未知、格式错误或区间过多）、
+// If-Range 不匹配，或多区间总长度超过文件本身（防止放大攻击）。
+// satisfiable 为 false 时 Range 有效但没有可满足的区间，应返回 416。
+func requestedRanges(c *gin.Context, metadata *models.FileMetadata) (ranges []httpRange, satisfiable bool) {
+	rangeHeader := c.GetHeader("Range")
+	if rangeHeader == "" || !ifRangeMatches(c, fileETag(metadata), metadata.CreatedAt) {
+		return nil, true
+	}
+
+	parsed, valid := parseRange(rangeHeader, metadata.Size)
+	if !valid {
+		return nil, true
+	}
+	if parsed == nil {
+		return nil, false
+	}
+	if sumRangesSize(parsed) > metadata.Size {
+		return nil, true
+	}
+	return parsed, true
+}
+
+// serveMultipartRanges 以 multipart/byteranges 格式输出多个区间
+func serveMultipartRanges(c *gin.Context, ranges []httpRange, size int64, contentType string, open rangeOpener) bool {
+	// 预先计算响应长度（分隔符长度固定，与具体取值无关）
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	var contentLength int64
+	for _, r := range ranges {
+		mw.CreatePart(r.mimeHeader(contentType, size))
+		contentLength += r.length()
+	}
+	mw.Close()
+	contentLength += counter.n
+
+	mw = multipart.NewWriter(c.Writer)
+	c.Header("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
+	c.Status(http.StatusPartialContent)
+
+	for _, r := range ranges {
+		part, err := mw.CreatePart(r.mimeHeader(contentType, size))
+		if err != nil {
+			return false
+		}
+
+		reader, err := open(r.start, r.length())
+		if err != nil {
+			// 响应头已发送，只能中断传输
+			return false
+		}
+		_, err = io.CopyN(part, reader, r.length())
+		reader.Close()
+		if err != nil {
+			return false
+		}
+	}
+
+	return mw.Close() == nil
+}
+
+// fileETag 生成文件的强 ETag
+//
+// 文件内容由明文 SHA-256 唯一确定，直接使用哈希值作为 ETag。
+func fileETag(metadata *models.FileMetadata) string {
+	return `"` + metadata.FileBlobHash + `"`
+}
+
+// ifRangeMatches 检查 If-Range 条件是否成立
+//
+// If-Range 可以是 ETag（要求强匹配）或 HTTP 日期（要求与 Last-Modified 完全一致），
+// 不成立时应忽略 Range 返回完整文件。
+func ifRangeMatches(c *gin.Context, etag string, lastModified time.Time) bool {
+	ifRange := c.GetHeader("If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// 弱 ETag 永远不匹配
+		return ifRange == etag
+	}
+
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return lastModified.UTC().Truncate(time.Second).Equal(t.UTC())
+}
+
+// contentDisposition 返回下载响应的 Content-Disposition 类型
+//
+// 只有客户端显式请求（disposition=inline）且类型可以安全预览时才内联，
+// 其他类型（如 HTML、SVG）内联会在站点源下执行脚本，始终作为附件。
+func contentDisposition(c *gin.Context, contentType string) string {
+	if c.Query("disposition") == "inline" && services.IsInlineSafe(contentType) {
+		return "inline"
+	}
+	return "attachment"
+}
+
+// countingReadCloser 统计已读取字节数的读取流（用于统计下载会话发送的字节数）
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+// countingWriter 只统计写入字节数的 Writer
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
 }
 
 // httpRange 表示 HTTP Range 请求的范围
@@ -224,56 +520,121 @@ type httpRange struct {
 	end   int64
 }
 
+// length 返回区间长度
+func (r httpRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+// contentRange 生成 Content-Range 头
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// mimeHeader 生成 multipart/byteranges 中单个区间的头部
+func (r httpRange) mimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// sumRangesSize 计算所有区间的总长度
+func sumRangesSize(ranges []httpRange) int64 {
+	var total int64
+	for _, r := range ranges {
+		total += r.length()
+	}
+	return total
+}
+
+// maxRangeCount 单个请求允许的最大区间数
+const maxRangeCount = 32
+
 // parseRange 解析 Range 请求头
 //
-// 示例: "bytes=0-1023" 或 "bytes=1024-"
+// 示例: "bytes=0-1023"、"bytes=1024-"、"bytes=-1024" 或 "bytes=0-99,200-299"
+//
+// 超出文件末尾的结束位置会被截断到文件末尾；起始位置超出文件大小的区间会被忽略。
 //
 // 参数:
 //   - rangeHeader: Range 请求头的值
 //   - size: 文件总大小
 //
 // 返回:
-//   - 解析后的范围列表
-func parseRange(rangeHeader string, size int64) []httpRange {
+//   - 解析后的范围列表，没有可满足的区间时为 nil（应返回 416）
+//   - 请求头是否有效；单位不是 bytes、格式错误或区间过多时为 false，
+//     按 RFC 9110 应忽略 Range 返回完整内容
+func parseRange(rangeHeader string, size int64) ([]httpRange, bool) {
 	const bytesPrefix = "bytes="
 	if !strings.HasPrefix(rangeHeader, bytesPrefix) {
-		return nil
+		return nil, false
 	}
 
-	rangeSpec := strings.TrimPrefix(rangeHeader, bytesPrefix)
-	parts := strings.SplitN(rangeSpec, "-", 2)
-	if len(parts) != 2 {
-		return nil
+	specs := strings.Split(strings.TrimPrefix(rangeHeader, bytesPrefix), ",")
+	if len(specs) > maxRangeCount {
+		return nil, false
 	}
 
-	var start, end int64
-	var err error
-
-	// 解析起始位置
-	if parts[0] == "" {
-		// 格式: "bytes=-1024" (最后 1024 字节)
-		suffix, err := strconv.ParseInt(parts[1], 10, 64)
-		if err != nil || suffix <= 0 || suffix > size {
-			return nil
+	var ranges []httpRange
+	valid := false
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
 		}
-		start = size - suffix
-		end = size - 1
-	} else {
-		start, err = strconv.ParseInt(parts[0], 10, 64)
-		if err != nil || start < 0 || start >= size {
-			return nil
+		valid = true
+
+		parts := strings.SplitN(spec, "-", 2)
+		if len(parts) != 2 {
+			return nil, false
 		}
+		startStr := strings.TrimSpace(parts[0])
+		endStr := strings.TrimSpace(parts[1])
 
-		if parts[1] == "" {
-			// 格式: "bytes=1024-" (从 1024 到文件末尾)
-			end = size - 1
+		var r httpRange
+		if startStr == "" {
+			// 格式: "bytes=-1024" (最后 1024 字节)
+			suffix, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, false
+			}
+			if suffix == 0 || size == 0 {
+				continue
+			}
+			if suffix > size {
+				suffix = size
+			}
+			r = httpRange{start: size - suffix, end: size - 1}
 		} else {
-			end, err = strconv.ParseInt(parts[1], 10, 64)
-			if err != nil || end < start || end >= size {
-				return nil
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, false
 			}
+
+			end := size - 1
+			if endStr != "" {
+				// 格式: "bytes=0-1023"；未指定时为 "bytes=1024-" (到文件末尾)
+				end, err = strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, false
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+
+			if start >= size {
+				// 无法满足的区间
+				continue
+			}
+			r = httpRange{start: start, end: end}
 		}
+
+		ranges = append(ranges, r)
 	}
 
-	return []httpRange{{start: start, end: end}}
+	if !valid {
+		return nil, false
+	}
+	return ranges, true
 }
@@ -2,21 +2,29 @@
 //
 // 本文件测试文件下载接口的功能：
 //   - 通过取件码下载文件
-//   - HTTP Range 请求支持
-//   - 访问密码验证
+//   - HTTP Range / If-Range 请求支持与多区间响应
+//   - 下载凭证验证
+//   - 通过分享链接访问和下载
+//   - 指定接收人的分享
 //   - 下载次数限制
 //   - 文件预览
+//   - 多文件分享的单文件下载与 ZIP 打包下载
 //
 // 作者: AhaVault Team
 // 创建时间: 2026-02-04
 package handlers
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,6 +35,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // setupDownloadTestEnv 设置下载测试环境
@@ -75,7 +84,7 @@ func setupDownloadTestEnv(t *testing.T) (*DownloadHandler, *gin.Engine, *models.
 	router := gin.New()
 
 	router.GET("/api/download/:code", handler.DownloadByPickupCode)
-	router.GET("/api/download/:code/preview", handler.DownloadPreview)
+	router.GET("/api/download/:code/:fileID", handler.DownloadSharedFile)
 
 	cleanup := func() {
 		// 清理资源
@@ -84,41 +93,93 @@ func setupDownloadTestEnv(t *testing.T) (*DownloadHandler, *gin.Engine, *models.
 	return handler, router, user, metadata, share, cleanup
 }
 
+// issueTicket 为分享签发下载凭证（fileID 为全零 UUID 时不绑定文件）
+func issueTicket(t *testing.T, shareService *services.ShareService, share *models.ShareSession, fileID uuid.UUID) string {
+	ticket, err := shareService.IssueDownloadTicket(share, fileID, uuid.Nil)
+	require.NoError(t, err)
+	return ticket.Token
+}
+
 // TestDownloadByPickupCode 测试通过取件码下载文件
 func TestDownloadByPickupCode(t *testing.T) {
-	_, router, _, _, share, cleanup := setupDownloadTestEnv(t)
+	handler, router, user, metadata, share, cleanup := setupDownloadTestEnv(t)
 	defer cleanup()
 
+	ticket := issueTicket(t, handler.shareService, share, uuid.Nil)
+	other, err := handler.shareService.CreateShare(user.ID, &services.CreateShareRequest{
+		FileIDs:   []uuid.UUID{metadata.ID},
+		ExpiresIn: time.Hour,
+	})
+	require.NoError(t, err)
+
 	tests := []struct {
 		name           string
 		pickupCode     string
-		password       string
+		ticket         string
+		query          string
 		expectedStatus int
 		checkResponse  func(t *testing.T, w *httptest.ResponseRecorder)
 	}{
 		{
 			name:           "valid download",
 			pickupCode:     share.PickupCode,
+			ticket:         ticket,
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
 				assert.Equal(t, "attachment; filename=\"test.txt\"", w.Header().Get("Content-Disposition"))
-				assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+				assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+				assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
 				assert.NotEmpty(t, w.Header().Get("Content-Length"))
 				assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
 			},
 		},
+		{
+			name:           "inline download of safe type",
+			pickupCode:     share.PickupCode,
+			ticket:         ticket,
+			query:          "disposition=inline",
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "inline; filename=\"test.txt\"", w.Header().Get("Content-Disposition"))
+				assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+			},
+		},
 		{
 			name:           "invalid pickup code",
 			pickupCode:     "INVALID1",
+			ticket:         ticket,
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:           "missing ticket",
+			pickupCode:     share.PickupCode,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "password in query is not accepted",
+			pickupCode:     share.PickupCode,
+			query:          "password=secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "ticket of another share",
+			pickupCode:     other.PickupCode,
+			ticket:         ticket,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "tampered ticket",
+			pickupCode:     share.PickupCode,
+			ticket:         ticket[:len(ticket)-2] + "xx",
+			expectedStatus: http.StatusForbidden,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			url := "/api/download/" + tt.pickupCode
-			if tt.password != "" {
-				url += "?password=" + tt.password
+			url := "/api/download/" + tt.pickupCode + "?ticket=" + tt.ticket
+			if tt.query != "" {
+				url += "&" + tt.query
 			}
 
 			req, err := http.NewRequest(http.MethodGet, url, nil)
@@ -136,6 +197,316 @@ func TestDownloadByPickupCode(t *testing.T) {
 	}
 }
 
+// TestDownloadInlineUnsafeType 测试不安全的类型即使请求内联也作为附件下载
+func TestDownloadInlineUnsafeType(t *testing.T) {
+	db := setupTestDB(t)
+	fileService := services.NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	shareService := services.NewShareService(db, fileService)
+	handler := NewDownloadHandler(shareService, fileService)
+
+	user := &models.User{Email: "inline@test.com", Password: "hashed_password", StorageQuota: 1 << 30}
+	require.NoError(t, db.Create(user).Error)
+
+	content := []byte("<html><body><script>alert(1)</script></body></html>")
+	metadata, err := fileService.UploadFile(user.ID, "page.txt", int64(len(content)), bytes.NewReader(content))
+	require.NoError(t, err)
+	share, err := shareService.CreateShare(user.ID, &services.CreateShareRequest{
+		FileIDs:      []uuid.UUID{metadata.ID},
+		ExpiresIn:    time.Hour,
+		MaxDownloads: 10,
+	})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/download/:code", handler.DownloadByPickupCode)
+
+	ticket := issueTicket(t, shareService, share, uuid.Nil)
+	req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"?disposition=inline&ticket="+ticket, nil)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=\"page.txt\"", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+}
+
+// TestDownloadSessionResume 测试下载会话的计数规则
+//
+// 测试场景：
+//  1. 部分区间传输不计数，凭会话续传完成后计一次
+//  2. 下载次数用完后新下载被拒绝
+//  3. 已发送完整文件的会话不能凭 Cookie 再次下载
+func TestDownloadSessionResume(t *testing.T) {
+	handler, router, user, metadata, _, cleanup := setupDownloadTestEnv(t)
+	defer cleanup()
+
+	share, err := handler.shareService.CreateShare(user.ID, &services.CreateShareRequest{
+		FileIDs:      []uuid.UUID{metadata.ID},
+		ExpiresIn:    time.Hour,
+		MaxDownloads: 1,
+	})
+	require.NoError(t, err)
+	ticket := issueTicket(t, handler.shareService, share, uuid.Nil)
+
+	download := func(rangeHeader string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"?ticket="+ticket, nil)
+		require.NoError(t, err)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	downloads := func() int {
+		current, _, _, err := handler.shareService.GetShareByTicket(share.PickupCode, ticket, uuid.Nil)
+		require.NoError(t, err)
+		return current.CurrentDownloads
+	}
+
+	first := download("bytes=0-9", nil)
+	require.Equal(t, http.StatusPartialContent, first.Code)
+	sessionID := first.Header().Get("X-Download-Session")
+	require.NotEmpty(t, sessionID)
+	cookies := first.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, sessionID, cookies[0].Value)
+	assert.Equal(t, 0, downloads(), "partial transfer must not be counted")
+
+	rest := download("bytes=10-", cookies)
+	require.Equal(t, http.StatusPartialContent, rest.Code)
+	assert.Equal(t, sessionID, rest.Header().Get("X-Download-Session"))
+	assert.Equal(t, 1, downloads())
+
+	// 下载次数已用完：新下载被拒绝
+	assert.Equal(t, http.StatusForbidden, download("", nil).Code)
+
+	// 同一会话不能从头或从中间再次下载
+	assert.Equal(t, http.StatusForbidden, download("", cookies).Code)
+	assert.Equal(t, http.StatusForbidden, download("bytes=10-", cookies).Code)
+	assert.Equal(t, 1, downloads())
+}
+
+// TestDownloadTicketFlow 测试凭证下载流程
+//
+// 测试场景：
+//  1. 验证访问密码后获得凭证，凭证可绑定文件
+//  2. 凭证下载中断后，过期凭证只能凭下载会话续传，不能开始新的下载
+func TestDownloadTicketFlow(t *testing.T) {
+	handler, router, user, metadata, _, cleanup := setupDownloadTestEnv(t)
+	defer cleanup()
+	router.POST("/api/public/shares/:code", NewShareHandler(handler.shareService).GetShareByCode)
+
+	share, err := handler.shareService.CreateShare(user.ID, &services.CreateShareRequest{
+		FileIDs:   []uuid.UUID{metadata.ID},
+		ExpiresIn: time.Hour,
+		Password:  "secret",
+	})
+	require.NoError(t, err)
+
+	getTicket := func(body string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, "/api/public/shares/"+share.PickupCode, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp struct {
+			Data struct {
+				Ticket string `json:"ticket"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp.Data.Ticket
+	}
+	download := func(ticket, rangeHeader string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"?ticket="+ticket, nil)
+		require.NoError(t, err)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	status, _ := getTicket(`{"password":"wrong"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = getTicket(`{"password":"secret","file_id":"` + uuid.NewString() + `"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, ticket := getTicket(`{"password":"secret","file_id":"` + metadata.ID.String() + `"}`)
+	require.Equal(t, http.StatusOK, status)
+	require.NotEmpty(t, ticket)
+
+	first := download(ticket, "bytes=0-9", nil)
+	require.Equal(t, http.StatusPartialContent, first.Code)
+	cookies := first.Result().Cookies()
+
+	// 凭证过期后只能续传
+	handler.shareService.SetDownloadTicket("ticket-secret", time.Nanosecond)
+	_, expired := getTicket(`{"password":"secret"}`)
+	assert.Equal(t, http.StatusForbidden, download(expired, "", nil).Code)
+
+	rest := download(expired, "bytes=10-", cookies)
+	require.Equal(t, http.StatusPartialContent, rest.Code)
+	assert.Equal(t, "test file for download.", rest.Body.String())
+}
+
+// TestShareLinkFlow 测试通过分享链接访问和下载
+//
+// 测试场景：
+//  1. 通过链接访问不返回取件码，通过取件码访问不返回链接
+//  2. 凭证通过链接下载，ZIP 文件名不包含取件码
+//  3. 撤销链接后链接和通过链接签发的凭证失效，取件码仍然有效
+func TestShareLinkFlow(t *testing.T) {
+	handler, router, user, metadata, _, cleanup := setupDownloadTestEnv(t)
+	defer cleanup()
+	shareHandler := NewShareHandler(handler.shareService)
+	router.POST("/api/public/shares/:code", shareHandler.GetShareByCode)
+	router.POST("/api/public/links/:token", shareHandler.GetShareByCode)
+	router.GET("/api/public/links/:token/download", handler.DownloadByPickupCode)
+
+	share, err := handler.shareService.CreateShare(user.ID, &services.CreateShareRequest{
+		FileIDs:    []uuid.UUID{metadata.ID},
+		ExpiresIn:  time.Hour,
+		Password:   "secret",
+		SecretLink: true,
+	})
+	require.NoError(t, err)
+	token := *share.LinkToken
+
+	type accessResponse struct {
+		Data struct {
+			Session map[string]interface{} `json:"session"`
+			Ticket  string                 `json:"ticket"`
+		} `json:"data"`
+	}
+	access := func(url string) (int, accessResponse) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(`{"password":"secret"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp accessResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+	download := func(ticket, query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/api/public/links/"+token+"/download?ticket="+ticket+query, nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	status, byCode := access("/api/public/shares/" + share.PickupCode)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, share.PickupCode, byCode.Data.Session["pickup_code"])
+	assert.NotContains(t, byCode.Data.Session, "link_token")
+
+	status, byLink := access("/api/public/links/" + token)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "", byLink.Data.Session["pickup_code"])
+	assert.Equal(t, token, byLink.Data.Session["link_token"])
+
+	w := download(byLink.Data.Ticket, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "This is a test file for download.", w.Body.String())
+	w = download(byLink.Data.Ticket, "&format=zip")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="share.zip"`, w.Header().Get("Content-Disposition"))
+
+	// 撤销链接后取件码仍然有效
+	require.NoError(t, handler.shareService.RevokeShareLink(share.ID, user.ID, services.AuditContext{}))
+	status, _ = access("/api/public/links/" + token)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, http.StatusNotFound, download(byLink.Data.Ticket, "").Code)
+	status, _ = access("/api/public/shares/" + share.PickupCode)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+// TestRecipientShareFlow 测试指定接收人的分享：未登录返回 401，非接收人返回 403
+//
+// 接收人的下载凭证转发给他人后同样不能使用。
+func TestRecipientShareFlow(t *testing.T) {
+	router, db, shareService, owned, files, _ := setupMultiFileShare(t)
+	shareHandler := NewShareHandler(shareService)
+	downloadHandler := NewDownloadHandler(shareService, nil)
+
+	// 模拟可选认证：请求头中的用户 ID 作为当前登录用户
+	asUser := func(c *gin.Context) {
+		if userID := c.GetHeader("X-User-ID"); userID != "" {
+			c.Set("user_id", userID)
+		}
+	}
+	router.POST("/api/public/shares/:code", asUser, shareHandler.GetShareByCode)
+	router.POST("/api/shares/:code/save", asUser, shareHandler.SaveToVault)
+	router.GET("/api/public/download/:code", asUser, downloadHandler.DownloadByPickupCode)
+
+	recipient := &models.User{Email: "Recipient@test.com", Password: "hashed_password", StorageQuota: 1024 * 1024}
+	stranger := &models.User{Email: "stranger@test.com", Password: "hashed_password", StorageQuota: 1024 * 1024}
+	require.NoError(t, db.Create(recipient).Error)
+	require.NoError(t, db.Create(stranger).Error)
+
+	share, err := shareService.CreateShare(owned.CreatorID, &services.CreateShareRequest{
+		FileIDs:    []uuid.UUID{files[0].ID},
+		ExpiresIn:  time.Hour,
+		Recipients: []string{"recipient@test.com"},
+	})
+	require.NoError(t, err)
+	assert.True(t, share.Restricted)
+
+	request := func(method, url, userID, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			req.Header.Set("X-User-ID", userID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	post := func(url, userID, body string) int {
+		return request(http.MethodPost, url, userID, body).Code
+	}
+
+	accessURL := "/api/public/shares/" + share.PickupCode
+	assert.Equal(t, http.StatusUnauthorized, post(accessURL, "", `{}`))
+	assert.Equal(t, http.StatusForbidden, post(accessURL, stranger.ID.String(), `{}`))
+	assert.Equal(t, http.StatusOK, post(accessURL, owned.CreatorID.String(), `{}`))
+
+	w := request(http.MethodPost, accessURL, recipient.ID.String(), `{}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var access struct {
+		Data struct {
+			Ticket string `json:"ticket"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &access))
+
+	// 转发的下载地址：未登录或非接收人不能下载
+	downloadURL := "/api/public/download/" + share.PickupCode + "?ticket=" + access.Data.Ticket
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, downloadURL, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, downloadURL, stranger.ID.String(), "").Code)
+
+	saveURL := "/api/shares/" + share.PickupCode + "/save"
+	saveBody := `{"file_ids":["` + files[0].ID.String() + `"]}`
+	assert.Equal(t, http.StatusForbidden, post(saveURL, stranger.ID.String(), saveBody))
+	assert.Equal(t, http.StatusOK, post(saveURL, recipient.ID.String(), saveBody))
+}
+
 // TestDownloadWithRange 测试 Range 下载
 func TestDownloadWithRange(t *testing.T) {
 	tests := []struct {
@@ -169,10 +540,11 @@ func TestDownloadWithRange(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// 每个子测试创建独立的测试环境，避免内存数据库状态问题
-			_, router, _, _, share, cleanup := setupDownloadTestEnv(t)
+			handler, router, _, _, share, cleanup := setupDownloadTestEnv(t)
 			defer cleanup()
 
-			req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode, nil)
+			ticket := issueTicket(t, handler.shareService, share, uuid.Nil)
+			req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"?ticket="+ticket, nil)
 			require.NoError(t, err)
 
 			if tt.rangeHeader != "" {
@@ -191,29 +563,6 @@ func TestDownloadWithRange(t *testing.T) {
 	}
 }
 
-// TestDownloadPreview 测试文件预览
-func TestDownloadPreview(t *testing.T) {
-	_, router, _, _, share, cleanup := setupDownloadTestEnv(t)
-	defer cleanup()
-
-	req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"/preview", nil)
-	require.NoError(t, err)
-
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusOK, w.Code)
-
-	var resp map[string]interface{}
-	err = json.Unmarshal(w.Body.Bytes(), &resp)
-	require.NoError(t, err)
-
-	assert.Equal(t, float64(0), resp["code"])
-	data := resp["data"].(map[string]interface{})
-	assert.Equal(t, share.PickupCode, data["pickup_code"])
-	assert.NotNil(t, data["expires_at"])
-}
-
 // TestParseRange 测试 Range 解析函数
 func TestParseRange(t *testing.T) {
 	tests := []struct {
@@ -221,6 +570,7 @@ func TestParseRange(t *testing.T) {
 		rangeHeader string
 		size        int64
 		expected    []httpRange
+		invalid     bool // 无效的 Range 应被忽略
 	}{
 		{
 			name:        "bytes=0-1023",
@@ -244,14 +594,346 @@ func TestParseRange(t *testing.T) {
 			name:        "invalid format",
 			rangeHeader: "invalid",
 			size:        2048,
+			invalid:     true,
+		},
+		{
+			name:        "multiple ranges",
+			rangeHeader: "bytes=0-9, 100-199,-10",
+			size:        2048,
+			expected:    []httpRange{{start: 0, end: 9}, {start: 100, end: 199}, {start: 2038, end: 2047}},
+		},
+		{
+			name:        "end beyond size is clamped",
+			rangeHeader: "bytes=1000-5000",
+			size:        2048,
+			expected:    []httpRange{{start: 1000, end: 2047}},
+		},
+		{
+			name:        "suffix larger than size",
+			rangeHeader: "bytes=-5000",
+			size:        2048,
+			expected:    []httpRange{{start: 0, end: 2047}},
+		},
+		{
+			name:        "unsatisfiable range is skipped",
+			rangeHeader: "bytes=4096-,0-0",
+			size:        2048,
+			expected:    []httpRange{{start: 0, end: 0}},
+		},
+		{
+			name:        "no satisfiable range",
+			rangeHeader: "bytes=4096-",
+			size:        2048,
 			expected:    nil,
 		},
+		{
+			name:        "end before start",
+			rangeHeader: "bytes=10-5",
+			size:        2048,
+			invalid:     true,
+		},
+		{
+			name:        "unsupported unit",
+			rangeHeader: "items=0-9",
+			size:        2048,
+			invalid:     true,
+		},
+		{
+			name:        "syntax error",
+			rangeHeader: "bytes=abc",
+			size:        2048,
+			invalid:     true,
+		},
+		{
+			name:        "empty range set",
+			rangeHeader: "bytes= , ",
+			size:        2048,
+			invalid:     true,
+		},
+		{
+			name:        "too many ranges",
+			rangeHeader: "bytes=" + strings.Repeat("0-0,", maxRangeCount) + "0-0",
+			size:        2048,
+			invalid:     true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := parseRange(tt.rangeHeader, tt.size)
+			result, valid := parseRange(tt.rangeHeader, tt.size)
+			assert.Equal(t, !tt.invalid, valid)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
 }
+
+// TestDownloadRangeHeaders 测试 If-Range、多区间和无法满足的区间
+func TestDownloadRangeHeaders(t *testing.T) {
+	const content = "This is a test file for download."
+
+	tests := []struct {
+		name          string
+		headers       func(metadata *models.FileMetadata) map[string]string
+		wantStatus    int
+		checkResponse func(t *testing.T, w *httptest.ResponseRecorder)
+	}{
+		{
+			name: "ETag 匹配时返回区间",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=5-6", "If-Range": `"` + metadata.FileBlobHash + `"`}
+			},
+			wantStatus: http.StatusPartialContent,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "is", w.Body.String())
+			},
+		},
+		{
+			name: "ETag 不匹配时返回完整文件",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=5-6", "If-Range": `"stale"`}
+			},
+			wantStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, content, w.Body.String())
+				assert.Empty(t, w.Header().Get("Content-Range"))
+			},
+		},
+		{
+			name: "日期匹配时返回区间",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=0-3", "If-Range": metadata.CreatedAt.UTC().Format(http.TimeFormat)}
+			},
+			wantStatus: http.StatusPartialContent,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "This", w.Body.String())
+			},
+		},
+		{
+			name: "日期不匹配时返回完整文件",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=0-3", "If-Range": "Mon, 02 Jan 2006 15:04:05 GMT"}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "多区间返回 multipart/byteranges",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=0-3,-9"}
+			},
+			wantStatus: http.StatusPartialContent,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+				require.NoError(t, err)
+				assert.Equal(t, "multipart/byteranges", mediaType)
+				assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+
+				reader := multipart.NewReader(w.Body, params["boundary"])
+				wantParts := []struct{ contentRange, body string }{
+					{"bytes 0-3/33", "This"},
+					{"bytes 24-32/33", "download."},
+				}
+				for _, want := range wantParts {
+					part, err := reader.NextPart()
+					require.NoError(t, err)
+					assert.Equal(t, want.contentRange, part.Header.Get("Content-Range"))
+					body, _ := io.ReadAll(part)
+					assert.Equal(t, want.body, string(body))
+				}
+				_, err = reader.NextPart()
+				assert.Equal(t, io.EOF, err)
+			},
+		},
+		{
+			name: "无法满足的区间返回 416",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=100-200"}
+			},
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "bytes */33", w.Header().Get("Content-Range"))
+			},
+		},
+		{
+			name: "不支持的单位被忽略",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "items=0-1"}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "格式错误的区间被忽略",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=abc"}
+			},
+			wantStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, content, w.Body.String())
+				assert.Empty(t, w.Header().Get("Content-Range"))
+			},
+		},
+		{
+			name: "区间过多时被忽略",
+			headers: func(metadata *models.FileMetadata) map[string]string {
+				return map[string]string{"Range": "bytes=" + strings.Repeat("0-0,", maxRangeCount) + "0-0"}
+			},
+			wantStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, content, w.Body.String())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, router, _, metadata, share, cleanup := setupDownloadTestEnv(t)
+			defer cleanup()
+
+			ticket := issueTicket(t, handler.shareService, share, uuid.Nil)
+			req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"?ticket="+ticket, nil)
+			require.NoError(t, err)
+			for k, v := range tt.headers(metadata) {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, `"`+metadata.FileBlobHash+`"`, w.Header().Get("ETag"))
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+// setupMultiFileShare 创建包含多个文件（含重名文件）的分享
+func setupMultiFileShare(t *testing.T) (*gin.Engine, *gorm.DB, *services.ShareService, *models.ShareSession, []*models.FileMetadata, map[string]string) {
+	db := setupTestDB(t)
+	fileService := services.NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	shareService := services.NewShareService(db, fileService)
+	handler := NewDownloadHandler(shareService, fileService)
+
+	user := &models.User{
+		Email:        "multi@test.com",
+		Password:     "hashed_password",
+		StorageQuota: 10 * 1024 * 1024 * 1024,
+	}
+	require.NoError(t, db.Create(user).Error)
+
+	uploads := []struct{ name, content string }{
+		{"report.pdf", "first report"},
+		{"Report.pdf", "second report"},
+		{"../notes.txt", "notes"},
+	}
+	var files []*models.FileMetadata
+	var fileIDs []uuid.UUID
+	for _, u := range uploads {
+		metadata, err := fileService.UploadFile(user.ID, u.name, int64(len(u.content)), bytes.NewReader([]byte(u.content)))
+		require.NoError(t, err)
+		files = append(files, metadata)
+		fileIDs = append(fileIDs, metadata.ID)
+	}
+
+	share, err := shareService.CreateShare(user.ID, &services.CreateShareRequest{
+		FileIDs:      fileIDs,
+		ExpiresIn:    time.Hour,
+		MaxDownloads: 10,
+	})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/download/:code", handler.DownloadByPickupCode)
+	router.GET("/api/download/:code/:fileID", handler.DownloadSharedFile)
+
+	want := map[string]string{
+		"Report.pdf":     "second report",
+		"report (1).pdf": "first report",
+		".._notes.txt":   "notes",
+	}
+	return router, db, shareService, share, files, want
+}
+
+// TestDownloadShareZip 测试多文件分享打包下载
+func TestDownloadShareZip(t *testing.T) {
+	router, db, shareService, share, _, want := setupMultiFileShare(t)
+
+	ticket := issueTicket(t, shareService, share, uuid.Nil)
+	req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"?ticket="+ticket, nil)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "share_"+share.PickupCode+".zip")
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(content)
+	}
+	assert.Equal(t, want, got)
+
+	// 整个 ZIP 只计一次下载
+	assert.Eventually(t, func() bool {
+		var session models.ShareSession
+		db.First(&session, "id = ?", share.ID)
+		return session.CurrentDownloads == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestDownloadSharedFile 测试下载分享中的指定文件
+func TestDownloadSharedFile(t *testing.T) {
+	router, _, shareService, share, files, _ := setupMultiFileShare(t)
+
+	ticket := issueTicket(t, shareService, share, uuid.Nil)
+	bound := issueTicket(t, shareService, share, files[0].ID)
+
+	tests := []struct {
+		name       string
+		fileID     string
+		ticket     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"分享中的文件", files[1].ID.String(), ticket, http.StatusOK, "second report"},
+		{"不在分享中的文件", uuid.New().String(), ticket, http.StatusNotFound, ""},
+		{"无效的文件 ID", "not-a-uuid", ticket, http.StatusBadRequest, ""},
+		{"凭证绑定的文件", files[0].ID.String(), bound, http.StatusOK, "first report"},
+		{"凭证绑定了其他文件", files[1].ID.String(), bound, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/download/"+share.PickupCode+"/"+tt.fileID+"?ticket="+tt.ticket, nil)
+			require.NoError(t, err)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestUniqueZipNames 测试 ZIP 条目名去重与清理
+func TestUniqueZipNames(t *testing.T) {
+	names := []string{"a.txt", "A.txt", "a.txt", "a (1).txt", "dir/b", "..", "", ".env"}
+	files := make([]models.FileMetadata, len(names))
+	for i, name := range names {
+		files[i].Filename = name
+	}
+
+	assert.Equal(t, []string{
+		"a.txt", "A (1).txt", "a (2).txt", "a (1) (1).txt", "dir_b", "file", "file (1)", ".env",
+	}, uniqueZipNames(files))
+}
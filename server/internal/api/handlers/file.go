@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -26,13 +27,17 @@ func NewFileHandler(fileService *services.FileService) *FileHandler {
 // CheckInstantUploadRequest 秒传检测请求
 type CheckInstantUploadRequest struct {
 	Hash string `json:"hash" binding:"required"`
+	Size int64  `json:"size" binding:"gte=0"` // 文件大小，挑战区间据此选取
 }
 
 // CreateFileMetadataRequest 创建文件元数据请求（秒传）
+//
+// Proofs 按挑战区间顺序给出 HEX(SHA-256(nonce || 区间明文))，文件大小以服务端记录为准。
 type CreateFileMetadataRequest struct {
-	Hash     string `json:"hash" binding:"required"`
-	Filename string `json:"filename" binding:"required"`
-	Size     int64  `json:"size" binding:"required"`
+	Hash        string   `json:"hash" binding:"required"`
+	Filename    string   `json:"filename" binding:"required"`
+	ChallengeID string   `json:"challenge_id" binding:"required"`
+	Proofs      []string `json:"proofs"`
 }
 
 // CheckInstantUpload 秒传检测
@@ -57,10 +62,12 @@ func (h *FileHandler) CheckInstantUpload(c *gin.Context) {
 		return
 	}
 
-	exists, blob, err := h.fileService.CheckInstantUpload(req.Hash, userUUID)
+	// 无论文件是否存在都下发挑战，是否可以秒传只在提交证明后告知，
+	// 防止仅凭哈希探测他人是否存有某个文件
+	challenge, err := h.fileService.IssueUploadChallenge(userUUID, req.Hash, req.Size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
 			"message": err.Error(),
 		})
 		return
@@ -70,8 +77,7 @@ func (h *FileHandler) CheckInstantUpload(c *gin.Context) {
 		"code":    0,
 		"message": "Success",
 		"data": gin.H{
-			"exists": exists,
-			"blob":   blob,
+			"challenge": challenge,
 		},
 	})
 }
@@ -98,8 +104,31 @@ func (h *FileHandler) CreateFileMetadata(c *gin.Context) {
 		return
 	}
 
-	metadata, err := h.fileService.CreateFileMetadata(userUUID, req.Hash, req.Filename, req.Size)
+	challengeID, err := uuid.Parse(req.ChallengeID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid challenge ID",
+		})
+		return
+	}
+
+	metadata, err := h.fileService.ClaimInstantUpload(userUUID, challengeID, req.Hash, req.Filename, req.Proofs)
 	if err != nil {
+		if errors.Is(err, services.ErrProofMismatch) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, services.ErrMimeTypeNotAllowed) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"code":    415,
+				"message": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": err.Error(),
@@ -152,8 +181,12 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	// 上传文件
 	metadata, err := h.fileService.UploadFile(userUUID, file.Filename, file.Size, src)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrMimeTypeNotAllowed) {
+			status = http.StatusUnsupportedMediaType
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
 			"message": err.Error(),
 		})
 		return
@@ -188,7 +221,7 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	reader, metadata, err := h.fileService.DownloadFile(fileUUID, userUUID)
+	metadata, err := h.fileService.GetFile(fileUUID, userUUID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
@@ -196,21 +229,12 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		})
 		return
 	}
-	defer reader.Close()
 
-	// 设置响应头
-	c.Header("Content-Disposition", "attachment; filename="+metadata.Filename)
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
-
-	// 流式传输文件
-	if _, err := io.Copy(c.Writer, reader); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to send file",
-		})
-		return
-	}
+	// 支持 Range / If-Range，只解密所需区间
+	serveFileContent(c, metadata, func(offset, length int64) (io.ReadCloser, error) {
+		reader, _, err := h.fileService.OpenRange(fileUUID, userUUID, offset, length)
+		return reader, err
+	})
 }
 
 // DeleteFile 删除文件
@@ -0,0 +1,148 @@
+// Package handlers 提供 HTTP 请求处理器测试
+//
+// 本文件测试文件管理接口的功能：
+//   - 秒传检测总是下发持有证明挑战，不透露文件是否存在
+//   - 提交持有证明完成秒传
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
+	"ahavault/server/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFileTestEnv 设置文件接口测试环境，返回以 claimer 身份访问的路由
+func setupFileTestEnv(t *testing.T, content []byte) (*gin.Engine, *models.FileMetadata) {
+	db := setupTestDB(t)
+	fileService := services.NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	handler := NewFileHandler(fileService)
+
+	owner := &models.User{Email: "owner@test.com", Password: "hashed_password", StorageQuota: 1 << 30}
+	claimer := &models.User{Email: "claimer@test.com", Password: "hashed_password", StorageQuota: 1 << 30}
+	require.NoError(t, db.Create(owner).Error)
+	require.NoError(t, db.Create(claimer).Error)
+
+	metadata, err := fileService.UploadFile(owner.ID, "owner.bin", int64(len(content)), bytes.NewReader(content))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", claimer.ID.String())
+		c.Next()
+	})
+	router.POST("/api/files/check", handler.CheckInstantUpload)
+	router.POST("/api/files", handler.CreateFileMetadata)
+
+	return router, metadata
+}
+
+// postJSON 发送 JSON 请求并解析响应
+func postJSON(t *testing.T, router *gin.Engine, path string, body interface{}) (int, map[string]interface{}) {
+	raw, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+// TestInstantUploadProofOfPossession 测试秒传持有证明流程
+func TestInstantUploadProofOfPossession(t *testing.T) {
+	content := bytes.Repeat([]byte("proof-of-possession "), 1024)
+	router, metadata := setupFileTestEnv(t, content)
+
+	// 检测接口不返回文件是否存在，只下发挑战
+	issue := func(hash string) map[string]interface{} {
+		code, resp := postJSON(t, router, "/api/files/check", gin.H{"hash": hash, "size": len(content)})
+		require.Equal(t, http.StatusOK, code)
+		data := resp["data"].(map[string]interface{})
+		assert.NotContains(t, data, "exists")
+		assert.NotContains(t, data, "blob")
+		return data["challenge"].(map[string]interface{})
+	}
+
+	answer := func(challenge map[string]interface{}, data []byte) []string {
+		nonce, err := hex.DecodeString(challenge["nonce"].(string))
+		require.NoError(t, err)
+		var proofs []string
+		for _, item := range challenge["ranges"].([]interface{}) {
+			r := item.(map[string]interface{})
+			offset, length := int64(r["offset"].(float64)), int64(r["length"].(float64))
+			proofs = append(proofs, services.ChallengeProof(nonce, data[offset:offset+length]))
+		}
+		return proofs
+	}
+
+	t.Run("仅凭哈希无法秒传", func(t *testing.T) {
+		challenge := issue(metadata.FileBlobHash)
+		code, resp := postJSON(t, router, "/api/files", gin.H{
+			"hash":         metadata.FileBlobHash,
+			"filename":     "stolen.bin",
+			"challenge_id": challenge["id"],
+			"proofs":       answer(challenge, make([]byte, len(content))),
+		})
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, float64(403), resp["code"])
+	})
+
+	t.Run("缺少挑战 ID", func(t *testing.T) {
+		code, _ := postJSON(t, router, "/api/files", gin.H{
+			"hash":     metadata.FileBlobHash,
+			"filename": "legacy.bin",
+			"size":     len(content),
+		})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("持有内容时秒传成功", func(t *testing.T) {
+		challenge := issue(metadata.FileBlobHash)
+		code, resp := postJSON(t, router, "/api/files", gin.H{
+			"hash":         metadata.FileBlobHash,
+			"filename":     "mine.bin",
+			"challenge_id": challenge["id"],
+			"proofs":       answer(challenge, content),
+		})
+		require.Equal(t, http.StatusOK, code)
+		data := resp["data"].(map[string]interface{})
+		assert.Equal(t, "mine.bin", data["filename"])
+		assert.Equal(t, float64(len(content)), data["size"])
+	})
+
+	t.Run("文件不存在时同样下发挑战", func(t *testing.T) {
+		missing := append([]byte("x"), content[1:]...)
+		hash := sha256.Sum256(missing)
+		challenge := issue(hex.EncodeToString(hash[:]))
+		assert.Len(t, challenge["ranges"], services.ChallengeRangeCount)
+
+		// 与证明错误的响应相同
+		code, resp := postJSON(t, router, "/api/files", gin.H{
+			"hash":         challenge["hash"],
+			"filename":     "missing.bin",
+			"challenge_id": challenge["id"],
+			"proofs":       answer(challenge, missing),
+		})
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, float64(403), resp["code"])
+	})
+
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"ahavault/server/internal/middleware"
+	"ahavault/server/internal/models"
 	"ahavault/server/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -26,14 +28,30 @@ func NewShareHandler(shareService *services.ShareService) *ShareHandler {
 // CreateShareRequest 创建分享请求
 type CreateShareRequest struct {
 	FileIDs      []string `json:"file_ids" binding:"required"`
-	ExpiresIn    int64    `json:"expires_in" binding:"required"` // 秒数
+	ExpiresIn    int64    `json:"expires_in"` // 秒数，0 或不填使用默认有效期
 	MaxDownloads int      `json:"max_downloads"`
 	Password     string   `json:"password"`
+	PickupCode   string   `json:"pickup_code"` // 自定义取件码（可选）
+	SecretLink   bool     `json:"secret_link"` // 同时生成分享链接
+	Recipients   []string `json:"recipients"`  // 接收人（用户 ID 或邮箱），仅限接收人登录后访问
 }
 
 // GetShareRequest 获取分享请求
 type GetShareRequest struct {
 	Password string `json:"password"`
+	FileID   string `json:"file_id"` // 可选，下载凭证只能下载该文件
+}
+
+// UpdateShareRequest 修改分享请求
+//
+// 未提供的字段不修改。
+type UpdateShareRequest struct {
+	ExpiresIn     *int64   `json:"expires_in"`    // 新的有效期（秒，从现在起计算）
+	MaxDownloads  *int     `json:"max_downloads"` // 0 表示不限
+	Password      *string  `json:"password"`      // 空字符串表示取消密码
+	AddFileIDs    []string `json:"add_file_ids"`
+	RemoveFileIDs []string `json:"remove_file_ids"`
+	Reactivate    bool     `json:"reactivate"` // 重新启用已停止的分享
 }
 
 // SaveToVaultRequest 转存请求
@@ -84,12 +102,25 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 		ExpiresIn:    time.Duration(req.ExpiresIn) * time.Second,
 		MaxDownloads: req.MaxDownloads,
 		Password:     req.Password,
+		PickupCode:   req.PickupCode,
+		SecretLink:   req.SecretLink,
+		Recipients:   req.Recipients,
 	}
 
 	session, err := h.shareService.CreateShare(userUUID, serviceReq)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
+		if respondSharePolicyError(c, err) {
+			return
+		}
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, services.ErrPickupCodeTaken):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrVanityCodesDisabled):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
 			"message": err.Error(),
 		})
 		return
@@ -102,10 +133,13 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 	})
 }
 
-// GetShareByCode 通过取件码获取分享
+// GetShareByCode 通过取件码或分享链接获取分享
+//
+// 验证访问密码后返回分享信息和短时有效的下载凭证，下载端点只接受该凭证。
+//
+// 端点: POST /api/public/shares/:code 或 POST /api/public/links/:token
 func (h *ShareHandler) GetShareByCode(c *gin.Context) {
-	code := c.Param("code")
-	if code == "" {
+	if c.Param("code") == "" && c.Param("token") == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "Pickup code is required",
@@ -116,7 +150,31 @@ func (h *ShareHandler) GetShareByCode(c *gin.Context) {
 	var req GetShareRequest
 	c.ShouldBindJSON(&req)
 
-	session, files, err := h.shareService.GetShareByCode(code, req.Password)
+	var fileID uuid.UUID
+	if req.FileID != "" {
+		parsed, err := uuid.Parse(req.FileID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid file ID: " + req.FileID,
+			})
+			return
+		}
+		fileID = parsed
+	}
+
+	session, files, err := h.lookupShare(c, req.Password)
+	if err != nil {
+		recordAccessFailure(c, err)
+		status := shareAccessStatus(err)
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ticket, err := h.shareService.IssueDownloadTicket(session, fileID, viewerID(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
@@ -129,16 +187,43 @@ func (h *ShareHandler) GetShareByCode(c *gin.Context) {
 		"code":    0,
 		"message": "Success",
 		"data": gin.H{
-			"session": session,
-			"files":   files,
+			"session":           session,
+			"files":             files,
+			"ticket":            ticket.Token,
+			"ticket_expires_at": ticket.ExpiresAt,
 		},
 	})
 }
 
+// lookupShare 按路径中的取件码或分享链接令牌验证分享
+//
+// 通过一种地址访问时不返回另一种地址，撤销分享链接后持有者不能再凭取件码访问，反之亦然。
+// 指定接收人的分享按当前登录用户（可选认证）检查接收人。
+func (h *ShareHandler) lookupShare(c *gin.Context, password string) (*models.ShareSession, []models.FileMetadata, error) {
+	if token := c.Param("token"); token != "" {
+		session, files, err := h.shareService.GetShareByLink(token, password, viewerID(c))
+		if err != nil {
+			return nil, nil, err
+		}
+		session.PickupCode = ""
+		return session, files, nil
+	}
+
+	session, files, err := h.shareService.GetShareByCode(c.Param("code"), password, viewerID(c))
+	if err != nil {
+		return nil, nil, err
+	}
+	session.LinkToken = nil
+	return session, files, nil
+}
+
 // SaveToVault 转存到文件柜
+//
+// 端点: POST /api/shares/:code/save 或 POST /api/links/:token/save
 func (h *ShareHandler) SaveToVault(c *gin.Context) {
 	code := c.Param("code")
-	if code == "" {
+	token := c.Param("token")
+	if code == "" && token == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "Pickup code is required",
@@ -180,10 +265,17 @@ func (h *ShareHandler) SaveToVault(c *gin.Context) {
 		fileIDs[i] = fileUUID
 	}
 
-	savedIDs, err := h.shareService.SaveToVault(code, req.Password, fileIDs, userUUID)
+	var savedIDs []uuid.UUID
+	if token != "" {
+		savedIDs, err = h.shareService.SaveToVaultByLink(token, req.Password, fileIDs, userUUID)
+	} else {
+		savedIDs, err = h.shareService.SaveToVault(code, req.Password, fileIDs, userUUID)
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
+		recordAccessFailure(c, err)
+		status := shareAccessStatus(err)
+		c.JSON(status, gin.H{
+			"code":    status,
 			"message": err.Error(),
 		})
 		return
@@ -234,6 +326,330 @@ func (h *ShareHandler) StopShare(c *gin.Context) {
 	})
 }
 
+// UpdateShare 修改分享
+//
+// 修改有效期、下载次数上限、访问密码和文件，或重新启用已停止的分享。
+func (h *ShareHandler) UpdateShare(c *gin.Context) {
+	shareUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid share ID",
+		})
+		return
+	}
+
+	var req UpdateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	serviceReq := &services.UpdateShareRequest{
+		MaxDownloads: req.MaxDownloads,
+		Password:     req.Password,
+		Reactivate:   req.Reactivate,
+	}
+	if req.ExpiresIn != nil {
+		expiresIn := time.Duration(*req.ExpiresIn) * time.Second
+		serviceReq.ExpiresIn = &expiresIn
+	}
+	if serviceReq.AddFileIDs, err = parseFileIDs(req.AddFileIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	if serviceReq.RemoveFileIDs, err = parseFileIDs(req.RemoveFileIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	session, err := h.shareService.UpdateShare(shareUUID, userUUID, serviceReq, services.AuditContext{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		if respondSharePolicyError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrShareNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": err.Error(),
+			})
+		case errors.Is(err, services.ErrInvalidShareUpdate):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to update share",
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Share updated successfully",
+		"data":    session,
+	})
+}
+
+// IssueShareLink 生成分享链接
+//
+// 已有链接时生成新的链接替换，旧链接立即失效；取件码不受影响。
+//
+// 端点: PUT /api/shares/:id/link
+func (h *ShareHandler) IssueShareLink(c *gin.Context) {
+	shareUUID, userUUID, ok := parseShareOwner(c)
+	if !ok {
+		return
+	}
+
+	session, err := h.shareService.IssueShareLink(shareUUID, userUUID, services.AuditContext{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		respondShareOwnerError(c, err, "Failed to create share link")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Share link created successfully",
+		"data":    session,
+	})
+}
+
+// RevokeShareLink 撤销分享链接
+//
+// 只撤销链接，取件码仍然有效。
+//
+// 端点: DELETE /api/shares/:id/link
+func (h *ShareHandler) RevokeShareLink(c *gin.Context) {
+	shareUUID, userUUID, ok := parseShareOwner(c)
+	if !ok {
+		return
+	}
+
+	err := h.shareService.RevokeShareLink(shareUUID, userUUID, services.AuditContext{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		respondShareOwnerError(c, err, "Failed to revoke share link")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Share link revoked successfully",
+	})
+}
+
+// ListShareRecipients 获取分享的接收人及其访问记录
+//
+// 端点: GET /api/shares/:id/recipients
+func (h *ShareHandler) ListShareRecipients(c *gin.Context) {
+	shareUUID, userUUID, ok := parseShareOwner(c)
+	if !ok {
+		return
+	}
+
+	recipients, err := h.shareService.ListShareRecipients(shareUUID, userUUID)
+	if err != nil {
+		respondShareOwnerError(c, err, "Failed to list share recipients")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Success",
+		"data": gin.H{
+			"recipients": recipients,
+		},
+	})
+}
+
+// ListIncomingShares 获取收到的分享列表
+//
+// 端点: GET /api/shares/incoming
+func (h *ShareHandler) ListIncomingShares(c *gin.Context) {
+	userUUID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	// 获取分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	shares, total, err := h.shareService.ListIncomingShares(userUUID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Success",
+		"data": gin.H{
+			"shares":    shares,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// viewerID 返回当前登录用户的 ID，未登录时返回 uuid.Nil
+func viewerID(c *gin.Context) uuid.UUID {
+	userUUID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		return uuid.Nil
+	}
+	return userUUID
+}
+
+// shareAccessStatus 返回访问分享失败时的状态码
+//
+// 指定接收人的分享：未登录返回 401，非接收人返回 403；其他错误返回 400。
+func shareAccessStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRecipientRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrNotRecipient):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// parseShareOwner 解析路径中的分享 ID 和当前用户 ID
+//
+// 解析失败时已写入错误响应，调用方直接返回即可。
+func parseShareOwner(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	shareUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid share ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userUUID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return shareUUID, userUUID, true
+}
+
+// respondShareOwnerError 返回分享管理操作的错误响应：分享不存在或不属于当前用户时返回 404
+func respondShareOwnerError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrShareNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code":    500,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+// respondSharePolicyError 分享超出限制时返回对应的错误响应
+//
+// 有效期或文件数超限返回 400，活跃分享数达到上限返回 403；data 中给出限制值
+// （有效期以秒为单位）。err 不是分享限制错误时返回 false。
+func respondSharePolicyError(c *gin.Context, err error) bool {
+	var policyErr *services.SharePolicyError
+	if !errors.As(err, &policyErr) {
+		if errors.Is(err, services.ErrInvalidShareExpiry) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return true
+		}
+		return false
+	}
+
+	status := http.StatusBadRequest
+	if errors.Is(err, services.ErrTooManyActiveShares) {
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{
+		"code":    status,
+		"message": err.Error(),
+		"data": gin.H{
+			"limit": policyErr.Limit,
+			"value": policyErr.Value,
+		},
+	})
+	return true
+}
+
+// parseFileIDs 解析文件 ID 列表
+func parseFileIDs(ids []string) ([]uuid.UUID, error) {
+	fileIDs := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		fileUUID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, errors.New("Invalid file ID: " + id)
+		}
+		fileIDs = append(fileIDs, fileUUID)
+	}
+	return fileIDs, nil
+}
+
 // ListMyShares 获取我的分享列表
 func (h *ShareHandler) ListMyShares(c *gin.Context) {
 	userID := middleware.GetUserID(c)
@@ -277,3 +693,14 @@ func (h *ShareHandler) ListMyShares(c *gin.Context) {
 		},
 	})
 }
+
+// recordAccessFailure 将取件码或分享链接无效、访问密码错误和下载凭证无效计入防暴力破解的失败次数
+func recordAccessFailure(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPassword):
+		middleware.RecordPasswordFailure(c)
+	case errors.Is(err, services.ErrInvalidPickupCode), errors.Is(err, services.ErrInvalidShareLink),
+		errors.Is(err, services.ErrInvalidTicket):
+		middleware.RecordPickupFailure(c)
+	}
+}
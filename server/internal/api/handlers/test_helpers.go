@@ -33,6 +33,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			status TEXT NOT NULL DEFAULT 'active',
 			storage_quota INTEGER NOT NULL DEFAULT 10737418240,
 			storage_used INTEGER NOT NULL DEFAULT 0,
+			storage_reserved INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			last_login_at DATETIME
@@ -42,6 +43,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			hash TEXT PRIMARY KEY,
 			store_path TEXT NOT NULL,
 			encrypted_dek TEXT NOT NULL,
+			key_id TEXT NOT NULL DEFAULT 'default',
 			size INTEGER NOT NULL,
 			mime_type TEXT,
 			ref_count INTEGER NOT NULL DEFAULT 1,
@@ -67,10 +69,13 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		CREATE TABLE share_sessions (
 			id TEXT PRIMARY KEY,
 			pickup_code TEXT NOT NULL UNIQUE,
+			link_token TEXT UNIQUE,
 			creator_id TEXT NOT NULL,
 			password_hash TEXT,
+			restricted BOOLEAN NOT NULL DEFAULT 0,
 			max_downloads INTEGER NOT NULL DEFAULT 0,
 			current_downloads INTEGER NOT NULL DEFAULT 0,
+			reserved_downloads INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			expires_at DATETIME NOT NULL,
 			stopped_at DATETIME,
@@ -86,16 +91,108 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			FOREIGN KEY (file_id) REFERENCES files_metadata(id)
 		);
 
+		CREATE TABLE share_recipients (
+			id TEXT PRIMARY KEY,
+			share_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			first_accessed_at DATETIME,
+			last_accessed_at DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (share_id, user_id),
+			FOREIGN KEY (share_id) REFERENCES share_sessions(id)
+		);
+
 		CREATE TABLE upload_sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'uploading',
+			upload_offset INTEGER NOT NULL DEFAULT 0,
+			upload_length INTEGER NOT NULL,
+			filename TEXT NOT NULL,
+			mime_type TEXT,
+			hash TEXT,
+			temp_path TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE TABLE tus_upload_jobs (
 			id TEXT PRIMARY KEY,
 			user_id TEXT NOT NULL,
 			filename TEXT NOT NULL,
 			size INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT,
+			file_id TEXT,
+			locked_by TEXT,
+			lease_expires_at DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		);
+
+		CREATE TABLE upload_challenges (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
 			hash TEXT NOT NULL,
-			uploaded_size INTEGER NOT NULL DEFAULT 0,
+			size INTEGER NOT NULL DEFAULT 0,
+			nonce TEXT NOT NULL,
+			ranges TEXT NOT NULL,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			expires_at DATETIME NOT NULL,
-			FOREIGN KEY (user_id) REFERENCES users(id)
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE quota_reservations (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE download_slots (
+			id TEXT PRIMARY KEY,
+			share_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			bytes_sent INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE audit_logs (
+			id TEXT PRIMARY KEY,
+			user_id TEXT,
+			action TEXT NOT NULL,
+			resource_type TEXT,
+			resource_id TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE share_policy_overrides (
+			user_id TEXT PRIMARY KEY,
+			max_share_expiry INTEGER,
+			max_files_per_share INTEGER,
+			max_active_shares INTEGER,
+			updated_by TEXT,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE system_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			description TEXT,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
 	`).Error
 	require.NoError(t, err)
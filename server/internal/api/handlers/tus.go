@@ -1,28 +1,59 @@
 package handlers
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"ahavault/server/internal/middleware"
 	"ahavault/server/internal/services"
+	"ahavault/server/internal/tasks"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/tus/tusd/v2/pkg/filestore"
 	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+)
+
+var (
+	// errTusUnauthorized 上传无法归属到当前用户
+	errTusUnauthorized = tusd.NewError("ERR_UNAUTHORIZED", "upload is not associated with a user", http.StatusUnauthorized)
+	// errTusLengthRequired 未声明上传大小（不支持 Upload-Defer-Length）
+	errTusLengthRequired = tusd.NewError("ERR_UPLOAD_LENGTH_REQUIRED", "upload length must be declared when creating the upload", http.StatusBadRequest)
+	// errTusInsufficientStorage 存储配额不足
+	errTusInsufficientStorage = tusd.NewError("ERR_INSUFFICIENT_STORAGE", "insufficient storage space", http.StatusInsufficientStorage)
+	// errTusFileTypeNotAllowed 文件类型不在允许列表中
+	errTusFileTypeNotAllowed = tusd.NewError("ERR_FILE_TYPE_NOT_ALLOWED", "file type is not allowed", http.StatusUnsupportedMediaType)
 )
 
 type TusHandler struct {
 	Handler     *tusd.Handler
 	fileService *services.FileService
+	processor   *tasks.TusProcessor
+	store       filestore.FileStore
+	policy      services.UploadPolicy
 	basePath    string
 	uploadDir   string
 }
 
-func NewTusHandler(fileService *services.FileService, uploadDir string) *TusHandler {
+// NewTusHandler 创建 Tus 上传处理器
+//
+// policy 在创建上传时（pre-create）和最后一个分片写入后（pre-finish）执行，
+// 不符合策略的上传在写入任何数据前即被拒绝。
+//
+// 上传数据保存在 processor.UploadDir()，locker 串行化对同一上传的并发请求。
+// 多实例部署时上传目录必须共享，并使用跨实例的锁（如 RedisTusLocker）；
+// locker 为 nil 时使用进程内锁，仅适用于单实例。
+func NewTusHandler(fileService *services.FileService, processor *tasks.TusProcessor, policy services.UploadPolicy, locker tusd.Locker) *TusHandler {
+	uploadDir := processor.UploadDir()
+
 	// Create upload directory if not exists
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
 		log.Fatalf("Failed to create tus upload directory: %v", err)
@@ -31,26 +62,37 @@ func NewTusHandler(fileService *services.FileService, uploadDir string) *TusHand
 	store := filestore.New(uploadDir)
 	composer := tusd.NewStoreComposer()
 	store.UseIn(composer)
+	if locker == nil {
+		locker = memorylocker.New()
+	}
+	composer.UseLocker(locker)
 
 	// Base path must match the router path prefix (without wildcard)
 	basePath := "/api/tus/upload/"
 
-	handler, err := tusd.NewHandler(tusd.Config{
-		BasePath:              basePath,
-		StoreComposer:         composer,
-		NotifyCompleteUploads: true,
-	})
-	if err != nil {
-		log.Fatalf("Unable to create tus handler: %s", err)
-	}
-
 	th := &TusHandler{
-		Handler:     handler,
 		fileService: fileService,
+		processor:   processor,
+		store:       store,
+		policy:      policy,
 		basePath:    basePath,
 		uploadDir:   uploadDir,
 	}
 
+	handler, err := tusd.NewHandler(tusd.Config{
+		BasePath:                   basePath,
+		StoreComposer:              composer,
+		MaxSize:                    policy.MaxFileSize,
+		NotifyCompleteUploads:      true,
+		PreUploadCreateCallback:    th.preUploadCreate,
+		PreFinishResponseCallback:  th.preFinishResponse,
+		PreUploadTerminateCallback: th.preUploadTerminate,
+	})
+	if err != nil {
+		log.Fatalf("Unable to create tus handler: %s", err)
+	}
+	th.Handler = handler
+
 	// Start background listener for completed uploads
 	go th.handleCompletedUploads()
 
@@ -86,75 +128,191 @@ func (h *TusHandler) GinHandler(c *gin.Context) {
 		}
 	}
 
-	// ServeHTTP handles the request
-	// Note: Gin's wildcard route might include the prefix in URL.Path
-	// tusd expects the path *after* BasePath if we don't use StripPrefix.
-	// But we configured BasePath in tusd config. 
-	// Let's verify: URL /api/tus/upload/123 -> BasePath /api/tus/upload/ -> ID 123.
-	// This should work directly.
-	h.Handler.ServeHTTP(c.Writer, c.Request)
+	// tusd 的路由按去掉 BasePath 后的路径分发（"" 为创建，"/<id>" 为上传资源），
+	// BasePath 只用于生成 Location 响应头，因此这里需要剥离路由前缀
+	http.StripPrefix(strings.TrimSuffix(h.basePath, "/"), h.Handler).ServeHTTP(c.Writer, c.Request)
 }
 
+// preUploadCreate 创建上传前校验大小和声明的文件类型，并预占配额
+//
+// 校验失败时上传不会被创建，客户端收到对应的 tus 错误响应。上传 ID 在这里生成，
+// 与配额预占 ID 一致，入库时由 TusProcessor 提交该预占。
+func (h *TusHandler) preUploadCreate(hook tusd.HookEvent) (tusd.HTTPResponse, tusd.FileInfoChanges, error) {
+	upload := hook.Upload
+	userUUID, err := uuid.Parse(upload.MetaData["userID"])
+	if err != nil {
+		return tusd.HTTPResponse{}, tusd.FileInfoChanges{}, errTusUnauthorized
+	}
+
+	// 延迟声明大小的上传无法预先校验配额
+	if upload.SizeIsDeferred {
+		return tusd.HTTPResponse{}, tusd.FileInfoChanges{}, errTusLengthRequired
+	}
+	if err := h.policy.CheckSize(upload.Size); err != nil {
+		return tusd.HTTPResponse{}, tusd.FileInfoChanges{}, tusd.ErrMaxSizeExceeded
+	}
+
+	mimeType := services.DeclaredMimeType(upload.MetaData["filetype"], upload.MetaData["filename"])
+	if err := h.policy.CheckMimeType(mimeType); err != nil {
+		return tusd.HTTPResponse{}, tusd.FileInfoChanges{}, errTusFileTypeNotAllowed
+	}
+
+	uploadID := strings.ReplaceAll(uuid.New().String(), "-", "")
+	if _, err := h.fileService.ReserveStorage(userUUID, uploadID, upload.Size, services.DefaultReservationTTL); err != nil {
+		if errors.Is(err, services.ErrInsufficientStorage) {
+			return tusd.HTTPResponse{}, tusd.FileInfoChanges{}, errTusInsufficientStorage
+		}
+		return tusd.HTTPResponse{}, tusd.FileInfoChanges{}, err
+	}
+
+	return tusd.HTTPResponse{}, tusd.FileInfoChanges{ID: uploadID}, nil
+}
+
+// preFinishResponse 上传完成后、入库前嗅探实际内容类型
+//
+// 声明的类型可以伪造，这里根据文件头再次校验。不符合策略的上传会被删除，
+// 不会进入入库队列。
+func (h *TusHandler) preFinishResponse(hook tusd.HookEvent) (tusd.HTTPResponse, error) {
+	upload := hook.Upload
+
+	mimeType, err := services.SniffMimeType(filepath.Join(h.uploadDir, upload.ID), upload.MetaData["filename"])
+	if err != nil {
+		return tusd.HTTPResponse{}, err
+	}
+	if err := h.policy.CheckMimeType(mimeType); err != nil {
+		log.Printf("Tus upload %s rejected: %v", upload.ID, err)
+		h.terminateUpload(hook.Context, upload.ID)
+		h.fileService.ReleaseReservation(upload.ID)
+		return tusd.HTTPResponse{}, errTusFileTypeNotAllowed
+	}
+
+	return tusd.HTTPResponse{}, nil
+}
+
+// preUploadTerminate 客户端取消上传（DELETE）时释放预占的配额
+func (h *TusHandler) preUploadTerminate(hook tusd.HookEvent) (tusd.HTTPResponse, error) {
+	return tusd.HTTPResponse{}, h.fileService.ReleaseReservation(hook.Upload.ID)
+}
+
+// terminateUpload 删除被拒绝的上传的临时文件
+func (h *TusHandler) terminateUpload(ctx context.Context, uploadID string) {
+	upload, err := h.store.GetUpload(ctx, uploadID)
+	if err == nil {
+		err = h.store.AsTerminatableUpload(upload).Terminate(ctx)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to remove rejected tus upload %s: %v", uploadID, err)
+	}
+}
+
+// handleCompletedUploads 为每个完成的上传创建持久化的入库任务
+//
+// 实际的加密入库由 TusProcessor 在后台执行，失败会重试，进程重启后会恢复。
 func (h *TusHandler) handleCompletedUploads() {
 	for {
 		event := <-h.Handler.CompleteUploads
 		log.Printf("Tus upload %s finished", event.Upload.ID)
 
-		// Fix: Extract Upload struct from HookEvent
-		go h.processUpload(event.Upload)
+		h.enqueueUpload(event.Upload)
 	}
 }
 
-func (h *TusHandler) processUpload(upload tusd.FileInfo) {
-	// Recover metadata
-	// Fix: Access fields directly on upload struct (no .Upload nesting)
+func (h *TusHandler) enqueueUpload(upload tusd.FileInfo) {
 	meta := upload.MetaData
-	userIDStr := meta["userID"]
 	filename := meta["filename"]
-	
 	if filename == "" {
 		filename = "uploaded_file"
 	}
-	if userIDStr == "" {
-		log.Printf("Error: No userID in metadata for upload %s", upload.ID)
-		return
-	}
 
-	userUUID, err := uuid.Parse(userIDStr)
+	userUUID, err := uuid.Parse(meta["userID"])
 	if err != nil {
-		log.Printf("Error processing upload %s: invalid user ID %s", upload.ID, userIDStr)
+		// 无法归属到用户的上传不会入库，直接清理临时文件
+		log.Printf("Error: invalid or missing userID in metadata for upload %s", upload.ID)
+		os.Remove(filepath.Join(h.uploadDir, upload.ID))
+		os.Remove(filepath.Join(h.uploadDir, upload.ID+".info"))
 		return
 	}
 
-	// Open the uploaded file from disk
-	filePath := fmt.Sprintf("%s/%s", h.uploadDir, upload.ID)
-	// infoPath := filePath + ".info" (tusd creates .info files too)
+	if _, err := h.processor.Enqueue(upload.ID, userUUID, filename, upload.Size); err != nil {
+		// 任务未能持久化时保留临时文件，客户端查询状态时会看到仍在上传
+		log.Printf("Error enqueueing upload %s: %v", upload.ID, err)
+	}
+}
 
-	file, err := os.Open(filePath)
+// GetUploadStatus 查询 Tus 上传的入库状态
+//
+// 客户端完成最后一个 PATCH 后轮询该接口，直到状态变为 completed（返回 file_id）
+// 或 failed（返回 error）。入库任务尚未创建时返回 uploading 及当前偏移量。
+//
+// 端点: GET /api/tus/status/:id
+//
+// 返回:
+//   - 200: 成功返回状态
+//   - 404: 上传不存在
+func (h *TusHandler) GetUploadStatus(c *gin.Context) {
+	uploadID := c.Param("id")
+	userID := middleware.GetUserID(c)
+	userUUID, err := uuid.Parse(userID)
 	if err != nil {
-		log.Printf("Error opening file %s: %v", filePath, err)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
 		return
 	}
-	defer file.Close()
 
-	// Call FileService to process (encrypt and store permanently)
-	// Note: Size needs to be int64
-	_, err = h.fileService.UploadFile(userUUID, filename, upload.Size, file)
-	if err != nil {
-		log.Printf("Error saving file to permanent storage: %v", err)
+	job, err := h.processor.GetJob(uploadID, userUUID)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "Success",
+			"data":    job,
+		})
+		return
+	}
+	if !errors.Is(err, tasks.ErrTusJobNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
 		return
 	}
 
-	// Cleanup temp files (optional, or keep generic cleanup task)
-	// tusd doesn't automatically delete completed files from store?
-	// We should remove it after successful processing.
-	file.Close() // Ensure closed before removal
-	if err := os.Remove(filePath); err != nil {
-		log.Printf("Warning: failed to remove temp file %s: %v", filePath, err)
+	// 入库任务尚未创建：上传仍在进行中，或完成通知尚未处理
+	if info, ok := h.uploadInfo(c.Request.Context(), uploadID, userID); ok {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "Success",
+			"data": gin.H{
+				"upload_id": uploadID,
+				"status":    "uploading",
+				"offset":    info.Offset,
+				"size":      info.Size,
+			},
+		})
+		return
 	}
-	if err := os.Remove(filePath + ".info"); err != nil {
-		log.Printf("Warning: failed to remove info file: %v", err)
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"code":    404,
+		"message": "Upload not found",
+	})
+}
+
+// uploadInfo 读取属于该用户的 Tus 上传信息
+func (h *TusHandler) uploadInfo(ctx context.Context, uploadID string, userID string) (tusd.FileInfo, bool) {
+	// Tus 上传 ID 只包含字母和数字，拒绝可能跳出上传目录的 ID
+	if uploadID == "" || strings.ContainsAny(uploadID, `./\`) {
+		return tusd.FileInfo{}, false
 	}
-	
-	log.Printf("Successfully processed and stored upload %s", upload.ID)
+
+	upload, err := h.store.GetUpload(ctx, uploadID)
+	if err != nil {
+		return tusd.FileInfo{}, false
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil || info.MetaData["userID"] != userID {
+		return tusd.FileInfo{}, false
+	}
+	return info, true
 }
@@ -0,0 +1,202 @@
+// Package handlers 提供 HTTP 请求处理器
+//
+// 本文件实现基于 Redis 的 Tus 上传锁：
+//   - 同一上传的 HEAD/PATCH/DELETE 请求在所有实例间串行执行
+//   - 持有期间定期续期，进程崩溃后锁在 TTL 到期时自动释放
+//   - 其他请求等待锁时通知持有者尽快释放（tusd 据此中断旧的 PATCH 请求）
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"ahavault/server/internal/database"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+const (
+	// tusLockTTL 锁的过期时间，持有者每 tusLockTTL/3 续期一次
+	tusLockTTL = 30 * time.Second
+	// tusLockPollInterval 等待锁时的重试间隔
+	tusLockPollInterval = 100 * time.Millisecond
+	// tusReleaseCheckInterval 持有者检查释放请求的间隔
+	tusReleaseCheckInterval = 500 * time.Millisecond
+	// tusLockKeyPrefix Redis 键前缀
+	tusLockKeyPrefix = "tus:lock:"
+)
+
+// tusLockBackend 锁依赖的原子操作
+//
+// 生产环境由 Redis 实现（见 redisTusLockBackend），测试可替换为内存实现。
+type tusLockBackend interface {
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, key string) error
+}
+
+// redisTusLockBackend 使用 database 包的 Redis 封装
+type redisTusLockBackend struct{}
+
+func (redisTusLockBackend) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return database.SetNX(ctx, key, value, ttl)
+}
+
+func (redisTusLockBackend) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return database.CompareAndExpire(ctx, key, value, ttl)
+}
+
+func (redisTusLockBackend) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	return database.CompareAndDelete(ctx, key, value)
+}
+
+func (redisTusLockBackend) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := database.Exists(ctx, key)
+	return n > 0, err
+}
+
+func (redisTusLockBackend) Del(ctx context.Context, key string) error {
+	return database.Del(ctx, key)
+}
+
+// RedisTusLocker 基于 Redis 的 tusd 上传锁，支持多实例部署
+type RedisTusLocker struct {
+	backend tusLockBackend
+	ttl     time.Duration
+}
+
+// NewRedisTusLocker 创建基于 Redis 的上传锁（使用 database.RedisClient）
+func NewRedisTusLocker() *RedisTusLocker {
+	return &RedisTusLocker{backend: redisTusLockBackend{}, ttl: tusLockTTL}
+}
+
+// NewLock 实现 tusd.Locker
+func (l *RedisTusLocker) NewLock(id string) (tusd.Lock, error) {
+	return &redisTusLock{locker: l, key: tusLockKeyPrefix + id}, nil
+}
+
+// redisTusLock 单个上传的锁
+type redisTusLock struct {
+	locker *RedisTusLocker
+	key    string
+
+	token string
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// releaseKey 其他请求请求释放锁时写入的键
+func (l *redisTusLock) releaseKey() string {
+	return l.key + ":release"
+}
+
+// Lock 获取锁，直到成功或 ctx 结束（返回 tusd.ErrLockTimeout）
+func (l *redisTusLock) Lock(ctx context.Context, requestUnlock func()) error {
+	backend := l.locker.backend
+	token, err := newLockToken()
+	if err != nil {
+		return err
+	}
+
+	for {
+		ok, err := backend.SetNX(ctx, l.key, token, l.locker.ttl)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if ok {
+			// 清除上一个持有者期间遗留的释放请求
+			backend.Del(ctx, l.releaseKey())
+
+			l.token = token
+			l.stop = make(chan struct{})
+			l.done = make(chan struct{})
+			l.once = sync.Once{}
+			go l.keepAlive(requestUnlock)
+			return nil
+		}
+
+		// 锁被占用：通知持有者释放
+		backend.SetNX(ctx, l.releaseKey(), token, l.locker.ttl)
+
+		select {
+		case <-ctx.Done():
+			return tusd.ErrLockTimeout
+		case <-time.After(tusLockPollInterval):
+		}
+	}
+}
+
+// Unlock 释放锁（仅当仍由自己持有时）
+func (l *redisTusLock) Unlock() error {
+	if l.stop == nil {
+		return nil
+	}
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+
+	_, err := l.locker.backend.CompareAndDelete(context.Background(), l.key, l.token)
+	return err
+}
+
+// keepAlive 定期续期并检查释放请求
+func (l *redisTusLock) keepAlive(requestUnlock func()) {
+	defer close(l.done)
+
+	refresh := time.NewTicker(l.locker.ttl / 3)
+	defer refresh.Stop()
+	check := time.NewTicker(tusReleaseCheckInterval)
+	defer check.Stop()
+
+	notified := false
+	for {
+		select {
+		case <-l.stop:
+			return
+
+		case <-refresh.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.locker.ttl/3)
+			held, err := l.locker.backend.CompareAndExpire(ctx, l.key, l.token, l.locker.ttl)
+			cancel()
+			if err != nil {
+				log.Printf("[Tus] Warning: failed to refresh lock %s: %v", l.key, err)
+			} else if !held {
+				// 锁已过期并可能被其他实例获取：让 tusd 立即中断当前请求，避免并发写入
+				log.Printf("[Tus] Warning: lock %s expired while held", l.key)
+				if !notified && requestUnlock != nil {
+					notified = true
+					requestUnlock()
+				}
+			}
+
+		case <-check.C:
+			if notified || requestUnlock == nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tusReleaseCheckInterval)
+			requested, err := l.locker.backend.Exists(ctx, l.releaseKey())
+			cancel()
+			if err == nil && requested {
+				notified = true
+				requestUnlock()
+			}
+		}
+	}
+}
+
+// newLockToken 生成锁持有者标识
+func newLockToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
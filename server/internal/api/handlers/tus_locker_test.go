@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// memoryLockBackend 模拟 Redis 的内存锁后端（多个 locker 共享即模拟多实例）
+type memoryLockBackend struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newMemoryLockBackend() *memoryLockBackend {
+	return &memoryLockBackend{values: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (b *memoryLockBackend) get(key string) (string, bool) {
+	value, ok := b.values[key]
+	if ok && time.Now().After(b.expires[key]) {
+		delete(b.values, key)
+		return "", false
+	}
+	return value, ok
+}
+
+func (b *memoryLockBackend) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.get(key); ok {
+		return false, nil
+	}
+	b.values[key] = value
+	b.expires[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (b *memoryLockBackend) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if current, ok := b.get(key); !ok || current != value {
+		return false, nil
+	}
+	b.expires[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (b *memoryLockBackend) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if current, ok := b.get(key); !ok || current != value {
+		return false, nil
+	}
+	delete(b.values, key)
+	return true, nil
+}
+
+func (b *memoryLockBackend) Exists(ctx context.Context, key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.get(key)
+	return ok, nil
+}
+
+func (b *memoryLockBackend) Del(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.values, key)
+	return nil
+}
+
+// TestRedisTusLocker 测试跨实例上传锁
+//
+// 测试场景：
+//  1. 两个实例（共享后端）对同一上传互斥，其他上传不受影响
+//  2. 等待者超时返回 ErrLockTimeout，并通知持有者释放
+//  3. 释放后等待者可以获得锁
+//  4. 持有者崩溃（未续期）后锁在 TTL 到期时自动释放
+func TestRedisTusLocker(t *testing.T) {
+	backend := newMemoryLockBackend()
+	instanceA := &RedisTusLocker{backend: backend, ttl: time.Second}
+	instanceB := &RedisTusLocker{backend: backend, ttl: time.Second}
+
+	lockA, err := instanceA.NewLock("upload-1")
+	require.NoError(t, err)
+	released := make(chan struct{})
+	var once sync.Once
+	require.NoError(t, lockA.Lock(context.Background(), func() {
+		once.Do(func() { close(released) })
+	}))
+
+	// 其他上传不受影响
+	other, err := instanceB.NewLock("upload-2")
+	require.NoError(t, err)
+	require.NoError(t, other.Lock(context.Background(), nil))
+	require.NoError(t, other.Unlock())
+
+	// 另一实例等待超时，持有者收到释放请求
+	lockB, err := instanceB.NewLock("upload-1")
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	err = lockB.Lock(ctx, nil)
+	cancel()
+	assert.ErrorIs(t, err, tusd.ErrLockTimeout)
+
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Fatal("lock holder was not asked to release the lock")
+	}
+
+	// 持有期间续期，锁不会过期
+	time.Sleep(1500 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	assert.ErrorIs(t, lockB.Lock(ctx, nil), tusd.ErrLockTimeout)
+	cancel()
+
+	require.NoError(t, lockA.Unlock())
+	require.NoError(t, lockB.Lock(context.Background(), nil))
+
+	// 旧持有者重复释放不会删除新持有者的锁
+	require.NoError(t, lockA.Unlock())
+	held, _ := backend.Exists(context.Background(), tusLockKeyPrefix+"upload-1")
+	assert.True(t, held)
+
+	// 模拟持有者崩溃：停止续期后锁在 TTL 到期时释放
+	crashed := lockB.(*redisTusLock)
+	crashed.once.Do(func() { close(crashed.stop) })
+	<-crashed.done
+
+	lockC, err := instanceA.NewLock("upload-1")
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	require.NoError(t, lockC.Lock(ctx, nil))
+	require.NoError(t, lockC.Unlock())
+}
+
+// TestRedisTusLocker_LostLock 测试续期时发现锁已丢失，通知 tusd 中断当前请求
+func TestRedisTusLocker_LostLock(t *testing.T) {
+	backend := newMemoryLockBackend()
+	locker := &RedisTusLocker{backend: backend, ttl: 300 * time.Millisecond}
+
+	lock, err := locker.NewLock("upload-1")
+	require.NoError(t, err)
+	released := make(chan struct{})
+	require.NoError(t, lock.Lock(context.Background(), func() { close(released) }))
+
+	// 模拟锁过期后被其他实例获取
+	require.NoError(t, backend.Del(context.Background(), tusLockKeyPrefix+"upload-1"))
+	ok, err := backend.SetNX(context.Background(), tusLockKeyPrefix+"upload-1", "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Fatal("lock holder was not asked to stop after losing the lock")
+	}
+
+	// 释放时不删除新持有者的锁
+	require.NoError(t, lock.Unlock())
+	held, _ := backend.Exists(context.Background(), tusLockKeyPrefix+"upload-1")
+	assert.True(t, held)
+}
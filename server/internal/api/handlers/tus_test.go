@@ -0,0 +1,294 @@
+// Package handlers 提供 HTTP 请求处理器测试
+//
+// 本文件测试 Tus 上传的准入校验与入库状态查询接口
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
+	"ahavault/server/internal/storage"
+	"ahavault/server/internal/tasks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetTusUploadStatus 测试轮询 Tus 上传的入库状态
+func TestGetTusUploadStatus(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	fileService := services.NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	processor := tasks.NewTusProcessor(db, fileService, dir, tasks.TusProcessorOptions{})
+	handler := NewTusHandler(fileService, processor, services.UploadPolicy{}, nil)
+
+	user := &models.User{Email: "tus@test.com", Password: "hashed_password", StorageQuota: 1 << 30}
+	require.NoError(t, db.Create(user).Error)
+
+	content := []byte("tus status content")
+	uploadID := "0123456789abcdef"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, uploadID), content, 0600))
+	_, err := processor.Enqueue(uploadID, user.ID, "status.txt", int64(len(content)))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	currentUser := user.ID
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", currentUser.String())
+		c.Next()
+	})
+	router.GET("/api/tus/status/:id", handler.GetUploadStatus)
+
+	getStatus := func(id string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, "/api/tus/status/"+id, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	code, resp := getStatus(uploadID)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.TusJobPending, resp["data"].(map[string]interface{})["status"])
+
+	processor.RunPending()
+
+	code, resp = getStatus(uploadID)
+	require.Equal(t, http.StatusOK, code)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, models.TusJobCompleted, data["status"])
+	assert.NotEmpty(t, data["file_id"])
+
+	// 尚未完成的上传：返回 uploading 及当前偏移量
+	inProgress := "fedcba9876543210"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, inProgress), content[:5], 0600))
+	info, err := json.Marshal(map[string]interface{}{
+		"ID":       inProgress,
+		"Size":     len(content),
+		"MetaData": map[string]string{"userID": user.ID.String()},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, inProgress+".info"), info, 0600))
+
+	code, resp = getStatus(inProgress)
+	require.Equal(t, http.StatusOK, code)
+	data = resp["data"].(map[string]interface{})
+	assert.Equal(t, "uploading", data["status"])
+	assert.Equal(t, float64(5), data["offset"])
+
+	code, _ = getStatus("unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = getStatus("..")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 其他用户无法查询
+	currentUser = uuid.New()
+	code, _ = getStatus(uploadID)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// TestTusUploadValidation 测试 Tus 上传的创建前与完成前校验
+//
+// 测试场景：
+//  1. 超出单文件上限、类型不在白名单、配额不足、未声明大小的上传在创建时被拒绝
+//  2. 声明类型与实际内容不符的上传在完成时被拒绝并删除，不会进入入库队列
+//  3. 合法的上传创建时预占配额，正常完成并创建入库任务
+func TestTusUploadValidation(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	fileService := services.NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	processor := tasks.NewTusProcessor(db, fileService, dir, tasks.TusProcessorOptions{})
+	handler := NewTusHandler(fileService, processor, services.UploadPolicy{
+		MaxFileSize:      1024,
+		AllowedMimeTypes: []string{"application/pdf"},
+	}, nil)
+
+	user := &models.User{Email: "tus-limits@test.com", Password: "hashed_password", StorageQuota: 600}
+	require.NoError(t, db.Create(user).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID.String())
+		c.Next()
+	})
+	router.Any("/api/tus/upload", handler.GinHandler)
+	router.Any("/api/tus/upload/*any", handler.GinHandler)
+
+	metadata := func(filename, filetype string) string {
+		return "filename " + base64.StdEncoding.EncodeToString([]byte(filename)) +
+			",filetype " + base64.StdEncoding.EncodeToString([]byte(filetype))
+	}
+	create := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/tus/upload", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	patch := func(location string, data []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, location, bytes.NewReader(data))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	countUploads := func() int {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		return len(entries)
+	}
+
+	t.Run("创建时拒绝", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			headers map[string]string
+			status  int
+		}{
+			{"超出单文件上限", map[string]string{"Upload-Length": "2048", "Upload-Metadata": metadata("big.pdf", "application/pdf")}, http.StatusRequestEntityTooLarge},
+			{"类型不在白名单", map[string]string{"Upload-Length": "100", "Upload-Metadata": metadata("notes.txt", "text/plain")}, http.StatusUnsupportedMediaType},
+			{"按扩展名推断类型", map[string]string{"Upload-Length": "100", "Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("run.exe"))}, http.StatusUnsupportedMediaType},
+			{"配额不足", map[string]string{"Upload-Length": "700", "Upload-Metadata": metadata("quota.pdf", "application/pdf")}, http.StatusInsufficientStorage},
+			{"未声明大小", map[string]string{"Upload-Defer-Length": "1", "Upload-Metadata": metadata("deferred.pdf", "application/pdf")}, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			w := create(tt.headers)
+			assert.Equal(t, tt.status, w.Code, tt.name+": "+w.Body.String())
+		}
+		assert.Equal(t, 0, countUploads(), "rejected uploads must not create files")
+	})
+
+	t.Run("完成时嗅探类型", func(t *testing.T) {
+		content := []byte("this is plain text pretending to be a pdf")
+		w := create(map[string]string{
+			"Upload-Length":   strconv.Itoa(len(content)),
+			"Upload-Metadata": metadata("fake.pdf", "application/pdf"),
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		w = patch(w.Header().Get("Location"), content)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Contains(t, w.Body.String(), "ERR_FILE_TYPE_NOT_ALLOWED")
+		assert.Equal(t, 0, countUploads(), "rejected upload must be removed")
+
+		var jobs int64
+		db.Model(&models.TusUploadJob{}).Count(&jobs)
+		assert.Equal(t, int64(0), jobs)
+
+		// 被拒绝的上传释放预占的配额
+		var updated models.User
+		require.NoError(t, db.First(&updated, user.ID).Error)
+		assert.Equal(t, int64(0), updated.StorageReserved)
+	})
+
+	t.Run("合法上传", func(t *testing.T) {
+		content := []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n")
+		w := create(map[string]string{
+			"Upload-Length":   strconv.Itoa(len(content)),
+			"Upload-Metadata": metadata("real.pdf", "application/pdf"),
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		// 创建上传即预占配额
+		var updated models.User
+		require.NoError(t, db.First(&updated, user.ID).Error)
+		assert.Equal(t, int64(len(content)), updated.StorageReserved)
+
+		w = patch(w.Header().Get("Location"), content)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		assert.Eventually(t, func() bool {
+			var jobs int64
+			db.Model(&models.TusUploadJob{}).Where("user_id = ?", user.ID).Count(&jobs)
+			return jobs == 1
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+}
+
+// TestTusResumeOnAnotherInstance 测试续传请求落到另一实例时继续上传
+//
+// 两个处理器共享上传目录和锁后端，模拟负载均衡后的两个实例。
+func TestTusResumeOnAnotherInstance(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	fileService := services.NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	backend := newMemoryLockBackend()
+
+	user := &models.User{Email: "replicas@test.com", Password: "hashed_password", StorageQuota: 1 << 30}
+	require.NoError(t, db.Create(user).Error)
+
+	gin.SetMode(gin.TestMode)
+	newInstance := func() *gin.Engine {
+		processor := tasks.NewTusProcessor(db, fileService, dir, tasks.TusProcessorOptions{})
+		handler := NewTusHandler(fileService, processor, services.UploadPolicy{}, &RedisTusLocker{backend: backend, ttl: tusLockTTL})
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user_id", user.ID.String())
+			c.Next()
+		})
+		router.Any("/api/tus/upload", handler.GinHandler)
+		router.Any("/api/tus/upload/*any", handler.GinHandler)
+		return router
+	}
+	instanceA, instanceB := newInstance(), newInstance()
+
+	send := func(router *gin.Engine, method, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	content := bytes.Repeat([]byte("replica "), 1024)
+	w := send(instanceA, http.MethodPost, "/api/tus/upload", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(len(content)),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("replica.txt")),
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	location := w.Header().Get("Location")
+
+	half := len(content) / 2
+	w = send(instanceA, http.MethodPatch, location, content[:half], map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	})
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	// 实例 B 查询偏移量并完成上传
+	w = send(instanceB, http.MethodHead, location, nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, strconv.Itoa(half), w.Header().Get("Upload-Offset"))
+
+	w = send(instanceB, http.MethodPatch, location, content[half:], map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(half),
+	})
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.Equal(t, strconv.Itoa(len(content)), w.Header().Get("Upload-Offset"))
+}
@@ -2,17 +2,17 @@
 //
 // 本文件实现了基于 Tus 协议的文件上传处理器，支持：
 //   - 分片上传（Chunked Upload）
-//   - 断点续传（Resumable Upload）
-//   - 上传进度查询
-//   - 上传完成后自动触发加密存储
+//   - 断点续传（Resumable Upload，会话持久化在 upload_sessions 表，服务重启后可继续）
+//   - 上传进度查询与进行中的上传列表
+//   - 上传完成后校验哈希并自动触发加密存储
 //
 // 作者: AhaVault Team
 // 创建时间: 2026-02-04
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -23,15 +23,17 @@ import (
 	"github.com/google/uuid"
 )
 
-// UploadHandler Tus 上传处理器
+// UploadHandler 分片上传处理器
 type UploadHandler struct {
-	fileService *services.FileService
+	fileService   *services.FileService
+	uploadService *services.UploadService
 }
 
 // NewUploadHandler 创建上传处理器
-func NewUploadHandler(fileService *services.FileService) *UploadHandler {
+func NewUploadHandler(fileService *services.FileService, uploadService *services.UploadService) *UploadHandler {
 	return &UploadHandler{
-		fileService: fileService,
+		fileService:   fileService,
+		uploadService: uploadService,
 	}
 }
 
@@ -46,11 +48,11 @@ type CreateUploadRequest struct {
 //
 // 该函数实现 Tus 协议的上传会话创建：
 //  1. 验证用户存储配额
-//  2. 检查是否可以秒传（文件已存在）
-//  3. 创建临时上传会话（使用 Redis 或内存存储）
+//  2. 生成秒传持有证明挑战（不透露文件是否已存在）
+//  3. 创建持久化的上传会话（upload_sessions 表 + 会话数据文件）
 //  4. 返回上传 URL 和会话 ID
 //
-// 端点: POST /api/tus/upload
+// 端点: POST /api/uploads
 //
 // 参数:
 //   - c: Gin 上下文对象
@@ -81,57 +83,103 @@ func (h *UploadHandler) CreateUpload(c *gin.Context) {
 		return
 	}
 
-	// 检查秒传
-	exists, _, err := h.fileService.CheckInstantUpload(req.Hash, userUUID)
+	// 附带秒传持有证明挑战：无论文件是否存在都下发，避免仅凭哈希探测他人的文件；
+	// 客户端可通过 POST /api/files 提交证明尝试秒传，失败时继续正常上传
+	challenge, err := h.fileService.IssueUploadChallenge(userUUID, req.Hash, req.Size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
 			"message": err.Error(),
 		})
 		return
 	}
 
-	if exists {
-		// 秒传成功，直接创建元数据
-		metadata, err := h.fileService.CreateFileMetadata(userUUID, req.Hash, req.Filename, req.Size)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"code":    400,
-				"message": err.Error(),
-			})
-			return
+	session, err := h.uploadService.CreateSession(userUUID, req.Filename, req.Size, req.Hash)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrInsufficientStorage) {
+			status = http.StatusInsufficientStorage
 		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"code":    0,
-			"message": "Instant upload successful",
-			"data": gin.H{
-				"instant_upload": true,
-				"file":           metadata,
-			},
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// 创建上传会话 ID
-	uploadID := uuid.New().String()
+	uploadURL := uploadLocation(session.ID)
+	data := gin.H{
+		"upload_id":      session.ID,
+		"upload_url":     uploadURL,
+		"upload_offset":  session.UploadOffset,
+		"upload_length":  session.UploadLength,
+		"filename":       session.Filename,
+		"hash":           session.Hash,
+		"instant_upload": false,
+		"challenge":      challenge,
+	}
 
 	// 返回上传会话信息
-	c.Header("Location", fmt.Sprintf("/api/tus/upload/%s", uploadID))
+	c.Header("Location", uploadURL)
 	c.Header("Tus-Resumable", "1.0.0")
-	c.Header("Upload-Offset", "0")
-	c.Header("Upload-Length", strconv.FormatInt(req.Size, 10))
+	c.Header("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.UploadLength, 10))
 
 	c.JSON(http.StatusCreated, gin.H{
 		"code":    0,
 		"message": "Upload session created",
+		"data":    data,
+	})
+}
+
+// ListUploads 列出当前用户进行中的上传会话
+//
+// 客户端（包括服务重启后）可据此恢复未完成的上传。
+//
+// 端点: GET /api/uploads
+func (h *UploadHandler) ListUploads(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	sessions, err := h.uploadService.ListSessions(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	uploads := make([]gin.H, 0, len(sessions))
+	for i := range sessions {
+		session := &sessions[i]
+		uploads = append(uploads, gin.H{
+			"upload_id":     session.ID,
+			"upload_url":    uploadLocation(session.ID),
+			"filename":      session.Filename,
+			"hash":          session.Hash,
+			"status":        session.Status,
+			"upload_offset": session.UploadOffset,
+			"upload_length": session.UploadLength,
+			"progress":      session.Progress(),
+			"created_at":    session.CreatedAt,
+			"updated_at":    session.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "Success",
 		"data": gin.H{
-			"upload_id":    uploadID,
-			"upload_url":   fmt.Sprintf("/api/tus/upload/%s", uploadID),
-			"upload_offset": 0,
-			"upload_length": req.Size,
-			"filename":     req.Filename,
-			"hash":         req.Hash,
+			"uploads": uploads,
+			"total":   len(uploads),
 		},
 	})
 }
@@ -139,13 +187,12 @@ func (h *UploadHandler) CreateUpload(c *gin.Context) {
 // UploadChunk 上传文件分片
 //
 // 该函数实现 Tus 协议的 PATCH 方法：
-//  1. 验证 Content-Length 和 Upload-Offset 头
-//  2. 接收文件分片数据
-//  3. 追加到临时文件
-//  4. 更新上传进度
-//  5. 若上传完成，触发文件加密和存储
+//  1. 验证 Upload-Offset 头与服务端记录的偏移量一致
+//  2. 接收文件分片数据并追加到会话数据文件
+//  3. 更新上传进度
+//  4. 若上传完成，校验哈希并触发文件加密和存储
 //
-// 端点: PATCH /api/tus/upload/:id
+// 端点: PATCH /api/uploads/:id
 //
 // 参数:
 //   - c: Gin 上下文对象
@@ -153,15 +200,17 @@ func (h *UploadHandler) CreateUpload(c *gin.Context) {
 // 返回:
 //   - 204: 分片上传成功
 //   - 200: 文件上传完成
-//   - 400: 请求参数错误
+//   - 400: 请求参数错误或超出声明的文件大小
 //   - 404: 上传会话不存在
 //   - 409: Upload-Offset 不匹配
+//   - 410: 上传会话已结束
+//   - 422: 文件内容与声明的哈希不一致
 func (h *UploadHandler) UploadChunk(c *gin.Context) {
-	uploadID := c.Param("id")
-	if uploadID == "" {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
-			"message": "Missing upload ID",
+			"message": "Invalid upload ID",
 		})
 		return
 	}
@@ -176,21 +225,8 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 		return
 	}
 
-	// 获取请求头信息
-	contentLengthStr := c.GetHeader("Content-Length")
-	uploadOffsetStr := c.GetHeader("Upload-Offset")
-
-	contentLength, err := strconv.ParseInt(contentLengthStr, 10, 64)
-	if err != nil || contentLength <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "Invalid Content-Length header",
-		})
-		return
-	}
-
-	uploadOffset, err := strconv.ParseInt(uploadOffsetStr, 10, 64)
-	if err != nil {
+	uploadOffset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || uploadOffset < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "Invalid Upload-Offset header",
@@ -198,41 +234,45 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 		return
 	}
 
-	// 读取请求体数据
 	body := c.Request.Body
 	defer body.Close()
 
-	// 限制读取大小（防止恶意请求）
-	limitedReader := io.LimitReader(body, contentLength)
-
-	// TODO: 实现实际的分片存储逻辑
-	// 这里需要：
-	// 1. 将数据追加到临时文件（/tmp/uploads/{uploadID}）
-	// 2. 更新上传进度到 Redis
-	// 3. 检查是否上传完成
-	// 4. 若完成，调用 fileService.UploadFile 进行加密存储
-
-	// 示例：直接上传完整文件（简化实现）
-	filename := c.GetHeader("Upload-Metadata-Filename")
-	sizeStr := c.GetHeader("Upload-Metadata-Size")
-	size, _ := strconv.ParseInt(sizeStr, 10, 64)
+	session, metadata, err := h.uploadService.WriteChunk(sessionID, userUUID, uploadOffset, body)
 
-	if filename == "" {
-		filename = "untitled"
+	c.Header("Tus-Resumable", "1.0.0")
+	if session != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
 	}
 
-	metadata, err := h.fileService.UploadFile(userUUID, filename, size, limitedReader)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUploadNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrUploadOffsetMismatch):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrUploadNotActive):
+			status = http.StatusGone
+		case errors.Is(err, services.ErrUploadExceedsLength):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrHashMismatch):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, services.ErrMimeTypeNotAllowed):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, services.ErrInsufficientStorage):
+			status = http.StatusInsufficientStorage
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
 			"message": err.Error(),
 		})
 		return
 	}
 
-	// 设置响应头
-	c.Header("Tus-Resumable", "1.0.0")
-	c.Header("Upload-Offset", strconv.FormatInt(uploadOffset+contentLength, 10))
+	if metadata == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
@@ -247,7 +287,7 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 //  1. 查询上传会话信息
 //  2. 返回当前上传偏移量和总大小
 //
-// 端点: HEAD /api/tus/upload/:id
+// 端点: HEAD /api/uploads/:id
 //
 // 参数:
 //   - c: Gin 上下文对象
@@ -255,36 +295,51 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 // 返回:
 //   - 200: 成功返回上传进度
 //   - 404: 上传会话不存在
+//   - 410: 上传会话已结束
 func (h *UploadHandler) GetUploadProgress(c *gin.Context) {
-	uploadID := c.Param("id")
-	if uploadID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "Missing upload ID",
-		})
+	c.Header("Tus-Resumable", "1.0.0")
+	c.Header("Cache-Control", "no-store")
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
 		return
 	}
 
-	// TODO: 从 Redis 或内存存储中获取上传进度
-	// 这里返回模拟数据
-	uploadOffset := int64(0)
-	uploadLength := int64(1024000)
+	userUUID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
 
-	c.Header("Tus-Resumable", "1.0.0")
-	c.Header("Upload-Offset", strconv.FormatInt(uploadOffset, 10))
-	c.Header("Upload-Length", strconv.FormatInt(uploadLength, 10))
-	c.Header("Cache-Control", "no-store")
+	session, err := h.uploadService.GetSession(sessionID, userUUID)
+	if err != nil {
+		if errors.Is(err, services.ErrUploadNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.UploadLength, 10))
+	c.Header("Upload-Status", string(session.Status))
 
+	if !session.IsUploading() {
+		c.Status(http.StatusGone)
+		return
+	}
 	c.Status(http.StatusOK)
 }
 
 // DeleteUpload 删除上传会话
 //
 // 该函数实现 Tus 协议的 DELETE 方法：
-//  1. 删除临时文件
-//  2. 清除上传会话信息
+//  1. 删除会话数据文件
+//  2. 清除上传会话记录
 //
-// 端点: DELETE /api/tus/upload/:id
+// 端点: DELETE /api/uploads/:id
 //
 // 参数:
 //   - c: Gin 上下文对象
@@ -293,16 +348,39 @@ func (h *UploadHandler) GetUploadProgress(c *gin.Context) {
 //   - 204: 删除成功
 //   - 404: 上传会话不存在
 func (h *UploadHandler) DeleteUpload(c *gin.Context) {
-	uploadID := c.Param("id")
-	if uploadID == "" {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
-			"message": "Missing upload ID",
+			"message": "Invalid upload ID",
 		})
 		return
 	}
 
-	// TODO: 删除临时文件和 Redis 会话数据
+	userID := middleware.GetUserID(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	if err := h.uploadService.CancelSession(sessionID, userUUID); err != nil {
+		if errors.Is(err, services.ErrUploadNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
 
 	c.Header("Tus-Resumable", "1.0.0")
 	c.Status(http.StatusNoContent)
@@ -314,7 +392,7 @@ func (h *UploadHandler) DeleteUpload(c *gin.Context) {
 //  1. 返回支持的 Tus 版本
 //  2. 返回支持的扩展
 //
-// 端点: OPTIONS /api/tus/upload
+// 端点: OPTIONS /api/uploads
 //
 // 参数:
 //   - c: Gin 上下文对象
@@ -349,3 +427,8 @@ func parseUploadMetadata(metadata string) map[string]string {
 
 	return result
 }
+
+// uploadLocation 返回上传会话的 URL
+func uploadLocation(sessionID uuid.UUID) string {
+	return fmt.Sprintf("/api/uploads/%s", sessionID)
+}
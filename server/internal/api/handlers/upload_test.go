@@ -5,6 +5,8 @@
 //   - 分片上传
 //   - 查询上传进度
 //   - 删除上传会话
+//   - 进行中的上传列表
+//   - 完成时的哈希校验
 //   - 秒传检测
 //
 // 作者: AhaVault Team
@@ -13,9 +15,12 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"ahavault/server/internal/models"
@@ -40,9 +45,10 @@ func setupUploadTestEnv(t *testing.T) (*UploadHandler, *gin.Engine, uuid.UUID, f
 
 	// 初始化服务
 	fileService := services.NewFileService(db, storageEngine, kek)
+	uploadService := services.NewUploadService(db, fileService, t.TempDir())
 
 	// 创建处理器
-	handler := NewUploadHandler(fileService)
+	handler := NewUploadHandler(fileService, uploadService)
 
 	// 创建测试用户
 	user := &models.User{
@@ -63,11 +69,12 @@ func setupUploadTestEnv(t *testing.T) (*UploadHandler, *gin.Engine, uuid.UUID, f
 		c.Next()
 	})
 
-	router.POST("/api/tus/upload", handler.CreateUpload)
-	router.PATCH("/api/tus/upload/:id", handler.UploadChunk)
-	router.HEAD("/api/tus/upload/:id", handler.GetUploadProgress)
-	router.DELETE("/api/tus/upload/:id", handler.DeleteUpload)
-	router.OPTIONS("/api/tus/upload", handler.Options)
+	router.GET("/api/uploads", handler.ListUploads)
+	router.POST("/api/uploads", handler.CreateUpload)
+	router.PATCH("/api/uploads/:id", handler.UploadChunk)
+	router.HEAD("/api/uploads/:id", handler.GetUploadProgress)
+	router.DELETE("/api/uploads/:id", handler.DeleteUpload)
+	router.OPTIONS("/api/uploads", handler.Options)
 
 	// 清理函数
 	cleanup := func() {
@@ -118,6 +125,8 @@ func TestCreateUpload(t *testing.T) {
 				assert.NotEmpty(t, data["upload_url"])
 				assert.Equal(t, float64(0), data["upload_offset"])
 				assert.Equal(t, float64(1024), data["upload_length"])
+				// 文件不存在时同样附带秒传挑战
+				assert.NotEmpty(t, data["challenge"])
 			},
 		},
 		{
@@ -156,7 +165,7 @@ func TestCreateUpload(t *testing.T) {
 			body, err := json.Marshal(tt.requestBody)
 			require.NoError(t, err)
 
-			req, err := http.NewRequest(http.MethodPost, "/api/tus/upload", bytes.NewReader(body))
+			req, err := http.NewRequest(http.MethodPost, "/api/uploads", bytes.NewReader(body))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
 
@@ -190,11 +199,149 @@ func TestCreateUpload(t *testing.T) {
 	}
 }
 
+// createUploadSession 通过接口创建上传会话，返回会话 URL
+func createUploadSession(t *testing.T, router *gin.Engine, filename string, content []byte) string {
+	sum := sha256.Sum256(content)
+	body, err := json.Marshal(CreateUploadRequest{
+		Filename: filename,
+		Size:     int64(len(content)),
+		Hash:     hex.EncodeToString(sum[:]),
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	location := w.Header().Get("Location")
+	require.NotEmpty(t, location)
+	return location
+}
+
+// patchChunk 发送分片
+func patchChunk(router *gin.Engine, url string, offset int64, chunk []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, url, bytes.NewReader(chunk))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// headUpload 查询上传进度
+func headUpload(router *gin.Engine, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodHead, url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
 // TestUploadChunk 测试分片上传
-// TODO: 实现分片上传测试
+func TestUploadChunk(t *testing.T) {
+	_, router, userID, cleanup := setupUploadTestEnv(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("chunked upload content "), 1000)
+	url := createUploadSession(t, router, "chunked.txt", content)
+
+	// 第一个分片
+	w := patchChunk(router, url, 0, content[:10000])
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "10000", w.Header().Get("Upload-Offset"))
+
+	// 偏移量不匹配
+	w = patchChunk(router, url, 5000, content[5000:10000])
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "10000", w.Header().Get("Upload-Offset"))
+
+	// 超出声明的文件大小
+	w = patchChunk(router, url, 10000, append(append([]byte{}, content[10000:]...), 'x'))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 最后一个分片：完成上传
+	w = patchChunk(router, url, 10000, content[10000:])
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "chunked.txt", data["filename"])
+	assert.Equal(t, float64(len(content)), data["size"])
+	assert.Equal(t, userID.String(), data["user_id"])
+
+	// 会话已完成
+	w = patchChunk(router, url, int64(len(content)), nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+// TestUploadChunk_HashMismatch 测试上传内容与声明哈希不一致
+func TestUploadChunk_HashMismatch(t *testing.T) {
+	_, router, _, cleanup := setupUploadTestEnv(t)
+	defer cleanup()
+
+	content := []byte("declared content")
+	url := createUploadSession(t, router, "mismatch.txt", content)
+
+	w := patchChunk(router, url, 0, []byte("tampered content"))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = headUpload(router, url)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "failed", w.Header().Get("Upload-Status"))
+}
+
+// TestGetUploadProgress 测试查询上传进度与进行中的上传列表
+func TestGetUploadProgress(t *testing.T) {
+	_, router, _, cleanup := setupUploadTestEnv(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("resume "), 500)
+	url := createUploadSession(t, router, "resume.txt", content)
+
+	require.Equal(t, http.StatusNoContent, patchChunk(router, url, 0, content[:1000]).Code)
 
-// TestGetUploadProgress 测试查询上传进度
-// TODO: 实现上传进度查询测试
+	w := headUpload(router, url)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, strconv.Itoa(len(content)), w.Header().Get("Upload-Length"))
+
+	// 进行中的上传列表
+	req := httptest.NewRequest(http.MethodGet, "/api/uploads", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	uploads := resp["data"].(map[string]interface{})["uploads"].([]interface{})
+	require.Len(t, uploads, 1)
+	assert.Equal(t, url, uploads[0].(map[string]interface{})["upload_url"])
+	assert.Equal(t, float64(1000), uploads[0].(map[string]interface{})["upload_offset"])
+
+	w = headUpload(router, "/api/uploads/"+uuid.New().String())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
 
 // TestDeleteUpload 测试删除上传会话
-// TODO: 实现删除上传会话测试
+func TestDeleteUpload(t *testing.T) {
+	_, router, _, cleanup := setupUploadTestEnv(t)
+	defer cleanup()
+
+	content := []byte("to be cancelled")
+	url := createUploadSession(t, router, "cancel.txt", content)
+	require.Equal(t, http.StatusNoContent, patchChunk(router, url, 0, content[:5]).Code)
+
+	req := httptest.NewRequest(http.MethodDelete, url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, headUpload(router, url).Code)
+
+	req = httptest.NewRequest(http.MethodDelete, url, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,92 @@
+// Package handlers 提供 HTTP 请求处理器
+//
+// 本文件实现分享的打包下载：将分享中的所有文件边解密边写入 ZIP，
+// 直接流式输出到响应，不落临时文件。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+)
+
+// fileOpener 打开文件的完整明文读取流
+type fileOpener func(fileID uuid.UUID) (io.ReadCloser, error)
+
+// writeShareZip 将文件逐个解密并写入 ZIP 流
+//
+// 文件以存储（不压缩）方式写入：内容逐个流式写出，
+// CPU 开销低且不需要预先知道压缩后的大小。
+// 同名文件会自动重命名，见 uniqueZipNames。
+func writeShareZip(w io.Writer, files []models.FileMetadata, open fileOpener) error {
+	zw := zip.NewWriter(w)
+	names := uniqueZipNames(files)
+
+	for i, file := range files {
+		header := &zip.FileHeader{
+			Name:     names[i],
+			Method:   zip.Store,
+			Modified: file.CreatedAt,
+		}
+		header.SetMode(0644)
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry: %w", err)
+		}
+
+		reader, err := open(file.ID)
+		if err != nil {
+			return fmt.Errorf("failed to open file %s: %w", file.ID, err)
+		}
+		_, err = io.Copy(entry, reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write file %s: %w", file.ID, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// uniqueZipNames 为 ZIP 条目生成不重复的文件名
+//
+// 文件名中的路径分隔符会被替换，避免解压时写出目录之外（Zip Slip）；
+// 重名（忽略大小写）的文件依次命名为 "name (1).ext"、"name (2).ext"。
+func uniqueZipNames(files []models.FileMetadata) []string {
+	names := make([]string, len(files))
+	used := make(map[string]bool, len(files))
+
+	for i, file := range files {
+		name := sanitizeZipName(file.Filename)
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+
+		candidate := name
+		for n := 1; used[strings.ToLower(candidate)]; n++ {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+
+		used[strings.ToLower(candidate)] = true
+		names[i] = candidate
+	}
+
+	return names
+}
+
+// sanitizeZipName 清理 ZIP 条目名中的路径成分
+func sanitizeZipName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "." || name == ".." || strings.TrimSpace(name) == "" {
+		return "file"
+	}
+	return name
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"time"
+
 	"ahavault/server/internal/api/handlers"
 	"ahavault/server/internal/middleware"
 	"ahavault/server/internal/services"
+	"ahavault/server/internal/tasks"
 	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
 )
 
 // SetupRoutes 设置路由
@@ -13,12 +17,21 @@ func SetupRoutes(
 	userService *services.UserService,
 	fileService *services.FileService,
 	shareService *services.ShareService,
+	uploadService *services.UploadService,
+	tusProcessor *tasks.TusProcessor,
+	uploadPolicy services.UploadPolicy,
+	tusLocker tusd.Locker,
+	keyRotator *tasks.KeyRotator,
+	scrubber *tasks.Scrubber,
+	bruteForce *middleware.BruteForceGuard,
 ) {
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(userService)
 	fileHandler := handlers.NewFileHandler(fileService)
+	uploadHandler := handlers.NewUploadHandler(fileService, uploadService)
 	shareHandler := handlers.NewShareHandler(shareService)
 	downloadHandler := handlers.NewDownloadHandler(shareService, fileService)
+	adminHandler := handlers.NewAdminHandler(keyRotator, scrubber, shareService)
 
 	// Apply global middleware
 	router.Use(middleware.CORS())
@@ -36,10 +49,22 @@ func SetupRoutes(
 		}
 
 		// Public share routes (public)
+		// 验证访问密码的端点按 IP 限流，并对取件码和访问密码做防暴力破解
+		pickupLimiter := middleware.NewIPRateLimiter(nil, 10, time.Minute, "ratelimit:pickup:")
+		// 下载端点同样按 IP 限流，上限高于验证密码的端点（一个分享中的每个文件各发起一次下载）
+		downloadLimiter := middleware.NewIPRateLimiter(nil, 60, time.Minute, "ratelimit:download:")
+		// 指定接收人的分享需要识别访问者，携带 token 时按登录用户访问
+		optionalAuth := middleware.OptionalAuth(userService)
 		public := api.Group("/public")
 		{
-			public.POST("/shares/:code", shareHandler.GetShareByCode)
-			public.GET("/download/:code", downloadHandler.DownloadByPickupCode)
+			public.POST("/shares/:code", pickupLimiter, bruteForce.Middleware(true), optionalAuth, shareHandler.GetShareByCode)
+			public.GET("/download/:code", downloadLimiter, bruteForce.Middleware(false), optionalAuth, downloadHandler.DownloadByPickupCode)
+			public.GET("/download/:code/:fileID", downloadLimiter, bruteForce.Middleware(false), optionalAuth, downloadHandler.DownloadSharedFile)
+
+			// 分享链接：与取件码相同的访问密码、有效期和下载次数规则
+			public.POST("/links/:token", pickupLimiter, bruteForce.Middleware(true), optionalAuth, shareHandler.GetShareByCode)
+			public.GET("/links/:token/download", downloadLimiter, bruteForce.Middleware(false), optionalAuth, downloadHandler.DownloadByPickupCode)
+			public.GET("/links/:token/download/:fileID", downloadLimiter, bruteForce.Middleware(false), optionalAuth, downloadHandler.DownloadSharedFile)
 		}
 
 		// 需要认证的路由
@@ -63,20 +88,57 @@ func SetupRoutes(
 				files.DELETE("/:id", fileHandler.DeleteFile)
 			}
 
+			// 分片上传路由（会话持久化，支持断点续传）
+			uploads := authenticated.Group("/uploads")
+			{
+				uploads.GET("", uploadHandler.ListUploads)
+				uploads.POST("", uploadHandler.CreateUpload)
+				uploads.OPTIONS("", uploadHandler.Options)
+				uploads.HEAD("/:id", uploadHandler.GetUploadProgress)
+				uploads.PATCH("/:id", uploadHandler.UploadChunk)
+				uploads.DELETE("/:id", uploadHandler.DeleteUpload)
+			}
+
 			// 分享路由
 			shares := authenticated.Group("/shares")
 			{
 				shares.GET("", shareHandler.ListMyShares)
+				shares.GET("/incoming", shareHandler.ListIncomingShares)
 				shares.POST("", shareHandler.CreateShare)
-				shares.POST("/:code/save", shareHandler.SaveToVault)
+				shares.POST("/:code/save", bruteForce.Middleware(true), shareHandler.SaveToVault)
+				shares.PATCH("/:id", shareHandler.UpdateShare)
 				shares.DELETE("/:id", shareHandler.StopShare)
+				shares.PUT("/:id/link", shareHandler.IssueShareLink)
+				shares.DELETE("/:id/link", shareHandler.RevokeShareLink)
+				shares.GET("/:id/recipients", shareHandler.ListShareRecipients)
+			}
+
+			// 通过分享链接转存
+			links := authenticated.Group("/links")
+			{
+				links.POST("/:token/save", bruteForce.Middleware(true), shareHandler.SaveToVault)
 			}
 
 			// Tus Upload Routes
-			tusHandler := handlers.NewTusHandler(fileService, "./tmp/tus_uploads")
+			tusHandler := handlers.NewTusHandler(fileService, tusProcessor, uploadPolicy, tusLocker)
 			// We handle both base path and wildcards for Tus protocol (POST, HEAD, PATCH, OPTIONS, DELETE)
 			authenticated.Any("/tus/upload", tusHandler.GinHandler)
 			authenticated.Any("/tus/upload/*any", tusHandler.GinHandler)
+			// 上传完成后的入库状态（轮询直到返回 file_id 或最终错误）
+			authenticated.GET("/tus/status/:id", tusHandler.GetUploadStatus)
+		}
+
+		// 管理员路由
+		admin := api.Group("/admin")
+		admin.Use(middleware.AdminAuth(userService))
+		{
+			admin.GET("/keys", adminHandler.ListKeys)
+			admin.POST("/keys/rewrap", adminHandler.RewrapKeys)
+			admin.POST("/scrub", adminHandler.StartScrub)
+			admin.GET("/scrub/reports", adminHandler.ListScrubReports)
+			admin.GET("/scrub/reports/:id", adminHandler.GetScrubReport)
+			admin.GET("/users/:id/share-policy", adminHandler.GetUserSharePolicy)
+			admin.PUT("/users/:id/share-policy", adminHandler.SetUserSharePolicy)
 		}
 	}
 
@@ -69,10 +69,20 @@ type RedisConfig struct {
 
 // StorageConfig 存储配置
 type StorageConfig struct {
-	Type string // 存储类型：local, s3
+	Type        string // 存储类型：local, s3
+	MigrateFrom string // 迁移源存储类型（迁移期间读取回退到该存储，为空表示未在迁移）
 
 	// Local 存储配置
 	LocalPath string
+	TempPath  string // 上传临时文件目录（为空时使用系统临时目录）
+
+	// 分片上传会话的数据目录（需持久化，服务重启后可续传）
+	UploadPath string
+	// Tus 上传的数据目录（需持久化，入库任务在重启后从这里恢复）
+	// 多实例部署时必须是所有实例共享的目录（如 NFS），续传请求可能落到任一实例
+	TusPath string
+	// Tus 上传锁：redis（跨实例，默认）或 memory（仅单实例）
+	TusLocker string
 
 	// S3 存储配置
 	S3Endpoint  string
@@ -81,12 +91,29 @@ type StorageConfig struct {
 	S3AccessKey string
 	S3SecretKey string
 	S3UseSSL    bool
+	S3PathStyle bool  // 是否使用 Path-Style 寻址（MinIO 等自建服务通常需要开启）
+	S3PartSize  int64 // 分片上传的分片大小（字节）
 }
 
 // CryptoConfig 加密配置
 type CryptoConfig struct {
-	MasterKey []byte // KEK (Key Encryption Key) - 32 bytes
-	JWTSecret string // JWT 签名密钥
+	KeyProvider   string            // 主密钥来源: env | file | vault
+	MasterKey     []byte            // KEK (Key Encryption Key) - 32 bytes，KeyProvider=env 时使用
+	MasterKeyFile string            // KEK 密钥文件路径，KeyProvider=file 时使用
+	MasterKeyID   string            // 主密钥的密钥 ID，新数据总是使用主密钥加密
+	RetiredKeys   map[string][]byte // 已退役的 KEK（ID -> 密钥），仅用于解密尚未轮换的数据
+	Vault         VaultConfig       // KeyProvider=vault 时使用
+	JWTSecret     string            // JWT 签名密钥
+}
+
+// VaultConfig HashiCorp Vault Transit 配置
+type VaultConfig struct {
+	Address   string
+	Token     string
+	Namespace string
+	Mount     string // Transit 引擎挂载路径
+	KeyName   string // Transit 密钥名称
+	Timeout   time.Duration
 }
 
 // ServerConfig 服务器配置
@@ -102,24 +129,46 @@ type ServerConfig struct {
 // BusinessConfig 业务配置
 type BusinessConfig struct {
 	// 文件相关
-	MaxFileSize      int64 // 单文件最大大小（字节）
-	AllowedMimeTypes []string
+	MaxFileSize      int64    // 单文件最大大小（字节）
+	AllowedMimeTypes []string // MIME 允许/禁止列表（! 前缀为禁止规则）
 
 	// 存储配额
 	DefaultUserQuota int64 // 新用户默认配额（字节）
 
 	// 分享相关
 	ShareCodeLength     int           // 取件码长度
+	ShareCodeFormat     string        // 取件码格式：random（随机字符）/ words（单词组合）
+	ShareCodeWords      int           // 单词组合取件码的单词数
+	VanityCodesEnabled  bool          // 是否允许自定义取件码
+	ShareCodeBlocklist  []string      // 额外的取件码不雅词汇
 	DefaultShareExpiry  time.Duration // 默认分享有效期
 	MaxShareExpiry      time.Duration // 最大分享有效期
 	MaxFilesPerShare    int           // 单次分享最大文件数
 	MaxActiveSharesUser int           // 单用户最大活跃分享数
 
+	// 下载统计
+	DownloadCountThreshold int64         // 下载会话累计发送达到该字节数即计为一次下载，0 表示完整传输后计数
+	DownloadTicketTTL      time.Duration // 下载凭证有效期（过期后只能续传已开始的下载）
+
+	// 防暴力破解（取件码与分享访问密码）
+	BruteForceMaxFailures     int           // 单个 IP 在窗口内允许的失败次数
+	BruteForceCodeMaxFailures int           // 单个取件码在窗口内允许的访问密码错误次数
+	BruteForceWindow          time.Duration // 失败计数窗口
+	BruteForceLockout         time.Duration // 首次锁定时长，再次触发时逐级翻倍
+	BruteForceMaxLockout      time.Duration // 最长锁定时长
+	BruteForceAlertLevel      int           // 锁定级别达到该值时写入审计告警
+
 	// 垃圾回收
 	GCRetentionDays     int           // 软删除保留天数
 	GCCleanupInterval   time.Duration // GC 清理间隔
 	GCFragmentRetention time.Duration // 上传碎片保留时间
 
+	// 存储巡检
+	ScrubSchedule    string        // 巡检 cron 表达式，为空时不定时执行
+	ScrubRateLimit   int64         // 巡检读取速率上限（字节/秒），0 表示不限速
+	ScrubQuarantine  bool          // 是否自动隔离异常条目
+	ScrubOrphanGrace time.Duration // 孤儿文件宽限期（避免误判正在上传的文件）
+
 	// 注册控制
 	RegistrationEnabled bool // 是否开启注册
 	InviteCodeRequired  bool // 是否需要邀请码
@@ -213,8 +262,13 @@ func (c *Config) loadRedisConfig() error {
 // loadStorageConfig 加载存储配置
 func (c *Config) loadStorageConfig() error {
 	c.Storage = StorageConfig{
-		Type:      getEnvOrDefault("STORAGE_TYPE", "local"),
-		LocalPath: getEnvOrDefault("STORAGE_PATH", "/data/storage"),
+		Type:        getEnvOrDefault("STORAGE_TYPE", "local"),
+		MigrateFrom: getEnvOrDefault("STORAGE_MIGRATE_FROM", ""),
+		LocalPath:   getEnvOrDefault("STORAGE_PATH", "/data/storage"),
+		TempPath:    getEnvOrDefault("STORAGE_TEMP_PATH", ""),
+		UploadPath:  getEnvOrDefault("STORAGE_UPLOAD_PATH", "./tmp/uploads"),
+		TusPath:     getEnvOrDefault("STORAGE_TUS_PATH", "./tmp/tus_uploads"),
+		TusLocker:   getEnvOrDefault("STORAGE_TUS_LOCKER", "redis"),
 
 		// S3 配置
 		S3Endpoint:  getEnvOrDefault("S3_ENDPOINT", ""),
@@ -223,26 +277,75 @@ func (c *Config) loadStorageConfig() error {
 		S3AccessKey: getEnvOrDefault("S3_ACCESS_KEY", ""),
 		S3SecretKey: getEnvOrDefault("S3_SECRET_KEY", ""),
 		S3UseSSL:    getEnvAsBool("S3_USE_SSL", true),
+		S3PathStyle: getEnvAsBool("S3_FORCE_PATH_STYLE", false),
+		S3PartSize:  getEnvAsInt64("S3_PART_SIZE", 16*1024*1024), // 16MB
 	}
 	return nil
 }
 
 // loadCryptoConfig 加载加密配置
 func (c *Config) loadCryptoConfig() error {
-	masterKeyHex := os.Getenv("APP_MASTER_KEY")
-	if masterKeyHex == "" {
-		return fmt.Errorf("APP_MASTER_KEY is required")
+	cryptoCfg := CryptoConfig{
+		KeyProvider: getEnvOrDefault("APP_KEY_PROVIDER", "env"),
 	}
 
-	// 解码 HEX 字符串
-	masterKey, err := hex.DecodeString(masterKeyHex)
-	if err != nil {
-		return fmt.Errorf("invalid APP_MASTER_KEY format (must be 64-char HEX): %w", err)
+	defaultKeyID := "default"
+	switch cryptoCfg.KeyProvider {
+	case "env":
+		masterKeyHex := os.Getenv("APP_MASTER_KEY")
+		if masterKeyHex == "" {
+			return fmt.Errorf("APP_MASTER_KEY is required")
+		}
+
+		// 解码 HEX 字符串
+		masterKey, err := hex.DecodeString(masterKeyHex)
+		if err != nil {
+			return fmt.Errorf("invalid APP_MASTER_KEY format (must be 64-char HEX): %w", err)
+		}
+
+		if len(masterKey) != 32 {
+			return fmt.Errorf("APP_MASTER_KEY must be 32 bytes (64 hex chars), got %d bytes", len(masterKey))
+		}
+		cryptoCfg.MasterKey = masterKey
+
+	case "file":
+		cryptoCfg.MasterKeyFile = os.Getenv("APP_MASTER_KEY_FILE")
+		if cryptoCfg.MasterKeyFile == "" {
+			return fmt.Errorf("APP_MASTER_KEY_FILE is required when APP_KEY_PROVIDER=file")
+		}
+
+	case "vault":
+		token, err := getEnvOrFile("VAULT_TOKEN")
+		if err != nil {
+			return err
+		}
+		cryptoCfg.Vault = VaultConfig{
+			Address:   os.Getenv("VAULT_ADDR"),
+			Token:     token,
+			Namespace: os.Getenv("VAULT_NAMESPACE"),
+			Mount:     getEnvOrDefault("VAULT_TRANSIT_MOUNT", "transit"),
+			KeyName:   getEnvOrDefault("VAULT_TRANSIT_KEY", "ahavault"),
+			Timeout:   getEnvAsDuration("VAULT_TIMEOUT", 10*time.Second),
+		}
+		if cryptoCfg.Vault.Address == "" || cryptoCfg.Vault.Token == "" {
+			return fmt.Errorf("VAULT_ADDR and VAULT_TOKEN (or VAULT_TOKEN_FILE) are required when APP_KEY_PROVIDER=vault")
+		}
+		defaultKeyID = "vault:" + cryptoCfg.Vault.KeyName
+
+	default:
+		return fmt.Errorf("APP_KEY_PROVIDER must be 'env', 'file' or 'vault', got: %s", cryptoCfg.KeyProvider)
 	}
 
-	if len(masterKey) != 32 {
-		return fmt.Errorf("APP_MASTER_KEY must be 32 bytes (64 hex chars), got %d bytes", len(masterKey))
+	// 读取密钥 ID 和已退役的 KEK（用于密钥轮换）
+	cryptoCfg.MasterKeyID = getEnvOrDefault("APP_MASTER_KEY_ID", defaultKeyID)
+	retiredKeys, err := parseRetiredKeys(os.Getenv("APP_RETIRED_MASTER_KEYS"))
+	if err != nil {
+		return err
+	}
+	if _, exists := retiredKeys[cryptoCfg.MasterKeyID]; exists {
+		return fmt.Errorf("APP_RETIRED_MASTER_KEYS must not contain the active key id %q", cryptoCfg.MasterKeyID)
 	}
+	cryptoCfg.RetiredKeys = retiredKeys
 
 	// 读取 JWT Secret
 	jwtSecret := os.Getenv("JWT_SECRET")
@@ -250,13 +353,38 @@ func (c *Config) loadCryptoConfig() error {
 		jwtSecret = "default-jwt-secret-please-change-in-production"
 	}
 
-	c.Crypto = CryptoConfig{
-		MasterKey: masterKey,
-		JWTSecret: jwtSecret,
-	}
+	cryptoCfg.JWTSecret = jwtSecret
+	c.Crypto = cryptoCfg
 	return nil
 }
 
+// parseRetiredKeys 解析已退役的 KEK 列表
+//
+// 格式: "id1:hex1,id2:hex2"，每个密钥为 64 位 HEX 字符串
+func parseRetiredKeys(value string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range parseCommaSeparated(value) {
+		id, keyHex, ok := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid APP_RETIRED_MASTER_KEYS entry (must be id:hex): %q", entry)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate key id in APP_RETIRED_MASTER_KEYS: %q", id)
+		}
+
+		key, err := hex.DecodeString(strings.TrimSpace(keyHex))
+		if err != nil {
+			return nil, fmt.Errorf("invalid APP_RETIRED_MASTER_KEYS key %q (must be 64-char HEX): %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("APP_RETIRED_MASTER_KEYS key %q must be 32 bytes (64 hex chars), got %d bytes", id, len(key))
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
 // loadServerConfig 加载服务器配置
 func (c *Config) loadServerConfig() error {
 	c.Server = ServerConfig{
@@ -282,20 +410,45 @@ func (c *Config) loadBusinessConfig() error {
 
 		// 分享相关
 		ShareCodeLength:     getEnvAsInt("SHARE_CODE_LENGTH", 8),
+		ShareCodeFormat:     getEnvOrDefault("SHARE_CODE_FORMAT", "random"),
+		ShareCodeWords:      getEnvAsInt("SHARE_CODE_WORDS", 3),
+		VanityCodesEnabled:  getEnvAsBool("SHARE_VANITY_CODES", true),
+		ShareCodeBlocklist:  parseCommaSeparated(getEnvOrDefault("SHARE_CODE_BLOCKLIST", "")),
 		DefaultShareExpiry:  getEnvAsDuration("DEFAULT_SHARE_EXPIRY", 24*time.Hour),
 		MaxShareExpiry:      getEnvAsDuration("MAX_SHARE_EXPIRY", 7*24*time.Hour),
 		MaxFilesPerShare:    getEnvAsInt("MAX_FILES_PER_SHARE", 100),
 		MaxActiveSharesUser: getEnvAsInt("MAX_ACTIVE_SHARES_USER", 50),
 
+		// 下载统计
+		DownloadCountThreshold: getEnvAsInt64("DOWNLOAD_COUNT_THRESHOLD", 0),
+		DownloadTicketTTL:      getEnvAsDuration("DOWNLOAD_TICKET_TTL", 10*time.Minute),
+
+		// 防暴力破解
+		BruteForceMaxFailures:     getEnvAsInt("BRUTE_FORCE_MAX_FAILURES", 10),
+		BruteForceCodeMaxFailures: getEnvAsInt("BRUTE_FORCE_CODE_MAX_FAILURES", 20),
+		BruteForceWindow:          getEnvAsDuration("BRUTE_FORCE_WINDOW", 15*time.Minute),
+		BruteForceLockout:         getEnvAsDuration("BRUTE_FORCE_LOCKOUT", 1*time.Minute),
+		BruteForceMaxLockout:      getEnvAsDuration("BRUTE_FORCE_MAX_LOCKOUT", 24*time.Hour),
+		BruteForceAlertLevel:      getEnvAsInt("BRUTE_FORCE_ALERT_LEVEL", 3),
+
 		// 垃圾回收
 		GCRetentionDays:     getEnvAsInt("GC_RETENTION_DAYS", 7),
 		GCCleanupInterval:   getEnvAsDuration("GC_CLEANUP_INTERVAL", 1*time.Hour),
 		GCFragmentRetention: getEnvAsDuration("GC_FRAGMENT_RETENTION", 24*time.Hour),
+		ScrubSchedule:       getEnvOrDefault("SCRUB_SCHEDULE", "0 4 * * 0"),
+		ScrubRateLimit:      getEnvAsInt64("SCRUB_RATE_LIMIT", 20*1024*1024),
+		ScrubQuarantine:     getEnvAsBool("SCRUB_QUARANTINE", false),
+		ScrubOrphanGrace:    getEnvAsDuration("SCRUB_ORPHAN_GRACE", 1*time.Hour),
 
 		// 注册控制
 		RegistrationEnabled: getEnvAsBool("REGISTRATION_ENABLED", true),
 		InviteCodeRequired:  getEnvAsBool("INVITE_CODE_REQUIRED", false),
 	}
+
+	// SCRUB_SCHEDULE=off 关闭定时巡检（仍可由管理员手动触发）
+	if c.Business.ScrubSchedule == "off" {
+		c.Business.ScrubSchedule = ""
+	}
 	return nil
 }
 
@@ -311,14 +464,30 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("STORAGE_TYPE must be 'local' or 's3', got: %s", c.Storage.Type)
 	}
 
-	if c.Storage.Type == "s3" {
+	if c.Storage.MigrateFrom != "" {
+		if c.Storage.MigrateFrom != "local" && c.Storage.MigrateFrom != "s3" {
+			return fmt.Errorf("STORAGE_MIGRATE_FROM must be 'local' or 's3', got: %s", c.Storage.MigrateFrom)
+		}
+		if c.Storage.MigrateFrom == c.Storage.Type {
+			return fmt.Errorf("STORAGE_MIGRATE_FROM must differ from STORAGE_TYPE")
+		}
+	}
+
+	if c.Storage.TusLocker != "redis" && c.Storage.TusLocker != "memory" {
+		return fmt.Errorf("STORAGE_TUS_LOCKER must be 'redis' or 'memory', got: %s", c.Storage.TusLocker)
+	}
+
+	if c.Storage.Type == "s3" || c.Storage.MigrateFrom == "s3" {
 		if c.Storage.S3AccessKey == "" || c.Storage.S3SecretKey == "" {
 			return fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY are required for S3 storage")
 		}
+		if c.Storage.S3PartSize < 5*1024*1024 {
+			return fmt.Errorf("S3_PART_SIZE must be at least 5MB, got: %d", c.Storage.S3PartSize)
+		}
 	}
 
 	// 验证加密配置
-	if len(c.Crypto.MasterKey) != 32 {
+	if c.Crypto.KeyProvider == "env" && len(c.Crypto.MasterKey) != 32 {
 		return fmt.Errorf("master key must be 32 bytes")
 	}
 
@@ -327,6 +496,43 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("SHARE_CODE_LENGTH must be between 6 and 12, got: %d", c.Business.ShareCodeLength)
 	}
 
+	if c.Business.ShareCodeFormat != "random" && c.Business.ShareCodeFormat != "words" {
+		return fmt.Errorf("SHARE_CODE_FORMAT must be 'random' or 'words', got: %s", c.Business.ShareCodeFormat)
+	}
+
+	// 词表只有数百个单词，2 个单词加两位数字不足千万种组合，可被穷举
+	if c.Business.ShareCodeWords < 3 || c.Business.ShareCodeWords > 4 {
+		return fmt.Errorf("SHARE_CODE_WORDS must be between 3 and 4, got: %d", c.Business.ShareCodeWords)
+	}
+
+	if c.Business.DefaultShareExpiry <= 0 || c.Business.MaxShareExpiry < 0 {
+		return fmt.Errorf("DEFAULT_SHARE_EXPIRY must be positive and MAX_SHARE_EXPIRY must not be negative")
+	}
+
+	if c.Business.MaxShareExpiry > 0 && c.Business.DefaultShareExpiry > c.Business.MaxShareExpiry {
+		return fmt.Errorf("DEFAULT_SHARE_EXPIRY (%s) must not exceed MAX_SHARE_EXPIRY (%s)", c.Business.DefaultShareExpiry, c.Business.MaxShareExpiry)
+	}
+
+	if c.Business.MaxFilesPerShare < 0 || c.Business.MaxActiveSharesUser < 0 {
+		return fmt.Errorf("MAX_FILES_PER_SHARE and MAX_ACTIVE_SHARES_USER must not be negative")
+	}
+
+	if c.Business.DownloadCountThreshold < 0 {
+		return fmt.Errorf("DOWNLOAD_COUNT_THRESHOLD must not be negative, got: %d", c.Business.DownloadCountThreshold)
+	}
+
+	if c.Business.DownloadTicketTTL <= 0 {
+		return fmt.Errorf("DOWNLOAD_TICKET_TTL must be positive, got: %s", c.Business.DownloadTicketTTL)
+	}
+
+	if c.Business.BruteForceMaxFailures <= 0 || c.Business.BruteForceCodeMaxFailures <= 0 || c.Business.BruteForceWindow <= 0 {
+		return fmt.Errorf("BRUTE_FORCE_MAX_FAILURES, BRUTE_FORCE_CODE_MAX_FAILURES and BRUTE_FORCE_WINDOW must be positive")
+	}
+
+	if c.Business.BruteForceLockout <= 0 || c.Business.BruteForceMaxLockout < c.Business.BruteForceLockout {
+		return fmt.Errorf("BRUTE_FORCE_LOCKOUT must be positive and not exceed BRUTE_FORCE_MAX_LOCKOUT")
+	}
+
 	return nil
 }
 
@@ -365,6 +571,24 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvOrFile 读取环境变量，未设置时从 <key>_FILE 指定的文件读取
+//
+// 用于通过 Docker/Kubernetes Secrets 挂载敏感配置，避免其出现在进程环境变量中。
+func getEnvOrFile(key string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", key, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // getEnvAsInt 获取环境变量作为整数
 func getEnvAsInt(key string, defaultValue int) int {
 	valueStr := os.Getenv(key)
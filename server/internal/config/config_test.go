@@ -84,6 +84,122 @@ func TestValidate(t *testing.T) {
 			wantError: true,
 			errorMsg:  "STORAGE_TYPE must be 'local' or 's3'",
 		},
+		{
+			name: "Migrate from same storage type",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("STORAGE_TYPE", "local")
+				os.Setenv("STORAGE_MIGRATE_FROM", "local")
+			},
+			wantError: true,
+			errorMsg:  "STORAGE_MIGRATE_FROM must differ from STORAGE_TYPE",
+		},
+		{
+			name: "Migrate from S3 without credentials",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("STORAGE_TYPE", "local")
+				os.Setenv("STORAGE_MIGRATE_FROM", "s3")
+			},
+			wantError: true,
+			errorMsg:  "S3_ACCESS_KEY and S3_SECRET_KEY are required",
+		},
+		{
+			name: "Invalid tus locker",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("STORAGE_TUS_LOCKER", "file")
+			},
+			wantError: true,
+			errorMsg:  "STORAGE_TUS_LOCKER must be 'redis' or 'memory'",
+		},
+		{
+			name: "Invalid share code format",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("SHARE_CODE_FORMAT", "emoji")
+			},
+			wantError: true,
+			errorMsg:  "SHARE_CODE_FORMAT must be 'random' or 'words'",
+		},
+		{
+			name: "Too many share code words",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("SHARE_CODE_FORMAT", "words")
+				os.Setenv("SHARE_CODE_WORDS", "5")
+			},
+			wantError: true,
+			errorMsg:  "SHARE_CODE_WORDS must be between 3 and 4",
+		},
+		{
+			name: "Too few share code words",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("SHARE_CODE_FORMAT", "words")
+				os.Setenv("SHARE_CODE_WORDS", "2")
+			},
+			wantError: true,
+			errorMsg:  "SHARE_CODE_WORDS must be between 3 and 4",
+		},
+		{
+			name: "Default share expiry exceeds max share expiry",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("DEFAULT_SHARE_EXPIRY", "48h")
+				os.Setenv("MAX_SHARE_EXPIRY", "24h")
+			},
+			wantError: true,
+			errorMsg:  "DEFAULT_SHARE_EXPIRY (48h0m0s) must not exceed MAX_SHARE_EXPIRY (24h0m0s)",
+		},
+		{
+			name: "Negative max files per share",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("MAX_FILES_PER_SHARE", "-1")
+			},
+			wantError: true,
+			errorMsg:  "MAX_FILES_PER_SHARE and MAX_ACTIVE_SHARES_USER must not be negative",
+		},
+		{
+			name: "Negative download count threshold",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("DOWNLOAD_COUNT_THRESHOLD", "-1")
+			},
+			wantError: true,
+			errorMsg:  "DOWNLOAD_COUNT_THRESHOLD must not be negative",
+		},
+		{
+			name: "Invalid download ticket TTL",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("DOWNLOAD_TICKET_TTL", "0s")
+			},
+			wantError: true,
+			errorMsg:  "DOWNLOAD_TICKET_TTL must be positive",
+		},
+		{
+			name: "Brute force lockout exceeds max lockout",
+			setupEnv: func() {
+				os.Setenv("APP_MASTER_KEY", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+				os.Setenv("POSTGRES_PASSWORD", "password")
+				os.Setenv("BRUTE_FORCE_LOCKOUT", "2h")
+				os.Setenv("BRUTE_FORCE_MAX_LOCKOUT", "1h")
+			},
+			wantError: true,
+			errorMsg:  "BRUTE_FORCE_LOCKOUT must be positive and not exceed BRUTE_FORCE_MAX_LOCKOUT",
+		},
 	}
 
 	for _, tt := range tests {
@@ -193,3 +309,117 @@ func TestGetEnvHelpers(t *testing.T) {
 		t.Errorf("parseCommaSeparated() length = %d, want %d", len(result), len(expected))
 	}
 }
+
+func TestParseRetiredKeys(t *testing.T) {
+	const key1 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	const key2 = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+	keys, err := parseRetiredKeys("v1:" + key1 + ", v2:" + key2)
+	if err != nil {
+		t.Fatalf("parseRetiredKeys() error = %v", err)
+	}
+	if len(keys) != 2 || len(keys["v1"]) != 32 || len(keys["v2"]) != 32 {
+		t.Errorf("parseRetiredKeys() = %v, want 2 keys of 32 bytes", keys)
+	}
+
+	if keys, err := parseRetiredKeys(""); err != nil || len(keys) != 0 {
+		t.Errorf("parseRetiredKeys(\"\") = %v, %v; want empty", keys, err)
+	}
+
+	invalid := []string{
+		key1,                         // 缺少 ID
+		"v1:zz",                      // 非 HEX
+		"v1:0123",                    // 长度错误
+		"v1:" + key1 + ",v1:" + key2, // 重复 ID
+		":" + key1,                   // 空 ID
+	}
+	for _, value := range invalid {
+		if _, err := parseRetiredKeys(value); err == nil {
+			t.Errorf("parseRetiredKeys(%q) should fail", value)
+		}
+	}
+}
+
+func TestLoadKeyProvider(t *testing.T) {
+	tokenFile := t.TempDir() + "/vault-token"
+	if err := os.WriteFile(tokenFile, []byte("s.file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantError bool
+		check     func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "file provider",
+			env:  map[string]string{"APP_KEY_PROVIDER": "file", "APP_MASTER_KEY_FILE": "/run/secrets/kek"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Crypto.MasterKeyFile != "/run/secrets/kek" || cfg.Crypto.MasterKeyID != "default" {
+					t.Errorf("unexpected crypto config: %+v", cfg.Crypto)
+				}
+			},
+		},
+		{
+			name:      "file provider without path",
+			env:       map[string]string{"APP_KEY_PROVIDER": "file"},
+			wantError: true,
+		},
+		{
+			name: "vault provider with token file",
+			env: map[string]string{
+				"APP_KEY_PROVIDER":  "vault",
+				"VAULT_ADDR":        "http://127.0.0.1:8200",
+				"VAULT_TOKEN_FILE":  tokenFile,
+				"VAULT_TRANSIT_KEY": "files",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Crypto.Vault.Token != "s.file-token" {
+					t.Errorf("Vault.Token = %q, want s.file-token", cfg.Crypto.Vault.Token)
+				}
+				if cfg.Crypto.Vault.Mount != "transit" {
+					t.Errorf("Vault.Mount = %q, want transit", cfg.Crypto.Vault.Mount)
+				}
+				if cfg.Crypto.MasterKeyID != "vault:files" {
+					t.Errorf("MasterKeyID = %q, want vault:files", cfg.Crypto.MasterKeyID)
+				}
+				if len(cfg.Crypto.MasterKey) != 0 {
+					t.Error("MasterKey should be empty for vault provider")
+				}
+			},
+		},
+		{
+			name:      "vault provider without token",
+			env:       map[string]string{"APP_KEY_PROVIDER": "vault", "VAULT_ADDR": "http://127.0.0.1:8200"},
+			wantError: true,
+		},
+		{
+			name:      "unknown provider",
+			env:       map[string]string{"APP_KEY_PROVIDER": "kms"},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			os.Setenv("POSTGRES_PASSWORD", "password")
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
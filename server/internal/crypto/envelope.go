@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -114,37 +115,41 @@ func DecryptDEKFromBase64(encryptedDEKBase64 string, kek []byte) ([]byte, error)
 }
 
 // EncryptFile 使用 DEK 加密文件内容
-// 返回格式: [Nonce(12) + Ciphertext(N) + AuthTag(16)]
+// 返回分段 AEAD 格式（见 stream.go），适合可一次性放入内存的小数据
 func EncryptFile(plaintext []byte, dek []byte) ([]byte, error) {
-	if len(dek) != 32 {
-		return nil, fmt.Errorf("DEK must be 32 bytes, got %d bytes", len(dek))
-	}
+	var buf bytes.Buffer
+	buf.Grow(SegmentedHeaderSize + len(plaintext) + (len(plaintext)/DefaultSegmentSize+1)*segmentTagSize)
 
-	block, err := aes.NewCipher(dek)
+	w, err := NewEncryptWriter(&buf, dek)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, err
 	}
-
-	aead, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt file: %w", err)
 	}
-
-	nonce := make([]byte, aead.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt file: %w", err)
 	}
 
-	ciphertext := aead.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+	return buf.Bytes(), nil
 }
 
 // DecryptFile 使用 DEK 解密文件内容
+// 根据格式头部自动识别分段格式和旧版整文件格式
 func DecryptFile(ciphertext []byte, dek []byte) ([]byte, error) {
 	if len(dek) != 32 {
 		return nil, fmt.Errorf("DEK must be 32 bytes, got %d bytes", len(dek))
 	}
 
+	if DetectFormat(ciphertext) == FormatSegmented {
+		return decryptSegmented(ciphertext, dek)
+	}
+	return decryptLegacy(ciphertext, dek)
+}
+
+// decryptLegacy 解密旧版整文件格式
+// 格式: [Nonce(12) + Ciphertext(N) + AuthTag(16)]
+func decryptLegacy(ciphertext []byte, dek []byte) ([]byte, error) {
 	block, err := aes.NewCipher(dek)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
@@ -172,33 +177,17 @@ func DecryptFile(ciphertext []byte, dek []byte) ([]byte, error) {
 }
 
 // EncryptStream 使用 DEK 加密数据流（用于大文件）
+// 输出分段 AEAD 格式，内存占用与数据大小无关
 func EncryptStream(reader io.Reader, writer io.Writer, dek []byte) error {
-	if len(dek) != 32 {
-		return fmt.Errorf("DEK must be 32 bytes, got %d bytes", len(dek))
-	}
-
-	block, err := aes.NewCipher(dek)
+	w, err := NewEncryptWriter(writer, dek)
 	if err != nil {
-		return fmt.Errorf("failed to create AES cipher: %w", err)
+		return err
 	}
 
-	// 生成 IV (16 bytes for CTR mode)
-	iv := make([]byte, aes.BlockSize)
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return fmt.Errorf("failed to generate IV: %w", err)
-	}
-
-	// 先写入 IV
-	if _, err := writer.Write(iv); err != nil {
-		return fmt.Errorf("failed to write IV: %w", err)
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to encrypt stream: %w", err)
 	}
-
-	// 使用 CTR 模式进行流式加密
-	stream := cipher.NewCTR(block, iv)
-	streamWriter := &cipher.StreamWriter{S: stream, W: writer}
-
-	// 复制并加密数据
-	if _, err := io.Copy(streamWriter, reader); err != nil {
+	if err := w.Close(); err != nil {
 		return fmt.Errorf("failed to encrypt stream: %w", err)
 	}
 
@@ -206,28 +195,14 @@ func EncryptStream(reader io.Reader, writer io.Writer, dek []byte) error {
 }
 
 // DecryptStream 使用 DEK 解密数据流（用于大文件）
+// 兼容所有格式版本；认证失败时返回错误，此前已写出的明文均已通过认证
 func DecryptStream(reader io.Reader, writer io.Writer, dek []byte) error {
-	if len(dek) != 32 {
-		return fmt.Errorf("DEK must be 32 bytes, got %d bytes", len(dek))
-	}
-
-	block, err := aes.NewCipher(dek)
+	r, err := NewDecryptStreamReader(reader, dek)
 	if err != nil {
-		return fmt.Errorf("failed to create AES cipher: %w", err)
-	}
-
-	// 读取 IV (16 bytes for CTR mode)
-	iv := make([]byte, aes.BlockSize)
-	if _, err := io.ReadFull(reader, iv); err != nil {
-		return fmt.Errorf("failed to read IV: %w", err)
+		return err
 	}
 
-	// 使用 CTR 模式解密
-	stream := cipher.NewCTR(block, iv)
-	streamReader := &cipher.StreamReader{S: stream, R: reader}
-
-	// 复制并解密数据
-	if _, err := io.Copy(writer, streamReader); err != nil {
+	if _, err := io.Copy(writer, r); err != nil {
 		return fmt.Errorf("failed to decrypt stream: %w", err)
 	}
 
@@ -0,0 +1,165 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DefaultKeyID 未显式指定 ID 的主密钥使用的密钥 ID
+//
+// 引入密钥环之前创建的 blob 都使用该 ID 对应的 KEK 加密。
+const DefaultKeyID = "default"
+
+// ErrUnknownKeyID 密钥环中不存在指定 ID 的 KEK
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// Keyring KEK 密钥环
+//
+// 密钥环中有且仅有一个主密钥（Primary），新的 DEK 总是使用主密钥加密；
+// 其余为已退役的旧密钥，只用于解密尚未重新加密的历史 DEK。
+// 每个 blob 记录加密其 DEK 的密钥 ID，当没有 blob 引用某个旧密钥时即可将其移除。
+type Keyring struct {
+	primary   string
+	providers map[string]KeyProvider
+}
+
+// NewKeyring 使用本地 KEK 创建密钥环
+//
+// primaryID 必须存在于 keys 中；所有 KEK 必须为 32 字节。
+func NewKeyring(primaryID string, keys map[string][]byte) (*Keyring, error) {
+	if primaryID == "" {
+		return nil, errors.New("primary key id is required")
+	}
+	if _, ok := keys[primaryID]; !ok {
+		return nil, fmt.Errorf("primary key %q not found in keyring", primaryID)
+	}
+
+	var primary KeyProvider
+	retired := make([]KeyProvider, 0, len(keys))
+	for id, kek := range keys {
+		provider, err := NewLocalKeyProvider(id, kek)
+		if err != nil {
+			return nil, err
+		}
+		if id == primaryID {
+			primary = provider
+		} else {
+			retired = append(retired, provider)
+		}
+	}
+
+	return NewProviderKeyring(primary, retired...)
+}
+
+// NewProviderKeyring 使用密钥提供者创建密钥环
+//
+// primary 用于加密新的 DEK，retired 仅用于解密；所有提供者的 KeyID 不能重复。
+func NewProviderKeyring(primary KeyProvider, retired ...KeyProvider) (*Keyring, error) {
+	if primary == nil {
+		return nil, errors.New("primary key provider is required")
+	}
+
+	kr := &Keyring{
+		primary:   primary.KeyID(),
+		providers: make(map[string]KeyProvider, len(retired)+1),
+	}
+	for _, provider := range append([]KeyProvider{primary}, retired...) {
+		id := provider.KeyID()
+		if id == "" {
+			return nil, errors.New("key id must not be empty")
+		}
+		if _, exists := kr.providers[id]; exists {
+			return nil, fmt.Errorf("duplicate key id in keyring: %q", id)
+		}
+		kr.providers[id] = provider
+	}
+
+	return kr, nil
+}
+
+// NewSingleKeyring 使用单个 KEK 创建密钥环（ID 为 DefaultKeyID）
+//
+// 不校验 KEK 长度，长度错误会在首次加解密时返回。
+func NewSingleKeyring(kek []byte) *Keyring {
+	return &Keyring{
+		primary: DefaultKeyID,
+		providers: map[string]KeyProvider{
+			DefaultKeyID: &LocalKeyProvider{id: DefaultKeyID, kek: append([]byte(nil), kek...)},
+		},
+	}
+}
+
+// PrimaryID 返回主密钥 ID
+func (k *Keyring) PrimaryID() string {
+	return k.primary
+}
+
+// IDs 返回所有密钥 ID（按字典序）
+func (k *Keyring) IDs() []string {
+	ids := make([]string, 0, len(k.providers))
+	for id := range k.providers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// RetiredIDs 返回除主密钥外的所有密钥 ID（按字典序）
+func (k *Keyring) RetiredIDs() []string {
+	ids := make([]string, 0, len(k.providers))
+	for _, id := range k.IDs() {
+		if id != k.primary {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Has 检查密钥环中是否存在指定 ID
+func (k *Keyring) Has(keyID string) bool {
+	_, ok := k.providers[normalizeKeyID(keyID)]
+	return ok
+}
+
+// WrapDEK 使用主密钥加密 DEK，返回密钥 ID 和密文
+func (k *Keyring) WrapDEK(dek []byte) (string, string, error) {
+	encrypted, err := k.providers[k.primary].Wrap(dek)
+	if err != nil {
+		return "", "", err
+	}
+	return k.primary, encrypted, nil
+}
+
+// UnwrapDEK 使用指定 ID 的密钥解密 DEK
+//
+// keyID 为空时视为 DefaultKeyID（兼容引入密钥环之前的数据）。
+func (k *Keyring) UnwrapDEK(keyID string, encryptedDEK string) ([]byte, error) {
+	keyID = normalizeKeyID(keyID)
+	provider, ok := k.providers[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+	return provider.Unwrap(encryptedDEK)
+}
+
+// RewrapDEK 将旧密钥加密的 DEK 改用主密钥加密
+//
+// 返回新的密钥 ID 和密文；DEK 明文只在内存中短暂存在。
+func (k *Keyring) RewrapDEK(keyID string, encryptedDEK string) (string, string, error) {
+	dek, err := k.UnwrapDEK(keyID, encryptedDEK)
+	if err != nil {
+		return "", "", err
+	}
+	defer ZeroBytes(dek)
+
+	return k.WrapDEK(dek)
+}
+
+// normalizeKeyID 将空 ID 视为 DefaultKeyID
+func normalizeKeyID(keyID string) string {
+	if keyID == "" {
+		return DefaultKeyID
+	}
+	return keyID
+}
@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func newTestKEK() []byte {
+	kek := make([]byte, 32)
+	rand.Read(kek)
+	return kek
+}
+
+// TestNewKeyring 测试密钥环创建参数校验
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		keys    map[string][]byte
+		wantErr bool
+	}{
+		{"单个密钥", "v1", map[string][]byte{"v1": newTestKEK()}, false},
+		{"多个密钥", "v2", map[string][]byte{"v1": newTestKEK(), "v2": newTestKEK()}, false},
+		{"主密钥不存在", "v3", map[string][]byte{"v1": newTestKEK()}, true},
+		{"主密钥 ID 为空", "", map[string][]byte{"v1": newTestKEK()}, true},
+		{"密钥长度错误", "v1", map[string][]byte{"v1": make([]byte, 16)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.primary, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestKeyringRotation 测试使用旧密钥解密并改用主密钥重新加密
+func TestKeyringRotation(t *testing.T) {
+	oldKEK, newKEK := newTestKEK(), newTestKEK()
+	dek, _ := GenerateDEK()
+
+	// 轮换前：只有旧密钥
+	oldRing := NewSingleKeyring(oldKEK)
+	keyID, wrapped, err := oldRing.WrapDEK(dek)
+	if err != nil {
+		t.Fatalf("WrapDEK() error = %v", err)
+	}
+	if keyID != DefaultKeyID {
+		t.Errorf("WrapDEK() key id = %q, want %q", keyID, DefaultKeyID)
+	}
+
+	// 轮换后：新密钥为主密钥，旧密钥保留用于解密
+	ring, err := NewKeyring("v2", map[string][]byte{DefaultKeyID: oldKEK, "v2": newKEK})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if got := ring.RetiredIDs(); len(got) != 1 || got[0] != DefaultKeyID {
+		t.Errorf("RetiredIDs() = %v, want [%s]", got, DefaultKeyID)
+	}
+
+	// 空 ID 视为默认密钥
+	unwrapped, err := ring.UnwrapDEK("", wrapped)
+	if err != nil {
+		t.Fatalf("UnwrapDEK() error = %v", err)
+	}
+	if !bytes.Equal(dek, unwrapped) {
+		t.Error("UnwrapDEK() result != original DEK")
+	}
+
+	newID, rewrapped, err := ring.RewrapDEK(keyID, wrapped)
+	if err != nil {
+		t.Fatalf("RewrapDEK() error = %v", err)
+	}
+	if newID != "v2" {
+		t.Errorf("RewrapDEK() key id = %q, want v2", newID)
+	}
+
+	// 重新加密后只依赖新密钥
+	newRing, _ := NewKeyring("v2", map[string][]byte{"v2": newKEK})
+	unwrapped, err = newRing.UnwrapDEK(newID, rewrapped)
+	if err != nil {
+		t.Fatalf("UnwrapDEK() after rewrap error = %v", err)
+	}
+	if !bytes.Equal(dek, unwrapped) {
+		t.Error("UnwrapDEK() after rewrap result != original DEK")
+	}
+
+	// 旧密钥移除后无法解密旧密文
+	if _, err := newRing.UnwrapDEK(keyID, wrapped); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("UnwrapDEK() error = %v, want ErrUnknownKeyID", err)
+	}
+}
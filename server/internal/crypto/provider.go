@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider KEK 提供者
+//
+// 负责用 KEK 加密（Wrap）和解密（Unwrap）DEK。KEK 本身可以在进程内存中
+// （LocalKeyProvider），也可以只存在于外部 KMS 中（VaultTransitProvider），
+// 后者使 Master Key 永远不会出现在应用进程的环境变量或内存里。
+type KeyProvider interface {
+	// KeyID 返回记录在 file_blobs.key_id 中的密钥 ID
+	KeyID() string
+	// Wrap 加密 DEK，返回可直接存入数据库的字符串
+	Wrap(dek []byte) (string, error)
+	// Unwrap 解密 Wrap 返回的字符串
+	Unwrap(encryptedDEK string) ([]byte, error)
+}
+
+// LocalKeyProvider 使用本地 KEK 的密钥提供者（AES-256-GCM）
+type LocalKeyProvider struct {
+	id  string
+	kek []byte
+}
+
+// NewLocalKeyProvider 创建本地密钥提供者
+//
+// kek 必须为 32 字节。
+func NewLocalKeyProvider(id string, kek []byte) (*LocalKeyProvider, error) {
+	if id == "" {
+		return nil, errors.New("key id must not be empty")
+	}
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("KEK %q must be 32 bytes, got %d bytes", id, len(kek))
+	}
+	return &LocalKeyProvider{id: id, kek: append([]byte(nil), kek...)}, nil
+}
+
+// LoadLocalKeyFile 从密钥文件创建本地密钥提供者
+//
+// 文件内容为 64 位 HEX 字符串（允许首尾空白），或 32 字节原始密钥。
+// 密钥文件应仅对服务进程可读（如 0400），适合配合 Docker/Kubernetes Secrets 挂载使用。
+func LoadLocalKeyFile(id string, path string) (*LocalKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	defer ZeroBytes(data)
+
+	kek := data
+	if len(data) != 32 {
+		decoded, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key file %s (must be 64-char HEX or 32 raw bytes): %w", path, err)
+		}
+		defer ZeroBytes(decoded)
+		kek = decoded
+	}
+
+	return NewLocalKeyProvider(id, kek)
+}
+
+// KeyID 返回密钥 ID
+func (p *LocalKeyProvider) KeyID() string {
+	return p.id
+}
+
+// Wrap 使用 KEK 加密 DEK，返回 Base64 编码的密文
+func (p *LocalKeyProvider) Wrap(dek []byte) (string, error) {
+	return EncryptDEKToBase64(dek, p.kek)
+}
+
+// Unwrap 使用 KEK 解密 Base64 编码的 DEK
+func (p *LocalKeyProvider) Unwrap(encryptedDEK string) ([]byte, error) {
+	return DecryptDEKFromBase64(encryptedDEK, p.kek)
+}
+
+// CheckKeyProvider 通过加密再解密一个随机 DEK 检查密钥提供者是否可用
+//
+// 用于启动时尽早发现 KMS 地址、令牌或权限配置错误。
+func CheckKeyProvider(p KeyProvider) error {
+	dek, err := GenerateDEK()
+	if err != nil {
+		return err
+	}
+	defer ZeroBytes(dek)
+
+	wrapped, err := p.Wrap(dek)
+	if err != nil {
+		return err
+	}
+	unwrapped, err := p.Unwrap(wrapped)
+	if err != nil {
+		return err
+	}
+	defer ZeroBytes(unwrapped)
+
+	if !bytes.Equal(dek, unwrapped) {
+		return fmt.Errorf("key provider %q returned a different DEK", p.KeyID())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLocalKeyProvider 测试本地密钥提供者加解密
+func TestLocalKeyProvider(t *testing.T) {
+	kek := newTestKEK()
+	provider, err := NewLocalKeyProvider("local", kek)
+	if err != nil {
+		t.Fatalf("NewLocalKeyProvider() error = %v", err)
+	}
+	if provider.KeyID() != "local" {
+		t.Errorf("KeyID() = %q, want %q", provider.KeyID(), "local")
+	}
+
+	dek, _ := GenerateDEK()
+	wrapped, err := provider.Wrap(dek)
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+
+	// 与 EncryptDEKToBase64 格式兼容
+	legacy, err := DecryptDEKFromBase64(wrapped, kek)
+	if err != nil || !bytes.Equal(legacy, dek) {
+		t.Errorf("wrapped DEK is not compatible with DecryptDEKFromBase64")
+	}
+
+	unwrapped, err := provider.Unwrap(wrapped)
+	if err != nil {
+		t.Fatalf("Unwrap() error = %v", err)
+	}
+	if !bytes.Equal(unwrapped, dek) {
+		t.Error("Unwrap() returned a different DEK")
+	}
+
+	if _, err := NewLocalKeyProvider("short", make([]byte, 16)); err == nil {
+		t.Error("NewLocalKeyProvider() should reject 16-byte KEK")
+	}
+	if _, err := NewLocalKeyProvider("", kek); err == nil {
+		t.Error("NewLocalKeyProvider() should reject empty key id")
+	}
+}
+
+// TestLoadLocalKeyFile 测试从密钥文件加载 KEK
+func TestLoadLocalKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	kek := newTestKEK()
+
+	hexPath := filepath.Join(dir, "master.hex")
+	if err := os.WriteFile(hexPath, []byte(hex.EncodeToString(kek)+"\n"), 0400); err != nil {
+		t.Fatal(err)
+	}
+	rawPath := filepath.Join(dir, "master.key")
+	if err := os.WriteFile(rawPath, kek, 0400); err != nil {
+		t.Fatal(err)
+	}
+	badPath := filepath.Join(dir, "bad.key")
+	if err := os.WriteFile(badPath, []byte("not a key"), 0400); err != nil {
+		t.Fatal(err)
+	}
+
+	reference, _ := NewLocalKeyProvider("ref", kek)
+	dek, _ := GenerateDEK()
+	wrapped, _ := reference.Wrap(dek)
+
+	for _, path := range []string{hexPath, rawPath} {
+		provider, err := LoadLocalKeyFile("file", path)
+		if err != nil {
+			t.Fatalf("LoadLocalKeyFile(%s) error = %v", filepath.Base(path), err)
+		}
+		got, err := provider.Unwrap(wrapped)
+		if err != nil || !bytes.Equal(got, dek) {
+			t.Errorf("LoadLocalKeyFile(%s) loaded a different KEK", filepath.Base(path))
+		}
+	}
+
+	if _, err := LoadLocalKeyFile("file", badPath); err == nil {
+		t.Error("LoadLocalKeyFile() should reject invalid key file")
+	}
+	if _, err := LoadLocalKeyFile("file", filepath.Join(dir, "missing")); err == nil {
+		t.Error("LoadLocalKeyFile() should fail for missing file")
+	}
+}
+
+// TestNewProviderKeyring 测试使用提供者创建密钥环
+func TestNewProviderKeyring(t *testing.T) {
+	p1, _ := NewLocalKeyProvider("v1", newTestKEK())
+	p2, _ := NewLocalKeyProvider("v2", newTestKEK())
+	dup, _ := NewLocalKeyProvider("v1", newTestKEK())
+
+	kr, err := NewProviderKeyring(p2, p1)
+	if err != nil {
+		t.Fatalf("NewProviderKeyring() error = %v", err)
+	}
+	if kr.PrimaryID() != "v2" {
+		t.Errorf("PrimaryID() = %q, want v2", kr.PrimaryID())
+	}
+
+	if _, err := NewProviderKeyring(p1, dup); err == nil {
+		t.Error("NewProviderKeyring() should reject duplicate key ids")
+	}
+	if _, err := NewProviderKeyring(nil); err == nil {
+		t.Error("NewProviderKeyring() should reject nil primary")
+	}
+}
+
+// TestCheckKeyProvider 测试密钥提供者可用性检查
+func TestCheckKeyProvider(t *testing.T) {
+	provider, _ := NewLocalKeyProvider("v1", newTestKEK())
+	if err := CheckKeyProvider(provider); err != nil {
+		t.Errorf("CheckKeyProvider() error = %v", err)
+	}
+
+	broken := &LocalKeyProvider{id: "broken", kek: make([]byte, 8)}
+	if err := CheckKeyProvider(broken); err == nil {
+		t.Error("CheckKeyProvider() should fail for invalid KEK")
+	}
+}
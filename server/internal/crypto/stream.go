@@ -0,0 +1,555 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 分段 AEAD 格式
+//
+// 文件被切分为固定大小的明文分段，每个分段独立使用 AES-256-GCM 加密，
+// 加密与解密都只需在内存中保留一个分段，适合任意大小的文件，
+// 并且可以只读取覆盖目标区间的分段实现随机访问。
+//
+// 布局: [Header(16)] [Segment 0] [Segment 1] ... [Segment N-1]
+//
+//	Header  = Magic(4) "AHVS" + Version(1) + SegmentSize(4, 大端) + NoncePrefix(7)
+//	Segment = GCM(明文分段) = Ciphertext(<=SegmentSize) + AuthTag(16)
+//	Nonce   = NoncePrefix(7) + Counter(4, 大端) + LastFlag(1)
+//
+// 每个分段都以 Header 作为附加认证数据（AAD），分段序号和"最后分段"标记
+// 编码在 Nonce 中，因此分段被重排、删除或文件被截断都会导致认证失败。
+// 除空文件外，最后一个分段总是非空的。
+const (
+	// DefaultSegmentSize 默认明文分段大小
+	DefaultSegmentSize = 64 * 1024 // 64KB
+
+	// MaxSegmentSize 允许的最大明文分段大小（防止恶意头部导致超大内存分配）
+	MaxSegmentSize = 16 * 1024 * 1024 // 16MB
+
+	// SegmentedHeaderSize 分段格式头部长度
+	SegmentedHeaderSize = 16
+
+	segmentedMagic       = "AHVS"
+	segmentNoncePrefixSz = 7
+	segmentTagSize       = 16
+)
+
+// FormatVersion 加密文件格式版本
+type FormatVersion byte
+
+const (
+	// FormatLegacy 整文件格式: [Nonce(12)] [Ciphertext(N)] [AuthTag(16)]，无头部
+	FormatLegacy FormatVersion = 1
+
+	// FormatSegmented 分段 AEAD 格式（当前版本）
+	FormatSegmented FormatVersion = 2
+)
+
+var (
+	// ErrSegmentCounterOverflow 分段数量超出上限
+	ErrSegmentCounterOverflow = errors.New("segment counter overflow")
+
+	// ErrInvalidRange 请求的明文区间无效
+	ErrInvalidRange = errors.New("invalid plaintext range")
+)
+
+// DetectFormat 根据密文开头的字节判断格式版本
+//
+// prefix 至少需要 SegmentedHeaderSize 字节才能识别分段格式，
+// 无法识别的数据按旧版整文件格式处理。
+// 旧版格式以 12 字节随机 Nonce 开头，与魔数和版本号同时碰撞的概率为 2^-40，可以忽略。
+func DetectFormat(prefix []byte) FormatVersion {
+	if len(prefix) >= SegmentedHeaderSize &&
+		string(prefix[:4]) == segmentedMagic &&
+		FormatVersion(prefix[4]) == FormatSegmented {
+		return FormatSegmented
+	}
+	return FormatLegacy
+}
+
+// IsSegmentedFormat 检查密文是否为分段 AEAD 格式
+func IsSegmentedFormat(ciphertext []byte) bool {
+	return DetectFormat(ciphertext) == FormatSegmented
+}
+
+// segmentedHeader 解析后的分段格式头部
+type segmentedHeader struct {
+	raw         []byte
+	segmentSize int
+	prefix      []byte
+}
+
+// parseSegmentedHeader 解析并校验分段格式头部
+func parseSegmentedHeader(header []byte) (*segmentedHeader, error) {
+	if DetectFormat(header) != FormatSegmented {
+		return nil, errors.New("not a segmented ciphertext")
+	}
+
+	raw := append([]byte(nil), header[:SegmentedHeaderSize]...)
+	segmentSize := binary.BigEndian.Uint32(raw[5:9])
+	if segmentSize == 0 || segmentSize > MaxSegmentSize {
+		return nil, fmt.Errorf("invalid segment size in header: %d", segmentSize)
+	}
+
+	return &segmentedHeader{
+		raw:         raw,
+		segmentSize: int(segmentSize),
+		prefix:      raw[9:],
+	}, nil
+}
+
+// encSegmentSize 单个加密分段（含认证标签）的长度
+func (h *segmentedHeader) encSegmentSize() int {
+	return h.segmentSize + segmentTagSize
+}
+
+// segmentNonce 计算分段 Nonce
+func segmentNonce(dst []byte, prefix []byte, counter uint32, last bool) []byte {
+	dst = append(dst[:0], prefix...)
+	dst = binary.BigEndian.AppendUint32(dst, counter)
+	if last {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// newSegmentAEAD 创建分段加密使用的 AES-GCM 实例
+func newSegmentAEAD(dek []byte) (cipher.AEAD, error) {
+	if len(dek) != 32 {
+		return nil, fmt.Errorf("DEK must be 32 bytes, got %d bytes", len(dek))
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// EncryptWriter 分段 AEAD 加密写入器
+//
+// 写入的明文会被缓冲到一个分段大小，写满后加密并写入底层 Writer。
+// 必须调用 Close 写出最后一个分段，否则密文会被视为截断。
+// Close 不会关闭底层 Writer。
+type EncryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	buf     []byte // 明文缓冲，容量为分段大小
+	out     []byte // 密文缓冲
+	nonce   []byte
+	counter uint32
+	closed  bool
+	err     error
+}
+
+// NewEncryptWriter 创建分段加密写入器（使用默认分段大小）
+func NewEncryptWriter(w io.Writer, dek []byte) (*EncryptWriter, error) {
+	return NewEncryptWriterSize(w, dek, DefaultSegmentSize)
+}
+
+// NewEncryptWriterSize 创建指定分段大小的加密写入器
+func NewEncryptWriterSize(w io.Writer, dek []byte, segmentSize int) (*EncryptWriter, error) {
+	if segmentSize <= 0 || segmentSize > MaxSegmentSize {
+		return nil, fmt.Errorf("invalid segment size: %d", segmentSize)
+	}
+
+	aead, err := newSegmentAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	// 构造头部
+	header := make([]byte, SegmentedHeaderSize)
+	copy(header, segmentedMagic)
+	header[4] = byte(FormatSegmented)
+	binary.BigEndian.PutUint32(header[5:9], uint32(segmentSize))
+	if _, err := io.ReadFull(rand.Reader, header[9:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return &EncryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: header[9:],
+		buf:    make([]byte, 0, segmentSize),
+		out:    make([]byte, 0, segmentSize+segmentTagSize),
+		nonce:  make([]byte, 0, aead.NonceSize()),
+	}, nil
+}
+
+// Write 写入明文
+func (e *EncryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// 缓冲已满且仍有后续数据，说明当前分段不是最后一个
+		if len(e.buf) == cap(e.buf) {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close 加密并写出最后一个分段
+func (e *EncryptWriter) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+
+	if e.err != nil {
+		return e.err
+	}
+	return e.flush(true)
+}
+
+// flush 加密当前缓冲的分段并写出
+func (e *EncryptWriter) flush(last bool) error {
+	e.nonce = segmentNonce(e.nonce, e.prefix, e.counter, last)
+	e.out = e.aead.Seal(e.out[:0], e.nonce, e.buf, e.header)
+
+	if _, err := e.w.Write(e.out); err != nil {
+		e.err = fmt.Errorf("failed to write segment: %w", err)
+		return e.err
+	}
+
+	if e.counter == ^uint32(0) && !last {
+		e.err = ErrSegmentCounterOverflow
+		return e.err
+	}
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// decryptSegmented 解密完整的分段格式密文
+func decryptSegmented(ciphertext []byte, dek []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), dek)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, 0, len(ciphertext))
+	buf := bytes.NewBuffer(plaintext)
+	if _, err := io.Copy(buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptReader 分段 AEAD 流式解密读取器
+//
+// 每次读入一个加密分段并校验，只有通过认证的明文才会返回给调用方。
+// 密文被截断、重排或篡改时 Read 返回错误，而不是 io.EOF。
+type DecryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  *segmentedHeader
+	in      []byte // 密文缓冲
+	plain   []byte // 当前分段中尚未返回的明文
+	nonce   []byte
+	counter uint32
+	done    bool
+	err     error
+}
+
+// NewDecryptReader 创建分段格式的流式解密读取器
+//
+// 会立即读取并校验头部；不支持旧版整文件格式，
+// 需要兼容旧数据时请使用 NewDecryptStreamReader。
+func NewDecryptReader(r io.Reader, dek []byte) (*DecryptReader, error) {
+	aead, err := newSegmentAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, SegmentedHeaderSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	header, err := parseSegmentedHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DecryptReader{
+		r:      bufio.NewReaderSize(r, header.encSegmentSize()+1),
+		aead:   aead,
+		header: header,
+		in:     make([]byte, header.encSegmentSize()),
+		nonce:  make([]byte, 0, aead.NonceSize()),
+	}, nil
+}
+
+// Read 读取解密后的明文
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.nextSegment()
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// nextSegment 读取、认证并解密下一个分段
+func (d *DecryptReader) nextSegment() error {
+	n, err := io.ReadFull(d.r, d.in)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		// 不足一个完整分段，只可能是最后一个分段
+	case err != nil:
+		return fmt.Errorf("failed to read segment %d: %w", d.counter, err)
+	}
+
+	last := n < len(d.in)
+	if !last {
+		// 恰好读满一个分段时，通过预读一个字节判断后面是否还有分段
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return fmt.Errorf("failed to read segment %d: %w", d.counter+1, err)
+		}
+	}
+
+	d.nonce = segmentNonce(d.nonce, d.header.prefix, d.counter, last)
+	plain, err := d.aead.Open(d.in[:0], d.nonce, d.in[:n], d.header.raw)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt segment %d: %w", d.counter, err)
+	}
+
+	if last {
+		d.done = true
+	} else {
+		if d.counter == ^uint32(0) {
+			return ErrSegmentCounterOverflow
+		}
+		d.counter++
+	}
+	d.plain = plain
+	return nil
+}
+
+// NewDecryptStreamReader 创建兼容所有格式版本的流式解密读取器
+//
+// 分段格式边读边解密；旧版整文件格式只能整体认证，
+// 会先将密文完整读入内存再解密。
+func NewDecryptStreamReader(r io.Reader, dek []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(SegmentedHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if DetectFormat(prefix) == FormatSegmented {
+		return NewDecryptReader(br, dek)
+	}
+
+	ciphertext, err := io.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+	plaintext, err := decryptLegacy(ciphertext, dek)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(plaintext), nil
+}
+
+// PlaintextReaderAt 支持随机访问的明文读取器
+type PlaintextReaderAt interface {
+	io.ReaderAt
+	// Size 返回明文总长度
+	Size() int64
+}
+
+// NewDecryptReaderAt 基于密文的随机访问接口创建明文随机访问读取器
+//
+// 分段格式下 ReadAt 只读取并解密覆盖目标区间的分段，
+// 配合 io.NewSectionReader 即可按字节区间读取明文。
+// 旧版整文件格式无法局部认证，会整体读入内存解密。
+//
+// 注意：只读取部分分段时无法检测到文件尾部被截断，
+// 但读取到的每个字节都经过了认证。
+func NewDecryptReaderAt(ra io.ReaderAt, size int64, dek []byte) (PlaintextReaderAt, error) {
+	prefix := make([]byte, SegmentedHeaderSize)
+	n, err := ra.ReadAt(prefix, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if DetectFormat(prefix[:n]) != FormatSegmented {
+		ciphertext := make([]byte, size)
+		if _, err := ra.ReadAt(ciphertext, 0); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read ciphertext: %w", err)
+		}
+		plaintext, err := decryptLegacy(ciphertext, dek)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(plaintext), nil
+	}
+
+	return newSegmentedReaderAt(ra, size, prefix, dek)
+}
+
+// segmentedReaderAt 分段格式的明文随机访问实现
+type segmentedReaderAt struct {
+	ra       io.ReaderAt
+	aead     cipher.AEAD
+	header   *segmentedHeader
+	segments int64 // 分段总数
+	size     int64 // 明文总长度
+	bodySize int64 // 头部之后的密文长度
+
+	mu       sync.Mutex
+	cacheIdx int64 // 缓存的分段序号，-1 表示无缓存
+	cache    []byte
+	in       []byte
+}
+
+// newSegmentedReaderAt 根据密文长度计算分段布局
+func newSegmentedReaderAt(ra io.ReaderAt, size int64, rawHeader []byte, dek []byte) (*segmentedReaderAt, error) {
+	aead, err := newSegmentAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	header, err := parseSegmentedHeader(rawHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := int64(header.encSegmentSize())
+	body := size - SegmentedHeaderSize
+	if body < segmentTagSize {
+		return nil, fmt.Errorf("ciphertext too short: %d bytes", size)
+	}
+
+	segments := (body + enc - 1) / enc
+	if segments > 1<<32 {
+		return nil, ErrSegmentCounterOverflow
+	}
+	if body-(segments-1)*enc < segmentTagSize {
+		return nil, errors.New("ciphertext truncated within segment tag")
+	}
+
+	return &segmentedReaderAt{
+		ra:       ra,
+		aead:     aead,
+		header:   header,
+		segments: segments,
+		size:     body - segments*segmentTagSize,
+		bodySize: body,
+		cacheIdx: -1,
+		in:       make([]byte, enc),
+	}, nil
+}
+
+// Size 返回明文总长度
+func (s *segmentedReaderAt) Size() int64 {
+	return s.size
+}
+
+// ReadAt 读取指定偏移的明文，只解密覆盖该区间的分段
+func (s *segmentedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidRange
+	}
+	if off >= s.size {
+		return 0, io.EOF
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segSize := int64(s.header.segmentSize)
+	n := 0
+	for n < len(p) && off < s.size {
+		idx := off / segSize
+		plain, err := s.segment(idx)
+		if err != nil {
+			return n, err
+		}
+
+		c := copy(p[n:], plain[off-idx*segSize:])
+		n += c
+		off += int64(c)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// segment 读取并解密指定序号的分段（带单分段缓存）
+func (s *segmentedReaderAt) segment(idx int64) ([]byte, error) {
+	if idx == s.cacheIdx {
+		return s.cache, nil
+	}
+
+	enc := int64(s.header.encSegmentSize())
+	start := idx * enc
+	length := enc
+	if remaining := s.bodySize - start; remaining < length {
+		length = remaining
+	}
+
+	in := s.in[:length]
+	if _, err := s.ra.ReadAt(in, SegmentedHeaderSize+start); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read segment %d: %w", idx, err)
+	}
+
+	last := idx == s.segments-1
+	nonce := segmentNonce(nil, s.header.prefix, uint32(idx), last)
+	plain, err := s.aead.Open(s.cache[:0], nonce, in, s.header.raw)
+	if err != nil {
+		s.cacheIdx = -1
+		return nil, fmt.Errorf("failed to decrypt segment %d: %w", idx, err)
+	}
+
+	s.cache = plain
+	s.cacheIdx = idx
+	return plain, nil
+}
@@ -0,0 +1,485 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// encryptSegmented 测试辅助函数：使用指定分段大小加密
+func encryptSegmented(t *testing.T, plaintext, dek []byte, segmentSize int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewEncryptWriterSize(&buf, dek, segmentSize)
+	if err != nil {
+		t.Fatalf("NewEncryptWriterSize() error = %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestEncryptWriterRoundTrip 测试分段加密与解密
+func TestEncryptWriterRoundTrip(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 64
+
+	// 覆盖空文件、不足一个分段、恰好整数个分段、跨多个分段等边界
+	sizes := []int{0, 1, 63, 64, 65, 128, 1000}
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+
+			ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+			if !IsSegmentedFormat(ciphertext) {
+				t.Fatal("IsSegmentedFormat() = false for segmented ciphertext")
+			}
+
+			segments := (size + segmentSize - 1) / segmentSize
+			if segments == 0 {
+				segments = 1
+			}
+			wantLen := SegmentedHeaderSize + size + segments*16
+			if len(ciphertext) != wantLen {
+				t.Errorf("ciphertext length = %d, want %d", len(ciphertext), wantLen)
+			}
+
+			decrypted, err := DecryptFile(ciphertext, dek)
+			if err != nil {
+				t.Fatalf("DecryptFile() error = %v", err)
+			}
+			if !bytes.Equal(plaintext, decrypted) {
+				t.Error("DecryptFile() result != original plaintext")
+			}
+		})
+	}
+}
+
+// TestEncryptWriterSmallWrites 测试多次小块写入
+func TestEncryptWriterSmallWrites(t *testing.T) {
+	dek, _ := GenerateDEK()
+	plaintext := make([]byte, 10*1024)
+	rand.Read(plaintext)
+
+	var buf bytes.Buffer
+	w, err := NewEncryptWriterSize(&buf, dek, 1000)
+	if err != nil {
+		t.Fatalf("NewEncryptWriterSize() error = %v", err)
+	}
+	for i := 0; i < len(plaintext); i += 7 {
+		end := i + 7
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		if _, err := w.Write(plaintext[i:end]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	decrypted, err := DecryptFile(buf.Bytes(), dek)
+	if err != nil {
+		t.Fatalf("DecryptFile() error = %v", err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Error("DecryptFile() result != original plaintext")
+	}
+}
+
+// TestSegmentedTamperDetection 测试截断、重排和篡改检测
+func TestSegmentedTamperDetection(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 32
+	const encSegment = segmentSize + 16
+
+	plaintext := make([]byte, segmentSize*3)
+	rand.Read(plaintext)
+	ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+	header := ciphertext[:SegmentedHeaderSize]
+	seg := func(i int) []byte {
+		start := SegmentedHeaderSize + i*encSegment
+		return ciphertext[start : start+encSegment]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"截断最后一个分段", ciphertext[:len(ciphertext)-encSegment]},
+		{"截断部分字节", ciphertext[:len(ciphertext)-1]},
+		{"交换分段顺序", join(header, seg(1), seg(0), seg(2))},
+		{"重复分段", join(header, seg(0), seg(0), seg(2))},
+		{"篡改头部", append(append(append([]byte(nil), header[:10]...), header[10]^0xFF), ciphertext[11:]...)},
+		{"篡改密文", func() []byte {
+			c := append([]byte(nil), ciphertext...)
+			c[SegmentedHeaderSize+5] ^= 0x01
+			return c
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecryptFile(tt.ciphertext, dek); err == nil {
+				t.Error("DecryptFile() should detect tampering")
+			}
+		})
+	}
+
+	// 错误的 DEK
+	wrongDEK, _ := GenerateDEK()
+	if _, err := DecryptFile(ciphertext, wrongDEK); err == nil {
+		t.Error("DecryptFile() should fail with wrong DEK")
+	}
+}
+
+// encryptLegacy 测试辅助函数：生成旧版整文件格式密文
+func encryptLegacy(t *testing.T, plaintext, dek []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		t.Fatalf("aes.NewCipher() error = %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM() error = %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+// TestDecryptFileLegacyFormat 测试旧版整文件格式仍可解密
+func TestDecryptFileLegacyFormat(t *testing.T) {
+	dek, _ := GenerateDEK()
+	plaintext := []byte("legacy whole-file ciphertext")
+	ciphertext := encryptLegacy(t, plaintext, dek)
+
+	if got := DetectFormat(ciphertext); got != FormatLegacy {
+		t.Fatalf("DetectFormat() = %d, want %d", got, FormatLegacy)
+	}
+
+	decrypted, err := DecryptFile(ciphertext, dek)
+	if err != nil {
+		t.Fatalf("DecryptFile() error = %v", err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Error("DecryptFile() result != original plaintext")
+	}
+
+	// 流式解密与随机访问同样兼容旧格式
+	var out bytes.Buffer
+	if err := DecryptStream(bytes.NewReader(ciphertext), &out, dek); err != nil {
+		t.Fatalf("DecryptStream() error = %v", err)
+	}
+	if !bytes.Equal(plaintext, out.Bytes()) {
+		t.Error("DecryptStream() result != original plaintext")
+	}
+
+	ra, err := NewDecryptReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), dek)
+	if err != nil {
+		t.Fatalf("NewDecryptReaderAt() error = %v", err)
+	}
+	if ra.Size() != int64(len(plaintext)) {
+		t.Errorf("Size() = %d, want %d", ra.Size(), len(plaintext))
+	}
+	buf := make([]byte, 5)
+	if _, err := ra.ReadAt(buf, 7); err != nil {
+		t.Fatalf("ReadAt() error = %v", err)
+	}
+	if !bytes.Equal(buf, plaintext[7:12]) {
+		t.Errorf("ReadAt() = %q, want %q", buf, plaintext[7:12])
+	}
+}
+
+// TestDetectFormat 测试格式版本识别
+func TestDetectFormat(t *testing.T) {
+	dek, _ := GenerateDEK()
+	segmented := encryptSegmented(t, []byte("data"), dek, 64)
+
+	unknownVersion := append([]byte(nil), segmented...)
+	unknownVersion[4] = 99
+
+	tests := []struct {
+		name string
+		data []byte
+		want FormatVersion
+	}{
+		{"分段格式", segmented, FormatSegmented},
+		{"仅头部", segmented[:SegmentedHeaderSize], FormatSegmented},
+		{"头部不完整", segmented[:SegmentedHeaderSize-1], FormatLegacy},
+		{"未知版本号", unknownVersion, FormatLegacy},
+		{"空数据", nil, FormatLegacy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.data); got != tt.want {
+				t.Errorf("DetectFormat() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecryptReader 测试流式解密读取器
+func TestDecryptReader(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 64
+
+	for _, size := range []int{0, 1, 63, 64, 65, 128, 1000} {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+			ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+			// 使用 iotest.OneByteReader 模拟底层每次只返回一个字节
+			r, err := NewDecryptReader(iotest.OneByteReader(bytes.NewReader(ciphertext)), dek)
+			if err != nil {
+				t.Fatalf("NewDecryptReader() error = %v", err)
+			}
+			decrypted, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(plaintext, decrypted) {
+				t.Error("DecryptReader result != original plaintext")
+			}
+		})
+	}
+}
+
+// TestDecryptReaderTamper 测试流式解密读取器的篡改检测
+func TestDecryptReaderTamper(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 32
+	const encSegment = segmentSize + 16
+
+	plaintext := make([]byte, segmentSize*3)
+	rand.Read(plaintext)
+	ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"在分段边界截断", ciphertext[:len(ciphertext)-encSegment]},
+		{"截断部分字节", ciphertext[:len(ciphertext)-1]},
+		{"篡改最后一个分段", func() []byte {
+			c := append([]byte(nil), ciphertext...)
+			c[len(c)-1] ^= 0x01
+			return c
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewDecryptReader(bytes.NewReader(tt.ciphertext), dek)
+			if err != nil {
+				t.Fatalf("NewDecryptReader() error = %v", err)
+			}
+			if _, err := io.ReadAll(r); err == nil {
+				t.Error("DecryptReader should detect tampering")
+			}
+		})
+	}
+
+	// 头部声明的分段大小超出上限
+	bad := append([]byte(nil), ciphertext...)
+	binary.BigEndian.PutUint32(bad[5:9], MaxSegmentSize+1)
+	if _, err := NewDecryptReader(bytes.NewReader(bad), dek); err == nil {
+		t.Error("NewDecryptReader() should reject oversized segment size")
+	}
+}
+
+// countingReaderAt 记录读取字节数的 ReaderAt
+type countingReaderAt struct {
+	r     io.ReaderAt
+	bytes int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// TestDecryptReaderAt 测试按字节区间随机解密
+func TestDecryptReaderAt(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 100
+
+	plaintext := make([]byte, 1050)
+	rand.Read(plaintext)
+	ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+	ra, err := NewDecryptReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), dek)
+	if err != nil {
+		t.Fatalf("NewDecryptReaderAt() error = %v", err)
+	}
+	if ra.Size() != int64(len(plaintext)) {
+		t.Fatalf("Size() = %d, want %d", ra.Size(), len(plaintext))
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+	}{
+		{"文件开头", 0, 10},
+		{"分段内部", 120, 50},
+		{"跨越分段边界", 95, 10},
+		{"跨越多个分段", 150, 520},
+		{"恰好一个分段", 300, 100},
+		{"最后一个分段", 1000, 50},
+		{"整个文件", 0, 1050},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(io.NewSectionReader(ra, tt.offset, tt.length))
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(got, plaintext[tt.offset:tt.offset+tt.length]) {
+				t.Error("range result != original plaintext")
+			}
+		})
+	}
+
+	// 超出末尾的读取返回 io.EOF
+	buf := make([]byte, 100)
+	n, err := ra.ReadAt(buf, 1000)
+	if n != 50 || err != io.EOF {
+		t.Errorf("ReadAt() past end = (%d, %v), want (50, EOF)", n, err)
+	}
+}
+
+// TestDecryptReaderAtReadsOnlyCoveringSegments 测试随机访问只读取覆盖区间的分段
+func TestDecryptReaderAtReadsOnlyCoveringSegments(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 1024
+
+	plaintext := make([]byte, segmentSize*100)
+	rand.Read(plaintext)
+	ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+	counter := &countingReaderAt{r: bytes.NewReader(ciphertext)}
+	ra, err := NewDecryptReaderAt(counter, int64(len(ciphertext)), dek)
+	if err != nil {
+		t.Fatalf("NewDecryptReaderAt() error = %v", err)
+	}
+	counter.bytes = 0
+
+	// 区间跨越第 50、51 两个分段
+	buf := make([]byte, 100)
+	if _, err := ra.ReadAt(buf, 50*segmentSize+1000); err != nil {
+		t.Fatalf("ReadAt() error = %v", err)
+	}
+	if !bytes.Equal(buf, plaintext[50*segmentSize+1000:50*segmentSize+1100]) {
+		t.Error("ReadAt() result != original plaintext")
+	}
+	if want := int64(2 * (segmentSize + 16)); counter.bytes != want {
+		t.Errorf("read %d ciphertext bytes, want %d", counter.bytes, want)
+	}
+}
+
+// TestDecryptReaderAtTamper 测试随机访问时的篡改与截断检测
+func TestDecryptReaderAtTamper(t *testing.T) {
+	dek, _ := GenerateDEK()
+	const segmentSize = 32
+	const encSegment = segmentSize + 16
+
+	plaintext := make([]byte, segmentSize*3)
+	rand.Read(plaintext)
+	ciphertext := encryptSegmented(t, plaintext, dek, segmentSize)
+
+	// 篡改第 1 个分段：读取该分段失败，其他分段不受影响
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[SegmentedHeaderSize+encSegment+3] ^= 0x01
+	ra, err := NewDecryptReaderAt(bytes.NewReader(tampered), int64(len(tampered)), dek)
+	if err != nil {
+		t.Fatalf("NewDecryptReaderAt() error = %v", err)
+	}
+	buf := make([]byte, 10)
+	if _, err := ra.ReadAt(buf, segmentSize+5); err == nil {
+		t.Error("ReadAt() should detect tampered segment")
+	}
+	if _, err := ra.ReadAt(buf, 0); err != nil {
+		t.Errorf("ReadAt() on untouched segment error = %v", err)
+	}
+
+	// 在分段边界截断：新的最后一个分段无法通过认证
+	truncated := ciphertext[:len(ciphertext)-encSegment]
+	ra, err = NewDecryptReaderAt(bytes.NewReader(truncated), int64(len(truncated)), dek)
+	if err != nil {
+		t.Fatalf("NewDecryptReaderAt() error = %v", err)
+	}
+	if _, err := ra.ReadAt(buf, segmentSize+5); err == nil {
+		t.Error("ReadAt() should detect truncation")
+	}
+
+	// 截断到认证标签内部
+	short := ciphertext[:SegmentedHeaderSize+2*encSegment+8]
+	if _, err := NewDecryptReaderAt(bytes.NewReader(short), int64(len(short)), dek); err == nil {
+		t.Error("NewDecryptReaderAt() should reject truncated tag")
+	}
+}
+
+// TestNewEncryptWriterInvalidDEK 测试无效的 DEK 长度
+func TestNewEncryptWriterInvalidDEK(t *testing.T) {
+	if _, err := NewEncryptWriter(io.Discard, make([]byte, 16)); err == nil {
+		t.Error("NewEncryptWriter() should fail with 16-byte DEK")
+	}
+}
+
+func BenchmarkEncryptWriter(b *testing.B) {
+	dek, _ := GenerateDEK()
+	data := make([]byte, 1024*1024) // 1MB
+	rand.Read(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, _ := NewEncryptWriter(io.Discard, dek)
+		w.Write(data)
+		w.Close()
+	}
+}
+
+func BenchmarkDecryptReaderAt(b *testing.B) {
+	dek, _ := GenerateDEK()
+	plaintext := make([]byte, 64*1024*1024) // 64MB
+	rand.Read(plaintext)
+	ciphertext, _ := EncryptFile(plaintext, dek)
+
+	ra, _ := NewDecryptReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), dek)
+	buf := make([]byte, 4096)
+
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		off := int64(i*7919*4096) % (ra.Size() - int64(len(buf)))
+		ra.ReadAt(buf, off)
+	}
+}
@@ -0,0 +1,185 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VaultConfig Vault Transit 密钥提供者配置
+type VaultConfig struct {
+	Address   string        // Vault 地址，如 https://vault.example.com:8200
+	Token     string        // 访问令牌（需要 transit/encrypt 与 transit/decrypt 权限）
+	Namespace string        // Vault Enterprise 命名空间（可选）
+	Mount     string        // Transit 引擎挂载路径，默认 "transit"
+	KeyName   string        // Transit 密钥名称
+	KeyID     string        // 记录在 file_blobs.key_id 中的 ID，默认 "vault:<KeyName>"
+	Timeout   time.Duration // 单次请求超时，默认 10s
+
+	// HTTPClient 自定义 HTTP 客户端（可选，用于配置 TLS 等）
+	HTTPClient *http.Client
+}
+
+// VaultTransitProvider 基于 HashiCorp Vault Transit 引擎的密钥提供者
+//
+// KEK 只存在于 Vault 中，DEK 的加解密通过 HTTP API 完成。
+// 密文格式为 Vault 原生的 "vault:v<N>:<base64>"，Vault 侧轮换密钥版本后旧密文仍可解密。
+type VaultTransitProvider struct {
+	keyID      string
+	encryptURL string
+	decryptURL string
+	token      string
+	namespace  string
+	client     *http.Client
+}
+
+// vaultResponse Vault API 通用响应
+type vaultResponse struct {
+	Data struct {
+		Ciphertext string `json:"ciphertext"`
+		Plaintext  string `json:"plaintext"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// NewVaultTransitProvider 创建 Vault Transit 密钥提供者
+func NewVaultTransitProvider(cfg VaultConfig) (*VaultTransitProvider, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("vault token is required")
+	}
+	if cfg.KeyName == "" {
+		return nil, errors.New("vault transit key name is required")
+	}
+
+	base, err := url.Parse(strings.TrimRight(cfg.Address, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid vault address: %q", cfg.Address)
+	}
+
+	mount := strings.Trim(cfg.Mount, "/")
+	if mount == "" {
+		mount = "transit"
+	}
+	keyID := cfg.KeyID
+	if keyID == "" {
+		keyID = "vault:" + cfg.KeyName
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+
+	endpoint := func(op string) string {
+		return base.String() + "/v1/" + mount + "/" + op + "/" + url.PathEscape(cfg.KeyName)
+	}
+
+	return &VaultTransitProvider{
+		keyID:      keyID,
+		encryptURL: endpoint("encrypt"),
+		decryptURL: endpoint("decrypt"),
+		token:      cfg.Token,
+		namespace:  cfg.Namespace,
+		client:     client,
+	}, nil
+}
+
+// KeyID 返回密钥 ID
+func (p *VaultTransitProvider) KeyID() string {
+	return p.keyID
+}
+
+// Wrap 调用 Vault 加密 DEK
+func (p *VaultTransitProvider) Wrap(dek []byte) (string, error) {
+	if len(dek) != 32 {
+		return "", errors.New("DEK must be 32 bytes")
+	}
+
+	resp, err := p.call(p.encryptURL, map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	})
+	if err != nil {
+		return "", fmt.Errorf("vault encrypt failed: %w", err)
+	}
+	if !strings.HasPrefix(resp.Data.Ciphertext, "vault:") {
+		return "", errors.New("vault encrypt failed: unexpected ciphertext format")
+	}
+	return resp.Data.Ciphertext, nil
+}
+
+// Unwrap 调用 Vault 解密 DEK
+func (p *VaultTransitProvider) Unwrap(encryptedDEK string) ([]byte, error) {
+	resp, err := p.call(p.decryptURL, map[string]string{
+		"ciphertext": encryptedDEK,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("vault decrypt failed: %w", err)
+	}
+
+	dek, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("vault decrypt failed: invalid plaintext encoding: %w", err)
+	}
+	if len(dek) != 32 {
+		ZeroBytes(dek)
+		return nil, errors.New("vault decrypt failed: DEK must be 32 bytes")
+	}
+	return dek, nil
+}
+
+// call 发送 Transit 请求并解析响应
+func (p *VaultTransitProvider) call(endpoint string, payload map[string]string) (*vaultResponse, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	httpResp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp vaultResponse
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &resp); err != nil && httpResp.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("status %d: %s", httpResp.StatusCode, strings.Join(resp.Errors, "; "))
+		}
+		return nil, fmt.Errorf("status %d", httpResp.StatusCode)
+	}
+
+	return &resp, nil
+}
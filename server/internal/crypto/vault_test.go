@@ -0,0 +1,283 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTransit 模拟 Vault Transit 引擎的本地服务
+//
+// 只实现 encrypt/decrypt 接口，支持多版本密钥以模拟 Vault 侧的密钥轮换。
+type fakeTransit struct {
+	mu        sync.Mutex
+	token     string
+	mount     string
+	keyName   string
+	namespace string
+	versions  [][]byte
+	requests  int
+}
+
+func newFakeTransit(t *testing.T, token, mount, keyName string) (*fakeTransit, *httptest.Server) {
+	ft := &fakeTransit{token: token, mount: mount, keyName: keyName}
+	ft.rotate()
+	srv := httptest.NewServer(ft)
+	t.Cleanup(srv.Close)
+	return ft, srv
+}
+
+// rotate 新增一个密钥版本（新数据使用最新版本加密）
+func (f *fakeTransit) rotate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := make([]byte, 32)
+	rand.Read(key)
+	f.versions = append(f.versions, key)
+}
+
+func (f *fakeTransit) fail(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	if r.Method != http.MethodPost {
+		f.fail(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != f.token {
+		f.fail(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	if f.namespace != "" && r.Header.Get("X-Vault-Namespace") != f.namespace {
+		f.fail(w, http.StatusNotFound, "no handler for route")
+		return
+	}
+
+	prefix := "/v1/" + f.mount + "/"
+	op, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if !strings.HasPrefix(r.URL.Path, prefix) || !ok || name != f.keyName {
+		f.fail(w, http.StatusNotFound, "no handler for route")
+		return
+	}
+
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.fail(w, http.StatusBadRequest, "failed to parse JSON input")
+		return
+	}
+
+	switch op {
+	case "encrypt":
+		plaintext, err := base64.StdEncoding.DecodeString(req["plaintext"])
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "failed to decode plaintext")
+			return
+		}
+		version := len(f.versions)
+		aead := f.aead(version)
+		nonce := make([]byte, aead.NonceSize())
+		rand.Read(nonce)
+		sealed := aead.Seal(nonce, nonce, plaintext, nil)
+		ciphertext := "vault:v" + string(rune('0'+version)) + ":" + base64.StdEncoding.EncodeToString(sealed)
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": ciphertext}})
+
+	case "decrypt":
+		parts := strings.SplitN(req["ciphertext"], ":", 3)
+		if len(parts) != 3 || parts[0] != "vault" || len(parts[1]) != 2 {
+			f.fail(w, http.StatusBadRequest, "invalid ciphertext: no prefix")
+			return
+		}
+		version := int(parts[1][1] - '0')
+		if version < 1 || version > len(f.versions) {
+			f.fail(w, http.StatusBadRequest, "invalid key version")
+			return
+		}
+		sealed, err := base64.StdEncoding.DecodeString(parts[2])
+		aead := f.aead(version)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			f.fail(w, http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "cipher: message authentication failed")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		}})
+
+	default:
+		f.fail(w, http.StatusNotFound, "no handler for route")
+	}
+}
+
+func (f *fakeTransit) aead(version int) cipher.AEAD {
+	block, _ := aes.NewCipher(f.versions[version-1])
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+// TestVaultTransitProvider 测试通过 Transit 引擎加解密 DEK
+func TestVaultTransitProvider(t *testing.T) {
+	ft, srv := newFakeTransit(t, "s.test-token", "transit", "ahavault")
+
+	provider, err := NewVaultTransitProvider(VaultConfig{
+		Address: srv.URL + "/",
+		Token:   "s.test-token",
+		KeyName: "ahavault",
+	})
+	if err != nil {
+		t.Fatalf("NewVaultTransitProvider() error = %v", err)
+	}
+	if provider.KeyID() != "vault:ahavault" {
+		t.Errorf("KeyID() = %q, want %q", provider.KeyID(), "vault:ahavault")
+	}
+
+	dek, _ := GenerateDEK()
+	wrapped, err := provider.Wrap(dek)
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if !strings.HasPrefix(wrapped, "vault:v1:") {
+		t.Errorf("Wrap() = %q, want vault:v1: prefix", wrapped)
+	}
+
+	got, err := provider.Unwrap(wrapped)
+	if err != nil {
+		t.Fatalf("Unwrap() error = %v", err)
+	}
+	if !bytes.Equal(got, dek) {
+		t.Error("Unwrap() returned a different DEK")
+	}
+
+	// Vault 侧轮换密钥版本后，旧密文仍可解密，新密文使用新版本
+	ft.rotate()
+	got, err = provider.Unwrap(wrapped)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Errorf("Unwrap() after vault rotation failed: %v", err)
+	}
+	wrapped2, err := provider.Wrap(dek)
+	if err != nil || !strings.HasPrefix(wrapped2, "vault:v2:") {
+		t.Errorf("Wrap() after vault rotation = %q, %v", wrapped2, err)
+	}
+
+	if err := CheckKeyProvider(provider); err != nil {
+		t.Errorf("CheckKeyProvider() error = %v", err)
+	}
+}
+
+// TestVaultTransitProvider_Errors 测试 Vault 错误信息透传
+func TestVaultTransitProvider_Errors(t *testing.T) {
+	_, srv := newFakeTransit(t, "s.test-token", "transit", "ahavault")
+	dek, _ := GenerateDEK()
+
+	wrongToken, _ := NewVaultTransitProvider(VaultConfig{Address: srv.URL, Token: "wrong", KeyName: "ahavault"})
+	if _, err := wrongToken.Wrap(dek); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Wrap() with wrong token error = %v, want permission denied", err)
+	}
+	if err := CheckKeyProvider(wrongToken); err == nil {
+		t.Error("CheckKeyProvider() should fail with wrong token")
+	}
+
+	provider, _ := NewVaultTransitProvider(VaultConfig{Address: srv.URL, Token: "s.test-token", KeyName: "ahavault"})
+	wrapped, _ := provider.Wrap(dek)
+	tampered := wrapped[:len(wrapped)-4] + "AAA="
+	if _, err := provider.Unwrap(tampered); err == nil {
+		t.Error("Unwrap() should fail for tampered ciphertext")
+	}
+	if _, err := provider.Unwrap("not-a-vault-ciphertext"); err == nil {
+		t.Error("Unwrap() should fail for invalid ciphertext")
+	}
+
+	if _, err := provider.Wrap(make([]byte, 16)); err == nil {
+		t.Error("Wrap() should reject 16-byte DEK")
+	}
+
+	unreachable, _ := NewVaultTransitProvider(VaultConfig{Address: "http://127.0.0.1:1", Token: "t", KeyName: "k"})
+	if _, err := unreachable.Wrap(dek); err == nil {
+		t.Error("Wrap() should fail when vault is unreachable")
+	}
+}
+
+// TestVaultTransitProvider_Options 测试挂载路径、命名空间与自定义密钥 ID
+func TestVaultTransitProvider_Options(t *testing.T) {
+	ft, srv := newFakeTransit(t, "s.test-token", "kms/transit", "files")
+	ft.namespace = "team-a"
+
+	provider, err := NewVaultTransitProvider(VaultConfig{
+		Address:   srv.URL,
+		Token:     "s.test-token",
+		Namespace: "team-a",
+		Mount:     "/kms/transit/",
+		KeyName:   "files",
+		KeyID:     "vault-2026",
+	})
+	if err != nil {
+		t.Fatalf("NewVaultTransitProvider() error = %v", err)
+	}
+	if provider.KeyID() != "vault-2026" {
+		t.Errorf("KeyID() = %q, want vault-2026", provider.KeyID())
+	}
+	if err := CheckKeyProvider(provider); err != nil {
+		t.Errorf("CheckKeyProvider() error = %v", err)
+	}
+
+	tests := []VaultConfig{
+		{Token: "t", KeyName: "k"},
+		{Address: srv.URL, KeyName: "k"},
+		{Address: srv.URL, Token: "t"},
+		{Address: "not a url", Token: "t", KeyName: "k"},
+	}
+	for _, cfg := range tests {
+		if _, err := NewVaultTransitProvider(cfg); err == nil {
+			t.Errorf("NewVaultTransitProvider(%+v) should fail", cfg)
+		}
+	}
+}
+
+// TestKeyring_LocalToVault 测试从本地 KEK 迁移到 Vault
+//
+// 旧数据由本地 KEK 加密，新主密钥为 Vault，RewrapDEK 后数据只依赖 Vault。
+func TestKeyring_LocalToVault(t *testing.T) {
+	_, srv := newFakeTransit(t, "s.test-token", "transit", "ahavault")
+	vault, _ := NewVaultTransitProvider(VaultConfig{Address: srv.URL, Token: "s.test-token", KeyName: "ahavault"})
+	local, _ := NewLocalKeyProvider(DefaultKeyID, newTestKEK())
+
+	dek, _ := GenerateDEK()
+	oldDEK, _ := local.Wrap(dek)
+
+	kr, err := NewProviderKeyring(vault, local)
+	if err != nil {
+		t.Fatalf("NewProviderKeyring() error = %v", err)
+	}
+
+	keyID, rewrapped, err := kr.RewrapDEK("", oldDEK)
+	if err != nil {
+		t.Fatalf("RewrapDEK() error = %v", err)
+	}
+	if keyID != "vault:ahavault" {
+		t.Errorf("RewrapDEK() key id = %q, want vault:ahavault", keyID)
+	}
+
+	vaultOnly, _ := NewProviderKeyring(vault)
+	got, err := vaultOnly.UnwrapDEK(keyID, rewrapped)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Errorf("UnwrapDEK() via vault failed: %v", err)
+	}
+}
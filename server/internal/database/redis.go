@@ -139,6 +139,15 @@ func Incr(ctx context.Context, key string) (int64, error) {
 	return RedisClient.Incr(ctx, key).Result()
 }
 
+// Decr 自减
+func Decr(ctx context.Context, key string) (int64, error) {
+	if RedisClient == nil {
+		return 0, fmt.Errorf("redis not initialized")
+	}
+
+	return RedisClient.Decr(ctx, key).Result()
+}
+
 // Expire 设置过期时间
 func Expire(ctx context.Context, key string, expiration time.Duration) error {
 	if RedisClient == nil {
@@ -166,6 +175,40 @@ func SetNX(ctx context.Context, key string, value interface{}, expiration time.D
 	return RedisClient.SetNX(ctx, key, value, expiration).Result()
 }
 
+// compareAndDeleteScript 值匹配时删除键（释放自己持有的锁）
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// compareAndExpireScript 值匹配时重设过期时间（续期自己持有的锁）
+var compareAndExpireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// CompareAndDelete 仅当键的值等于 value 时删除（分布式锁释放）
+func CompareAndDelete(ctx context.Context, key string, value string) (bool, error) {
+	if RedisClient == nil {
+		return false, fmt.Errorf("redis not initialized")
+	}
+
+	n, err := compareAndDeleteScript.Run(ctx, RedisClient, []string{key}, value).Int()
+	return n == 1, err
+}
+
+// CompareAndExpire 仅当键的值等于 value 时重设过期时间（分布式锁续期）
+func CompareAndExpire(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	if RedisClient == nil {
+		return false, fmt.Errorf("redis not initialized")
+	}
+
+	n, err := compareAndExpireScript.Run(ctx, RedisClient, []string{key}, value, expiration.Milliseconds()).Int()
+	return n == 1, err
+}
+
 // HSet 设置哈希字段
 func HSet(ctx context.Context, key string, values ...interface{}) error {
 	if RedisClient == nil {
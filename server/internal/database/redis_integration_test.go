@@ -50,6 +50,7 @@ func TestRedisIntegration(t *testing.T) {
 	t.Run("过期时间操作", testRedisExpiration)
 	t.Run("哈希操作", testRedisHashOps)
 	t.Run("分布式锁", testRedisLock)
+	t.Run("锁续期与释放", testRedisLockOwnership)
 }
 
 // testRedisHealthCheck 测试 Redis 健康检查
@@ -195,6 +196,40 @@ func testRedisLock(t *testing.T) {
 	Del(ctx, lockKey)
 }
 
+// testRedisLockOwnership 测试只有持有者能续期和释放锁
+func testRedisLockOwnership(t *testing.T) {
+	ctx := context.Background()
+	lockKey := "test:lock:owner:" + time.Now().Format("20060102150405")
+
+	acquired, err := SetNX(ctx, lockKey, "owner1", 2*time.Second)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// 非持有者无法续期或释放
+	ok, err := CompareAndExpire(ctx, lockKey, "owner2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = CompareAndDelete(ctx, lockKey, "owner2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 持有者续期
+	ok, err = CompareAndExpire(ctx, lockKey, "owner1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ttl, err := TTL(ctx, lockKey)
+	require.NoError(t, err)
+	assert.Greater(t, ttl, 2*time.Second)
+
+	// 持有者释放
+	ok, err = CompareAndDelete(ctx, lockKey, "owner1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	count, err := Exists(ctx, lockKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
 // testRedisIncr 测试自增操作
 func TestRedisIncr(t *testing.T) {
 	if testing.Short() {
@@ -11,55 +11,78 @@ import (
 // Auth JWT 认证中间件
 func Auth(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从请求头获取 token
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "Authorization header required",
-			})
-			c.Abort()
+		if !authenticate(c, userService) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		// 解析 Bearer token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "Invalid authorization header format",
-			})
-			c.Abort()
-			return
-		}
+// authenticate 验证 Authorization 头中的 JWT 并将用户 ID 存入上下文
+//
+// 失败时写入 401 响应并中止请求，返回 false。不调用 c.Next()，
+// 调用方可在认证之后继续检查（如管理员权限），全部通过后再执行后续处理器。
+func authenticate(c *gin.Context, userService *services.UserService) bool {
+	// 从请求头获取 token
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Authorization header required",
+		})
+		c.Abort()
+		return false
+	}
 
-		token := parts[1]
+	// 解析 Bearer token
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid authorization header format",
+		})
+		c.Abort()
+		return false
+	}
 
-		// 验证 token
-		claims, err := userService.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "Invalid or expired token",
-			})
-			c.Abort()
-			return
-		}
+	token := parts[1]
+
+	// 验证 token
+	claims, err := userService.ValidateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid or expired token",
+		})
+		c.Abort()
+		return false
+	}
 
-		// 将用户 ID 存储到上下文
-		userID := (*claims)["user_id"].(string)
-		c.Set("user_id", userID)
+	// 将用户 ID 存储到上下文
+	userID := (*claims)["user_id"].(string)
+	c.Set("user_id", userID)
+	return true
+}
 
+// OptionalAuth 可选的 JWT 认证中间件
+//
+// 未携带 Authorization 时以匿名身份继续处理；携带时与 Auth 相同，无效则返回 401。
+func OptionalAuth(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" && !authenticate(c, userService) {
+			return
+		}
 		c.Next()
 	}
 }
 
 // AdminAuth 管理员认证中间件
+//
+// 认证和管理员检查都通过后才执行后续处理器。
 func AdminAuth(userService *services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 先执行普通认证
-		Auth(userService)(c)
-		if c.IsAborted() {
+		if !authenticate(c, userService) {
 			return
 		}
 
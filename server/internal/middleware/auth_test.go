@@ -4,6 +4,8 @@
 //   - JWT Token 验证
 //   - Bearer 格式解析
 //   - 用户 ID 上下文存储
+//   - 可选认证（匿名访问）
+//   - 管理员认证（非管理员不执行后续处理器）
 //
 // 作者: AhaVault Team
 // 创建时间: 2026-02-06
@@ -14,8 +16,13 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestGetUserID(t *testing.T) {
@@ -112,3 +119,93 @@ func TestAuthMiddleware_InvalidFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionalAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(OptionalAuth(nil))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": GetUserID(c)})
+	})
+
+	// 未携带 Authorization 时匿名访问
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user_id":""}`, w.Body.String())
+
+	// 携带但格式错误时拒绝，而不是降级为匿名
+	req, _ = http.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Basic sometoken")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid authorization header format")
+}
+
+// TestAdminAuthMiddleware 测试管理员认证：非管理员返回 403 且处理器不会执行
+func TestAdminAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`
+		CREATE TABLE users (
+			id TEXT PRIMARY KEY,
+			email TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'user',
+			status TEXT NOT NULL DEFAULT 'active',
+			storage_quota INTEGER NOT NULL DEFAULT 10737418240,
+			storage_used INTEGER NOT NULL DEFAULT 0,
+			storage_reserved INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at DATETIME
+		)
+	`).Error)
+
+	userService := services.NewUserService(db, "test-secret")
+	admin := &models.User{Email: "admin@test.com", Password: "hashed_password", Role: models.RoleAdmin}
+	member := &models.User{Email: "member@test.com", Password: "hashed_password", Role: models.RoleUser}
+	require.NoError(t, db.Create(admin).Error)
+	require.NoError(t, db.Create(member).Error)
+
+	calls := 0
+	router := gin.New()
+	router.Use(AdminAuth(userService))
+	router.POST("/admin/action", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"ok": 1})
+	})
+
+	send := func(user *models.User) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/admin/action", nil)
+		if user != nil {
+			token, err := userService.GenerateToken(user)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 未登录
+	w := send(nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Zero(t, calls)
+
+	// 非管理员：只有 403 响应，处理器没有执行
+	w = send(member)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"code":403,"message":"Admin access required"}`, w.Body.String())
+	assert.Zero(t, calls)
+
+	w = send(admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"ok":1}`, w.Body.String())
+	assert.Equal(t, 1, calls)
+}
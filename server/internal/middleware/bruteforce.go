@@ -0,0 +1,334 @@
+// Package middleware 提供 HTTP 中间件
+//
+// 本文件实现取件码与分享访问密码的防暴力破解：
+//   - 按客户端 IP 统计失败次数（取件码无效、访问密码错误、下载凭证无效）
+//   - 每次尝试在处理前先计入，超过上限直接拒绝，成功后退还（并发的猜测不能超过上限）
+//   - 按取件码（或分享链接）统计访问密码错误次数（防止多个 IP 分布式猜测同一分享的密码）
+//   - 窗口内失败次数达到上限时锁定，同一 IP / 取件码再次触发时锁定时长逐级翻倍
+//   - 持续攻击（锁定级别达到告警级别）时写入审计日志告警
+//
+// 计数保存在 Redis 中，多实例共享；Redis 不可用时放行请求（优雅降级）。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ahavault/server/internal/database"
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// bruteForceKeyPrefix Redis 键前缀
+	bruteForceKeyPrefix = "bruteforce:"
+	// bruteForceLevelTTL 锁定级别的保留时间：期间再次触发锁定时逐级延长
+	bruteForceLevelTTL = 24 * time.Hour
+	// bruteForceFailureKey 上下文中记录失败类型的键
+	bruteForceFailureKey = "bruteforce_failure"
+)
+
+// bruteForceFailure 失败类型
+type bruteForceFailure int
+
+const (
+	failurePickup   bruteForceFailure = iota + 1 // 取件码无效或下载凭证无效
+	failurePassword                              // 访问密码错误
+)
+
+// BruteForceConfig 防暴力破解配置
+type BruteForceConfig struct {
+	MaxFailures     int           // 单个 IP 在窗口内允许的失败次数
+	CodeMaxFailures int           // 单个取件码在窗口内允许的访问密码错误次数
+	Window          time.Duration // 失败计数窗口
+	Lockout         time.Duration // 首次锁定时长，之后每次翻倍
+	MaxLockout      time.Duration // 最长锁定时长
+	AlertLevel      int           // 锁定级别达到该值时写入审计告警
+}
+
+// attemptStore 失败计数依赖的 Redis 操作
+//
+// 生产环境使用 database 包的 Redis 封装（见 redisAttemptStore），测试可替换为内存实现。
+type attemptStore interface {
+	Incr(ctx context.Context, key string) (int64, error)
+	Decr(ctx context.Context, key string) (int64, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+}
+
+// redisAttemptStore 使用 database 包的 Redis 封装
+type redisAttemptStore struct{}
+
+func (redisAttemptStore) Incr(ctx context.Context, key string) (int64, error) {
+	return database.Incr(ctx, key)
+}
+
+func (redisAttemptStore) Decr(ctx context.Context, key string) (int64, error) {
+	return database.Decr(ctx, key)
+}
+
+func (redisAttemptStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return database.Expire(ctx, key, ttl)
+}
+
+func (redisAttemptStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return database.TTL(ctx, key)
+}
+
+func (redisAttemptStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return database.Set(ctx, key, value, ttl)
+}
+
+func (redisAttemptStore) Del(ctx context.Context, key string) error {
+	return database.Del(ctx, key)
+}
+
+// BruteForceGuard 取件码与访问密码防暴力破解
+type BruteForceGuard struct {
+	store  attemptStore
+	db     *gorm.DB // 写入审计告警，为空时只记录日志
+	config BruteForceConfig
+}
+
+// NewBruteForceGuard 创建防暴力破解守卫（使用 database.RedisClient）
+func NewBruteForceGuard(db *gorm.DB, config BruteForceConfig) *BruteForceGuard {
+	return &BruteForceGuard{store: redisAttemptStore{}, db: db, config: config}
+}
+
+// RecordPickupFailure 记录一次取件失败（取件码无效或下载凭证无效）
+//
+// 由处理器在验证失败时调用，请求结束后计入客户端 IP 的失败次数。
+func RecordPickupFailure(c *gin.Context) {
+	if _, exists := c.Get(bruteForceFailureKey); !exists {
+		c.Set(bruteForceFailureKey, failurePickup)
+	}
+}
+
+// RecordPasswordFailure 记录一次访问密码错误
+//
+// 请求结束后同时计入客户端 IP 和取件码的失败次数。
+func RecordPasswordFailure(c *gin.Context) {
+	c.Set(bruteForceFailureKey, failurePassword)
+}
+
+// Middleware 返回防暴力破解中间件
+//
+// 请求前检查客户端 IP 是否被锁定，checkCode 为 true 时还检查路径中的取件码
+// （用于验证访问密码的端点；下载端点只校验凭证，取件码被锁定时不影响已获得凭证的下载）。
+// 未锁定时先把本次请求计为一次失败（Incr 同时完成计数和上限检查），窗口内的尝试已达上限时
+// 直接拒绝，并发的猜测因此不会超过上限；请求成功或未计为该范围的失败时退还。
+// 被拒绝时返回 429 和 Retry-After。
+func (g *BruteForceGuard) Middleware(checkCode bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ipScope := bruteForceScope(models.ResourceTypeIP, c.ClientIP())
+		code := shareAddress(c)
+		codeScope := ""
+		if checkCode && code != "" {
+			codeScope = bruteForceScope(models.ResourceTypeShare, code)
+		}
+
+		retryAfter := g.lockedFor(ctx, ipScope)
+		if codeScope != "" {
+			if d := g.lockedFor(ctx, codeScope); d > retryAfter {
+				retryAfter = d
+			}
+		}
+		if retryAfter > 0 {
+			abortTooManyAttempts(c, retryAfter)
+			return
+		}
+
+		ipCount, ok := g.reserveAttempt(ctx, ipScope, g.config.MaxFailures)
+		if !ok {
+			abortTooManyAttempts(c, g.windowFor(ctx, ipScope))
+			return
+		}
+		var codeCount int64
+		if codeScope != "" {
+			if codeCount, ok = g.reserveAttempt(ctx, codeScope, g.config.CodeMaxFailures); !ok {
+				g.refundAttempt(ctx, ipScope)
+				abortTooManyAttempts(c, g.windowFor(ctx, codeScope))
+				return
+			}
+		}
+
+		c.Next()
+
+		// 请求可能已被取消，计数不受影响
+		ctx = context.Background()
+		value, failed := c.Get(bruteForceFailureKey)
+		if failed {
+			g.recordFailure(ctx, c, models.ResourceTypeIP, c.ClientIP(), ipCount, g.config.MaxFailures)
+		} else {
+			g.refundAttempt(ctx, ipScope)
+		}
+		if codeScope == "" {
+			return
+		}
+		if value == failurePassword {
+			g.recordFailure(ctx, c, models.ResourceTypeShare, code, codeCount, g.config.CodeMaxFailures)
+		} else {
+			g.refundAttempt(ctx, codeScope)
+		}
+	}
+}
+
+// abortTooManyAttempts 返回 429 和 Retry-After
+func abortTooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code":    429,
+		"message": "Too many failed attempts",
+		"data": gin.H{
+			"retry_after": seconds,
+		},
+	})
+	c.Abort()
+}
+
+// shareAddress 返回路径中分享地址的计数标识
+//
+// 取件码规范化后使用（大小写不同的同一取件码共用计数）；分享链接使用令牌的指纹，
+// 令牌本身不写入 Redis 和审计日志。路径中没有分享地址时返回空字符串。
+func shareAddress(c *gin.Context) string {
+	if token := c.Param("token"); token != "" {
+		return "link-" + services.ShareLinkFingerprint(token)
+	}
+	return services.CanonicalPickupCode(c.Param("code"))
+}
+
+// lockedFor 返回剩余锁定时长，未锁定时为 0
+func (g *BruteForceGuard) lockedFor(ctx context.Context, scope string) time.Duration {
+	return g.remaining(ctx, bruteForceKeyPrefix+"lock:"+scope)
+}
+
+// windowFor 返回失败计数窗口的剩余时长
+func (g *BruteForceGuard) windowFor(ctx context.Context, scope string) time.Duration {
+	return g.remaining(ctx, bruteForceKeyPrefix+"fail:"+scope)
+}
+
+// remaining 返回键的剩余过期时长，键不存在或未设置过期时为 0
+func (g *BruteForceGuard) remaining(ctx context.Context, key string) time.Duration {
+	ttl, err := g.store.TTL(ctx, key)
+	if err != nil {
+		log.Printf("[BruteForce] Failed to check TTL of %s: %v", key, err)
+		return 0
+	}
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// bruteForceScope 生成计数范围（ip:<IP> 或 share:<取件码>）
+func bruteForceScope(resourceType, resourceID string) string {
+	return resourceType + ":" + resourceID
+}
+
+// reserveAttempt 处理请求前把本次尝试计为一次失败
+//
+// 返回计入后的次数；超过上限时退还并返回 false。Redis 不可用时放行（次数为 0，不会触发锁定）。
+func (g *BruteForceGuard) reserveAttempt(ctx context.Context, scope string, limit int) (int64, bool) {
+	failKey := bruteForceKeyPrefix + "fail:" + scope
+	count, err := g.store.Incr(ctx, failKey)
+	if err != nil {
+		log.Printf("[BruteForce] Failed to count attempt of %s: %v", scope, err)
+		return 0, true
+	}
+	if count == 1 {
+		g.store.Expire(ctx, failKey, g.config.Window)
+	}
+	if count > int64(limit) {
+		g.refundAttempt(ctx, scope)
+		return count, false
+	}
+	return count, true
+}
+
+// refundAttempt 退还预先计入的一次失败
+func (g *BruteForceGuard) refundAttempt(ctx context.Context, scope string) {
+	failKey := bruteForceKeyPrefix + "fail:" + scope
+	count, err := g.store.Decr(ctx, failKey)
+	if err != nil {
+		log.Printf("[BruteForce] Failed to refund attempt of %s: %v", scope, err)
+		return
+	}
+	// 期间已锁定并清零计数时，退还会得到没有过期时间的负数
+	if count < 0 {
+		g.store.Del(ctx, failKey)
+	}
+}
+
+// recordFailure 确认预先计入的失败，计入后的次数达到上限时锁定并清零计数
+func (g *BruteForceGuard) recordFailure(ctx context.Context, c *gin.Context, resourceType, resourceID string, count int64, limit int) {
+	if count < int64(limit) {
+		return
+	}
+
+	scope := bruteForceScope(resourceType, resourceID)
+	levelKey := bruteForceKeyPrefix + "level:" + scope
+	level, err := g.store.Incr(ctx, levelKey)
+	if err != nil {
+		log.Printf("[BruteForce] Failed to escalate lockout of %s: %v", scope, err)
+		return
+	}
+	g.store.Expire(ctx, levelKey, bruteForceLevelTTL)
+
+	lockout := g.lockoutFor(level)
+	if err := g.store.Set(ctx, bruteForceKeyPrefix+"lock:"+scope, strconv.FormatInt(level, 10), lockout); err != nil {
+		log.Printf("[BruteForce] Failed to lock %s: %v", scope, err)
+		return
+	}
+	g.store.Del(ctx, bruteForceKeyPrefix+"fail:"+scope)
+	log.Printf("[BruteForce] %s locked for %s after %d failures (level %d)", scope, lockout, count, level)
+
+	if g.config.AlertLevel > 0 && level >= int64(g.config.AlertLevel) {
+		g.alert(c, resourceType, resourceID, count, level, lockout)
+	}
+}
+
+// lockoutFor 计算指定级别的锁定时长：首次为 Lockout，之后每级翻倍，不超过 MaxLockout
+func (g *BruteForceGuard) lockoutFor(level int64) time.Duration {
+	lockout := g.config.Lockout
+	for i := int64(1); i < level && lockout < g.config.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if g.config.MaxLockout > 0 && lockout > g.config.MaxLockout {
+		lockout = g.config.MaxLockout
+	}
+	return lockout
+}
+
+// alert 持续攻击时写入审计日志告警
+func (g *BruteForceGuard) alert(c *gin.Context, resourceType, resourceID string, failures, level int64, lockout time.Duration) {
+	log.Printf("[BruteForce] ALERT: sustained attack on %s %s (lockout level %d)", resourceType, resourceID, level)
+	if g.db == nil {
+		return
+	}
+
+	err := models.CreateLog(g.db, nil, models.ActionBruteForceAlert, resourceType, resourceID,
+		c.ClientIP(), c.Request.UserAgent(), map[string]interface{}{
+			"path":     c.FullPath(),
+			"failures": failures,
+			"level":    level,
+			"lockout":  lockout.String(),
+		})
+	if err != nil {
+		log.Printf("[BruteForce] Failed to write audit alert: %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+// Package middleware 提供 HTTP 中间件测试
+//
+// 本文件测试取件码与访问密码防暴力破解：
+//   - 按 IP 与按取件码（或分享链接）的失败计数和锁定
+//   - 并发猜测不超过失败次数上限
+//   - 逐级延长的锁定时长
+//   - 持续攻击的审计告警
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memoryAttemptStore 模拟 Redis 的内存计数（多个守卫共享即模拟多实例）
+type memoryAttemptStore struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{values: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (s *memoryAttemptStore) get(key string) (string, bool) {
+	value, ok := s.values[key]
+	if expires, set := s.expires[key]; ok && set && time.Now().After(expires) {
+		delete(s.values, key)
+		delete(s.expires, key)
+		return "", false
+	}
+	return value, ok
+}
+
+func (s *memoryAttemptStore) Incr(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, _ := s.get(key)
+	n, _ := strconv.ParseInt(value, 10, 64)
+	n++
+	s.values[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (s *memoryAttemptStore) Decr(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, _ := s.get(key)
+	n, _ := strconv.ParseInt(value, 10, 64)
+	n--
+	s.values[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (s *memoryAttemptStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.get(key); ok {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (s *memoryAttemptStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.get(key); !ok {
+		return -2, nil
+	}
+	expires, set := s.expires[key]
+	if !set {
+		return -1, nil
+	}
+	return time.Until(expires), nil
+}
+
+func (s *memoryAttemptStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.expires[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memoryAttemptStore) Del(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	delete(s.expires, key)
+	return nil
+}
+
+// setupBruteForceRouter 创建带防暴力破解的测试路由
+//
+// 密码 "secret" 正确，"bad" 为取件码无效，其他为密码错误；下载端点的凭证 "ok" 有效。
+func setupBruteForceRouter(guard *BruteForceGuard) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/shares/:code", guard.Middleware(true), func(c *gin.Context) {
+		switch c.Query("password") {
+		case "secret":
+			c.Status(http.StatusOK)
+		case "bad":
+			RecordPickupFailure(c)
+			c.Status(http.StatusBadRequest)
+		default:
+			RecordPasswordFailure(c)
+			c.Status(http.StatusBadRequest)
+		}
+	})
+	router.GET("/download/:code", guard.Middleware(false), func(c *gin.Context) {
+		if c.Query("ticket") != "ok" {
+			RecordPickupFailure(c)
+			c.Status(http.StatusForbidden)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+// sendFrom 以指定客户端 IP 发送请求
+func sendFrom(router *gin.Engine, method, ip, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestBruteForceGuard_IPLockout 测试单个 IP 的失败次数达到上限后被锁定
+func TestBruteForceGuard_IPLockout(t *testing.T) {
+	guard := &BruteForceGuard{store: newMemoryAttemptStore(), config: BruteForceConfig{
+		MaxFailures: 3, CodeMaxFailures: 100, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour,
+	}}
+	router := setupBruteForceRouter(guard)
+
+	// 成功的请求不计数
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=secret").Code)
+	}
+
+	// 取件码无效与凭证无效都计入 IP 的失败次数
+	assert.Equal(t, http.StatusBadRequest, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=bad").Code)
+	assert.Equal(t, http.StatusForbidden, sendFrom(router, http.MethodGet, "192.0.2.1", "/download/BBBB3333?ticket=forged").Code)
+	assert.Equal(t, http.StatusBadRequest, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/CCCC4444?password=bad").Code)
+
+	// 锁定后即使密码正确也被拒绝，下载端点同样受限
+	w := sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=secret")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, http.MethodGet, "192.0.2.1", "/download/AAAA2222?ticket=ok").Code)
+
+	// 其他 IP 不受影响
+	assert.Equal(t, http.StatusOK, sendFrom(router, http.MethodPost, "192.0.2.2", "/shares/AAAA2222?password=secret").Code)
+}
+
+// TestBruteForceGuard_ConcurrentGuesses 测试并发的猜测在处理前计数，进入处理器的请求不超过上限
+func TestBruteForceGuard_ConcurrentGuesses(t *testing.T) {
+	store := newMemoryAttemptStore()
+	guard := &BruteForceGuard{store: store, config: BruteForceConfig{
+		MaxFailures: 100, CodeMaxFailures: 3, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour,
+	}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var entered, rejected atomic.Int32
+	release := make(chan struct{})
+	router.POST("/shares/:code", guard.Middleware(true), func(c *gin.Context) {
+		entered.Add(1)
+		<-release
+		RecordPasswordFailure(c)
+		c.Status(http.StatusBadRequest)
+	})
+
+	// 所有猜测同时处理中：进入处理器或被拒绝
+	const guesses = 20
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ip := "192.0.2." + strconv.Itoa(i+1)
+			if sendFrom(router, http.MethodPost, ip, "/shares/AAAA2222?password=guess").Code == http.StatusTooManyRequests {
+				rejected.Add(1)
+			}
+		}(i)
+	}
+	require.Eventually(t, func() bool {
+		return entered.Load()+rejected.Load() == guesses
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(3), entered.Load())
+	assert.Equal(t, int32(guesses-3), rejected.Load())
+
+	// 上限内的猜测全部失败后锁定取件码
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, http.MethodPost, "192.0.2.100", "/shares/AAAA2222?password=secret").Code)
+	assert.Equal(t, int32(3), entered.Load())
+}
+
+// TestBruteForceGuard_RefundOnSuccess 测试成功的请求退还预先计入的失败
+func TestBruteForceGuard_RefundOnSuccess(t *testing.T) {
+	store := newMemoryAttemptStore()
+	guard := &BruteForceGuard{store: store, config: BruteForceConfig{
+		MaxFailures: 2, CodeMaxFailures: 2, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour,
+	}}
+	router := setupBruteForceRouter(guard)
+
+	// 一次失败后，成功与取件码无效交替出现：成功不计数，取件码无效不计入取件码
+	assert.Equal(t, http.StatusBadRequest, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=guess").Code)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=secret").Code)
+	}
+	assert.Equal(t, http.StatusBadRequest, sendFrom(router, http.MethodPost, "192.0.2.2", "/shares/AAAA2222?password=bad").Code)
+
+	failKey := bruteForceKeyPrefix + "fail:"
+	ipCount, _ := store.get(failKey + bruteForceScope(models.ResourceTypeIP, "192.0.2.1"))
+	codeCount, _ := store.get(failKey + bruteForceScope(models.ResourceTypeShare, "AAAA2222"))
+	assert.Equal(t, "1", ipCount)
+	assert.Equal(t, "1", codeCount)
+
+	// 第二次密码错误达到上限，IP 和取件码都被锁定
+	assert.Equal(t, http.StatusBadRequest, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=guess").Code)
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, http.MethodGet, "192.0.2.1", "/download/AAAA2222?ticket=ok").Code)
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, http.MethodPost, "192.0.2.3", "/shares/AAAA2222?password=secret").Code)
+}
+
+// TestBruteForceGuard_CodeLockout 测试多个 IP 猜测同一取件码的密码时锁定该取件码
+func TestBruteForceGuard_CodeLockout(t *testing.T) {
+	store := newMemoryAttemptStore()
+	config := BruteForceConfig{
+		MaxFailures: 100, CodeMaxFailures: 3, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour,
+	}
+	// 两个实例共享计数
+	routerA := setupBruteForceRouter(&BruteForceGuard{store: store, config: config})
+	routerB := setupBruteForceRouter(&BruteForceGuard{store: store, config: config})
+
+	sendFrom(routerA, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=guess1")
+	sendFrom(routerB, http.MethodPost, "192.0.2.2", "/shares/AAAA2222?password=guess2")
+	sendFrom(routerA, http.MethodPost, "192.0.2.3", "/shares/AAAA2222?password=guess3")
+
+	// 取件码被锁定：新的 IP 也不能再验证密码
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(routerB, http.MethodPost, "192.0.2.4", "/shares/AAAA2222?password=secret").Code)
+	// 其他取件码、已获得凭证的下载不受影响
+	assert.Equal(t, http.StatusOK, sendFrom(routerA, http.MethodPost, "192.0.2.4", "/shares/BBBB3333?password=secret").Code)
+	assert.Equal(t, http.StatusOK, sendFrom(routerA, http.MethodGet, "192.0.2.4", "/download/AAAA2222?ticket=ok").Code)
+}
+
+// TestBruteForceGuard_LinkLockout 测试分享链接按令牌指纹计数，令牌本身不写入计数键
+func TestBruteForceGuard_LinkLockout(t *testing.T) {
+	store := newMemoryAttemptStore()
+	guard := &BruteForceGuard{store: store, config: BruteForceConfig{
+		MaxFailures: 100, CodeMaxFailures: 2, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour,
+	}}
+	router := setupBruteForceRouter(guard)
+	router.POST("/links/:token", guard.Middleware(true), func(c *gin.Context) {
+		if c.Query("password") != "secret" {
+			RecordPasswordFailure(c)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	token := "wO9O-d3k1nCMKcegeETxaYi7joc3ualD0Aw5M-8nhaE"
+
+	sendFrom(router, http.MethodPost, "192.0.2.1", "/links/"+token+"?password=guess1")
+	sendFrom(router, http.MethodPost, "192.0.2.2", "/links/"+token+"?password=guess2")
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, http.MethodPost, "192.0.2.3", "/links/"+token+"?password=secret").Code)
+
+	// 取件码和其他链接不受影响
+	assert.Equal(t, http.StatusOK, sendFrom(router, http.MethodPost, "192.0.2.3", "/shares/AAAA2222?password=secret").Code)
+	assert.Equal(t, http.StatusOK, sendFrom(router, http.MethodPost, "192.0.2.3", "/links/"+strings.Repeat("A", 43)+"?password=secret").Code)
+
+	for key := range store.values {
+		assert.NotContains(t, key, token)
+	}
+}
+
+// TestBruteForceGuard_Escalation 测试重复触发锁定时锁定时长逐级翻倍并写入审计告警
+func TestBruteForceGuard_Escalation(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`
+		CREATE TABLE audit_logs (
+			id TEXT PRIMARY KEY,
+			user_id TEXT,
+			action TEXT NOT NULL,
+			resource_type TEXT,
+			resource_id TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`).Error)
+
+	store := newMemoryAttemptStore()
+	guard := &BruteForceGuard{store: store, db: db, config: BruteForceConfig{
+		MaxFailures: 2, CodeMaxFailures: 100, Window: time.Minute,
+		Lockout: time.Minute, MaxLockout: 3 * time.Minute, AlertLevel: 3,
+	}}
+	router := setupBruteForceRouter(guard)
+	lockKey := bruteForceKeyPrefix + "lock:" + bruteForceScope(models.ResourceTypeIP, "192.0.2.1")
+
+	var lockouts []time.Duration
+	for level := 1; level <= 3; level++ {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusBadRequest, sendFrom(router, http.MethodPost, "192.0.2.1", "/shares/AAAA2222?password=bad").Code)
+		}
+		ttl, err := store.TTL(context.Background(), lockKey)
+		require.NoError(t, err)
+		lockouts = append(lockouts, ttl.Round(time.Minute))
+
+		var alerts int64
+		require.NoError(t, db.Model(&models.AuditLog{}).Where("action = ?", models.ActionBruteForceAlert).Count(&alerts).Error)
+		if level < 3 {
+			assert.Zero(t, alerts, "level %d must not raise an alert", level)
+		} else {
+			assert.Equal(t, int64(1), alerts)
+		}
+
+		// 模拟锁定到期
+		require.NoError(t, store.Del(context.Background(), lockKey))
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}, lockouts)
+
+	var alert models.AuditLog
+	require.NoError(t, db.Where("action = ?", models.ActionBruteForceAlert).First(&alert).Error)
+	assert.Equal(t, models.ResourceTypeIP, alert.ResourceType)
+	assert.Equal(t, "192.0.2.1", alert.ResourceID)
+}
@@ -17,13 +17,14 @@ import (
 	"net/http"
 	"time"
 
+	"ahavault/server/internal/database"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 )
 
 // RateLimitConfig 限流配置
 type RateLimitConfig struct {
-	// Redis 客户端
+	// Redis 客户端（为空时使用 database 包的全局 Redis 连接）
 	RedisClient *redis.Client
 
 	// 限流规则：每个时间窗口允许的最大请求数
@@ -90,7 +91,7 @@ func RateLimit(config RateLimitConfig) gin.HandlerFunc {
 		ctx := context.Background()
 
 		// 获取当前计数
-		count, err := config.RedisClient.Incr(ctx, key).Result()
+		count, err := rateLimitIncr(ctx, config.RedisClient, key)
 		if err != nil {
 			// Redis 错误时放行请求（优雅降级）
 			fmt.Printf("[RateLimit] Redis error: %v\n", err)
@@ -100,13 +101,13 @@ func RateLimit(config RateLimitConfig) gin.HandlerFunc {
 
 		// 如果是第一次请求，设置过期时间
 		if count == 1 {
-			config.RedisClient.Expire(ctx, key, config.Window)
+			rateLimitExpire(ctx, config.RedisClient, key, config.Window)
 		}
 
 		// 检查是否超过限制
 		if count > int64(config.Limit) {
 			// 获取剩余时间
-			ttl, _ := config.RedisClient.TTL(ctx, key).Result()
+			ttl, _ := rateLimitTTL(ctx, config.RedisClient, key)
 
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"code":    429,
@@ -130,6 +131,30 @@ func RateLimit(config RateLimitConfig) gin.HandlerFunc {
 	}
 }
 
+// rateLimitIncr 计数加一（未指定 Redis 客户端时使用 database.Incr）
+func rateLimitIncr(ctx context.Context, client *redis.Client, key string) (int64, error) {
+	if client == nil {
+		return database.Incr(ctx, key)
+	}
+	return client.Incr(ctx, key).Result()
+}
+
+// rateLimitExpire 设置计数的过期时间（未指定 Redis 客户端时使用 database.Expire）
+func rateLimitExpire(ctx context.Context, client *redis.Client, key string, window time.Duration) error {
+	if client == nil {
+		return database.Expire(ctx, key, window)
+	}
+	return client.Expire(ctx, key, window).Err()
+}
+
+// rateLimitTTL 获取计数的剩余时间（未指定 Redis 客户端时使用 database.TTL）
+func rateLimitTTL(ctx context.Context, client *redis.Client, key string) (time.Duration, error) {
+	if client == nil {
+		return database.TTL(ctx, key)
+	}
+	return client.TTL(ctx, key).Result()
+}
+
 // generateKey 生成限流键
 func generateKey(c *gin.Context, config RateLimitConfig) string {
 	switch config.LimitBy {
@@ -40,22 +40,28 @@ func (al *AuditLog) BeforeCreate(tx *gorm.DB) error {
 
 // 审计日志动作常量
 const (
-	ActionLogin          = "login"
-	ActionLogout         = "logout"
-	ActionRegister       = "register"
-	ActionUploadFile     = "upload_file"
-	ActionDownloadFile   = "download_file"
-	ActionDeleteFile     = "delete_file"
-	ActionRenameFile     = "rename_file"
-	ActionCreateShare    = "create_share"
-	ActionAccessShare    = "access_share"
-	ActionStopShare      = "stop_share"
-	ActionSaveToVault    = "save_to_vault"
-	ActionBanFile        = "ban_file"
-	ActionUnbanFile      = "unban_file"
-	ActionDisableUser    = "disable_user"
-	ActionEnableUser     = "enable_user"
-	ActionUpdateSettings = "update_settings"
+	ActionLogin             = "login"
+	ActionLogout            = "logout"
+	ActionRegister          = "register"
+	ActionUploadFile        = "upload_file"
+	ActionDownloadFile      = "download_file"
+	ActionDeleteFile        = "delete_file"
+	ActionRenameFile        = "rename_file"
+	ActionCreateShare       = "create_share"
+	ActionAccessShare       = "access_share"
+	ActionStopShare         = "stop_share"
+	ActionUpdateShare       = "update_share"
+	ActionReactivateShare   = "reactivate_share"
+	ActionCreateShareLink   = "create_share_link"
+	ActionRevokeShareLink   = "revoke_share_link"
+	ActionSaveToVault       = "save_to_vault"
+	ActionBanFile           = "ban_file"
+	ActionUnbanFile         = "unban_file"
+	ActionDisableUser       = "disable_user"
+	ActionEnableUser        = "enable_user"
+	ActionUpdateSettings    = "update_settings"
+	ActionUpdateSharePolicy = "update_share_policy"
+	ActionBruteForceAlert   = "brute_force_alert"
 )
 
 // 资源类型常量
@@ -64,6 +70,7 @@ const (
 	ResourceTypeFile     = "file"
 	ResourceTypeShare    = "share"
 	ResourceTypeSettings = "settings"
+	ResourceTypeIP       = "ip"
 )
 
 // CreateLog 创建审计日志
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DownloadSlotStatus 下载名额状态
+type DownloadSlotStatus string
+
+const (
+	DownloadSlotClaimed   DownloadSlotStatus = "claimed"   // 传输中，占用分享的一个下载名额
+	DownloadSlotCommitted DownloadSlotStatus = "committed" // 已计入下载次数
+	DownloadSlotReleased  DownloadSlotStatus = "released"  // 传输中断，名额已归还（可凭会话续传时重新占用）
+)
+
+// DownloadSlot 分享的一次下载会话
+//
+// 开始传输时以条件更新占用分享的下载名额（计入 share_sessions.reserved_downloads），
+// 传输完成（或累计发送达到计数阈值）时转为一次下载，中断时归还名额。
+// ID 即下载会话 ID：同一会话的 Range 续传不会重复计数。
+type DownloadSlot struct {
+	ID        uuid.UUID          `gorm:"type:uuid;primary_key" json:"id"`
+	ShareID   uuid.UUID          `gorm:"type:uuid;not null;index" json:"share_id"`
+	FileID    uuid.UUID          `gorm:"type:uuid;not null" json:"file_id"` // 打包下载或转存时为全零 UUID
+	Status    DownloadSlotStatus `gorm:"type:varchar(20);not null" json:"status"`
+	BytesSent int64              `gorm:"type:bigint;not null;default:0" json:"bytes_sent"` // 本会话累计发送的字节数
+	CreatedAt time.Time          `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time          `gorm:"not null;default:now()" json:"updated_at"`
+	ExpiresAt time.Time          `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName 指定表名
+func (DownloadSlot) TableName() string {
+	return "download_slots"
+}
+
+// IsExpired 检查下载会话是否已过期
+func (s *DownloadSlot) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// IsCommitted 检查是否已计入下载次数
+func (s *DownloadSlot) IsCommitted() bool {
+	return s.Status == DownloadSlotCommitted
+}
+
+// Release 将占用中的名额归还给分享
+//
+// 以状态条件更新判断归属：并发释放或提交同一名额时只有一方生效。
+// 返回 false 表示名额已被其他操作处理（已提交或已释放）。
+func (s *DownloadSlot) Release(tx *gorm.DB) (bool, error) {
+	result := tx.Model(&DownloadSlot{}).
+		Where("id = ? AND status = ?", s.ID, DownloadSlotClaimed).
+		Updates(map[string]interface{}{"status": DownloadSlotReleased, "updated_at": time.Now()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	err := tx.Model(&ShareSession{}).Where("id = ?", s.ShareID).
+		Update("reserved_downloads", gorm.Expr("reserved_downloads - 1")).Error
+	if err != nil {
+		return false, err
+	}
+	s.Status = DownloadSlotReleased
+	return true, nil
+}
+
+// Commit 将名额计入分享的下载次数
+//
+// 占用中的名额直接转为一次下载；已归还的名额（并行的另一个请求中断时归还）
+// 说明数据已经发出，同样计数。返回 false 表示名额已被提交过。
+func (s *DownloadSlot) Commit(tx *gorm.DB) (bool, error) {
+	for _, from := range []DownloadSlotStatus{DownloadSlotClaimed, DownloadSlotReleased} {
+		result := tx.Model(&DownloadSlot{}).
+			Where("id = ? AND status = ?", s.ID, from).
+			Updates(map[string]interface{}{"status": DownloadSlotCommitted, "updated_at": time.Now()})
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		updates := map[string]interface{}{"current_downloads": gorm.Expr("current_downloads + 1")}
+		if from == DownloadSlotClaimed {
+			updates["reserved_downloads"] = gorm.Expr("reserved_downloads - 1")
+		}
+		if err := tx.Model(&ShareSession{}).Where("id = ?", s.ShareID).Updates(updates).Error; err != nil {
+			return false, err
+		}
+		s.Status = DownloadSlotCommitted
+		return true, nil
+	}
+	return false, nil
+}
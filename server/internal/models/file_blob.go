@@ -11,7 +11,8 @@ import (
 type FileBlob struct {
 	Hash         string `gorm:"type:varchar(64);primary_key" json:"hash"`
 	StorePath    string `gorm:"type:varchar(255);not null" json:"store_path"`
-	EncryptedDEK string `gorm:"type:text;not null" json:"-"` // 加密的 DEK，不返回到前端
+	EncryptedDEK string `gorm:"type:text;not null" json:"-"`                                // 加密的 DEK，不返回到前端
+	KeyID        string `gorm:"type:varchar(64);not null;default:'default';index" json:"-"` // 加密 DEK 所用 KEK 的 ID
 	Size         int64  `gorm:"type:bigint;not null" json:"size"`
 	MimeType     string `gorm:"type:varchar(128)" json:"mime_type"`
 
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"mime"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
@@ -41,6 +43,20 @@ func (fm *FileMetadata) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// ContentType 返回文件的 MIME 类型
+//
+// 优先使用入库时识别并记录在 blob 上的类型（需预加载 FileBlob）；未记录类型的
+// 旧文件按扩展名推断，无法推断时返回 application/octet-stream。
+func (fm *FileMetadata) ContentType() string {
+	if fm.FileBlob.MimeType != "" {
+		return fm.FileBlob.MimeType
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(fm.Filename)); byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
 // IsDeleted 检查是否已软删除
 func (fm *FileMetadata) IsDeleted() bool {
 	return fm.DeletedAt != nil
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// QuotaReservation 进行中上传预占的存储配额
+//
+// 上传开始时预占声明大小的配额（计入 users.storage_reserved），文件入库时
+// 预占转为已用空间，上传失败、取消或过期时释放。ID 与上传 ID 一致
+// （分片上传会话 ID / Tus 上传 ID），便于各上传流程按 ID 提交或释放。
+type QuotaReservation struct {
+	ID        string    `gorm:"type:varchar(64);primary_key" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Size      int64     `gorm:"type:bigint;not null" json:"size"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName 指定表名
+func (QuotaReservation) TableName() string {
+	return "quota_reservations"
+}
+
+// IsExpired 检查预占是否已过期
+func (r *QuotaReservation) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// Release 删除预占记录并归还用户的预占配额
+//
+// 以删除结果判断归属：并发释放或提交同一预占时只有一方会归还配额。
+// 返回 false 表示预占已被其他操作处理。
+func (r *QuotaReservation) Release(tx *gorm.DB) (bool, error) {
+	result := tx.Where("id = ?", r.ID).Delete(&QuotaReservation{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	err := tx.Model(&User{}).Where("id = ?", r.UserID).
+		Update("storage_reserved", gorm.Expr("storage_reserved - ?", r.Size)).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ScrubReport 存储巡检报告
+type ScrubReport struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Status      string     `gorm:"type:varchar(20);not null;index" json:"status"` // running, completed, failed
+	TriggeredBy string     `gorm:"type:varchar(20);not null" json:"triggered_by"` // scheduled, manual
+	Quarantine  bool       `gorm:"type:boolean;not null;default:false" json:"quarantine"`
+	StartedAt   time.Time  `gorm:"not null;index" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+
+	// 统计
+	BlobsChecked      int   `gorm:"type:int;not null;default:0" json:"blobs_checked"`
+	BytesVerified     int64 `gorm:"type:bigint;not null;default:0" json:"bytes_verified"`
+	FilesScanned      int   `gorm:"type:int;not null;default:0" json:"files_scanned"` // 遍历到的存储文件数
+	MissingCount      int   `gorm:"type:int;not null;default:0" json:"missing_count"`
+	OrphanCount       int   `gorm:"type:int;not null;default:0" json:"orphan_count"`
+	CorruptedCount    int   `gorm:"type:int;not null;default:0" json:"corrupted_count"`
+	ErrorCount        int   `gorm:"type:int;not null;default:0" json:"error_count"`
+	QuarantinedCount  int   `gorm:"type:int;not null;default:0" json:"quarantined_count"`
+	OrphanScanSkipped bool  `gorm:"type:boolean;not null;default:false" json:"orphan_scan_skipped"` // 存储引擎不支持遍历
+
+	// 异常条目明细（[]ScrubIssue，超过上限时截断）
+	Issues datatypes.JSON `gorm:"type:jsonb" json:"issues"`
+	Error  string         `gorm:"type:text" json:"error,omitempty"`
+}
+
+// ScrubIssue 巡检发现的异常条目
+type ScrubIssue struct {
+	Kind        string `json:"kind"` // missing, orphan, corrupted, error
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	Quarantined bool   `json:"quarantined"`
+	Location    string `json:"location,omitempty"` // 隔离后的位置（仅孤儿文件）
+}
+
+// TableName 指定表名
+func (ScrubReport) TableName() string {
+	return "scrub_reports"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (sr *ScrubReport) BeforeCreate(tx *gorm.DB) error {
+	if sr.ID == uuid.Nil {
+		sr.ID = uuid.New()
+	}
+	return nil
+}
+
+// 巡检报告状态常量
+const (
+	ScrubStatusRunning   = "running"
+	ScrubStatusCompleted = "completed"
+	ScrubStatusFailed    = "failed"
+)
+
+// 巡检异常类型常量
+const (
+	ScrubIssueMissing   = "missing"   // 数据库有记录但存储中不存在
+	ScrubIssueOrphan    = "orphan"    // 存储中存在但数据库无记录
+	ScrubIssueCorrupted = "corrupted" // 无法解密或哈希不匹配（位衰减）
+	ScrubIssueError     = "error"     // 无法完成校验（如密钥缺失、读取失败）
+)
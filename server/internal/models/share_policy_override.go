@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SharePolicyOverride 管理员为单个用户设置的分享限制
+//
+// 字段为空时使用全局配置（MAX_SHARE_EXPIRY / MAX_FILES_PER_SHARE / MAX_ACTIVE_SHARES_USER），
+// 为 0 时表示对该用户不限制。
+type SharePolicyOverride struct {
+	UserID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"user_id"`
+	MaxShareExpiry   *int64     `gorm:"type:bigint" json:"max_share_expiry,omitempty"` // 最大分享有效期（秒）
+	MaxFilesPerShare *int       `gorm:"type:int" json:"max_files_per_share,omitempty"`
+	MaxActiveShares  *int       `gorm:"type:int" json:"max_active_shares,omitempty"`
+	UpdatedBy        *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"` // 设置该限制的管理员
+	UpdatedAt        time.Time  `gorm:"not null;default:now()" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (SharePolicyOverride) TableName() string {
+	return "share_policy_overrides"
+}
+
+// IsEmpty 检查是否未覆盖任何限制
+func (o *SharePolicyOverride) IsEmpty() bool {
+	return o.MaxShareExpiry == nil && o.MaxFilesPerShare == nil && o.MaxActiveShares == nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ShareRecipient 指定接收人分享的接收人
+//
+// 接收人必须是创建分享时已注册的用户。注册不验证邮箱所有权，因此不能按邮箱把分享
+// 交给之后注册该邮箱的人。Email 为创建分享时接收人的邮箱（小写），仅用于展示。
+type ShareRecipient struct {
+	ID      uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ShareID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_share_recipient" json:"share_id"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_share_recipient;index" json:"user_id"`
+	Email   string    `gorm:"type:varchar(255);not null" json:"email"`
+
+	// 访问记录（打开分享或转存时更新）
+	AccessCount     int        `gorm:"type:int;not null;default:0" json:"access_count"`
+	FirstAccessedAt *time.Time `gorm:"default:null" json:"first_accessed_at,omitempty"`
+	LastAccessedAt  *time.Time `gorm:"default:null" json:"last_accessed_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ShareRecipient) TableName() string {
+	return "share_recipients"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (r *ShareRecipient) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// HasAccessed 检查接收人是否访问过分享
+func (r *ShareRecipient) HasAccessed() bool {
+	return r.FirstAccessedAt != nil
+}
@@ -11,13 +11,16 @@ import (
 // ShareSession 分享会话模型
 type ShareSession struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	PickupCode string    `gorm:"type:varchar(8);uniqueIndex;not null" json:"pickup_code"`
+	PickupCode string    `gorm:"type:varchar(32);uniqueIndex;not null" json:"pickup_code"`
+	LinkToken  *string   `gorm:"type:varchar(64);uniqueIndex" json:"link_token,omitempty"` // 分享链接令牌，nil 表示未启用
 	CreatorID  uuid.UUID `gorm:"type:uuid;not null;index" json:"creator_id"`
 
 	// 访问控制
-	PasswordHash     string `gorm:"type:varchar(255)" json:"-"` // 密码哈希，不返回到前端
-	MaxDownloads     int    `gorm:"type:int;not null;default:0" json:"max_downloads"`
-	CurrentDownloads int    `gorm:"type:int;not null;default:0" json:"current_downloads"`
+	PasswordHash      string `gorm:"type:varchar(255)" json:"-"`               // 密码哈希，不返回到前端
+	Restricted        bool   `gorm:"not null;default:false" json:"restricted"` // 仅限指定的接收人访问
+	MaxDownloads      int    `gorm:"type:int;not null;default:0" json:"max_downloads"`
+	CurrentDownloads  int    `gorm:"type:int;not null;default:0" json:"current_downloads"`
+	ReservedDownloads int    `gorm:"type:int;not null;default:0" json:"-"` // 传输中占用的下载名额
 
 	// 生命周期
 	CreatedAt time.Time  `gorm:"not null;default:now();index" json:"created_at"`
@@ -100,6 +103,11 @@ func (ss *ShareSession) HasPassword() bool {
 	return ss.PasswordHash != ""
 }
 
+// HasLink 检查是否启用了分享链接
+func (ss *ShareSession) HasLink() bool {
+	return ss.LinkToken != nil
+}
+
 // Stop 停止分享
 func (ss *ShareSession) Stop(tx *gorm.DB) error {
 	now := time.Now()
@@ -140,14 +148,24 @@ func (ss *ShareSession) HoursUntilExpiry() int {
 	return hours
 }
 
-// CanAccess 检查是否可以访问（综合检查）
-func (ss *ShareSession) CanAccess() error {
+// CheckAvailable 检查分享是否仍然有效（未停止、未过期），不检查下载次数
+//
+// 下载次数由占用下载名额时的条件更新原子地检查，见 DownloadSlot。
+func (ss *ShareSession) CheckAvailable() error {
 	if ss.IsStopped() {
 		return fmt.Errorf("share has been stopped by owner")
 	}
 	if ss.IsExpired() {
 		return fmt.Errorf("share has expired")
 	}
+	return nil
+}
+
+// CanAccess 检查是否可以访问（综合检查）
+func (ss *ShareSession) CanAccess() error {
+	if err := ss.CheckAvailable(); err != nil {
+		return err
+	}
 	if ss.IsExhausted() {
 		return fmt.Errorf("download limit reached")
 	}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// StorageMigration 存储后端迁移任务
+//
+// 按 hash 顺序迁移 file_blobs，LastHash 记录已完成的最后一个 hash，
+// 进程崩溃后从 LastHash 继续。
+type StorageMigration struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Source     string     `gorm:"type:varchar(20);not null;index:idx_storage_migrations_pair" json:"source"`
+	Target     string     `gorm:"type:varchar(20);not null;index:idx_storage_migrations_pair" json:"target"`
+	Status     string     `gorm:"type:varchar(20);not null;index" json:"status"`         // running, completed, failed
+	LastHash   string     `gorm:"type:varchar(64);not null;default:''" json:"last_hash"` // 已完成的最后一个 hash
+	StartedAt  time.Time  `gorm:"not null" json:"started_at"`
+	UpdatedAt  time.Time  `gorm:"not null;default:now()" json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	// 统计
+	TotalBlobs  int64 `gorm:"type:bigint;not null;default:0" json:"total_blobs"`
+	Copied      int64 `gorm:"type:bigint;not null;default:0" json:"copied"`
+	Skipped     int64 `gorm:"type:bigint;not null;default:0" json:"skipped"` // 目标中已存在且校验一致
+	Failed      int64 `gorm:"type:bigint;not null;default:0" json:"failed"`
+	BytesCopied int64 `gorm:"type:bigint;not null;default:0" json:"bytes_copied"`
+
+	// 失败明细（[]StorageMigrationFailure，超过上限时截断）
+	Failures datatypes.JSON `gorm:"type:jsonb" json:"failures"`
+	Error    string         `gorm:"type:text" json:"error,omitempty"`
+}
+
+// StorageMigrationFailure 迁移失败的 blob
+type StorageMigrationFailure struct {
+	Hash  string `json:"hash"`
+	Error string `json:"error"`
+}
+
+// TableName 指定表名
+func (StorageMigration) TableName() string {
+	return "storage_migrations"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (sm *StorageMigration) BeforeCreate(tx *gorm.DB) error {
+	if sm.ID == uuid.Nil {
+		sm.ID = uuid.New()
+	}
+	return nil
+}
+
+// 存储迁移状态常量
+const (
+	StorageMigrationRunning   = "running"
+	StorageMigrationCompleted = "completed"
+	StorageMigrationFailed    = "failed"
+)
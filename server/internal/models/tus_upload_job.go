@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TusUploadJob Tus 上传完成后的入库任务
+//
+// 每个完成的 Tus 上传对应一条记录（ID 即 Tus 上传 ID），后台任务将
+// 临时文件加密入库并回写 FileID。失败时按指数退避重试。处理中的任务
+// 由实例以租约持有并定期续期，租约过期（持有实例崩溃）后任务会被重新排队。
+type TusUploadJob struct {
+	ID       string    `gorm:"type:varchar(64);primary_key" json:"upload_id"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	Filename string    `gorm:"type:varchar(255);not null" json:"filename"`
+	Size     int64     `gorm:"type:bigint;not null" json:"size"`
+
+	Status        string     `gorm:"type:varchar(20);not null;index:idx_tus_upload_jobs_due,priority:1" json:"status"` // pending, processing, completed, failed
+	Attempts      int        `gorm:"type:int;not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_tus_upload_jobs_due,priority:2" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"error,omitempty"`
+	FileID        *uuid.UUID `gorm:"type:uuid" json:"file_id,omitempty"` // 入库成功后的 FileMetadata ID
+
+	LockedBy       *string    `gorm:"type:varchar(64)" json:"-"` // 持有任务的实例标识
+	LeaseExpiresAt *time.Time `json:"-"`                         // 租约到期时间，持有实例定期续期
+
+	CreatedAt   time.Time  `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"not null;default:now()" json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// TableName 指定表名
+func (TusUploadJob) TableName() string {
+	return "tus_upload_jobs"
+}
+
+// IsTerminal 任务是否已结束（成功或最终失败）
+func (j *TusUploadJob) IsTerminal() bool {
+	return j.Status == TusJobCompleted || j.Status == TusJobFailed
+}
+
+// Tus 入库任务状态常量
+const (
+	TusJobPending    = "pending"
+	TusJobProcessing = "processing"
+	TusJobCompleted  = "completed"
+	TusJobFailed     = "failed"
+)
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// UploadChallenge 秒传持有证明挑战
+//
+// 秒传前服务端随机选取若干明文区间，客户端必须返回这些区间的哈希，
+// 以证明自己确实持有文件内容，而不仅仅知道文件的 SHA-256。
+// 挑战只能使用一次，验证（无论成功与否）后即被删除。
+type UploadChallenge struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"-"`
+	Hash      string         `gorm:"type:varchar(64);not null" json:"hash"`
+	Size      int64          `gorm:"not null;default:0" json:"size"`         // 客户端声明的文件大小，挑战区间据此选取
+	Nonce     string         `gorm:"type:varchar(64);not null" json:"nonce"` // HEX 编码的随机数，参与证明哈希计算
+	Ranges    datatypes.JSON `gorm:"type:jsonb;not null" json:"ranges"`      // []ChallengeRange
+	CreatedAt time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	ExpiresAt time.Time      `gorm:"not null;index" json:"expires_at"`
+}
+
+// ChallengeRange 挑战要求证明的明文区间
+type ChallengeRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// TableName 指定表名
+func (UploadChallenge) TableName() string {
+	return "upload_challenges"
+}
+
+// BeforeCreate GORM 钩子：创建前
+func (uc *UploadChallenge) BeforeCreate(tx *gorm.DB) error {
+	if uc.ID == uuid.Nil {
+		uc.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired 检查挑战是否过期
+func (uc *UploadChallenge) IsExpired() bool {
+	return time.Now().After(uc.ExpiresAt)
+}
@@ -16,8 +16,9 @@ type User struct {
 	Status   string    `gorm:"type:varchar(50);not null;default:'active'" json:"status"`
 
 	// 存储配额
-	StorageQuota int64 `gorm:"type:bigint;not null;default:10737418240" json:"storage_quota"` // 10GB
-	StorageUsed  int64 `gorm:"type:bigint;not null;default:0" json:"storage_used"`
+	StorageQuota    int64 `gorm:"type:bigint;not null;default:10737418240" json:"storage_quota"` // 10GB
+	StorageUsed     int64 `gorm:"type:bigint;not null;default:0" json:"storage_used"`
+	StorageReserved int64 `gorm:"type:bigint;not null;default:0" json:"storage_reserved"` // 进行中上传预占的配额
 
 	// 时间戳
 	CreatedAt   time.Time  `gorm:"not null;default:now()" json:"created_at"`
@@ -65,14 +66,14 @@ func (u *User) IsActive() bool {
 	return u.Status == StatusActive
 }
 
-// HasStorageSpace 检查是否有足够的存储空间
+// HasStorageSpace 检查是否有足够的存储空间（已用与预占空间均计入）
 func (u *User) HasStorageSpace(requiredSize int64) bool {
-	return u.StorageUsed+requiredSize <= u.StorageQuota
+	return u.StorageUsed+u.StorageReserved+requiredSize <= u.StorageQuota
 }
 
 // AvailableStorage 获取可用存储空间
 func (u *User) AvailableStorage() int64 {
-	available := u.StorageQuota - u.StorageUsed
+	available := u.StorageQuota - u.StorageUsed - u.StorageReserved
 	if available < 0 {
 		return 0
 	}
@@ -0,0 +1,216 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现分享下载名额：
+//   - 开始传输时以条件更新原子地占用下载名额（并发请求不会突破下载次数限制）
+//   - 传输完成，或累计发送达到计数阈值时才计入下载次数，中断的传输归还名额
+//   - 同一下载会话的 Range 续传复用名额，不重复计数；从头开始的请求占用新的名额
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDownloadLimitReached 分享的下载次数已用完（含传输中占用的名额）
+	ErrDownloadLimitReached = errors.New("download limit reached")
+	// ErrShareUnavailable 分享已停止或已过期
+	ErrShareUnavailable = errors.New("share is no longer available")
+)
+
+// DownloadSessionTTL 下载会话的有效期
+//
+// 有效期内同一会话的续传不重复计数；异常退出未归还的名额在过期后由 GC 释放。
+const DownloadSessionTTL = 24 * time.Hour
+
+// DownloadRequest 客户端的下载请求
+type DownloadRequest struct {
+	SessionID string // 客户端携带的下载会话 ID
+	Offset    int64  // 请求的起始字节，没有 Range 时为 0
+	Size      int64  // 内容总大小，未知（如 ZIP）时为 -1
+}
+
+// SetDownloadCountThreshold 设置下载计数阈值（字节）
+//
+// 一次下载会话累计发送达到阈值时即计入下载次数，0 表示只在完整传输后计数。
+func (s *ShareService) SetDownloadCountThreshold(threshold int64) {
+	s.countThreshold = threshold
+}
+
+// ClaimDownload 为一次下载占用分享的下载名额
+//
+// 客户端携带的下载会话属于同一分享和文件且未过期时复用：已归还名额的会话重新占用，
+// 占用中或已计数的会话只用于续传（见 resumeSession）；否则创建新会话。
+// fileID 为 uuid.Nil 时表示打包下载或转存整个分享。
+// 名额用完时返回 ErrDownloadLimitReached。
+func (s *ShareService) ClaimDownload(share *models.ShareSession, fileID uuid.UUID, req DownloadRequest) (*models.DownloadSlot, error) {
+	if slot, err := s.resumeSession(share, fileID, req); err != nil || slot != nil {
+		return slot, err
+	}
+
+	now := time.Now()
+	slot := &models.DownloadSlot{
+		ID:        uuid.New(),
+		ShareID:   share.ID,
+		FileID:    fileID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(DownloadSessionTTL),
+	}
+	if err := s.claimSlot(share.ID, slot, true); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// ResumeDownload 凭已有的下载会话续传
+//
+// 与 ClaimDownload 相同，但不创建新会话：会话不存在、已过期或不属于该分享和文件时
+// 返回 ErrTicketExpired。用于下载凭证过期后的续传。
+func (s *ShareService) ResumeDownload(share *models.ShareSession, fileID uuid.UUID, req DownloadRequest) (*models.DownloadSlot, error) {
+	slot, err := s.resumeSession(share, fileID, req)
+	if err != nil {
+		return nil, err
+	}
+	if slot == nil {
+		return nil, ErrTicketExpired
+	}
+	return slot, nil
+}
+
+// resumeSession 复用客户端携带的下载会话，没有可复用的会话时返回 nil
+//
+// 占用中或已计数的会话只有在请求从中间开始（Range 起始位置大于 0）、且会话累计发送
+// 不足内容大小时复用，否则同一会话可以在有效期内反复完整下载而不计数。
+func (s *ShareService) resumeSession(share *models.ShareSession, fileID uuid.UUID, req DownloadRequest) (*models.DownloadSlot, error) {
+	id, err := uuid.Parse(req.SessionID)
+	if err != nil {
+		return nil, nil
+	}
+
+	var slot models.DownloadSlot
+	err = s.db.Where("id = ? AND share_id = ? AND file_id = ? AND expires_at > ?", id, share.ID, fileID, time.Now()).
+		First(&slot).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get download session: %w", err)
+	}
+	if slot.Status != models.DownloadSlotReleased {
+		if req.Offset <= 0 || req.Offset >= req.Size || slot.BytesSent >= req.Size {
+			return nil, nil
+		}
+		return &slot, nil
+	}
+	if err := s.claimSlot(share.ID, &slot, false); err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// claimSlot 以条件更新占用一个下载名额，create 为 false 时重新占用已归还的会话
+func (s *ShareService) claimSlot(shareID uuid.UUID, slot *models.DownloadSlot, create bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ShareSession{}).
+			Where("id = ? AND stopped_at IS NULL AND expires_at > ?", shareID, time.Now()).
+			Where("max_downloads = 0 OR current_downloads + reserved_downloads < max_downloads").
+			Update("reserved_downloads", gorm.Expr("reserved_downloads + 1"))
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim download slot: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			var share models.ShareSession
+			if err := tx.First(&share, "id = ?", shareID).Error; err != nil {
+				return fmt.Errorf("failed to get share: %w", err)
+			}
+			if err := share.CheckAvailable(); err != nil {
+				return fmt.Errorf("%w: %v", ErrShareUnavailable, err)
+			}
+			return ErrDownloadLimitReached
+		}
+
+		slot.Status = models.DownloadSlotClaimed
+		if create {
+			if err := tx.Create(slot).Error; err != nil {
+				return fmt.Errorf("failed to create download session: %w", err)
+			}
+			return nil
+		}
+
+		result = tx.Model(&models.DownloadSlot{}).
+			Where("id = ? AND status = ?", slot.ID, models.DownloadSlotReleased).
+			Updates(map[string]interface{}{"status": models.DownloadSlotClaimed, "updated_at": time.Now()})
+		if result.Error != nil {
+			return fmt.Errorf("failed to reclaim download session: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// 并发请求已重新占用或提交了该会话，撤销本次占用
+			return tx.Model(&models.ShareSession{}).Where("id = ?", shareID).
+				Update("reserved_downloads", gorm.Expr("reserved_downloads - 1")).Error
+		}
+		return nil
+	})
+}
+
+// FinishDownload 结束一次传输
+//
+// 累计本会话发送的字节数，达到计数点时计入下载次数，否则归还名额（之后可凭会话续传）。
+// 计数点为内容总大小，设置了更小的计数阈值时为阈值；size < 0 表示大小未知（如 ZIP），
+// 此时完整传输或达到阈值时计数。返回该会话是否已计入下载次数。
+func (s *ShareService) FinishDownload(slot *models.DownloadSlot, sent int64, size int64, completed bool) (bool, error) {
+	committed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if sent > 0 {
+			err := tx.Model(&models.DownloadSlot{}).Where("id = ?", slot.ID).
+				Updates(map[string]interface{}{
+					"bytes_sent": gorm.Expr("bytes_sent + ?", sent),
+					"updated_at": time.Now(),
+				}).Error
+			if err != nil {
+				return fmt.Errorf("failed to record download progress: %w", err)
+			}
+		}
+
+		var current models.DownloadSlot
+		if err := tx.First(&current, "id = ?", slot.ID).Error; err != nil {
+			return fmt.Errorf("failed to get download session: %w", err)
+		}
+		*slot = current
+		if slot.IsCommitted() {
+			committed = true
+			return nil
+		}
+
+		if !s.reachedCountPoint(slot.BytesSent, size, completed) {
+			_, err := slot.Release(tx)
+			return err
+		}
+		if _, err := slot.Commit(tx); err != nil {
+			return fmt.Errorf("failed to commit download: %w", err)
+		}
+		committed = true
+		return nil
+	})
+	return committed, err
+}
+
+// reachedCountPoint 判断累计发送的字节数是否达到计数点
+func (s *ShareService) reachedCountPoint(sent int64, size int64, completed bool) bool {
+	if size < 0 {
+		return completed || (s.countThreshold > 0 && sent >= s.countThreshold)
+	}
+	point := size
+	if s.countThreshold > 0 && s.countThreshold < size {
+		point = s.countThreshold
+	}
+	return sent >= point
+}
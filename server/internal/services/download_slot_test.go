@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createLimitedShare 上传一个文件并创建限制下载次数的分享
+func createLimitedShare(t *testing.T, shareService *ShareService, fileService *FileService, user *models.User, maxDownloads int) (*models.ShareSession, *models.FileMetadata) {
+	content := bytes.Repeat([]byte("d"), 100)
+	file, err := fileService.UploadFile(user.ID, "limited.bin", int64(len(content)), bytes.NewReader(content))
+	require.NoError(t, err)
+
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+		FileIDs:      []uuid.UUID{file.ID},
+		ExpiresIn:    time.Hour,
+		MaxDownloads: maxDownloads,
+	})
+	require.NoError(t, err)
+	return share, file
+}
+
+// reloadShare 重新读取分享的下载计数
+func reloadShare(t *testing.T, shareService *ShareService, share *models.ShareSession) *models.ShareSession {
+	var fresh models.ShareSession
+	require.NoError(t, shareService.db.First(&fresh, "id = ?", share.ID).Error)
+	return &fresh
+}
+
+// TestClaimDownload_Concurrent 测试并发下载不会突破下载次数限制
+func TestClaimDownload_Concurrent(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // 内存数据库的每个连接都是独立的库
+
+	share, file := createLimitedShare(t, shareService, fileService, user, 3)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slot, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{})
+			if err != nil {
+				assert.ErrorIs(t, err, ErrDownloadLimitReached)
+				return
+			}
+			mu.Lock()
+			granted++
+			mu.Unlock()
+			_, err = shareService.FinishDownload(slot, file.Size, file.Size, true)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, granted)
+	fresh := reloadShare(t, shareService, share)
+	assert.Equal(t, 3, fresh.CurrentDownloads)
+	assert.Equal(t, 0, fresh.ReservedDownloads)
+}
+
+// TestDownloadSlot_Lifecycle 测试下载名额的占用、归还与续传
+//
+// 测试场景：
+//  1. 传输中占用名额，其他下载被拒绝
+//  2. 中断的传输不计数并归还名额
+//  3. 同一会话续传完成后只计一次
+//  4. 下载次数用完后，已发送完整文件的会话不能再次下载
+func TestDownloadSlot_Lifecycle(t *testing.T) {
+	shareService, fileService, user, _ := setupShareTestEnv(t)
+	share, file := createLimitedShare(t, shareService, fileService, user, 1)
+
+	slot, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, models.DownloadSlotClaimed, slot.Status)
+
+	_, err = shareService.ClaimDownload(share, file.ID, DownloadRequest{})
+	assert.ErrorIs(t, err, ErrDownloadLimitReached)
+
+	// 传输到一半中断
+	committed, err := shareService.FinishDownload(slot, 40, file.Size, false)
+	require.NoError(t, err)
+	assert.False(t, committed)
+	fresh := reloadShare(t, shareService, share)
+	assert.Equal(t, 0, fresh.CurrentDownloads)
+	assert.Equal(t, 0, fresh.ReservedDownloads)
+
+	// 凭会话续传剩余部分
+	resumed, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Offset: 40, Size: file.Size})
+	require.NoError(t, err)
+	assert.Equal(t, slot.ID, resumed.ID)
+	committed, err = shareService.FinishDownload(resumed, 60, file.Size, true)
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 1, reloadShare(t, shareService, share).CurrentDownloads)
+
+	// 下载次数已用完：新下载被拒绝，已发送完整文件的会话不能从头或从中间再次下载
+	_, err = shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: uuid.NewString()})
+	assert.ErrorIs(t, err, ErrDownloadLimitReached)
+	_, err = shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Size: file.Size})
+	assert.ErrorIs(t, err, ErrDownloadLimitReached)
+	_, err = shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Offset: 1, Size: file.Size})
+	assert.ErrorIs(t, err, ErrDownloadLimitReached)
+	fresh = reloadShare(t, shareService, share)
+	assert.Equal(t, 1, fresh.CurrentDownloads)
+	assert.Equal(t, 0, fresh.ReservedDownloads)
+
+	// 会话不能用于其他文件
+	_, err = shareService.ClaimDownload(share, uuid.Nil, DownloadRequest{SessionID: slot.ID.String(), Offset: 40, Size: file.Size})
+	assert.ErrorIs(t, err, ErrDownloadLimitReached)
+}
+
+// TestDownloadSlot_CountThreshold 测试达到计数阈值时即计数，计数后的续传不重复计数
+func TestDownloadSlot_CountThreshold(t *testing.T) {
+	shareService, fileService, user, _ := setupShareTestEnv(t)
+	shareService.SetDownloadCountThreshold(50)
+	share, file := createLimitedShare(t, shareService, fileService, user, 0)
+
+	// 未达到阈值的中断不计数
+	slot, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{})
+	require.NoError(t, err)
+	committed, err := shareService.FinishDownload(slot, 30, file.Size, false)
+	require.NoError(t, err)
+	assert.False(t, committed)
+
+	// 累计达到阈值后即使中断也计数
+	slot, err = shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Offset: 30, Size: file.Size})
+	require.NoError(t, err)
+	committed, err = shareService.FinishDownload(slot, 20, file.Size, false)
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 1, reloadShare(t, shareService, share).CurrentDownloads)
+
+	// 已计数会话续传剩余部分不重复计数
+	resumed, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Offset: 50, Size: file.Size})
+	require.NoError(t, err)
+	assert.Equal(t, slot.ID, resumed.ID)
+	committed, err = shareService.FinishDownload(resumed, 50, file.Size, true)
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 1, reloadShare(t, shareService, share).CurrentDownloads)
+
+	// 从头开始的下载占用新的名额
+	again, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Size: file.Size})
+	require.NoError(t, err)
+	assert.NotEqual(t, slot.ID, again.ID)
+	_, err = shareService.FinishDownload(again, file.Size, file.Size, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reloadShare(t, shareService, share).CurrentDownloads)
+
+	// 大小未知的打包下载：达到阈值或完整传输时计数
+	zipSlot, err := shareService.ClaimDownload(share, uuid.Nil, DownloadRequest{})
+	require.NoError(t, err)
+	committed, err = shareService.FinishDownload(zipSlot, 10, -1, true)
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 3, reloadShare(t, shareService, share).CurrentDownloads)
+}
@@ -0,0 +1,263 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现分享下载凭证（ticket）：
+//   - 验证访问密码后签发短时有效的凭证，绑定分享（可选绑定单个文件）
+//   - 下载端点只接受凭证，访问密码不再出现在下载地址中（访问日志、浏览器历史、代理）
+//   - 凭证在有效期内可重复使用；过期后仍可凭同一下载会话续传，但不能开始新的下载
+//   - 分享的访问密码变更后，之前签发的凭证立即失效
+//   - 指定接收人的分享，凭证绑定签发给的用户，转发给他人不能使用
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrTicketRequired 下载请求未携带凭证
+	ErrTicketRequired = errors.New("download ticket required")
+	// ErrInvalidTicket 凭证无效（签名错误、不属于该分享或访问密码已变更）
+	ErrInvalidTicket = errors.New("invalid download ticket")
+	// ErrTicketExpired 凭证已过期，且请求不是已有下载会话的续传
+	ErrTicketExpired = errors.New("download ticket expired")
+)
+
+// DefaultDownloadTicketTTL 默认的下载凭证有效期
+const DefaultDownloadTicketTTL = 10 * time.Minute
+
+// downloadTicketAudience 下载凭证的 aud 声明，与登录令牌区分
+const downloadTicketAudience = "share-download"
+
+// DownloadTicket 分享下载凭证
+type DownloadTicket struct {
+	Token     string
+	ShareID   uuid.UUID
+	FileID    uuid.UUID // 全零 UUID 表示整个分享
+	ViewerID  uuid.UUID // 指定接收人的分享：签发给的用户，否则为全零 UUID
+	ExpiresAt time.Time
+	Expired   bool // 已过期，只能用于续传已有的下载会话
+}
+
+// downloadTicketClaims 下载凭证的 JWT 声明
+type downloadTicketClaims struct {
+	ShareID  string `json:"sid"`
+	FileID   string `json:"fid,omitempty"`
+	Password string `json:"pwd,omitempty"` // 签发时访问密码的指纹
+	jwt.RegisteredClaims
+}
+
+// SetDownloadTicket 设置下载凭证的签名密钥和有效期
+//
+// 签名密钥由 secret 派生，与登录令牌使用不同的密钥，两者不能互相冒用。
+// 多实例部署时各实例必须使用相同的 secret。
+func (s *ShareService) SetDownloadTicket(secret string, ttl time.Duration) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("ahavault download ticket"))
+	s.ticketKey = mac.Sum(nil)
+	if ttl > 0 {
+		s.ticketTTL = ttl
+	}
+}
+
+// newTicketKey 生成随机的凭证签名密钥（未调用 SetDownloadTicket 时使用，仅对本实例有效）
+func newTicketKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate download ticket key: %v", err))
+	}
+	return key
+}
+
+// IssueDownloadTicket 为已验证访问密码的分享签发下载凭证
+//
+// fileID 不为全零 UUID 时凭证只能下载该文件，文件必须属于该分享。
+// 指定接收人的分享，凭证绑定 viewerID（sub 声明），只有该用户和分享创建者可以使用。
+func (s *ShareService) IssueDownloadTicket(share *models.ShareSession, fileID uuid.UUID, viewerID uuid.UUID) (*DownloadTicket, error) {
+	if fileID != uuid.Nil {
+		var count int64
+		err := s.db.Model(&models.ShareFile{}).
+			Where("share_id = ? AND file_id = ?", share.ID, fileID).
+			Count(&count).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify share file: %w", err)
+		}
+		if count == 0 {
+			return nil, errors.New("file not found in share")
+		}
+	}
+
+	now := time.Now()
+	ticket := &DownloadTicket{
+		ShareID:   share.ID,
+		FileID:    fileID,
+		ExpiresAt: now.Add(s.ticketTTL),
+	}
+	claims := downloadTicketClaims{
+		ShareID:  share.ID.String(),
+		Password: s.passwordTag(share),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{downloadTicketAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(ticket.ExpiresAt),
+		},
+	}
+	if fileID != uuid.Nil {
+		claims.FileID = fileID.String()
+	}
+	if share.Restricted {
+		ticket.ViewerID = viewerID
+		claims.Subject = viewerID.String()
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.ticketKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign download ticket: %w", err)
+	}
+	ticket.Token = token
+	return ticket, nil
+}
+
+// GetShareByTicket 验证下载凭证，返回分享及凭证可以下载的文件
+//
+// 凭证绑定了文件时只返回该文件。不检查下载次数：下载次数在占用下载名额时原子地
+// 检查（见 ClaimDownload），下载次数用完后已计数会话的续传仍然可以继续。
+// 凭证过期但在下载会话有效期内时仍返回分享，DownloadTicket.Expired 为 true，
+// 调用方只能用它续传已有的下载会话（见 ResumeDownload）。
+// viewerID 为访问者的用户 ID，未登录时为 uuid.Nil；指定接收人的分享只接受签发给访问者的凭证。
+func (s *ShareService) GetShareByTicket(pickupCode string, token string, viewerID uuid.UUID) (*models.ShareSession, []models.FileMetadata, *DownloadTicket, error) {
+	if token == "" {
+		return nil, nil, nil, ErrTicketRequired
+	}
+
+	ticket, err := s.parseDownloadTicket(token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	session, err := s.findShareByCode(pickupCode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s.checkTicket(session, ticket, viewerID)
+}
+
+// checkTicket 检查凭证是否属于该分享和访问者且仍然有效，返回凭证可以下载的文件
+func (s *ShareService) checkTicket(session *models.ShareSession, ticket *parsedTicket, viewerID uuid.UUID) (*models.ShareSession, []models.FileMetadata, *DownloadTicket, error) {
+	if session.ID != ticket.ShareID {
+		return nil, nil, nil, ErrInvalidTicket
+	}
+
+	// 指定接收人的分享：只有凭证签发给的用户和分享创建者可以使用
+	if session.Restricted && viewerID != session.CreatorID {
+		if viewerID == uuid.Nil {
+			return nil, nil, nil, ErrRecipientRequired
+		}
+		if viewerID != ticket.ViewerID {
+			return nil, nil, nil, ErrNotRecipient
+		}
+	}
+	if err := session.CheckAvailable(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrShareUnavailable, err)
+	}
+
+	// 访问密码变更（设置、修改或取消）后旧凭证失效
+	if !hmac.Equal([]byte(ticket.passwordTag), []byte(s.passwordTag(session))) {
+		return nil, nil, nil, ErrInvalidTicket
+	}
+
+	files, err := s.shareFiles(session)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ticket.FileID != uuid.Nil {
+		var bound []models.FileMetadata
+		for _, file := range files {
+			if file.ID == ticket.FileID {
+				bound = append(bound, file)
+			}
+		}
+		files = bound
+	}
+
+	return session, files, &ticket.DownloadTicket, nil
+}
+
+// parsedTicket 解析后的凭证
+type parsedTicket struct {
+	DownloadTicket
+	passwordTag string
+}
+
+// parseDownloadTicket 校验凭证签名并解析声明
+//
+// 有效期单独检查：过期时间在下载会话有效期内的凭证标记为已过期，超过则无效。
+func (s *ShareService) parseDownloadTicket(token string) (*parsedTicket, error) {
+	var claims downloadTicketClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.ticketKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, ErrInvalidTicket
+	}
+
+	audienceOK := false
+	for _, aud := range claims.Audience {
+		if aud == downloadTicketAudience {
+			audienceOK = true
+		}
+	}
+	shareID, err := uuid.Parse(claims.ShareID)
+	if !audienceOK || err != nil || claims.ExpiresAt == nil {
+		return nil, ErrInvalidTicket
+	}
+
+	ticket := &parsedTicket{
+		DownloadTicket: DownloadTicket{
+			Token:     token,
+			ShareID:   shareID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		},
+		passwordTag: claims.Password,
+	}
+	if claims.FileID != "" {
+		if ticket.FileID, err = uuid.Parse(claims.FileID); err != nil {
+			return nil, ErrInvalidTicket
+		}
+	}
+	if claims.Subject != "" {
+		if ticket.ViewerID, err = uuid.Parse(claims.Subject); err != nil {
+			return nil, ErrInvalidTicket
+		}
+	}
+
+	now := time.Now()
+	if now.After(ticket.ExpiresAt) {
+		if now.After(ticket.ExpiresAt.Add(DownloadSessionTTL)) {
+			return nil, ErrTicketExpired
+		}
+		ticket.Expired = true
+	}
+	return ticket, nil
+}
+
+// passwordTag 计算分享访问密码的指纹（无密码时为空）
+func (s *ShareService) passwordTag(share *models.ShareSession) string {
+	if !share.HasPassword() {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.ticketKey)
+	mac.Write([]byte(share.PasswordHash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestDownloadTicket 测试下载凭证的签发与验证
+//
+// 测试场景：
+//  1. 凭证可以重复使用，绑定文件时只返回该文件
+//  2. 缺少凭证、篡改、其他分享、其他密钥签名和登录令牌均被拒绝
+//  3. 访问密码变更后旧凭证失效
+func TestDownloadTicket(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	shareService.SetDownloadTicket("ticket-secret", time.Minute)
+
+	var fileIDs []uuid.UUID
+	for _, name := range []string{"a.txt", "b.txt"} {
+		file, err := fileService.UploadFile(user.ID, name, 4, bytes.NewReader([]byte(name[:1]+"bcd")))
+		require.NoError(t, err)
+		fileIDs = append(fileIDs, file.ID)
+	}
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+		FileIDs:   fileIDs,
+		ExpiresIn: time.Hour,
+		Password:  "secret",
+	})
+	require.NoError(t, err)
+
+	ticket, err := shareService.IssueDownloadTicket(share, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), ticket.ExpiresAt, 2*time.Second)
+
+	for i := 0; i < 2; i++ {
+		got, files, parsed, err := shareService.GetShareByTicket(share.PickupCode, ticket.Token, uuid.Nil)
+		require.NoError(t, err)
+		assert.Equal(t, share.ID, got.ID)
+		assert.Len(t, files, 2)
+		assert.False(t, parsed.Expired)
+	}
+
+	bound, err := shareService.IssueDownloadTicket(share, fileIDs[1], uuid.Nil)
+	require.NoError(t, err)
+	_, files, parsed, err := shareService.GetShareByTicket(share.PickupCode, bound.Token, uuid.Nil)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, fileIDs[1], files[0].ID)
+	assert.Equal(t, fileIDs[1], parsed.FileID)
+
+	_, err = shareService.IssueDownloadTicket(share, uuid.New(), uuid.Nil)
+	assert.Error(t, err)
+
+	// 无效凭证
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, "", uuid.Nil)
+	assert.ErrorIs(t, err, ErrTicketRequired)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, ticket.Token+"x", uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	other, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1], ExpiresIn: time.Hour})
+	require.NoError(t, err)
+	_, _, _, err = shareService.GetShareByTicket(other.PickupCode, ticket.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	foreign := NewShareService(db, fileService)
+	foreign.SetDownloadTicket("another-secret", time.Minute)
+	forged, err := foreign.IssueDownloadTicket(share, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, forged.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	// 登录令牌（即使使用同一密钥签名）不能作为下载凭证
+	login, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID.String(),
+		"sid":     share.ID.String(),
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("ticket-secret"))
+	require.NoError(t, err)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, login, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	// 修改访问密码后旧凭证失效
+	hash, err := bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.ShareSession{}).Where("id = ?", share.ID).
+		Update("password_hash", string(hash)).Error)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, ticket.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+}
+
+// TestDownloadTicket_Expired 测试过期凭证只能续传已有的下载会话
+func TestDownloadTicket_Expired(t *testing.T) {
+	shareService, fileService, user, _ := setupShareTestEnv(t)
+	share, file := createLimitedShare(t, shareService, fileService, user, 0)
+
+	// 先用有效凭证开始下载
+	ticket, err := shareService.IssueDownloadTicket(share, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+	_, _, parsed, err := shareService.GetShareByTicket(share.PickupCode, ticket.Token, uuid.Nil)
+	require.NoError(t, err)
+	require.False(t, parsed.Expired)
+	slot, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{})
+	require.NoError(t, err)
+	_, err = shareService.FinishDownload(slot, 10, file.Size, false)
+	require.NoError(t, err)
+
+	// 有效期不足一秒的凭证签发后即过期（exp 精确到秒）
+	shareService.SetDownloadTicket("ticket-secret", time.Nanosecond)
+	expired, err := shareService.IssueDownloadTicket(share, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+	_, _, parsed, err = shareService.GetShareByTicket(share.PickupCode, expired.Token, uuid.Nil)
+	require.NoError(t, err)
+	assert.True(t, parsed.Expired)
+
+	// 不能开始新的下载，已有会话可以续传
+	_, err = shareService.ResumeDownload(share, file.ID, DownloadRequest{})
+	assert.ErrorIs(t, err, ErrTicketExpired)
+	_, err = shareService.ResumeDownload(share, file.ID, DownloadRequest{SessionID: uuid.NewString(), Offset: 10, Size: file.Size})
+	assert.ErrorIs(t, err, ErrTicketExpired)
+	resumed, err := shareService.ResumeDownload(share, file.ID, DownloadRequest{SessionID: slot.ID.String(), Offset: 10, Size: file.Size})
+	require.NoError(t, err)
+	assert.Equal(t, slot.ID, resumed.ID)
+	assert.Equal(t, models.DownloadSlotClaimed, resumed.Status)
+}
@@ -1,10 +1,13 @@
 package services
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"ahavault/server/internal/crypto"
 	"ahavault/server/internal/models"
@@ -13,19 +16,33 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrInsufficientStorage 用户存储空间不足
+	ErrInsufficientStorage = errors.New("insufficient storage space")
+	// ErrHashMismatch 文件内容与声明的哈希不一致
+	ErrHashMismatch = errors.New("file hash mismatch")
+)
+
 // FileService 文件服务
 type FileService struct {
 	db      *gorm.DB
 	storage storage.Engine
-	kek     []byte
+	keyring *crypto.Keyring
+	tempDir string       // 上传临时文件目录
+	policy  UploadPolicy // 上传准入策略（入库时检查内容类型）
 }
 
 // NewFileService 创建文件服务实例
 func NewFileService(db *gorm.DB, storageEngine storage.Engine, kek []byte) *FileService {
+	return NewFileServiceWithKeyring(db, storageEngine, crypto.NewSingleKeyring(kek))
+}
+
+// NewFileServiceWithKeyring 使用已初始化的密钥环（如 KMS 主密钥 + 已退役密钥）创建文件服务实例
+func NewFileServiceWithKeyring(db *gorm.DB, storageEngine storage.Engine, keyring *crypto.Keyring) *FileService {
 	return &FileService{
 		db:      db,
 		storage: storageEngine,
-		kek:     kek,
+		keyring: keyring,
 	}
 }
 
@@ -56,16 +73,22 @@ func (s *FileService) CheckInstantUpload(hash string, userID uuid.UUID) (bool, *
 
 // CreateFileMetadata 创建文件元数据（秒传）
 func (s *FileService) CreateFileMetadata(userID uuid.UUID, hash string, filename string, size int64) (*models.FileMetadata, error) {
-	// 检查用户存储空间
+	return s.createFileMetadata(userID, hash, filename, size, "", nil)
+}
+
+// UploadCommitFunc 在入库事务内、提交之前执行的回调
+//
+// 返回错误时整个入库（文件元数据、引用计数、配额）回滚，上传返回该错误。
+// 用于让调用方的状态（如入库任务的完成标记）与入库原子地提交。
+type UploadCommitFunc func(tx *gorm.DB, metadata *models.FileMetadata) error
+
+// createFileMetadata 创建引用已有 blob 的文件元数据，并提交 reservationID 对应的配额预占
+func (s *FileService) createFileMetadata(userID uuid.UUID, hash string, filename string, size int64, reservationID string, commit UploadCommitFunc) (*models.FileMetadata, error) {
 	var user models.User
 	if err := s.db.First(&user, userID).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if !user.HasStorageSpace(size) {
-		return nil, errors.New("insufficient storage space")
-	}
-
 	// 开启事务
 	tx := s.db.Begin()
 	defer tx.Rollback()
@@ -76,6 +99,13 @@ func (s *FileService) CreateFileMetadata(userID uuid.UUID, hash string, filename
 		return nil, fmt.Errorf("file blob not found: %w", err)
 	}
 
+	// 已有文件的类型可能已不被当前策略允许（旧文件未记录类型时不检查）
+	if blob.MimeType != "" {
+		if err := s.policy.CheckMimeType(blob.MimeType); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := blob.IncrementRefCount(tx); err != nil {
 		return nil, fmt.Errorf("failed to increment ref count: %w", err)
 	}
@@ -92,34 +122,123 @@ func (s *FileService) CreateFileMetadata(userID uuid.UUID, hash string, filename
 		return nil, fmt.Errorf("failed to create metadata: %w", err)
 	}
 
-	// 更新用户存储使用量
-	if err := tx.Model(&user).Update("storage_used", gorm.Expr("storage_used + ?", size)).Error; err != nil {
-		return nil, fmt.Errorf("failed to update storage usage: %w", err)
+	// 更新用户存储使用量（原子检查配额）
+	if err := chargeStorage(tx, userID, size, reservationID); err != nil {
+		return nil, err
 	}
 
-	tx.Commit()
+	if commit != nil {
+		if err := commit(tx, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit metadata: %w", err)
+	}
 
 	return metadata, nil
 }
 
 // UploadFile 上传新文件
+//
+// 上传流程（内存占用与文件大小无关）：
+//  1. 将上传内容写入临时文件，同时计算 SHA-256
+//  2. 根据哈希进行二次秒传检测
+//  3. 从临时文件读取明文，分段加密后直接流式写入存储引擎
+//
+// 声明了大小时，上传期间预占相应配额，避免并行上传共同突破配额。
 func (s *FileService) UploadFile(userID uuid.UUID, filename string, size int64, reader io.Reader) (*models.FileMetadata, error) {
-	// 检查用户存储空间
+	if size <= 0 {
+		return s.uploadFile(userID, filename, size, reader, "", nil)
+	}
+
+	reservationID := uuid.New().String()
+	if _, err := s.ReserveStorage(userID, reservationID, size, DefaultReservationTTL); err != nil {
+		return nil, err
+	}
+	// 入库成功时预占已被提交，释放为空操作
+	defer s.ReleaseReservation(reservationID)
+
+	return s.uploadFile(userID, filename, size, reader, reservationID, nil)
+}
+
+// UploadReservedFile 上传已预占配额的文件
+//
+// 用于上传开始时已调用 ReserveStorage 的流程（如 Tus 上传），入库时提交该预占。
+// commit 不为 nil 时在入库事务内执行，可用于原子地标记调用方的任务已完成。
+// 失败时预占保持不变，由调用方决定重试或释放。
+func (s *FileService) UploadReservedFile(userID uuid.UUID, filename string, size int64, reader io.Reader, reservationID string, commit UploadCommitFunc) (*models.FileMetadata, error) {
+	return s.uploadFile(userID, filename, size, reader, reservationID, commit)
+}
+
+// uploadFile 落盘、计算哈希并加密入库
+func (s *FileService) uploadFile(userID uuid.UUID, filename string, size int64, reader io.Reader, reservationID string, commit UploadCommitFunc) (*models.FileMetadata, error) {
 	var user models.User
 	if err := s.db.First(&user, userID).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if !user.HasStorageSpace(size) {
-		return nil, errors.New("insufficient storage space")
+	// 落盘并计算哈希
+	spool, hash, written, err := s.spoolToTempFile(reader)
+	if err != nil {
+		return nil, err
 	}
+	defer removeTempFile(spool)
 
-	// 计算哈希
-	var buf bytes.Buffer
-	tee := io.TeeReader(reader, &buf)
-	hash, err := crypto.CalculateSHA256Stream(tee)
+	if size <= 0 {
+		size = written
+	} else if written != size {
+		return nil, fmt.Errorf("size mismatch: declared %d bytes, received %d bytes", size, written)
+	}
+
+	return s.storePlaintextFile(&user, filename, size, hash, spool, reservationID, commit)
+}
+
+// ImportUploadedFile 将已完整落盘的上传文件加密入库
+//
+// 用于分片上传完成后的处理：重新计算文件的 SHA-256 并与客户端声明的哈希比对，
+// 不一致时返回 ErrHashMismatch。入库时提交 reservationID 对应的配额预占。
+// 文件不会被删除，由调用方负责清理。
+func (s *FileService) ImportUploadedFile(userID uuid.UUID, filename string, file *os.File, expectedHash string, reservationID string) (*models.FileMetadata, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind upload file: %w", err)
+	}
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash upload file: %w", err)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(hash, expectedHash) {
+		return nil, ErrHashMismatch
+	}
+
+	return s.storePlaintextFile(&user, filename, size, hash, file, reservationID, nil)
+}
+
+// storePlaintextFile 将临时文件中的明文加密存储并创建文件元数据
+//
+// hash 和 size 必须是对临时文件内容计算得到的值。内容类型根据文件头识别，不在
+// 允许列表中时返回 ErrMimeTypeNotAllowed。配额在写入元数据的同一事务内原子地计入
+// （提交 reservationID 对应的预占），配额不足时返回 ErrInsufficientStorage。
+// commit 不为 nil 时在同一事务内、提交之前执行。
+func (s *FileService) storePlaintextFile(user *models.User, filename string, size int64, hash string, spool *os.File, reservationID string, commit UploadCommitFunc) (*models.FileMetadata, error) {
+	userID := user.ID
+
+	// 识别实际内容类型并检查策略
+	mimeType, err := sniffFile(spool, filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate hash: %w", err)
+		return nil, err
+	}
+	if err := s.policy.CheckMimeType(mimeType); err != nil {
+		return nil, err
 	}
 
 	// 检查是否已存在（二次秒传检测）
@@ -129,7 +248,7 @@ func (s *FileService) UploadFile(userID uuid.UUID, filename string, size int64,
 	}
 	if exists {
 		// 文件已存在，执行秒传
-		return s.CreateFileMetadata(userID, hash, filename, size)
+		return s.createFileMetadata(userID, hash, filename, size, reservationID, commit)
 	}
 
 	// 生成 DEK
@@ -139,19 +258,8 @@ func (s *FileService) UploadFile(userID uuid.UUID, filename string, size int64,
 	}
 	defer crypto.ZeroBytes(dek)
 
-	// 加密文件内容
-	plaintext, err := io.ReadAll(&buf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	ciphertext, err := crypto.EncryptFile(plaintext, dek)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt file: %w", err)
-	}
-
-	// 加密 DEK
-	encryptedDEK, err := crypto.EncryptDEKToBase64(dek, s.kek)
+	// 使用主密钥加密 DEK
+	keyID, encryptedDEK, err := s.keyring.WrapDEK(dek)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt DEK: %w", err)
 	}
@@ -166,8 +274,11 @@ func (s *FileService) UploadFile(userID uuid.UUID, filename string, size int64,
 	tx := s.db.Begin()
 	defer tx.Rollback()
 
-	// 存储物理文件
-	if err := s.storage.Put(hash, bytes.NewReader(ciphertext)); err != nil {
+	// 加密并存储物理文件
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind temp file: %w", err)
+	}
+	if err := s.putEncrypted(hash, spool, dek); err != nil {
 		return nil, fmt.Errorf("failed to store file: %w", err)
 	}
 
@@ -176,7 +287,9 @@ func (s *FileService) UploadFile(userID uuid.UUID, filename string, size int64,
 		Hash:         hash,
 		StorePath:    storePath,
 		EncryptedDEK: encryptedDEK,
+		KeyID:        keyID,
 		Size:         size,
+		MimeType:     mimeType,
 		RefCount:     1,
 	}
 
@@ -199,69 +312,215 @@ func (s *FileService) UploadFile(userID uuid.UUID, filename string, size int64,
 		return nil, fmt.Errorf("failed to create metadata: %w", err)
 	}
 
-	// 更新用户存储使用量
-	if err := tx.Model(&user).Update("storage_used", gorm.Expr("storage_used + ?", size)).Error; err != nil {
+	// 更新用户存储使用量（原子检查配额）
+	if err := chargeStorage(tx, userID, size, reservationID); err != nil {
 		s.storage.Delete(hash)
-		return nil, fmt.Errorf("failed to update storage usage: %w", err)
+		return nil, err
 	}
 
-	tx.Commit()
+	if commit != nil {
+		if err := commit(tx, metadata); err != nil {
+			s.storage.Delete(hash)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		s.storage.Delete(hash)
+		return nil, fmt.Errorf("failed to commit upload: %w", err)
+	}
 
 	return metadata, nil
 }
 
-// DownloadFile 下载文件
-func (s *FileService) DownloadFile(fileID uuid.UUID, userID uuid.UUID) (io.ReadCloser, *models.FileMetadata, error) {
-	// 获取文件元数据
+// SetKeyring 设置 KEK 密钥环（支持多个 KEK 共存以便轮换）
+//
+// 新上传文件的 DEK 使用主密钥加密，读取时按 blob 记录的密钥 ID 解密。
+func (s *FileService) SetKeyring(keyring *crypto.Keyring) {
+	s.keyring = keyring
+}
+
+// SetUploadPolicy 设置上传准入策略
+//
+// 入库时按策略检查识别出的内容类型，零值不限制。
+func (s *FileService) SetUploadPolicy(policy UploadPolicy) {
+	s.policy = policy
+}
+
+// SetTempDir 设置上传临时文件目录（为空时使用系统临时目录）
+//
+// 大文件上传会完整落盘一次，建议指向与存储目录同一块磁盘，
+// 避免使用基于内存的 tmpfs。
+func (s *FileService) SetTempDir(dir string) {
+	s.tempDir = dir
+}
+
+// spoolToTempFile 将上传内容写入临时文件并同时计算 SHA-256
+//
+// 返回的临时文件由调用方负责通过 removeTempFile 清理。
+func (s *FileService) spoolToTempFile(reader io.Reader) (*os.File, string, int64, error) {
+	file, err := os.CreateTemp(s.tempDir, "ahavault-upload-*")
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hasher), reader)
+	if err != nil {
+		removeTempFile(file)
+		return nil, "", 0, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	return file, hex.EncodeToString(hasher.Sum(nil)), written, nil
+}
+
+// removeTempFile 关闭并删除临时文件
+func removeTempFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// putEncrypted 将明文分段加密后流式写入存储引擎
+//
+// 加密在独立的 goroutine 中进行，通过 io.Pipe 与存储引擎的写入对接，
+// 任一端失败都会中断另一端。
+func (s *FileService) putEncrypted(hash string, plaintext io.Reader, dek []byte) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := encryptTo(pw, plaintext, dek)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	putErr := s.storage.Put(hash, pr)
+	// 存储引擎提前返回时，关闭读端以解除加密 goroutine 的阻塞
+	pr.CloseWithError(io.ErrClosedPipe)
+	encErr := <-done
+
+	if putErr != nil {
+		return putErr
+	}
+	if encErr != nil {
+		return fmt.Errorf("failed to encrypt file: %w", encErr)
+	}
+	return nil
+}
+
+// encryptTo 使用分段 AEAD 格式加密明文并写入 w
+func encryptTo(w io.Writer, plaintext io.Reader, dek []byte) error {
+	enc, err := crypto.NewEncryptWriter(w, dek)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, plaintext); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ErrInvalidRange 请求的区间超出文件范围
+var ErrInvalidRange = errors.New("requested range not satisfiable")
+
+// GetFile 获取文件元数据（校验所有者和有效期）
+func (s *FileService) GetFile(fileID uuid.UUID, userID uuid.UUID) (*models.FileMetadata, error) {
 	var metadata models.FileMetadata
-	err := s.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", fileID, userID).
+	err := s.db.Preload("FileBlob").
+		Where("id = ? AND user_id = ? AND deleted_at IS NULL", fileID, userID).
 		First(&metadata).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil, errors.New("file not found")
+			return nil, errors.New("file not found")
 		}
-		return nil, nil, fmt.Errorf("failed to get file: %w", err)
+		return nil, fmt.Errorf("failed to get file: %w", err)
 	}
 
 	// 检查文件是否过期
 	if metadata.IsExpired() {
-		return nil, nil, errors.New("file has expired")
+		return nil, errors.New("file has expired")
 	}
 
-	// 获取物理文件
-	var blob models.FileBlob
-	if err := s.db.Where("hash = ?", metadata.FileBlobHash).First(&blob).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to get blob: %w", err)
+	return &metadata, nil
+}
+
+// DownloadFile 下载文件（边读边解密，不会将整个文件读入内存）
+func (s *FileService) DownloadFile(fileID uuid.UUID, userID uuid.UUID) (io.ReadCloser, *models.FileMetadata, error) {
+	return s.OpenRange(fileID, userID, 0, -1)
+}
+
+// OpenRange 打开文件指定区间的明文读取流
+//
+// 只从存储引擎读取并解密覆盖 [offset, offset+length) 的密文分段，
+// length < 0 或超出文件末尾时读到文件末尾。offset 超出文件大小时返回 ErrInvalidRange。
+// 调用方必须关闭返回的读取流。
+func (s *FileService) OpenRange(fileID uuid.UUID, userID uuid.UUID, offset, length int64) (io.ReadCloser, *models.FileMetadata, error) {
+	metadata, err := s.GetFile(fileID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if offset < 0 || offset > metadata.Size {
+		return nil, nil, ErrInvalidRange
+	}
+	if length < 0 || length > metadata.Size-offset {
+		length = metadata.Size - offset
 	}
 
+	// 获取物理文件（GetFile 已预加载）
+	blob := &metadata.FileBlob
+	if blob.Hash == "" {
+		return nil, nil, errors.New("failed to get blob: record not found")
+	}
+
+	plaintext, ciphertext, err := s.openBlob(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if plaintext.Size() != metadata.Size {
+		ciphertext.Close()
+		return nil, nil, fmt.Errorf("file size mismatch: expected %d bytes, got %d bytes", metadata.Size, plaintext.Size())
+	}
+
+	reader := &rangeReadCloser{
+		Reader: io.NewSectionReader(plaintext, offset, length),
+		Closer: ciphertext,
+	}
+	return reader, metadata, nil
+}
+
+// rangeReadCloser 明文区间读取流，关闭时释放底层存储读取流
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// openBlob 打开物理文件的明文随机读取器
+//
+// 只在调用 ReadAt 时按需读取并解密对应的密文分段，调用方必须关闭返回的 Closer。
+func (s *FileService) openBlob(blob *models.FileBlob) (crypto.PlaintextReaderAt, io.Closer, error) {
 	// 解密 DEK
-	dek, err := crypto.DecryptDEKFromBase64(blob.EncryptedDEK, s.kek)
+	dek, err := s.keyring.UnwrapDEK(blob.KeyID, blob.EncryptedDEK)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to decrypt DEK: %w", err)
 	}
 	defer crypto.ZeroBytes(dek)
 
-	// 读取加密文件
-	encryptedReader, err := s.storage.Get(blob.Hash)
+	// 获取密文长度以计算分段布局
+	info, err := s.storage.Stat(blob.Hash)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get file from storage: %w", err)
 	}
-	defer encryptedReader.Close()
-
-	// 读取并解密
-	ciphertext, err := io.ReadAll(encryptedReader)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read encrypted file: %w", err)
-	}
 
-	plaintext, err := crypto.DecryptFile(ciphertext, dek)
+	ciphertext := storage.NewReaderAt(s.storage, blob.Hash, info.Size)
+	plaintext, err := crypto.NewDecryptReaderAt(ciphertext, info.Size, dek)
 	if err != nil {
+		ciphertext.Close()
 		return nil, nil, fmt.Errorf("failed to decrypt file: %w", err)
 	}
 
-	// 返回解密后的内容
-	reader := io.NopCloser(bytes.NewReader(plaintext))
-	return reader, &metadata, nil
+	return plaintext, ciphertext, nil
 }
 
 // DeleteFile 删除文件（软删除）
@@ -3,8 +3,8 @@
 // 本文件为 FileService 的单元测试，覆盖以下功能：
 //   - 秒传检测（CheckInstantUpload）
 //   - 文件元数据创建（CreateFileMetadata）
-//   - 文件上传（UploadFile）
-//   - 文件下载（DownloadFile）
+//   - 文件上传（UploadFile，含流式加密与基准测试）
+//   - 文件下载（DownloadFile、OpenRange）
 //   - 文件删除（DeleteFile）
 //   - 文件列表查询（ListFiles）
 //
@@ -14,10 +14,17 @@ package services
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"testing"
 	"time"
 
+	"ahavault/server/internal/crypto"
 	"ahavault/server/internal/models"
 	"ahavault/server/internal/storage"
 	"github.com/google/uuid"
@@ -28,7 +35,7 @@ import (
 )
 
 // setupTestDB 创建测试数据库
-func setupTestDB(t *testing.T) *gorm.DB {
+func setupTestDB(t testing.TB) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
 		// 禁用外键约束，简化测试
 		DisableForeignKeyConstraintWhenMigrating: true,
@@ -45,6 +52,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			status TEXT NOT NULL DEFAULT 'active',
 			storage_quota INTEGER NOT NULL DEFAULT 10737418240,
 			storage_used INTEGER NOT NULL DEFAULT 0,
+			storage_reserved INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			last_login_at DATETIME
@@ -54,6 +62,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			hash TEXT PRIMARY KEY,
 			store_path TEXT NOT NULL,
 			encrypted_dek TEXT NOT NULL,
+			key_id TEXT NOT NULL DEFAULT 'default',
 			size INTEGER NOT NULL,
 			mime_type TEXT,
 			ref_count INTEGER NOT NULL DEFAULT 1,
@@ -79,10 +88,13 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		CREATE TABLE share_sessions (
 			id TEXT PRIMARY KEY,
 			pickup_code TEXT NOT NULL UNIQUE,
+			link_token TEXT UNIQUE,
 			creator_id TEXT NOT NULL,
 			password_hash TEXT,
+			restricted BOOLEAN NOT NULL DEFAULT 0,
 			max_downloads INTEGER NOT NULL DEFAULT 0,
 			current_downloads INTEGER NOT NULL DEFAULT 0,
+			reserved_downloads INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			expires_at DATETIME NOT NULL,
 			stopped_at DATETIME,
@@ -98,6 +110,93 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			FOREIGN KEY (file_id) REFERENCES files_metadata(id)
 		);
 
+		CREATE TABLE share_recipients (
+			id TEXT PRIMARY KEY,
+			share_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			access_count INTEGER NOT NULL DEFAULT 0,
+			first_accessed_at DATETIME,
+			last_accessed_at DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (share_id, user_id),
+			FOREIGN KEY (share_id) REFERENCES share_sessions(id)
+		);
+
+		CREATE TABLE upload_sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'uploading',
+			upload_offset INTEGER NOT NULL DEFAULT 0,
+			upload_length INTEGER NOT NULL,
+			filename TEXT NOT NULL,
+			mime_type TEXT,
+			hash TEXT,
+			temp_path TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE TABLE upload_challenges (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			nonce TEXT NOT NULL,
+			ranges TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE quota_reservations (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE download_slots (
+			id TEXT PRIMARY KEY,
+			share_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			bytes_sent INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE audit_logs (
+			id TEXT PRIMARY KEY,
+			user_id TEXT,
+			action TEXT NOT NULL,
+			resource_type TEXT,
+			resource_id TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE share_policy_overrides (
+			user_id TEXT PRIMARY KEY,
+			max_share_expiry INTEGER,
+			max_files_per_share INTEGER,
+			max_active_shares INTEGER,
+			updated_by TEXT,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE system_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			description TEXT,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
 		CREATE INDEX idx_user_files ON files_metadata(user_id, deleted_at);
 		CREATE INDEX idx_blob_hash ON files_metadata(file_blob_hash);
 		CREATE INDEX idx_pickup_code ON share_sessions(pickup_code);
@@ -109,7 +208,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 }
 
 // createTestUser 创建测试用户
-func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+func createTestUser(t testing.TB, db *gorm.DB) *models.User {
 	user := &models.User{
 		Email:        "test@example.com",
 		Password:     "hashed_password",
@@ -777,3 +876,320 @@ func TestUploadFile_InsufficientStorage(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "insufficient storage")
 }
+
+// TestUploadFile_MimeType 测试入库时识别内容类型并执行类型策略
+//
+// 测试场景：
+//  1. 按文件头识别类型并记录在 blob 上（扩展名不一致时以内容为准）
+//  2. 类型不在允许列表中时拒绝入库，不计入配额
+//  3. 策略收紧后，不允许类型的已有文件不能再通过秒传引用
+func TestUploadFile_MimeType(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	user := createTestUser(t, db)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	metadata, err := service.UploadFile(user.ID, "photo.dat", int64(len(png)), bytes.NewReader(png))
+	require.NoError(t, err)
+
+	var blob models.FileBlob
+	require.NoError(t, db.First(&blob, "hash = ?", metadata.FileBlobHash).Error)
+	assert.Equal(t, "image/png", blob.MimeType)
+
+	file, err := service.GetFile(metadata.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", file.ContentType())
+
+	// 改名为 .jpg 的二进制内容不能通过 image/* 白名单
+	service.SetUploadPolicy(UploadPolicy{AllowedMimeTypes: []string{"image/*"}})
+	binary := []byte{0x00, 0x01, 0x02, 0x03, 0xfe, 0xff}
+	_, err = service.UploadFile(user.ID, "fake.jpg", int64(len(binary)), bytes.NewReader(binary))
+	assert.ErrorIs(t, err, ErrMimeTypeNotAllowed)
+
+	var fresh models.User
+	require.NoError(t, db.First(&fresh, user.ID).Error)
+	assert.Equal(t, int64(len(png)), fresh.StorageUsed)
+	assert.Equal(t, int64(0), fresh.StorageReserved)
+
+	// 策略禁止 PNG 后，已有的 PNG 不能再被引用
+	service.SetUploadPolicy(UploadPolicy{AllowedMimeTypes: []string{"image/*", "!image/png"}})
+	_, err = service.CreateFileMetadata(user.ID, metadata.FileBlobHash, "copy.png", metadata.Size)
+	assert.ErrorIs(t, err, ErrMimeTypeNotAllowed)
+}
+
+// TestUploadFile_Streaming 测试跨多个加密分段的大文件上传与下载
+func TestUploadFile_Streaming(t *testing.T) {
+	db := setupTestDB(t)
+	storageEngine := storage.NewMemoryEngine()
+	kek := []byte("test-master-key-1234567890123456")
+	service := NewFileService(db, storageEngine, kek)
+	tempDir := t.TempDir()
+	service.SetTempDir(tempDir)
+	user := createTestUser(t, db)
+
+	content := make([]byte, 3*1024*1024+17) // 跨越多个 64KB 分段
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	metadata, err := service.UploadFile(user.ID, "large.bin", int64(len(content)), bytes.NewReader(content))
+	require.NoError(t, err)
+
+	// 临时文件应已清理
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	reader, _, err := service.DownloadFile(metadata.ID, user.ID)
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, downloaded))
+}
+
+// TestUploadFile_SizeMismatch 测试声明大小与实际内容不一致
+func TestUploadFile_SizeMismatch(t *testing.T) {
+	db := setupTestDB(t)
+	storageEngine := storage.NewMemoryEngine()
+	kek := []byte("test-master-key-1234567890123456")
+	service := NewFileService(db, storageEngine, kek)
+	user := createTestUser(t, db)
+
+	content := []byte("short content")
+	_, err := service.UploadFile(user.ID, "test.txt", int64(len(content))+10, bytes.NewReader(content))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "size mismatch")
+
+	var count int64
+	db.Model(&models.FileBlob{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+// TestUploadFile_StorageFailure 测试存储引擎写入失败时的清理
+func TestUploadFile_StorageFailure(t *testing.T) {
+	db := setupTestDB(t)
+	kek := []byte("test-master-key-1234567890123456")
+	service := NewFileService(db, failingEngine{storage.NewMemoryEngine()}, kek)
+	user := createTestUser(t, db)
+
+	content := make([]byte, 1024*1024)
+	_, err := service.UploadFile(user.ID, "test.bin", int64(len(content)), bytes.NewReader(content))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to store file")
+
+	var count int64
+	db.Model(&models.FileBlob{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+// failingEngine 读取部分数据后写入失败的存储引擎
+type failingEngine struct {
+	storage.Engine
+}
+
+func (f failingEngine) Put(hash string, reader io.Reader) error {
+	buf := make([]byte, 1024)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return err
+	}
+	return errors.New("disk full")
+}
+
+// patternReader 按需生成内容的 Reader，避免基准测试本身占用大量内存
+type patternReader struct {
+	seed      uint64
+	remaining int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	for i := range p {
+		r.seed = r.seed*6364136223846793005 + 1442695040888963407
+		p[i] = byte(r.seed >> 56)
+	}
+	r.remaining -= int64(len(p))
+	return len(p), nil
+}
+
+// BenchmarkUploadFile 测试流式上传的吞吐与内存占用
+//
+// 每次迭代使用不同的内容以避免触发秒传，B/op 应与文件大小无关。
+func BenchmarkUploadFile(b *testing.B) {
+	sizes := []int64{1 << 20, 16 << 20, 64 << 20}
+
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			db := setupTestDB(b)
+			storageEngine, err := storage.NewLocalEngine(b.TempDir())
+			require.NoError(b, err)
+			kek := []byte("test-master-key-1234567890123456")
+			service := NewFileService(db, storageEngine, kek)
+			service.SetTempDir(b.TempDir())
+			user := createTestUser(b, db)
+			db.Model(user).Update("storage_quota", int64(1)<<50)
+
+			b.SetBytes(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				reader := &patternReader{seed: uint64(i + 1), remaining: size}
+				if _, err := service.UploadFile(user.ID, "bench.bin", size, reader); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestOpenRange 测试按区间解密读取
+func TestOpenRange(t *testing.T) {
+	db := setupTestDB(t)
+	storageEngine := storage.NewMemoryEngine()
+	kek := []byte("test-master-key-1234567890123456")
+	service := NewFileService(db, storageEngine, kek)
+	user := createTestUser(t, db)
+
+	content := make([]byte, 300*1024+123) // 跨越多个 64KB 分段
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	metadata, err := service.UploadFile(user.ID, "range.bin", int64(len(content)), bytes.NewReader(content))
+	require.NoError(t, err)
+
+	size := int64(len(content))
+	tests := []struct {
+		name        string
+		offset      int64
+		length      int64
+		wantStart   int64
+		wantEnd     int64
+		wantErr     error
+		errContains string
+	}{
+		{name: "文件开头", offset: 0, length: 100, wantStart: 0, wantEnd: 100},
+		{name: "跨越分段边界", offset: 64*1024 - 10, length: 20, wantStart: 64*1024 - 10, wantEnd: 64*1024 + 10},
+		{name: "读到末尾", offset: 200 * 1024, length: -1, wantStart: 200 * 1024, wantEnd: size},
+		{name: "长度超出末尾", offset: size - 5, length: 100, wantStart: size - 5, wantEnd: size},
+		{name: "偏移等于文件大小", offset: size, length: -1, wantStart: size, wantEnd: size},
+		{name: "偏移超出文件", offset: size + 1, length: 1, wantErr: ErrInvalidRange},
+		{name: "负偏移", offset: -1, length: 1, wantErr: ErrInvalidRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, meta, err := service.OpenRange(metadata.ID, user.ID, tt.offset, tt.length)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer reader.Close()
+			assert.Equal(t, metadata.ID, meta.ID)
+
+			got, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(content[tt.wantStart:tt.wantEnd], got))
+		})
+	}
+
+	// 其他用户无权读取
+	_, _, err = service.OpenRange(metadata.ID, uuid.New(), 0, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file not found")
+}
+
+// TestOpenRange_LegacyBlob 测试旧版整文件格式的 blob 仍可读取
+func TestOpenRange_LegacyBlob(t *testing.T) {
+	db := setupTestDB(t)
+	storageEngine := storage.NewMemoryEngine()
+	kek := []byte("test-master-key-1234567890123456")
+	service := NewFileService(db, storageEngine, kek)
+	user := createTestUser(t, db)
+
+	content := []byte("content encrypted with the legacy whole-file format")
+	hash := "1111111111111111111111111111111111111111111111111111111111111111"
+
+	// 按旧版格式加密: [Nonce(12)] [Ciphertext] [AuthTag(16)]
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+	block, err := aes.NewCipher(dek)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	require.NoError(t, storageEngine.Put(hash, bytes.NewReader(aead.Seal(nonce, nonce, content, nil))))
+
+	encryptedDEK, err := crypto.EncryptDEKToBase64(dek, kek)
+	require.NoError(t, err)
+	storePath, _ := storage.GeneratePath(hash)
+	require.NoError(t, db.Create(&models.FileBlob{
+		Hash: hash, StorePath: storePath, EncryptedDEK: encryptedDEK, Size: int64(len(content)), RefCount: 1,
+	}).Error)
+	metadata, err := service.CreateFileMetadata(user.ID, hash, "legacy.txt", int64(len(content)))
+	require.NoError(t, err)
+
+	reader, _, err := service.OpenRange(metadata.ID, user.ID, 8, 9)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, content[8:17], got)
+}
+
+// TestKeyringRotation 测试更换主 KEK 后旧文件仍可读取、新文件使用新 KEK
+func TestKeyringRotation(t *testing.T) {
+	db := setupTestDB(t)
+	storageEngine := storage.NewMemoryEngine()
+	oldKEK := []byte("test-master-key-1234567890123456")
+	newKEK := []byte("rotated-master-key-6543210987654")
+	service := NewFileService(db, storageEngine, oldKEK)
+	user := createTestUser(t, db)
+
+	oldContent := []byte("uploaded before rotation")
+	oldFile, err := service.UploadFile(user.ID, "old.txt", int64(len(oldContent)), bytes.NewReader(oldContent))
+	require.NoError(t, err)
+
+	// 切换主密钥，旧密钥保留为退役密钥
+	keyring, err := crypto.NewKeyring("k2", map[string][]byte{
+		crypto.DefaultKeyID: oldKEK,
+		"k2":                newKEK,
+	})
+	require.NoError(t, err)
+	service.SetKeyring(keyring)
+
+	newContent := []byte("uploaded after rotation")
+	newFile, err := service.UploadFile(user.ID, "new.txt", int64(len(newContent)), bytes.NewReader(newContent))
+	require.NoError(t, err)
+
+	var newBlob, oldBlob models.FileBlob
+	require.NoError(t, db.First(&newBlob, "hash = ?", newFile.FileBlobHash).Error)
+	assert.Equal(t, "k2", newBlob.KeyID)
+	require.NoError(t, db.First(&oldBlob, "hash = ?", oldFile.FileBlobHash).Error)
+	assert.Equal(t, crypto.DefaultKeyID, oldBlob.KeyID)
+
+	for _, tc := range []struct {
+		id      uuid.UUID
+		content []byte
+	}{{oldFile.ID, oldContent}, {newFile.ID, newContent}} {
+		reader, _, err := service.OpenRange(tc.id, user.ID, 0, -1)
+		require.NoError(t, err)
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		assert.Equal(t, tc.content, got)
+	}
+
+	// 去掉旧密钥后，旧文件无法解密
+	keyring, err = crypto.NewKeyring("k2", map[string][]byte{"k2": newKEK})
+	require.NoError(t, err)
+	service = NewFileServiceWithKeyring(db, storageEngine, keyring)
+	_, _, err = service.OpenRange(oldFile.ID, user.ID, 0, -1)
+	assert.ErrorIs(t, err, crypto.ErrUnknownKeyID)
+}
@@ -0,0 +1,118 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现内容类型识别：
+//   - 入库时根据文件头（魔数）与扩展名识别 MIME 类型，记录在 file_blobs.mime_type
+//   - 判断类型是否可以安全地在浏览器中内联预览
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inlineSafeMimeTypes 可以内联预览的类型
+//
+// 只包含浏览器不会当作可执行文档处理的类型（HTML、SVG、XML 等不在其中）。
+var inlineSafeMimeTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"image/avif":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/ogg":       true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"audio/wave":      true,
+	"audio/wav":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// DetectMimeType 根据文件头与文件名识别内容类型
+//
+// 以文件头嗅探结果为准，嗅探只能得到通用类型时才参考扩展名细化：
+//   - 文本内容可细化为其他文本类型（如 text/csv、application/json）
+//   - ZIP 内容可细化为基于 ZIP 的文档格式（如 docx、epub、jar）
+//
+// 无法识别的二进制内容始终为 application/octet-stream，扩展名不能把它标记为
+// 图片、音视频或文本，避免通过改名绕过类型白名单。
+func DetectMimeType(header []byte, filename string) string {
+	if len(header) > sniffLength {
+		header = header[:sniffLength]
+	}
+	sniffed := normalizeMimeType(http.DetectContentType(header))
+
+	byExt := normalizeMimeType(mime.TypeByExtension(filepath.Ext(filename)))
+	if byExt == "" || byExt == sniffed {
+		return sniffed
+	}
+
+	switch sniffed {
+	case "text/plain", "text/xml":
+		if isTextMimeType(byExt) {
+			return byExt
+		}
+	case "application/zip":
+		if isZipBasedMimeType(byExt) {
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// SniffMimeType 根据文件头（结合文件名）识别文件的实际内容类型
+func SniffMimeType(path, filename string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return sniffFile(file, filename)
+}
+
+// sniffFile 读取文件头识别内容类型（不改变文件的读取位置）
+func sniffFile(file io.ReaderAt, filename string) (string, error) {
+	buf := make([]byte, sniffLength)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read file header: %w", err)
+	}
+	return DetectMimeType(buf[:n], filename), nil
+}
+
+// IsInlineSafe 判断类型是否可以在浏览器中内联预览
+func IsInlineSafe(mimeType string) bool {
+	return inlineSafeMimeTypes[normalizeMimeType(mimeType)]
+}
+
+// isTextMimeType 判断是否为文本类的类型（用于细化嗅探得到的文本内容）
+func isTextMimeType(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	if !strings.HasPrefix(mimeType, "application/") {
+		return false
+	}
+	return mimeType == "application/json" || mimeType == "application/xml" ||
+		strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml")
+}
+
+// isZipBasedMimeType 判断是否为以 ZIP 为容器的文档格式
+func isZipBasedMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "application/vnd.") ||
+		strings.HasSuffix(mimeType, "+zip") ||
+		mimeType == "application/java-archive"
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"mime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	// .epub 不在 Go 内置的扩展名表中，显式注册避免依赖系统 mime.types
+	mime.AddExtensionType(".epub", "application/epub+zip")
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00")
+	binary := []byte{0x00, 0x01, 0x02, 0x03, 0xfe, 0xff}
+
+	tests := []struct {
+		name     string
+		header   []byte
+		filename string
+		want     string
+	}{
+		{"magic bytes win over extension", png, "photo.pdf", "image/png"},
+		{"magic bytes without extension", png, "photo", "image/png"},
+		{"text refined by extension", []byte(`{"key": "value"}`), "data.json", "application/json"},
+		{"text refined to other text type", []byte("body { color: red }"), "site.css", "text/css"},
+		{"text not refined to image", []byte("<svg></svg>"), "logo.svg", "text/plain"},
+		{"zip refined to zip-based format", zip, "book.epub", "application/epub+zip"},
+		{"zip not refined to unrelated type", zip, "archive.pdf", "application/zip"},
+		{"unknown binary ignores extension", binary, "fake.jpg", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectMimeType(tt.header, tt.filename))
+		})
+	}
+}
+
+func TestIsInlineSafe(t *testing.T) {
+	assert.True(t, IsInlineSafe("image/png"))
+	assert.True(t, IsInlineSafe("application/pdf"))
+	assert.True(t, IsInlineSafe("text/plain; charset=utf-8"))
+	assert.False(t, IsInlineSafe("text/html"))
+	assert.False(t, IsInlineSafe("image/svg+xml"))
+	assert.False(t, IsInlineSafe("application/octet-stream"))
+}
@@ -2,16 +2,58 @@ package services
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrInvalidVanityCode 自定义取件码格式不合法或包含不雅词汇
+	ErrInvalidVanityCode = errors.New("invalid vanity pickup code")
+	// ErrPickupCodeTaken 自定义取件码已被使用
+	ErrPickupCodeTaken = errors.New("pickup code already taken")
+	// ErrVanityCodesDisabled 未开启自定义取件码
+	ErrVanityCodesDisabled = errors.New("vanity pickup codes are disabled")
+)
+
+// 取件码长度范围
+const (
+	MinPickupCodeLength = 6  // 随机字符取件码最短长度
+	MaxPickupCodeLength = 12 // 随机字符取件码最长长度
+	MinVanityCodeLength = 6  // 自定义取件码最短长度
+	MaxVanityCodeLength = 32 // 自定义取件码最长长度（与 share_sessions.pickup_code 列宽一致）
+	MinPickupCodeWords  = 3  // 单词组合取件码最少单词数（2 个单词的组合数太少，可被穷举）
+	MaxPickupCodeWords  = 4  // 单词组合取件码最多单词数
+)
+
+// PickupCodeFormat 取件码格式
+type PickupCodeFormat string
+
+const (
+	PickupCodeFormatRandom PickupCodeFormat = "random" // 随机字符，如 A2B3C4D5
+	PickupCodeFormatWords  PickupCodeFormat = "words"  // 单词组合，如 tiger-ocean-maple-42
+)
+
+// profaneWords 内置的不雅词汇，生成的取件码和自定义取件码都不能包含
+var profaneWords = []string{
+	"anal", "arse", "ass", "bastard", "bitch", "boob", "cock", "crap", "cum", "cunt", "dick",
+	"dildo", "fag", "fuck", "jizz", "kkk", "nazi", "nigga", "nigger", "penis", "piss", "porn",
+	"rape", "retard", "sex", "shit", "slut", "tit", "twat", "vagina", "wank", "whore",
+}
+
+// leetReplacer 不雅词汇检查时还原常见的数字替代
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b")
+
 // PickupCodeGenerator 取件码生成器
 type PickupCodeGenerator struct {
-	length  int
-	charset string
+	length    int
+	charset   string
+	format    PickupCodeFormat
+	words     int      // 单词组合格式的单词数
+	blocklist []string // 额外的不雅词汇
 }
 
 // NewPickupCodeGenerator 创建取件码生成器
@@ -24,11 +66,48 @@ func NewPickupCodeGenerator(length int) *PickupCodeGenerator {
 	return &PickupCodeGenerator{
 		length:  length,
 		charset: charset,
+		format:  PickupCodeFormatRandom,
+	}
+}
+
+// NewWordCodeGenerator 创建单词组合取件码生成器
+// 生成 words 个单词加两位数字，如 tiger-ocean-maple-42；比随机字符更容易口头传达，但组合数更少
+// （3 个单词约 22 亿），建议同时设置访问密码
+func NewWordCodeGenerator(words int) *PickupCodeGenerator {
+	return &PickupCodeGenerator{
+		format: PickupCodeFormatWords,
+		words:  words,
+	}
+}
+
+// SetBlocklist 设置额外的不雅词汇（在内置词汇之外）
+func (g *PickupCodeGenerator) SetBlocklist(words []string) {
+	g.blocklist = nil
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			g.blocklist = append(g.blocklist, word)
+		}
 	}
 }
 
+// Format 返回生成的取件码格式
+func (g *PickupCodeGenerator) Format() PickupCodeFormat {
+	return g.format
+}
+
+// withLength 返回长度不同、其他设置相同的生成器
+func (g *PickupCodeGenerator) withLength(length int) *PickupCodeGenerator {
+	gen := *g
+	gen.length = length
+	return &gen
+}
+
 // Generate 生成随机取件码
 func (g *PickupCodeGenerator) Generate() (string, error) {
+	if g.format == PickupCodeFormatWords {
+		return g.generateWords()
+	}
+
 	code := make([]byte, g.length)
 	charsetLen := big.NewInt(int64(len(g.charset)))
 
@@ -44,6 +123,27 @@ func (g *PickupCodeGenerator) Generate() (string, error) {
 	return string(code), nil
 }
 
+// generateWords 生成单词组合取件码
+func (g *PickupCodeGenerator) generateWords() (string, error) {
+	parts := make([]string, 0, g.words+1)
+	wordCount := big.NewInt(int64(len(pickupWords)))
+	for i := 0; i < g.words; i++ {
+		index, err := rand.Int(rand.Reader, wordCount)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random index: %w", err)
+		}
+		parts = append(parts, pickupWords[index.Int64()])
+	}
+
+	number, err := rand.Int(rand.Reader, big.NewInt(100))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random number: %w", err)
+	}
+	parts = append(parts, fmt.Sprintf("%02d", number.Int64()))
+
+	return strings.Join(parts, "-"), nil
+}
+
 // GenerateUnique 生成唯一的取件码（检查数据库防止碰撞）
 func (g *PickupCodeGenerator) GenerateUnique(db *gorm.DB) (string, error) {
 	maxAttempts := 10 // 最多尝试10次
@@ -54,6 +154,11 @@ func (g *PickupCodeGenerator) GenerateUnique(db *gorm.DB) (string, error) {
 			return "", err
 		}
 
+		// 随机组合出不雅词汇时重新生成
+		if g.IsProfane(code) {
+			continue
+		}
+
 		// 检查数据库中是否已存在
 		var count int64
 		err = db.Table("share_sessions").Where("pickup_code = ?", code).Count(&count).Error
@@ -95,5 +200,91 @@ func ValidatePickupCode(code string, expectedLength int) error {
 	return nil
 }
 
+// IsProfane 检查取件码是否包含不雅词汇
+//
+// 忽略大小写、连字符和常见的数字替代（0→o、1→i、3→e、4→a、5→s、7→t、8→b）。
+// 4 个字母以上的词汇按子串匹配；更短的词汇只匹配完整的一段，避免误伤 class、title 之类的正常单词。
+func (g *PickupCodeGenerator) IsProfane(code string) bool {
+	segments := strings.Split(strings.ToLower(code), "-")
+	for i, segment := range segments {
+		segments[i] = leetReplacer.Replace(segment)
+	}
+	joined := strings.Join(segments, "")
+
+	for _, list := range [][]string{profaneWords, g.blocklist} {
+		for _, word := range list {
+			if len(word) >= 4 {
+				if strings.Contains(joined, word) {
+					return true
+				}
+				continue
+			}
+			for _, segment := range segments {
+				if segment == word {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ValidateVanityCode 检查用户自定义的取件码（需先经 CanonicalPickupCode 规范化）
+//
+// 自定义取件码为 6-32 个小写字母、数字，可用单个连字符分隔（如 team-offsite-2026）；
+// 不能包含不雅词汇。是否已被使用由调用方检查。
+func (g *PickupCodeGenerator) ValidateVanityCode(code string) error {
+	if err := ValidatePickupCodeFormat(code); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVanityCode, err)
+	}
+	if g.IsProfane(code) {
+		return fmt.Errorf("%w: contains blocked words", ErrInvalidVanityCode)
+	}
+	return nil
+}
+
+// CanonicalPickupCode 规范化取件码
+//
+// 取件码不区分大小写：符合随机字符格式（6-12 位，字符集内）的统一为大写，
+// 其他格式（单词组合、自定义取件码）统一为小写。保存和查询前都需规范化。
+func CanonicalPickupCode(code string) string {
+	code = strings.TrimSpace(code)
+	if upper := strings.ToUpper(code); isRandomPickupCode(upper) {
+		return upper
+	}
+	return strings.ToLower(code)
+}
+
+// ValidatePickupCodeFormat 验证规范化后的取件码是否为任一在用格式
+//
+// 接受 6-12 位随机字符取件码（修改 SHARE_CODE_LENGTH 前创建的分享仍可访问），
+// 以及由小写字母、数字和单个连字符组成的 6-32 位取件码（单词组合和自定义取件码）。
+func ValidatePickupCodeFormat(code string) error {
+	if isRandomPickupCode(code) {
+		return nil
+	}
+
+	if len(code) < MinVanityCodeLength || len(code) > MaxVanityCodeLength {
+		return fmt.Errorf("invalid code length: expected %d-%d, got %d", MinVanityCodeLength, MaxVanityCodeLength, len(code))
+	}
+	for _, segment := range strings.Split(code, "-") {
+		if segment == "" {
+			return errors.New("code must not start or end with a hyphen or contain consecutive hyphens")
+		}
+		for _, char := range segment {
+			if (char < 'a' || char > 'z') && (char < '0' || char > '9') {
+				return fmt.Errorf("invalid character in code: %c", char)
+			}
+		}
+	}
+	return nil
+}
+
+// isRandomPickupCode 检查是否为随机字符格式的取件码（长度在允许范围内）
+func isRandomPickupCode(code string) bool {
+	return len(code) >= MinPickupCodeLength && len(code) <= MaxPickupCodeLength &&
+		ValidatePickupCode(code, len(code)) == nil
+}
+
 // DefaultPickupCodeGenerator 默认的取件码生成器（8位）
 var DefaultPickupCodeGenerator = NewPickupCodeGenerator(8)
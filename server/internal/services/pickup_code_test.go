@@ -1,6 +1,8 @@
 package services
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"gorm.io/driver/sqlite"
@@ -197,3 +199,155 @@ func TestDefaultPickupCodeGenerator(t *testing.T) {
 		t.Errorf("Default generator should produce 8-character codes, got %d", len(code))
 	}
 }
+
+func TestWordCodeGenerator(t *testing.T) {
+	gen := NewWordCodeGenerator(3)
+	if gen.Format() != PickupCodeFormatWords {
+		t.Fatalf("Format() = %s, want %s", gen.Format(), PickupCodeFormatWords)
+	}
+
+	words := make(map[string]bool, len(pickupWords))
+	for _, word := range pickupWords {
+		words[word] = true
+	}
+
+	for i := 0; i < 50; i++ {
+		code, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+
+		parts := strings.Split(code, "-")
+		if len(parts) != 4 {
+			t.Fatalf("Generated code %q should have 3 words and a number", code)
+		}
+		for _, word := range parts[:3] {
+			if !words[word] {
+				t.Errorf("Generated code %q contains unknown word %q", code, word)
+			}
+		}
+		if len(parts[3]) != 2 || strings.Trim(parts[3], "0123456789") != "" {
+			t.Errorf("Generated code %q should end with two digits", code)
+		}
+		if CanonicalPickupCode(code) != code {
+			t.Errorf("Generated code %q is not canonical", code)
+		}
+		if err := ValidatePickupCodeFormat(code); err != nil {
+			t.Errorf("ValidatePickupCodeFormat(%q) error = %v", code, err)
+		}
+	}
+
+	// 最长的组合也不超过列宽
+	longest := 0
+	for _, word := range pickupWords {
+		if len(word) > longest {
+			longest = len(word)
+		}
+	}
+	if max := MaxPickupCodeWords*(longest+1) + 2; max > MaxVanityCodeLength {
+		t.Errorf("Longest word code has %d characters, limit is %d", max, MaxVanityCodeLength)
+	}
+}
+
+func TestPickupWordsNotProfane(t *testing.T) {
+	gen := NewWordCodeGenerator(3)
+	for _, word := range pickupWords {
+		if gen.IsProfane(word) {
+			t.Errorf("Word list contains blocked word %q", word)
+		}
+	}
+}
+
+func TestCanonicalPickupCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"A2B3C4D5", "A2B3C4D5"},
+		{"a2b3c4d5", "A2B3C4D5"},
+		{" a2b3c4 ", "A2B3C4"},
+		{"Tiger-Ocean-42", "tiger-ocean-42"},
+		{"TEAM-OFFSITE", "team-offsite"},
+		{"happybday", "HAPPYBDAY"},         // 符合随机字符格式，统一为大写
+		{"birthday", "birthday"},           // 含 I，不符合随机字符格式
+		{"abcdefghjkmnp", "abcdefghjkmnp"}, // 超过 12 位
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalPickupCode(tt.code); got != tt.want {
+			t.Errorf("CanonicalPickupCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePickupCodeFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr bool
+	}{
+		{"random 6", "A2B3C4", false},
+		{"random 8", "A2B3C4D5", false},
+		{"random 12", "A2B3C4D5E6F7", false},
+		{"word code", "tiger-ocean-42", false},
+		{"vanity code", "team-offsite-2026", false},
+		{"vanity without hyphen", "birthday", false},
+		{"too short", "abc", true},
+		{"too long", strings.Repeat("a", 33), true},
+		{"uppercase vanity", "Team-Offsite", true},
+		{"leading hyphen", "-team-offsite", true},
+		{"trailing hyphen", "team-offsite-", true},
+		{"consecutive hyphens", "team--offsite", true},
+		{"invalid character", "team_offsite", true},
+		{"unicode", "téam-offsite", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePickupCodeFormat(tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePickupCodeFormat(%q) error = %v, wantErr %v", tt.code, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsProfane(t *testing.T) {
+	gen := NewPickupCodeGenerator(8)
+	gen.SetBlocklist([]string{" Competitor ", ""})
+
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"team-offsite", false},
+		{"class-trip", false}, // 短词只匹配完整的一段
+		{"title-page", false},
+		{"FVCK2345", false},
+		{"FUCK2345", true},
+		{"my-sh1t-code", true},
+		{"big-ass-party", true},
+		{"sex-party", true},
+		{"acme-competitor", true},
+		{"C0MPET1T0R", true},
+	}
+
+	for _, tt := range tests {
+		if got := gen.IsProfane(tt.code); got != tt.want {
+			t.Errorf("IsProfane(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestValidateVanityCode(t *testing.T) {
+	gen := NewPickupCodeGenerator(8)
+
+	if err := gen.ValidateVanityCode("team-offsite-2026"); err != nil {
+		t.Errorf("ValidateVanityCode() error = %v", err)
+	}
+	for _, code := range []string{"abc", "team--offsite", "shit-happens"} {
+		if err := gen.ValidateVanityCode(code); !errors.Is(err, ErrInvalidVanityCode) {
+			t.Errorf("ValidateVanityCode(%q) error = %v, want ErrInvalidVanityCode", code, err)
+		}
+	}
+}
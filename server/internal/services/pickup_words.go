@@ -0,0 +1,44 @@
+package services
+
+// pickupWords 单词组合取件码使用的词表
+//
+// 只收录 3-6 个字母、容易拼写且不易混淆的常见名词，保证 4 个单词的取件码不超过 32 个字符；
+// 不收录会被敏感词过滤误判的单词（如 canal、grape）。
+var pickupWords = []string{
+	"acorn", "actor", "agent", "alarm", "album", "alert", "alpha", "amber",
+	"angle", "ankle", "apple", "apron", "arena", "arrow", "aspen", "atlas",
+	"attic", "autumn", "badge", "bagel", "baker", "bamboo", "banjo", "barn",
+	"basil", "basin", "beach", "beacon", "bean", "bear", "beaver", "bell",
+	"berry", "bike", "birch", "bison", "blade", "bloom", "board", "boat", "bonus",
+	"book", "boot", "bottle", "bread", "brick", "bridge", "brook", "broom",
+	"brush", "bubble", "bucket", "bugle", "cabin", "cable", "cactus", "camel",
+	"camera", "candle", "canoe", "canyon", "carbon", "cargo", "carpet",
+	"carrot", "castle", "cedar", "cello", "chalk", "cherry", "chess", "chief",
+	"chili", "cider", "circle", "citrus", "cliff", "clock", "cloud", "clover",
+	"coast", "cobalt", "cocoa", "comet", "coral", "cotton", "cousin", "coyote",
+	"crane", "crayon", "crown", "cup", "daisy", "dancer", "delta", "denim",
+	"desert", "dingo", "donkey", "dragon", "drum", "eagle", "echo", "elbow",
+	"elder", "ember", "engine", "falcon", "fern", "ferry", "fiddle", "field",
+	"flame", "flute", "forest", "fossil", "fox", "frost", "galaxy", "garden",
+	"garlic", "gecko", "giant", "ginger", "globe", "goose", "gravel",
+	"guitar", "hammer", "harbor", "harp", "hazel", "helmet", "heron", "hill",
+	"honey", "hornet", "horse", "igloo", "island", "ivory", "jacket", "jaguar",
+	"jelly", "jewel", "jungle", "kayak", "kettle", "kiwi", "koala", "ladder",
+	"lagoon", "lake", "lemon", "lily", "lime", "lion", "lizard", "llama",
+	"locket", "lotus", "magnet", "mango", "maple", "marble", "meadow", "melon",
+	"meteor", "mint", "mirror", "mitten", "monkey", "moose", "mosaic", "motor",
+	"muffin", "nectar", "needle", "nest", "noodle", "nutmeg", "oasis", "ocean",
+	"olive", "onion", "orange", "orbit", "orchid", "otter", "owl", "paddle",
+	"panda", "paper", "parrot", "peach", "peanut", "pearl", "pebble", "pepper",
+	"piano", "pigeon", "pillow", "pilot", "pine", "planet", "plum", "pocket",
+	"pony", "poppy", "potato", "puffin", "puzzle", "quartz", "quill", "rabbit",
+	"radar", "radio", "rain", "raven", "reef", "ribbon", "river", "robin",
+	"rocket", "rose", "ruby", "saddle", "sail", "salmon", "sandal", "saturn",
+	"scarf", "seal", "shadow", "shell", "silver", "sketch", "sled", "slope",
+	"snail", "spider", "spruce", "squid", "stable", "star", "stone", "storm",
+	"summer", "sunset", "swan", "table", "tango", "teapot", "tiger", "timber",
+	"toast", "tomato", "torch", "tower", "trail", "tulip", "tundra", "turtle",
+	"valley", "velvet", "violin", "wagon", "walnut", "walrus", "wave", "whale",
+	"willow", "window", "winter", "wizard", "wolf", "yacht", "yarn", "zebra",
+	"zephyr",
+}
@@ -0,0 +1,129 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现上传配额预占：
+//   - 上传开始时以条件更新原子地预占配额（多实例部署下同样无竞态）
+//   - 文件入库时在同一事务内将预占转为已用空间
+//   - 上传失败、取消或过期时释放预占
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultReservationTTL 配额预占的默认有效期
+//
+// 过期的预占由 GC 释放；之后入库的文件不再受预占保护，入库时重新检查配额。
+const DefaultReservationTTL = 24 * time.Hour
+
+// ReserveStorage 为上传预占 size 字节的配额
+//
+// 预占以 users 表上的条件更新完成：只有已用、已预占与本次预占之和不超过配额时
+// 更新才会生效，因此并发上传（包括跨实例）不会共同突破配额。
+func (s *FileService) ReserveStorage(userID uuid.UUID, uploadID string, size int64, ttl time.Duration) (*models.QuotaReservation, error) {
+	if size < 0 {
+		return nil, errors.New("reservation size must not be negative")
+	}
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	now := time.Now()
+	reservation := &models.QuotaReservation{
+		ID:        uploadID,
+		UserID:    userID,
+		Size:      size,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND storage_used + storage_reserved + ? <= storage_quota", userID, size).
+			Update("storage_reserved", gorm.Expr("storage_reserved + ?", size))
+		if result.Error != nil {
+			return fmt.Errorf("failed to reserve storage: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			var user models.User
+			if err := tx.First(&user, userID).Error; err != nil {
+				return fmt.Errorf("failed to get user: %w", err)
+			}
+			return ErrInsufficientStorage
+		}
+
+		if err := tx.Create(reservation).Error; err != nil {
+			return fmt.Errorf("failed to create reservation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// ReleaseReservation 释放上传的配额预占
+//
+// 预占不存在（已提交、已释放或从未创建）时直接返回。
+func (s *FileService) ReleaseReservation(uploadID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var reservation models.QuotaReservation
+		if err := tx.Where("id = ?", uploadID).First(&reservation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return fmt.Errorf("failed to get reservation: %w", err)
+		}
+		if _, err := reservation.Release(tx); err != nil {
+			return fmt.Errorf("failed to release reservation: %w", err)
+		}
+		return nil
+	})
+}
+
+// chargeStorage 在入库事务内计入用户的已用空间
+//
+// reservationID 对应的预占存在时，预占被删除并转为已用空间；否则（没有预占或预占
+// 已过期释放）直接以条件更新检查剩余配额。两种情况下都不会超出配额。
+func chargeStorage(tx *gorm.DB, userID uuid.UUID, size int64, reservationID string) error {
+	var reserved int64
+	if reservationID != "" {
+		var reservation models.QuotaReservation
+		err := tx.Where("id = ? AND user_id = ?", reservationID, userID).First(&reservation).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to get reservation: %w", err)
+		}
+		if err == nil {
+			result := tx.Where("id = ?", reservation.ID).Delete(&models.QuotaReservation{})
+			if result.Error != nil {
+				return fmt.Errorf("failed to commit reservation: %w", result.Error)
+			}
+			if result.RowsAffected == 1 {
+				reserved = reservation.Size
+			}
+		}
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND storage_used + storage_reserved - ? + ? <= storage_quota", userID, reserved, size).
+		Updates(map[string]interface{}{
+			"storage_used":     gorm.Expr("storage_used + ?", size),
+			"storage_reserved": gorm.Expr("storage_reserved - ?", reserved),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update storage usage: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStorage
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadUser 重新读取用户的配额字段
+func reloadUser(t *testing.T, service *FileService, user *models.User) *models.User {
+	var fresh models.User
+	require.NoError(t, service.db.First(&fresh, user.ID).Error)
+	return &fresh
+}
+
+// TestReserveStorage_Concurrent 测试并发预占不会共同突破配额
+func TestReserveStorage_Concurrent(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // 内存数据库的每个连接都是独立的库
+
+	service := NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	user := &models.User{Email: "quota@example.com", Password: "hashed_password", StorageQuota: 1000}
+	require.NoError(t, db.Create(user).Error)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := service.ReserveStorage(user.ID, fmt.Sprintf("upload-%d", i), 300, time.Hour); err == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			} else {
+				assert.ErrorIs(t, err, ErrInsufficientStorage)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, granted)
+	assert.Equal(t, int64(900), reloadUser(t, service, user).StorageReserved)
+}
+
+// TestReservation_Lifecycle 测试预占的提交与释放
+//
+// 测试场景：
+//  1. 预占计入可用空间，其他上传无法占用
+//  2. 入库时预占转为已用空间
+//  3. 释放后归还预占空间，重复释放无副作用
+func TestReservation_Lifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	user := &models.User{Email: "lifecycle@example.com", Password: "hashed_password", StorageQuota: 100}
+	require.NoError(t, db.Create(user).Error)
+
+	content := bytes.Repeat([]byte("r"), 60)
+	_, err := service.ReserveStorage(user.ID, "tus-upload", int64(len(content)), time.Hour)
+	require.NoError(t, err)
+
+	// 剩余 40 字节，不带预占的上传被拒绝
+	_, err = service.UploadFile(user.ID, "other.txt", 50, bytes.NewReader(bytes.Repeat([]byte("o"), 50)))
+	assert.ErrorIs(t, err, ErrInsufficientStorage)
+	fresh := reloadUser(t, service, user)
+	assert.Equal(t, int64(60), fresh.StorageReserved, "failed upload must release its own reservation")
+	assert.Equal(t, int64(40), fresh.AvailableStorage())
+
+	// 入库提交预占
+	metadata, err := service.UploadReservedFile(user.ID, "reserved.txt", int64(len(content)), bytes.NewReader(content), "tus-upload", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), metadata.Size)
+	fresh = reloadUser(t, service, user)
+	assert.Equal(t, int64(60), fresh.StorageUsed)
+	assert.Equal(t, int64(0), fresh.StorageReserved)
+
+	var count int64
+	db.Model(&models.QuotaReservation{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// 释放
+	_, err = service.ReserveStorage(user.ID, "cancelled", 30, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, service.ReleaseReservation("cancelled"))
+	require.NoError(t, service.ReleaseReservation("cancelled"))
+	fresh = reloadUser(t, service, user)
+	assert.Equal(t, int64(0), fresh.StorageReserved)
+	assert.Equal(t, int64(60), fresh.StorageUsed)
+}
+
+// TestReservation_ExpiredFallsBackToQuotaCheck 测试预占释放后入库仍检查配额
+func TestReservation_ExpiredFallsBackToQuotaCheck(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	user := &models.User{Email: "expired@example.com", Password: "hashed_password", StorageQuota: 100}
+	require.NoError(t, db.Create(user).Error)
+
+	_, err := service.ReserveStorage(user.ID, "slow-upload", 80, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, service.ReleaseReservation("slow-upload"))
+
+	// 预占释放期间其他上传占用了空间
+	_, err = service.UploadFile(user.ID, "fast.txt", 50, bytes.NewReader(bytes.Repeat([]byte("f"), 50)))
+	require.NoError(t, err)
+
+	_, err = service.UploadReservedFile(user.ID, "slow.txt", 80, bytes.NewReader(bytes.Repeat([]byte("s"), 80)), "slow-upload", nil)
+	assert.ErrorIs(t, err, ErrInsufficientStorage)
+
+	fresh := reloadUser(t, service, user)
+	assert.Equal(t, int64(50), fresh.StorageUsed)
+	assert.Equal(t, int64(0), fresh.StorageReserved)
+}
+
+// TestUploadService_ReservesQuota 测试分片上传会话在整个上传期间占用配额
+func TestUploadService_ReservesQuota(t *testing.T) {
+	db := setupTestDB(t)
+	fileService := NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	service := NewUploadService(db, fileService, t.TempDir())
+	user := &models.User{Email: "sessions@example.com", Password: "hashed_password", StorageQuota: 100}
+	require.NoError(t, db.Create(user).Error)
+
+	content := bytes.Repeat([]byte("s"), 60)
+	first, err := service.CreateSession(user.ID, "first.bin", int64(len(content)), sha256Hex(content))
+	require.NoError(t, err)
+
+	// 第一个会话尚未上传任何数据，但已占用配额
+	_, err = service.CreateSession(user.ID, "second.bin", int64(len(content)), sha256Hex(content))
+	assert.ErrorIs(t, err, ErrInsufficientStorage)
+
+	_, metadata, err := service.WriteChunk(first.ID, user.ID, 0, bytes.NewReader(content))
+	require.NoError(t, err)
+	require.NotNil(t, metadata)
+	fresh := reloadUser(t, service.fileService, user)
+	assert.Equal(t, int64(60), fresh.StorageUsed)
+	assert.Equal(t, int64(0), fresh.StorageReserved)
+
+	// 取消会话释放预占
+	small := []byte("small")
+	session, err := service.CreateSession(user.ID, "small.bin", int64(len(small)), sha256Hex(small))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), reloadUser(t, service.fileService, user).StorageReserved)
+	require.NoError(t, service.CancelSession(session.ID, user.ID))
+	assert.Equal(t, int64(0), reloadUser(t, service.fileService, user).StorageReserved)
+}
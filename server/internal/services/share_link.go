@@ -0,0 +1,196 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现分享链接（取件码之外的第二种分享地址）：
+//   - 链接令牌为 256 位随机数的 base64url 编码，不可猜测，适合粘贴到聊天中
+//   - 与取件码使用相同的访问密码、有效期和下载次数规则，共享同一个下载计数
+//   - 可单独撤销或重新生成，不影响取件码；通过一种地址访问时不返回另一种地址
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-17
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidShareLink 分享链接格式错误、不存在或已撤销
+var ErrInvalidShareLink = errors.New("invalid share link")
+
+// shareLinkTokenBytes 分享链接令牌的随机字节数（256 位）
+const shareLinkTokenBytes = 32
+
+// generateShareLinkToken 生成分享链接令牌
+func generateShareLinkToken() (string, error) {
+	b := make([]byte, shareLinkTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share link token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isShareLinkToken 检查令牌格式（不查询数据库）
+func isShareLinkToken(token string) bool {
+	if len(token) != base64.RawURLEncoding.EncodedLen(shareLinkTokenBytes) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil
+}
+
+// ShareLinkFingerprint 返回分享链接令牌的指纹
+//
+// 用于限流计数、日志等需要区分链接但不能保存令牌本身的场合。
+func ShareLinkFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetShareByLink 通过分享链接获取分享
+//
+// 与 GetShareByCode 相同，检查有效期、下载次数、接收人并验证访问密码。
+func (s *ShareService) GetShareByLink(token string, password string, viewerID uuid.UUID) (*models.ShareSession, []models.FileMetadata, error) {
+	session, err := s.findShareByLink(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.openShare(session, password, viewerID)
+}
+
+// GetShareByLinkTicket 通过分享链接验证下载凭证，返回分享及凭证可以下载的文件
+//
+// 与 GetShareByTicket 相同；链接撤销后，之前签发的凭证不能再通过该链接下载。
+func (s *ShareService) GetShareByLinkTicket(token string, ticketToken string, viewerID uuid.UUID) (*models.ShareSession, []models.FileMetadata, *DownloadTicket, error) {
+	if ticketToken == "" {
+		return nil, nil, nil, ErrTicketRequired
+	}
+
+	ticket, err := s.parseDownloadTicket(ticketToken)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	session, err := s.findShareByLink(token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s.checkTicket(session, ticket, viewerID)
+}
+
+// SaveToVaultByLink 通过分享链接转存到文件柜
+func (s *ShareService) SaveToVaultByLink(token string, password string, fileIDs []uuid.UUID, userID uuid.UUID) ([]uuid.UUID, error) {
+	session, files, err := s.GetShareByLink(token, password, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveToVault(session, files, fileIDs, userID)
+}
+
+// findShareByLink 按分享链接令牌查询分享
+func (s *ShareService) findShareByLink(token string) (*models.ShareSession, error) {
+	if !isShareLinkToken(token) {
+		return nil, ErrInvalidShareLink
+	}
+
+	var session models.ShareSession
+	err := s.db.Where("link_token = ?", token).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidShareLink
+		}
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return &session, nil
+}
+
+// IssueShareLink 为分享生成分享链接
+//
+// 已有链接时生成新的令牌替换（旧链接立即失效）。仅分享创建者可以操作，写入审计日志。
+// 返回修改后的分享。
+func (s *ShareService) IssueShareLink(shareID uuid.UUID, userID uuid.UUID, audit AuditContext) (*models.ShareSession, error) {
+	token, err := generateShareLinkToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var session *models.ShareSession
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		found, err := s.findOwnShare(tx, shareID, userID)
+		if err != nil {
+			return err
+		}
+		session = found
+		rotated := session.HasLink()
+
+		if err := tx.Model(&models.ShareSession{}).Where("id = ?", session.ID).Update("link_token", token).Error; err != nil {
+			return fmt.Errorf("failed to update share link: %w", err)
+		}
+		session.LinkToken = &token
+
+		// 审计日志不记录令牌本身
+		err = models.CreateLog(tx, &userID, models.ActionCreateShareLink, models.ResourceTypeShare, session.ID.String(),
+			audit.IPAddress, audit.UserAgent, map[string]interface{}{
+				"rotated":     rotated,
+				"fingerprint": ShareLinkFingerprint(token),
+			})
+		if err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// RevokeShareLink 撤销分享链接
+//
+// 只撤销链接，取件码仍然有效；之前通过链接签发的下载凭证随之失效。
+// 未启用分享链接时不做任何修改。仅分享创建者可以操作，写入审计日志。
+func (s *ShareService) RevokeShareLink(shareID uuid.UUID, userID uuid.UUID, audit AuditContext) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		session, err := s.findOwnShare(tx, shareID, userID)
+		if err != nil {
+			return err
+		}
+		if !session.HasLink() {
+			return nil
+		}
+
+		if err := tx.Model(&models.ShareSession{}).Where("id = ?", session.ID).Update("link_token", nil).Error; err != nil {
+			return fmt.Errorf("failed to revoke share link: %w", err)
+		}
+
+		err = models.CreateLog(tx, &userID, models.ActionRevokeShareLink, models.ResourceTypeShare, session.ID.String(),
+			audit.IPAddress, audit.UserAgent, map[string]interface{}{
+				"fingerprint": ShareLinkFingerprint(*session.LinkToken),
+			})
+		if err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+		return nil
+	})
+}
+
+// findOwnShare 查询用户创建的分享，不存在或不属于该用户时返回 ErrShareNotFound
+func (s *ShareService) findOwnShare(tx *gorm.DB, shareID uuid.UUID, userID uuid.UUID) (*models.ShareSession, error) {
+	var session models.ShareSession
+	err := tx.Where("id = ? AND creator_id = ?", shareID, userID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return &session, nil
+}
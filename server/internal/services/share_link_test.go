@@ -0,0 +1,158 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShareLink 测试通过分享链接访问分享
+//
+// 测试场景：
+//  1. 创建分享时生成链接，链接与取件码使用相同的访问密码
+//  2. 格式错误、不存在的链接
+//  3. 下载凭证只能通过签发时的分享使用，链接与取件码共享下载次数
+//  4. 通过链接转存
+func TestShareLink(t *testing.T) {
+	shareService, fileService, user, _ := setupShareTestEnv(t)
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 1)
+
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+		FileIDs:      fileIDs,
+		ExpiresIn:    time.Hour,
+		MaxDownloads: 2,
+		Password:     "secret",
+		SecretLink:   true,
+	})
+	require.NoError(t, err)
+	require.True(t, share.HasLink())
+	token := *share.LinkToken
+	assert.Len(t, token, 43) // 256 位的 base64url 编码
+	assert.NotContains(t, token, share.PickupCode)
+
+	// 与取件码相同的访问密码规则
+	_, _, err = shareService.GetShareByLink(token, "", uuid.Nil)
+	assert.ErrorIs(t, err, ErrPasswordRequired)
+	_, _, err = shareService.GetShareByLink(token, "wrong", uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	found, files, err := shareService.GetShareByLink(token, "secret", uuid.Nil)
+	require.NoError(t, err)
+	assert.Equal(t, share.ID, found.ID)
+	require.Len(t, files, 1)
+
+	// 格式错误、大小写不同、不存在的链接
+	for _, invalid := range []string{"", share.PickupCode, strings.ToUpper(token), token[:42] + "!", strings.Repeat("A", 43)} {
+		_, _, err = shareService.GetShareByLink(invalid, "secret", uuid.Nil)
+		assert.ErrorIs(t, err, ErrInvalidShareLink, invalid)
+	}
+
+	// 下载凭证绑定分享，通过链接或取件码都可以使用
+	ticket, err := shareService.IssueDownloadTicket(found, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+	_, _, _, err = shareService.GetShareByLinkTicket(token, ticket.Token, uuid.Nil)
+	require.NoError(t, err)
+	_, _, _, err = shareService.GetShareByLinkTicket(token, "", uuid.Nil)
+	assert.ErrorIs(t, err, ErrTicketRequired)
+
+	other, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs, ExpiresIn: time.Hour, SecretLink: true})
+	require.NoError(t, err)
+	_, _, _, err = shareService.GetShareByLinkTicket(*other.LinkToken, ticket.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	// 链接和取件码共享下载次数
+	slot, err := shareService.ClaimDownload(found, fileIDs[0], DownloadRequest{})
+	require.NoError(t, err)
+	_, err = shareService.FinishDownload(slot, files[0].Size, files[0].Size, true)
+	require.NoError(t, err)
+
+	otherUser := &models.User{
+		Email:        "saver@example.com",
+		Password:     "password",
+		Role:         models.RoleUser,
+		Status:       models.StatusActive,
+		StorageQuota: 10 * 1024 * 1024 * 1024,
+	}
+	require.NoError(t, shareService.db.Create(otherUser).Error)
+	saved, err := shareService.SaveToVaultByLink(token, "secret", fileIDs, otherUser.ID)
+	require.NoError(t, err)
+	assert.Len(t, saved, 1)
+
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "secret", uuid.Nil)
+	assert.EqualError(t, err, "download limit reached")
+	_, _, err = shareService.GetShareByLink(token, "secret", uuid.Nil)
+	assert.EqualError(t, err, "download limit reached")
+}
+
+// TestIssueAndRevokeShareLink 测试生成、重新生成和撤销分享链接
+func TestIssueAndRevokeShareLink(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 1)
+	audit := AuditContext{IPAddress: "192.0.2.1", UserAgent: "test"}
+
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs, ExpiresIn: time.Hour})
+	require.NoError(t, err)
+	assert.False(t, share.HasLink())
+
+	// 未启用时撤销不做任何修改
+	require.NoError(t, shareService.RevokeShareLink(share.ID, user.ID, audit))
+
+	updated, err := shareService.IssueShareLink(share.ID, user.ID, audit)
+	require.NoError(t, err)
+	require.True(t, updated.HasLink())
+	first := *updated.LinkToken
+	_, _, err = shareService.GetShareByLink(first, "", uuid.Nil)
+	require.NoError(t, err)
+
+	// 重新生成后旧链接失效，通过旧链接签发的凭证也不能再使用
+	ticket, err := shareService.IssueDownloadTicket(updated, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+	updated, err = shareService.IssueShareLink(share.ID, user.ID, audit)
+	require.NoError(t, err)
+	second := *updated.LinkToken
+	assert.NotEqual(t, first, second)
+	_, _, err = shareService.GetShareByLink(first, "", uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidShareLink)
+	_, _, _, err = shareService.GetShareByLinkTicket(first, ticket.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidShareLink)
+	_, _, _, err = shareService.GetShareByLinkTicket(second, ticket.Token, uuid.Nil)
+	assert.NoError(t, err)
+
+	// 撤销链接不影响取件码
+	require.NoError(t, shareService.RevokeShareLink(share.ID, user.ID, audit))
+	_, _, err = shareService.GetShareByLink(second, "", uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidShareLink)
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "", uuid.Nil)
+	assert.NoError(t, err)
+	assert.False(t, reloadShare(t, shareService, share).HasLink())
+
+	// 仅分享创建者可以操作
+	_, err = shareService.IssueShareLink(share.ID, uuid.New(), audit)
+	assert.ErrorIs(t, err, ErrShareNotFound)
+	assert.ErrorIs(t, shareService.RevokeShareLink(share.ID, uuid.New(), audit), ErrShareNotFound)
+
+	// 审计日志只记录令牌指纹
+	var logs []models.AuditLog
+	require.NoError(t, db.Where("resource_id = ? AND action IN ?", share.ID.String(),
+		[]string{models.ActionCreateShareLink, models.ActionRevokeShareLink}).Find(&logs).Error)
+	actions := map[string]int{}
+	fingerprints := map[string]bool{}
+	for _, log := range logs {
+		actions[log.Action]++
+		assert.NotContains(t, string(log.Details), first)
+		assert.NotContains(t, string(log.Details), second)
+
+		var details map[string]interface{}
+		require.NoError(t, json.Unmarshal(log.Details, &details))
+		if log.Action == models.ActionCreateShareLink {
+			fingerprints[details["fingerprint"].(string)] = details["rotated"].(bool)
+		}
+	}
+	assert.Equal(t, map[string]int{models.ActionCreateShareLink: 2, models.ActionRevokeShareLink: 1}, actions)
+	assert.Equal(t, map[string]bool{ShareLinkFingerprint(first): false, ShareLinkFingerprint(second): true}, fingerprints)
+}
@@ -0,0 +1,245 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现分享限制：
+//   - 分享有效期（未指定时使用默认有效期，不超过最大有效期）
+//   - 单次分享最大文件数
+//   - 单用户最大活跃分享数（创建分享时锁定用户行检查，并发创建不会突破上限）
+//   - 管理员按用户覆盖以上限制
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidShareExpiry 分享有效期不合法（为负）
+	ErrInvalidShareExpiry = errors.New("share expiry must be positive")
+	// ErrShareExpiryTooLong 分享有效期超过上限
+	ErrShareExpiryTooLong = errors.New("share expiry exceeds the allowed maximum")
+	// ErrTooManyShareFiles 分享的文件数超过上限
+	ErrTooManyShareFiles = errors.New("too many files in share")
+	// ErrTooManyActiveShares 用户的活跃分享数达到上限
+	ErrTooManyActiveShares = errors.New("too many active shares")
+	// ErrInvalidSharePolicy 管理员设置的分享限制不合法
+	ErrInvalidSharePolicy = errors.New("invalid share policy")
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// SharePolicyError 分享超出限制
+//
+// Err 为 ErrShareExpiryTooLong、ErrTooManyShareFiles 或 ErrTooManyActiveShares，
+// 可用 errors.Is 判断；Limit 和 Value 供调用方返回给客户端（有效期以秒为单位）。
+type SharePolicyError struct {
+	Err   error
+	Limit int64 // 限制值
+	Value int64 // 请求的值
+}
+
+func (e *SharePolicyError) Error() string {
+	return fmt.Sprintf("%v: %d (limit %d)", e.Err, e.Value, e.Limit)
+}
+
+func (e *SharePolicyError) Unwrap() error {
+	return e.Err
+}
+
+// SharePolicy 分享限制
+//
+// 零值表示不限制；DefaultExpiry 为 0 时未指定有效期的请求被拒绝。
+type SharePolicy struct {
+	DefaultExpiry   time.Duration // 默认分享有效期
+	MaxExpiry       time.Duration // 最大分享有效期，0 表示不限制
+	MaxFiles        int           // 单次分享最大文件数，0 表示不限制
+	MaxActiveShares int           // 最大活跃分享数，0 表示不限制
+}
+
+// ResolveExpiry 返回分享实际使用的有效期
+//
+// expiresIn 为 0 时使用默认有效期（超过最大有效期时取最大有效期）。
+func (p SharePolicy) ResolveExpiry(expiresIn time.Duration) (time.Duration, error) {
+	if expiresIn == 0 {
+		expiresIn = p.DefaultExpiry
+		if p.MaxExpiry > 0 && expiresIn > p.MaxExpiry {
+			expiresIn = p.MaxExpiry
+		}
+	}
+	if expiresIn <= 0 {
+		return 0, ErrInvalidShareExpiry
+	}
+	if err := p.CheckExpiry(expiresIn); err != nil {
+		return 0, err
+	}
+	return expiresIn, nil
+}
+
+// CheckExpiry 检查有效期是否超过上限
+func (p SharePolicy) CheckExpiry(expiresIn time.Duration) error {
+	if p.MaxExpiry > 0 && expiresIn > p.MaxExpiry {
+		return &SharePolicyError{
+			Err:   ErrShareExpiryTooLong,
+			Limit: int64(p.MaxExpiry / time.Second),
+			Value: int64(expiresIn / time.Second),
+		}
+	}
+	return nil
+}
+
+// CheckFileCount 检查分享的文件数是否超过上限
+func (p SharePolicy) CheckFileCount(count int) error {
+	if p.MaxFiles > 0 && count > p.MaxFiles {
+		return &SharePolicyError{Err: ErrTooManyShareFiles, Limit: int64(p.MaxFiles), Value: int64(count)}
+	}
+	return nil
+}
+
+// withOverride 应用管理员为用户设置的限制
+func (p SharePolicy) withOverride(override *models.SharePolicyOverride) SharePolicy {
+	if override == nil {
+		return p
+	}
+	if override.MaxShareExpiry != nil {
+		p.MaxExpiry = time.Duration(*override.MaxShareExpiry) * time.Second
+	}
+	if override.MaxFilesPerShare != nil {
+		p.MaxFiles = *override.MaxFilesPerShare
+	}
+	if override.MaxActiveShares != nil {
+		p.MaxActiveShares = *override.MaxActiveShares
+	}
+	return p
+}
+
+// SetSharePolicy 设置全局分享限制（可由管理员按用户覆盖）
+func (s *ShareService) SetSharePolicy(policy SharePolicy) {
+	s.policy = policy
+}
+
+// EffectiveSharePolicy 返回用户实际适用的分享限制
+func (s *ShareService) EffectiveSharePolicy(userID uuid.UUID) (SharePolicy, error) {
+	return s.policyFor(s.db, userID)
+}
+
+// policyFor 读取用户的限制覆盖并应用到全局限制
+func (s *ShareService) policyFor(tx *gorm.DB, userID uuid.UUID) (SharePolicy, error) {
+	override, err := s.findSharePolicyOverride(tx, userID)
+	if err != nil {
+		return SharePolicy{}, err
+	}
+	return s.policy.withOverride(override), nil
+}
+
+// findSharePolicyOverride 读取用户的限制覆盖，未设置时返回 nil
+func (s *ShareService) findSharePolicyOverride(tx *gorm.DB, userID uuid.UUID) (*models.SharePolicyOverride, error) {
+	var override models.SharePolicyOverride
+	err := tx.Where("user_id = ?", userID).First(&override).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get share policy override: %w", err)
+	}
+	return &override, nil
+}
+
+// checkActiveShares 检查用户能否再增加一个活跃分享
+//
+// 必须在事务中调用：先锁定用户行，串行化同一用户的并发创建（包括跨实例），
+// 计数与随后的插入之间不会有其他分享生效。
+func (s *ShareService) checkActiveShares(tx *gorm.DB, userID uuid.UUID, policy SharePolicy) error {
+	if policy.MaxActiveShares <= 0 {
+		return nil
+	}
+
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, "id = ?", userID).Error
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var count int64
+	err = tx.Model(&models.ShareSession{}).
+		Where("creator_id = ? AND stopped_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Where("max_downloads = 0 OR current_downloads < max_downloads").
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to count active shares: %w", err)
+	}
+	if count >= int64(policy.MaxActiveShares) {
+		return &SharePolicyError{Err: ErrTooManyActiveShares, Limit: int64(policy.MaxActiveShares), Value: count + 1}
+	}
+	return nil
+}
+
+// GetSharePolicyOverride 获取管理员为用户设置的分享限制，未设置时返回 nil
+func (s *ShareService) GetSharePolicyOverride(userID uuid.UUID) (*models.SharePolicyOverride, error) {
+	return s.findSharePolicyOverride(s.db, userID)
+}
+
+// SetSharePolicyOverride 设置用户的分享限制覆盖
+//
+// 字段为空时使用全局配置，全部为空时删除该用户的覆盖；0 表示对该用户不限制。
+// 修改写入审计日志。已创建的分享不受影响。
+func (s *ShareService) SetSharePolicyOverride(userID uuid.UUID, override *models.SharePolicyOverride, adminID uuid.UUID, audit AuditContext) error {
+	if (override.MaxShareExpiry != nil && *override.MaxShareExpiry < 0) ||
+		(override.MaxFilesPerShare != nil && *override.MaxFilesPerShare < 0) ||
+		(override.MaxActiveShares != nil && *override.MaxActiveShares < 0) {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidSharePolicy)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id").First(&user, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		previous, err := s.findSharePolicyOverride(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if override.IsEmpty() {
+			if previous == nil {
+				return nil
+			}
+			if err := tx.Where("user_id = ?", userID).Delete(&models.SharePolicyOverride{}).Error; err != nil {
+				return fmt.Errorf("failed to delete share policy override: %w", err)
+			}
+		} else {
+			override.UserID = userID
+			override.UpdatedBy = &adminID
+			override.UpdatedAt = time.Now()
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}},
+				UpdateAll: true,
+			}).Create(override).Error
+			if err != nil {
+				return fmt.Errorf("failed to save share policy override: %w", err)
+			}
+		}
+
+		details := map[string]interface{}{"from": previous, "to": override}
+		if override.IsEmpty() {
+			details["to"] = nil
+		}
+		err = models.CreateLog(tx, &adminID, models.ActionUpdateSharePolicy, models.ResourceTypeUser, userID.String(),
+			audit.IPAddress, audit.UserAgent, details)
+		if err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSharePolicy_ResolveExpiry 测试分享有效期的默认值与上限
+func TestSharePolicy_ResolveExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    SharePolicy
+		expiresIn time.Duration
+		want      time.Duration
+		wantErr   error
+	}{
+		{"未指定时使用默认有效期", SharePolicy{DefaultExpiry: 24 * time.Hour, MaxExpiry: 48 * time.Hour}, 0, 24 * time.Hour, nil},
+		{"默认有效期超过上限时取上限", SharePolicy{DefaultExpiry: 24 * time.Hour, MaxExpiry: time.Hour}, 0, time.Hour, nil},
+		{"等于上限", SharePolicy{MaxExpiry: 48 * time.Hour}, 48 * time.Hour, 48 * time.Hour, nil},
+		{"超过上限", SharePolicy{MaxExpiry: 48 * time.Hour}, 49 * time.Hour, 0, ErrShareExpiryTooLong},
+		{"不限制", SharePolicy{}, 365 * 24 * time.Hour, 365 * 24 * time.Hour, nil},
+		{"有效期为负", SharePolicy{}, -time.Hour, 0, ErrInvalidShareExpiry},
+		{"未指定且没有默认有效期", SharePolicy{}, 0, 0, ErrInvalidShareExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.ResolveExpiry(tt.expiresIn)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// uploadTestFiles 为用户上传 n 个测试文件
+func uploadTestFiles(t *testing.T, fileService *FileService, userID uuid.UUID, n int) []uuid.UUID {
+	var fileIDs []uuid.UUID
+	for i := 0; i < n; i++ {
+		content := []byte(fmt.Sprintf("policy file %d", i))
+		file, err := fileService.UploadFile(userID, fmt.Sprintf("policy%d.txt", i), int64(len(content)), bytes.NewReader(content))
+		require.NoError(t, err)
+		fileIDs = append(fileIDs, file.ID)
+	}
+	return fileIDs
+}
+
+// TestCreateShare_Policy 测试创建与修改分享时的限制
+//
+// 测试场景：
+//  1. 未指定有效期时使用默认有效期，超过上限时返回限制值
+//  2. 文件数超过上限
+//  3. 活跃分享数达到上限，停止分享后释放名额
+//  4. 重新启用分享同样受活跃分享数限制
+func TestCreateShare_Policy(t *testing.T) {
+	shareService, fileService, user, _ := setupShareTestEnv(t)
+	shareService.SetSharePolicy(SharePolicy{
+		DefaultExpiry:   24 * time.Hour,
+		MaxExpiry:       48 * time.Hour,
+		MaxFiles:        2,
+		MaxActiveShares: 2,
+	})
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 3)
+
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1]})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), share.ExpiresAt, 2*time.Second)
+
+	_, err = shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1], ExpiresIn: 72 * time.Hour})
+	var policyErr *SharePolicyError
+	require.True(t, errors.As(err, &policyErr))
+	assert.ErrorIs(t, err, ErrShareExpiryTooLong)
+	assert.Equal(t, int64(48*3600), policyErr.Limit)
+	assert.Equal(t, int64(72*3600), policyErr.Value)
+
+	_, err = shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs, ExpiresIn: time.Hour})
+	assert.ErrorIs(t, err, ErrTooManyShareFiles)
+
+	// 修改分享时加入文件同样受文件数限制
+	_, err = shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{AddFileIDs: fileIDs[1:]}, AuditContext{})
+	assert.ErrorIs(t, err, ErrTooManyShareFiles)
+
+	// 活跃分享数
+	second, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1], ExpiresIn: time.Hour})
+	require.NoError(t, err)
+	_, err = shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1], ExpiresIn: time.Hour})
+	require.True(t, errors.As(err, &policyErr))
+	assert.ErrorIs(t, err, ErrTooManyActiveShares)
+	assert.Equal(t, int64(2), policyErr.Limit)
+
+	require.NoError(t, shareService.StopShare(second.ID, user.ID))
+	third, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1], ExpiresIn: time.Hour})
+	require.NoError(t, err)
+
+	// 已达上限时不能重新启用
+	_, err = shareService.UpdateShare(second.ID, user.ID, &UpdateShareRequest{Reactivate: true}, AuditContext{})
+	assert.ErrorIs(t, err, ErrTooManyActiveShares)
+	require.NoError(t, shareService.StopShare(third.ID, user.ID))
+	_, err = shareService.UpdateShare(second.ID, user.ID, &UpdateShareRequest{Reactivate: true}, AuditContext{})
+	assert.NoError(t, err)
+}
+
+// TestSharePolicyOverride 测试管理员按用户覆盖分享限制
+func TestSharePolicyOverride(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	shareService.SetSharePolicy(SharePolicy{
+		DefaultExpiry:   24 * time.Hour,
+		MaxExpiry:       48 * time.Hour,
+		MaxFiles:        1,
+		MaxActiveShares: 1,
+	})
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 2)
+	adminID := uuid.New()
+
+	override, err := shareService.GetSharePolicyOverride(user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, override)
+
+	// 放宽有效期、取消文件数限制，活跃分享数沿用全局配置
+	maxExpiry := int64(30 * 24 * 3600)
+	unlimited := 0
+	err = shareService.SetSharePolicyOverride(user.ID, &models.SharePolicyOverride{
+		MaxShareExpiry:   &maxExpiry,
+		MaxFilesPerShare: &unlimited,
+	}, adminID, AuditContext{IPAddress: "192.0.2.1"})
+	require.NoError(t, err)
+
+	policy, err := shareService.EffectiveSharePolicy(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, SharePolicy{
+		DefaultExpiry:   24 * time.Hour,
+		MaxExpiry:       30 * 24 * time.Hour,
+		MaxFiles:        0,
+		MaxActiveShares: 1,
+	}, policy)
+
+	_, err = shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs, ExpiresIn: 7 * 24 * time.Hour})
+	require.NoError(t, err)
+	_, err = shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs[:1]})
+	assert.ErrorIs(t, err, ErrTooManyActiveShares)
+
+	// 修改写入审计日志
+	var log models.AuditLog
+	require.NoError(t, db.Where("action = ?", models.ActionUpdateSharePolicy).First(&log).Error)
+	assert.Equal(t, models.ResourceTypeUser, log.ResourceType)
+	assert.Equal(t, user.ID.String(), log.ResourceID)
+	require.NotNil(t, log.UserID)
+	assert.Equal(t, adminID, *log.UserID)
+
+	// 再次设置覆盖原值
+	maxActive := 5
+	err = shareService.SetSharePolicyOverride(user.ID, &models.SharePolicyOverride{MaxActiveShares: &maxActive}, adminID, AuditContext{})
+	require.NoError(t, err)
+	policy, err = shareService.EffectiveSharePolicy(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 48*time.Hour, policy.MaxExpiry)
+	assert.Equal(t, 1, policy.MaxFiles)
+	assert.Equal(t, 5, policy.MaxActiveShares)
+
+	// 全部为空时恢复全局配置
+	require.NoError(t, shareService.SetSharePolicyOverride(user.ID, &models.SharePolicyOverride{}, adminID, AuditContext{}))
+	override, err = shareService.GetSharePolicyOverride(user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, override)
+
+	// 不合法的设置
+	negative := -1
+	err = shareService.SetSharePolicyOverride(user.ID, &models.SharePolicyOverride{MaxActiveShares: &negative}, adminID, AuditContext{})
+	assert.ErrorIs(t, err, ErrInvalidSharePolicy)
+	err = shareService.SetSharePolicyOverride(uuid.New(), &models.SharePolicyOverride{MaxActiveShares: &maxActive}, adminID, AuditContext{})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -0,0 +1,219 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现指定接收人的分享：
+//   - 创建分享时指定接收人（注册用户 ID 或邮箱），分享仅限接收人登录后访问和转存
+//   - 接收人必须是已注册的用户：注册不验证邮箱所有权，不能按邮箱把分享交给之后注册的人
+//   - 接收人的"收到的分享"列表
+//   - 分享创建者查看各接收人是否访问过
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-17
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRecipient 接收人不合法（格式错误、无法对应唯一的注册用户或数量超限）
+	ErrInvalidRecipient = errors.New("invalid share recipient")
+	// ErrRecipientRequired 分享仅限接收人访问，访问者未登录
+	ErrRecipientRequired = errors.New("share is restricted to its recipients, sign in to access it")
+	// ErrNotRecipient 访问者不是分享的接收人
+	ErrNotRecipient = errors.New("not a recipient of this share")
+)
+
+// MaxShareRecipients 单个分享最多的接收人数
+const MaxShareRecipients = 50
+
+// IncomingShare 收到的分享
+type IncomingShare struct {
+	models.ShareSession
+	Status         models.ShareStatus `json:"status"`
+	SenderEmail    string             `json:"sender_email"`
+	AccessCount    int                `json:"access_count"` // 当前用户访问的次数
+	LastAccessedAt *time.Time         `json:"last_accessed_at,omitempty"`
+}
+
+// resolveRecipients 解析接收人列表
+//
+// 每一项为注册用户 ID 或已注册的邮箱（不区分大小写），按用户去重。
+func (s *ShareService) resolveRecipients(inputs []string) ([]models.ShareRecipient, error) {
+	if len(inputs) > MaxShareRecipients {
+		return nil, fmt.Errorf("%w: at most %d recipients", ErrInvalidRecipient, MaxShareRecipients)
+	}
+
+	seen := make(map[uuid.UUID]bool, len(inputs))
+	recipients := make([]models.ShareRecipient, 0, len(inputs))
+	for _, input := range inputs {
+		user, err := s.findRecipientUser(strings.TrimSpace(input))
+		if err != nil {
+			return nil, err
+		}
+		if seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+		recipients = append(recipients, models.ShareRecipient{
+			UserID: user.ID,
+			Email:  strings.ToLower(user.Email),
+		})
+	}
+	return recipients, nil
+}
+
+// findRecipientUser 按用户 ID 或邮箱查询接收人
+//
+// 邮箱必须对应唯一的注册用户：不存在时不为之后注册该邮箱的人保留分享，
+// 只有大小写不同的多个账户时拒绝，由创建者改用用户 ID 指定。
+// 用户不存在、邮箱未注册和对应多个账户返回同样的错误，不能借此探测邮箱是否已注册。
+func (s *ShareService) findRecipientUser(input string) (*models.User, error) {
+	var users []models.User
+	if userID, err := uuid.Parse(input); err == nil {
+		if err := s.db.Select("id", "email").Where("id = ?", userID).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if len(users) == 0 {
+			return nil, unknownRecipient(input)
+		}
+		return &users[0], nil
+	}
+
+	if err := validateEmail(input); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrInvalidRecipient, input, err)
+	}
+	err := s.db.Select("id", "email").Where("LOWER(email) = ?", strings.ToLower(input)).Limit(2).Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if len(users) != 1 {
+		return nil, unknownRecipient(input)
+	}
+	return &users[0], nil
+}
+
+// unknownRecipient 接收人无法对应唯一的注册用户
+func unknownRecipient(input string) error {
+	return fmt.Errorf("%w: %q", ErrInvalidRecipient, input)
+}
+
+// checkRecipient 检查访问者能否访问指定接收人的分享
+//
+// 不限接收人的分享和分享创建者返回 nil, nil；接收人返回其记录，用于更新访问记录。
+func (s *ShareService) checkRecipient(session *models.ShareSession, viewerID uuid.UUID) (*models.ShareRecipient, error) {
+	if !session.Restricted || viewerID == session.CreatorID {
+		return nil, nil
+	}
+	if viewerID == uuid.Nil {
+		return nil, ErrRecipientRequired
+	}
+
+	var recipient models.ShareRecipient
+	err := s.db.Where("share_id = ? AND user_id = ?", session.ID, viewerID).First(&recipient).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotRecipient
+		}
+		return nil, fmt.Errorf("failed to get share recipient: %w", err)
+	}
+	return &recipient, nil
+}
+
+// recordRecipientAccess 更新接收人的访问记录
+func (s *ShareService) recordRecipientAccess(recipient *models.ShareRecipient) error {
+	now := time.Now()
+	err := s.db.Model(&models.ShareRecipient{}).Where("id = ?", recipient.ID).Updates(map[string]interface{}{
+		"access_count":      gorm.Expr("access_count + 1"),
+		"first_accessed_at": gorm.Expr("COALESCE(first_accessed_at, ?)", now),
+		"last_accessed_at":  now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record share access: %w", err)
+	}
+	return nil
+}
+
+// ListShareRecipients 获取分享的接收人及其访问记录（仅分享创建者）
+func (s *ShareService) ListShareRecipients(shareID uuid.UUID, userID uuid.UUID) ([]models.ShareRecipient, error) {
+	session, err := s.findOwnShare(s.db, shareID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []models.ShareRecipient
+	if err := s.db.Where("share_id = ?", session.ID).Order("email ASC").Find(&recipients).Error; err != nil {
+		return nil, fmt.Errorf("failed to list share recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+// ListIncomingShares 获取用户收到的分享（按分享时间倒序）
+//
+// 返回的分享不包含分享链接。
+func (s *ShareService) ListIncomingShares(userID uuid.UUID, page int, pageSize int) ([]IncomingShare, int64, error) {
+	incoming := func() *gorm.DB {
+		return s.db.Model(&models.ShareRecipient{}).Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := incoming().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count incoming shares: %w", err)
+	}
+
+	var recipients []models.ShareRecipient
+	offset := (page - 1) * pageSize
+	if err := incoming().Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&recipients).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list incoming shares: %w", err)
+	}
+	if len(recipients) == 0 {
+		return []IncomingShare{}, total, nil
+	}
+
+	shareIDs := make([]uuid.UUID, len(recipients))
+	for i, recipient := range recipients {
+		shareIDs[i] = recipient.ShareID
+	}
+	var sessions []models.ShareSession
+	if err := s.db.Where("id IN ?", shareIDs).Find(&sessions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get shares: %w", err)
+	}
+	sessionMap := make(map[uuid.UUID]models.ShareSession, len(sessions))
+	creatorIDs := make([]uuid.UUID, 0, len(sessions))
+	for _, session := range sessions {
+		sessionMap[session.ID] = session
+		creatorIDs = append(creatorIDs, session.CreatorID)
+	}
+
+	var creators []models.User
+	if err := s.db.Select("id", "email").Where("id IN ?", creatorIDs).Find(&creators).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get share creators: %w", err)
+	}
+	creatorEmails := make(map[uuid.UUID]string, len(creators))
+	for _, creator := range creators {
+		creatorEmails[creator.ID] = creator.Email
+	}
+
+	shares := make([]IncomingShare, 0, len(recipients))
+	for _, recipient := range recipients {
+		session, ok := sessionMap[recipient.ShareID]
+		if !ok {
+			continue
+		}
+		session.LinkToken = nil
+		shares = append(shares, IncomingShare{
+			ShareSession:   session,
+			Status:         session.GetStatus(),
+			SenderEmail:    creatorEmails[session.CreatorID],
+			AccessCount:    recipient.AccessCount,
+			LastAccessedAt: recipient.LastAccessedAt,
+		})
+	}
+	return shares, total, nil
+}
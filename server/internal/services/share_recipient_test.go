@@ -0,0 +1,208 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createRecipientUser 创建测试用户
+func createRecipientUser(t *testing.T, db *gorm.DB, email string) *models.User {
+	user := &models.User{
+		Email:        email,
+		Password:     "password",
+		Role:         models.RoleUser,
+		Status:       models.StatusActive,
+		StorageQuota: 10 * 1024 * 1024 * 1024,
+	}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+// TestRecipientShare 测试指定接收人的分享
+//
+// 测试场景：
+//  1. 按用户 ID 和已注册的邮箱指定接收人，邮箱不区分大小写，按用户去重
+//  2. 未登录、非接收人不能访问（先于访问密码检查），接收人和创建者可以访问
+//  3. 之后注册的同名（大小写不同）邮箱账户不是接收人
+//  4. 转存和分享链接同样受接收人限制，下载凭证只能由签发给的接收人和创建者使用
+//  5. 创建者查看接收人的访问记录，接收人查看收到的分享
+func TestRecipientShare(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 1)
+	alice := createRecipientUser(t, db, "Alice@example.com")
+	bob := createRecipientUser(t, db, "bob@example.com")
+	carol := createRecipientUser(t, db, "carol@example.com")
+	stranger := createRecipientUser(t, db, "stranger@example.com")
+
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+		FileIDs:    fileIDs,
+		ExpiresIn:  time.Hour,
+		Password:   "secret",
+		SecretLink: true,
+		Recipients: []string{alice.ID.String(), " BOB@example.com ", "carol@example.com", "alice@EXAMPLE.com"},
+	})
+	require.NoError(t, err)
+	assert.True(t, share.Restricted)
+
+	recipients, err := shareService.ListShareRecipients(share.ID, user.ID)
+	require.NoError(t, err)
+	require.Len(t, recipients, 3)
+	assert.Equal(t, "alice@example.com", recipients[0].Email)
+	assert.Equal(t, alice.ID, recipients[0].UserID)
+	assert.Equal(t, "bob@example.com", recipients[1].Email)
+	assert.Equal(t, bob.ID, recipients[1].UserID)
+	assert.Equal(t, "carol@example.com", recipients[2].Email)
+	assert.Equal(t, carol.ID, recipients[2].UserID)
+
+	// 未登录、非接收人在访问密码之前被拒绝
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "secret", uuid.Nil)
+	assert.ErrorIs(t, err, ErrRecipientRequired)
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "wrong", stranger.ID)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+	_, _, err = shareService.GetShareByLink(*share.LinkToken, "secret", stranger.ID)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+
+	// 接收人同样需要访问密码
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "wrong", alice.ID)
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	_, files, err := shareService.GetShareByCode(share.PickupCode, "secret", alice.ID)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	_, _, err = shareService.GetShareByLink(*share.LinkToken, "secret", alice.ID)
+	require.NoError(t, err)
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "secret", user.ID)
+	require.NoError(t, err)
+
+	// 转发给他人的下载凭证不能使用
+	ticket, err := shareService.IssueDownloadTicket(share, uuid.Nil, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, ticket.ViewerID)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, ticket.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrRecipientRequired)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, ticket.Token, stranger.ID)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+	_, _, _, err = shareService.GetShareByLinkTicket(*share.LinkToken, ticket.Token, bob.ID)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, ticket.Token, alice.ID)
+	assert.NoError(t, err)
+	_, _, _, err = shareService.GetShareByLinkTicket(*share.LinkToken, ticket.Token, user.ID)
+	assert.NoError(t, err)
+
+	// 分享创建后注册的同名邮箱账户不是接收人
+	impostor := createRecipientUser(t, db, "Carol@Example.com")
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "secret", impostor.ID)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+
+	_, err = shareService.SaveToVault(share.PickupCode, "secret", fileIDs, stranger.ID)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+	saved, err := shareService.SaveToVault(share.PickupCode, "secret", fileIDs, carol.ID)
+	require.NoError(t, err)
+	assert.Len(t, saved, 1)
+
+	// 访问记录：失败的访问不计入
+	recipients, err = shareService.ListShareRecipients(share.ID, user.ID)
+	require.NoError(t, err)
+	require.Len(t, recipients, 3)
+	assert.Equal(t, 2, recipients[0].AccessCount)
+	assert.True(t, recipients[0].HasAccessed())
+	require.NotNil(t, recipients[0].FirstAccessedAt)
+	assert.True(t, !recipients[0].LastAccessedAt.Before(*recipients[0].FirstAccessedAt))
+	assert.False(t, recipients[1].HasAccessed())
+	assert.Zero(t, recipients[1].AccessCount)
+	assert.Equal(t, 1, recipients[2].AccessCount)
+
+	_, err = shareService.ListShareRecipients(share.ID, alice.ID)
+	assert.ErrorIs(t, err, ErrShareNotFound)
+
+	// 收到的分享不包含分享链接
+	incoming, total, err := shareService.ListIncomingShares(bob.ID, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, incoming, 1)
+	assert.Equal(t, share.ID, incoming[0].ID)
+	assert.Equal(t, user.Email, incoming[0].SenderEmail)
+	assert.Equal(t, models.ShareStatusActive, incoming[0].Status)
+	assert.Nil(t, incoming[0].LinkToken)
+	assert.Zero(t, incoming[0].AccessCount)
+
+	incoming, total, err = shareService.ListIncomingShares(carol.ID, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, incoming, 1)
+	assert.Equal(t, 1, incoming[0].AccessCount)
+	assert.NotNil(t, incoming[0].LastAccessedAt)
+
+	for _, other := range []*models.User{stranger, impostor} {
+		incoming, total, err = shareService.ListIncomingShares(other.ID, 1, 20)
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		assert.Empty(t, incoming)
+	}
+}
+
+// TestCreateShare_InvalidRecipients 测试不合法的接收人
+func TestCreateShare_InvalidRecipients(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 1)
+
+	createRecipientUser(t, db, "dup@example.com")
+	createRecipientUser(t, db, "DUP@example.com")
+
+	tooMany := make([]string, MaxShareRecipients+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("user%d@example.com", i)
+	}
+
+	tests := []struct {
+		name       string
+		recipients []string
+	}{
+		{"邮箱格式错误", []string{"not-an-email"}},
+		{"邮箱未注册", []string{"nobody@example.com"}},
+		{"邮箱对应多个账户", []string{"dup@example.com"}},
+		{"用户不存在", []string{uuid.New().String()}},
+		{"接收人过多", tooMany},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+				FileIDs:    fileIDs,
+				ExpiresIn:  time.Hour,
+				Recipients: tt.recipients,
+			})
+			assert.ErrorIs(t, err, ErrInvalidRecipient)
+		})
+	}
+
+	// 用户不存在、邮箱未注册和对应多个账户的错误信息相同，不透露账户是否存在
+	unknownID := uuid.New().String()
+	for _, input := range []string{"nobody@example.com", "dup@example.com", unknownID} {
+		_, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+			FileIDs:    fileIDs,
+			ExpiresIn:  time.Hour,
+			Recipients: []string{input},
+		})
+		require.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("invalid share recipient: %q", input), err.Error())
+	}
+
+	// 失败时不创建分享
+	var count int64
+	require.NoError(t, db.Model(&models.ShareSession{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// 不指定接收人时任何人都可以访问
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{FileIDs: fileIDs, ExpiresIn: time.Hour})
+	require.NoError(t, err)
+	assert.False(t, share.Restricted)
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "", uuid.Nil)
+	assert.NoError(t, err)
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"ahavault/server/internal/models"
@@ -11,11 +13,28 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrInvalidPickupCode 取件码格式错误或不存在
+	ErrInvalidPickupCode = errors.New("invalid pickup code")
+	// ErrPasswordRequired 分享设置了访问密码，但请求未提供
+	ErrPasswordRequired = errors.New("password required")
+	// ErrInvalidPassword 访问密码错误
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrShareNotFound 分享不存在或不属于当前用户
+	ErrShareNotFound = errors.New("share not found")
+)
+
 // ShareService 分享服务
 type ShareService struct {
 	db          *gorm.DB
 	codeGen     *PickupCodeGenerator
 	fileService *FileService
+
+	countThreshold int64         // 下载计数阈值（字节），0 表示完整传输后计数
+	ticketKey      []byte        // 下载凭证签名密钥
+	ticketTTL      time.Duration // 下载凭证有效期
+	policy         SharePolicy   // 分享限制（可由管理员按用户覆盖）
+	vanityCodes    bool          // 是否允许自定义取件码
 }
 
 // NewShareService 创建分享服务实例
@@ -24,15 +43,30 @@ func NewShareService(db *gorm.DB, fileService *FileService) *ShareService {
 		db:          db,
 		codeGen:     DefaultPickupCodeGenerator,
 		fileService: fileService,
+		ticketKey:   newTicketKey(),
+		ticketTTL:   DefaultDownloadTicketTTL,
 	}
 }
 
+// SetPickupCodeGenerator 设置取件码生成器（格式、长度、额外的不雅词汇）
+func (s *ShareService) SetPickupCodeGenerator(codeGen *PickupCodeGenerator) {
+	s.codeGen = codeGen
+}
+
+// SetVanityCodes 设置是否允许创建分享时自定义取件码
+func (s *ShareService) SetVanityCodes(enabled bool) {
+	s.vanityCodes = enabled
+}
+
 // CreateShareRequest 创建分享请求
 type CreateShareRequest struct {
 	FileIDs      []uuid.UUID
 	ExpiresIn    time.Duration
 	MaxDownloads int
 	Password     string
+	PickupCode   string   // 自定义取件码（可选），为空时随机生成
+	SecretLink   bool     // 同时生成分享链接
+	Recipients   []string // 接收人（用户 ID 或邮箱），非空时仅限接收人登录后访问
 }
 
 // CreateShare 创建分享
@@ -41,9 +75,22 @@ func (s *ShareService) CreateShare(userID uuid.UUID, req *CreateShareRequest) (*
 		return nil, errors.New("no files selected")
 	}
 
+	// 检查分享限制
+	policy, err := s.policyFor(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	expiresIn, err := policy.ResolveExpiry(req.ExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.CheckFileCount(len(req.FileIDs)); err != nil {
+		return nil, err
+	}
+
 	// 验证所有文件属于该用户
 	var count int64
-	err := s.db.Model(&models.FileMetadata{}).
+	err = s.db.Model(&models.FileMetadata{}).
 		Where("id IN ? AND user_id = ? AND deleted_at IS NULL", req.FileIDs, userID).
 		Count(&count).Error
 	if err != nil {
@@ -54,10 +101,20 @@ func (s *ShareService) CreateShare(userID uuid.UUID, req *CreateShareRequest) (*
 		return nil, errors.New("some files not found or access denied")
 	}
 
-	// 生成唯一取件码
-	pickupCode, err := s.codeGen.GenerateUnique(s.db)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate pickup code: %w", err)
+	// 自定义取件码或生成唯一取件码
+	var pickupCode string
+	if req.PickupCode != "" {
+		if pickupCode, err = s.checkVanityCode(s.db, req.PickupCode); err != nil {
+			return nil, err
+		}
+	} else {
+		codeGen, err := s.codeGenerator()
+		if err != nil {
+			return nil, err
+		}
+		if pickupCode, err = codeGen.GenerateUnique(s.db); err != nil {
+			return nil, fmt.Errorf("failed to generate pickup code: %w", err)
+		}
 	}
 
 	// 处理密码
@@ -70,24 +127,52 @@ func (s *ShareService) CreateShare(userID uuid.UUID, req *CreateShareRequest) (*
 		passwordHash = string(hash)
 	}
 
+	var linkToken *string
+	if req.SecretLink {
+		token, err := generateShareLinkToken()
+		if err != nil {
+			return nil, err
+		}
+		linkToken = &token
+	}
+
+	// 指定接收人
+	recipients, err := s.resolveRecipients(req.Recipients)
+	if err != nil {
+		return nil, err
+	}
+
 	// 计算过期时间
-	expiresAt := time.Now().Add(req.ExpiresIn)
+	expiresAt := time.Now().Add(expiresIn)
 
 	// 开启事务
 	tx := s.db.Begin()
 	defer tx.Rollback()
 
+	// 检查活跃分享数
+	if err := s.checkActiveShares(tx, userID, policy); err != nil {
+		return nil, err
+	}
+
 	// 创建分享会话
 	session := &models.ShareSession{
 		PickupCode:       pickupCode,
+		LinkToken:        linkToken,
 		CreatorID:        userID,
 		PasswordHash:     passwordHash,
+		Restricted:       len(recipients) > 0,
 		MaxDownloads:     req.MaxDownloads,
 		CurrentDownloads: 0,
 		ExpiresAt:        expiresAt,
 	}
 
 	if err := tx.Create(session).Error; err != nil {
+		// 并发创建了相同的自定义取件码
+		if req.PickupCode != "" {
+			if _, checkErr := s.checkVanityCode(s.db, req.PickupCode); errors.Is(checkErr, ErrPickupCodeTaken) {
+				return nil, checkErr
+			}
+		}
 		return nil, fmt.Errorf("failed to create share session: %w", err)
 	}
 
@@ -102,48 +187,138 @@ func (s *ShareService) CreateShare(userID uuid.UUID, req *CreateShareRequest) (*
 		}
 	}
 
+	// 创建接收人
+	for i := range recipients {
+		recipients[i].ShareID = session.ID
+		if err := tx.Create(&recipients[i]).Error; err != nil {
+			return nil, fmt.Errorf("failed to create share recipient: %w", err)
+		}
+	}
+
 	tx.Commit()
 
 	return session, nil
 }
 
+// codeGenerator 返回生成取件码使用的生成器
+//
+// 随机字符格式时，系统设置中的取件码长度（share_code_length）优先于 SHARE_CODE_LENGTH，
+// 修改后无需重启即可生效；设置为空或不在 6-12 之间时使用启动配置。
+func (s *ShareService) codeGenerator() (*PickupCodeGenerator, error) {
+	if s.codeGen.Format() != PickupCodeFormatRandom {
+		return s.codeGen, nil
+	}
+
+	value, err := models.GetValue(s.db, models.SettingShareCodeLength)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.codeGen, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share code length setting: %w", err)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || length < MinPickupCodeLength || length > MaxPickupCodeLength || length == s.codeGen.length {
+		return s.codeGen, nil
+	}
+	return s.codeGen.withLength(length), nil
+}
+
+// checkVanityCode 检查自定义取件码，返回规范化后的取件码
+func (s *ShareService) checkVanityCode(tx *gorm.DB, code string) (string, error) {
+	if !s.vanityCodes {
+		return "", ErrVanityCodesDisabled
+	}
+
+	code = CanonicalPickupCode(code)
+	if err := s.codeGen.ValidateVanityCode(code); err != nil {
+		return "", err
+	}
+
+	var count int64
+	if err := tx.Model(&models.ShareSession{}).Where("pickup_code = ?", code).Count(&count).Error; err != nil {
+		return "", fmt.Errorf("failed to check code uniqueness: %w", err)
+	}
+	if count > 0 {
+		return "", ErrPickupCodeTaken
+	}
+	return code, nil
+}
+
 // GetShareByCode 通过取件码获取分享
-func (s *ShareService) GetShareByCode(pickupCode string, password string) (*models.ShareSession, []models.FileMetadata, error) {
-	// 验证取件码格式
-	if err := ValidatePickupCode(pickupCode, 8); err != nil {
+//
+// viewerID 为访问者的用户 ID，未登录时为 uuid.Nil；指定接收人的分享仅限接收人和创建者访问。
+func (s *ShareService) GetShareByCode(pickupCode string, password string, viewerID uuid.UUID) (*models.ShareSession, []models.FileMetadata, error) {
+	session, err := s.findShareByCode(pickupCode)
+	if err != nil {
 		return nil, nil, err
 	}
+	return s.openShare(session, password, viewerID)
+}
+
+// findShareByCode 按取件码查询分享
+func (s *ShareService) findShareByCode(pickupCode string) (*models.ShareSession, error) {
+	// 验证取件码格式
+	pickupCode = CanonicalPickupCode(pickupCode)
+	if err := ValidatePickupCodeFormat(pickupCode); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPickupCode, err)
+	}
 
-	// 查询分享会话
 	var session models.ShareSession
 	err := s.db.Where("pickup_code = ?", pickupCode).First(&session).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil, errors.New("invalid pickup code")
+			return nil, ErrInvalidPickupCode
 		}
-		return nil, nil, fmt.Errorf("failed to get share: %w", err)
+		return nil, fmt.Errorf("failed to get share: %w", err)
 	}
+	return &session, nil
+}
 
+// openShare 检查分享状态、接收人并验证访问密码，返回分享中的文件
+//
+// 取件码和分享链接使用相同的有效期、下载次数、接收人和访问密码规则。
+func (s *ShareService) openShare(session *models.ShareSession, password string, viewerID uuid.UUID) (*models.ShareSession, []models.FileMetadata, error) {
 	// 检查访问权限
 	if err := session.CanAccess(); err != nil {
 		return nil, nil, err
 	}
 
+	// 先确认接收人身份，非接收人不能尝试访问密码
+	recipient, err := s.checkRecipient(session, viewerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// 验证密码
 	if session.HasPassword() {
 		if password == "" {
-			return nil, nil, errors.New("password required")
+			return nil, nil, ErrPasswordRequired
 		}
-		err = bcrypt.CompareHashAndPassword([]byte(session.PasswordHash), []byte(password))
+		err := bcrypt.CompareHashAndPassword([]byte(session.PasswordHash), []byte(password))
 		if err != nil {
-			return nil, nil, errors.New("invalid password")
+			return nil, nil, ErrInvalidPassword
 		}
 	}
 
-	// 获取关联的文件
+	files, err := s.shareFiles(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if recipient != nil {
+		if err := s.recordRecipientAccess(recipient); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return session, files, nil
+}
+
+// shareFiles 获取分享中的文件
+func (s *ShareService) shareFiles(session *models.ShareSession) ([]models.FileMetadata, error) {
 	var shareFiles []models.ShareFile
 	if err := s.db.Where("share_id = ?", session.ID).Find(&shareFiles).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to get share files: %w", err)
+		return nil, fmt.Errorf("failed to get share files: %w", err)
 	}
 
 	fileIDs := make([]uuid.UUID, len(shareFiles))
@@ -151,12 +326,14 @@ func (s *ShareService) GetShareByCode(pickupCode string, password string) (*mode
 		fileIDs[i] = sf.FileID
 	}
 
+	// 按文件名排序，保证列表和多文件下载（ZIP）的顺序及重名处理稳定
 	var files []models.FileMetadata
-	if err := s.db.Where("id IN ? AND deleted_at IS NULL", fileIDs).Find(&files).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to get files: %w", err)
+	if err := s.db.Where("id IN ? AND deleted_at IS NULL", fileIDs).
+		Order("filename ASC, id ASC").Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
 	}
 
-	return &session, files, nil
+	return files, nil
 }
 
 // IncrementDownload 增加下载次数
@@ -179,7 +356,7 @@ func (s *ShareService) StopShare(shareID uuid.UUID, userID uuid.UUID) error {
 	err := s.db.Where("id = ? AND creator_id = ?", shareID, userID).First(&session).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("share not found")
+			return ErrShareNotFound
 		}
 		return fmt.Errorf("failed to get share: %w", err)
 	}
@@ -194,7 +371,17 @@ func (s *ShareService) StopShare(shareID uuid.UUID, userID uuid.UUID) error {
 // SaveToVault 转存到文件柜
 func (s *ShareService) SaveToVault(pickupCode string, password string, fileIDs []uuid.UUID, userID uuid.UUID) ([]uuid.UUID, error) {
 	// 验证分享
-	session, files, err := s.GetShareByCode(pickupCode, password)
+	session, files, err := s.GetShareByCode(pickupCode, password, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveToVault(session, files, fileIDs, userID)
+}
+
+// saveToVault 将已验证的分享中的文件转存到用户的文件柜
+func (s *ShareService) saveToVault(session *models.ShareSession, files []models.FileMetadata, fileIDs []uuid.UUID, userID uuid.UUID) ([]uuid.UUID, error) {
+	// 转存计为一次下载，先占用下载名额
+	slot, err := s.ClaimDownload(session, uuid.Nil, DownloadRequest{Size: -1})
 	if err != nil {
 		return nil, err
 	}
@@ -217,6 +404,7 @@ func (s *ShareService) SaveToVault(pickupCode string, password string, fileIDs [
 		// 执行秒传（逻辑复制）
 		newMetadata, err := s.fileService.CreateFileMetadata(userID, file.FileBlobHash, file.Filename, file.Size)
 		if err != nil {
+			s.FinishDownload(slot, 0, -1, false)
 			return savedIDs, fmt.Errorf("failed to save file %s: %w", file.Filename, err)
 		}
 
@@ -224,7 +412,7 @@ func (s *ShareService) SaveToVault(pickupCode string, password string, fileIDs [
 	}
 
 	// 增加下载计数
-	s.IncrementDownload(session.ID)
+	s.FinishDownload(slot, 0, -1, true)
 
 	return savedIDs, nil
 }
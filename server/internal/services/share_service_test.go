@@ -7,6 +7,7 @@
 //   - 停止分享（StopShare）
 //   - 转存到文件柜（SaveToVault）
 //   - 获取我的分享列表（ListMyShares）
+//   - 取件码格式与自定义取件码
 //
 // 作者: AhaVault Team
 // 创建时间: 2026-02-04
@@ -14,6 +15,7 @@ package services
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
 
@@ -320,7 +322,7 @@ func TestGetShareByCode(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			session, files, err := shareService.GetShareByCode(tt.pickupCode, tt.password)
+			session, files, err := shareService.GetShareByCode(tt.pickupCode, tt.password, uuid.Nil)
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -601,3 +603,82 @@ func TestListMyShares_Empty(t *testing.T) {
 	assert.Equal(t, int64(0), total)
 	assert.Empty(t, shares)
 }
+
+// TestCreateShare_PickupCode 测试取件码的格式与自定义取件码
+//
+// 测试场景：
+//  1. 系统设置中的取件码长度优先于启动配置，不合法时使用启动配置
+//  2. 单词组合取件码，取件时不区分大小写
+//  3. 自定义取件码：规范化、重复、不合法、含不雅词汇、未开启
+func TestCreateShare_PickupCode(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	fileIDs := uploadTestFiles(t, fileService, user.ID, 1)
+	req := func(code string) *CreateShareRequest {
+		return &CreateShareRequest{FileIDs: fileIDs, ExpiresIn: time.Hour, PickupCode: code}
+	}
+
+	t.Run("系统设置的取件码长度", func(t *testing.T) {
+		// 与初始化迁移一样预置该设置
+		require.NoError(t, db.Create(&models.SystemSetting{Key: models.SettingShareCodeLength, Value: ""}).Error)
+		share, err := shareService.CreateShare(user.ID, req(""))
+		require.NoError(t, err)
+		assert.Len(t, share.PickupCode, 8)
+
+		require.NoError(t, models.SetValue(db, models.SettingShareCodeLength, "12"))
+		share, err = shareService.CreateShare(user.ID, req(""))
+		require.NoError(t, err)
+		assert.Len(t, share.PickupCode, 12)
+
+		require.NoError(t, models.SetValue(db, models.SettingShareCodeLength, "20"))
+		share, err = shareService.CreateShare(user.ID, req(""))
+		require.NoError(t, err)
+		assert.Len(t, share.PickupCode, 8)
+
+		_, _, err = shareService.GetShareByCode(strings.ToLower(share.PickupCode), "", uuid.Nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("单词组合取件码", func(t *testing.T) {
+		shareService.SetPickupCodeGenerator(NewWordCodeGenerator(3))
+		defer shareService.SetPickupCodeGenerator(DefaultPickupCodeGenerator)
+
+		share, err := shareService.CreateShare(user.ID, req(""))
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(share.PickupCode, "-"), 4)
+
+		found, _, err := shareService.GetShareByCode(strings.ToUpper(share.PickupCode), "", uuid.Nil)
+		require.NoError(t, err)
+		assert.Equal(t, share.ID, found.ID)
+	})
+
+	t.Run("自定义取件码", func(t *testing.T) {
+		_, err := shareService.CreateShare(user.ID, req("team-offsite"))
+		assert.ErrorIs(t, err, ErrVanityCodesDisabled)
+
+		shareService.SetVanityCodes(true)
+		share, err := shareService.CreateShare(user.ID, req(" Team-Offsite "))
+		require.NoError(t, err)
+		assert.Equal(t, "team-offsite", share.PickupCode)
+
+		found, _, err := shareService.GetShareByCode("TEAM-OFFSITE", "", uuid.Nil)
+		require.NoError(t, err)
+		assert.Equal(t, share.ID, found.ID)
+
+		// 已停止的分享仍占用取件码
+		require.NoError(t, shareService.StopShare(share.ID, user.ID))
+		_, err = shareService.CreateShare(user.ID, req("team-offsite"))
+		assert.ErrorIs(t, err, ErrPickupCodeTaken)
+
+		// 与随机取件码的格式相同时按大写比较
+		share, err = shareService.CreateShare(user.ID, req("happy2345"))
+		require.NoError(t, err)
+		assert.Equal(t, "HAPPY2345", share.PickupCode)
+		_, err = shareService.CreateShare(user.ID, req("HAPPY2345"))
+		assert.ErrorIs(t, err, ErrPickupCodeTaken)
+
+		for _, code := range []string{"abc", "team_offsite", "shit-happens"} {
+			_, err = shareService.CreateShare(user.ID, req(code))
+			assert.ErrorIs(t, err, ErrInvalidVanityCode, code)
+		}
+	})
+}
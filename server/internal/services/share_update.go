@@ -0,0 +1,251 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现分享的修改：
+//   - 延长或缩短有效期（不超过用户适用的最大分享有效期）
+//   - 修改下载次数上限
+//   - 设置、修改或取消访问密码（之前签发的下载凭证随之失效）
+//   - 增删分享中的文件
+//   - 重新启用已停止的分享
+//
+// 所有修改在同一事务中完成，并写入审计日志。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidShareUpdate 修改内容不合法
+var ErrInvalidShareUpdate = errors.New("invalid share update")
+
+// UpdateShareRequest 修改分享请求
+//
+// 指针字段为 nil 表示不修改。
+type UpdateShareRequest struct {
+	ExpiresIn     *time.Duration // 新的有效期（从现在起计算）
+	MaxDownloads  *int           // 下载次数上限，0 表示不限
+	Password      *string        // 访问密码，空字符串表示取消密码
+	AddFileIDs    []uuid.UUID    // 加入分享的文件
+	RemoveFileIDs []uuid.UUID    // 移出分享的文件
+	Reactivate    bool           // 重新启用已停止的分享
+}
+
+// AuditContext 审计日志的请求来源
+type AuditContext struct {
+	IPAddress string
+	UserAgent string
+}
+
+// UpdateShare 修改分享
+//
+// 重新启用时分享在修改后必须未过期且下载次数未用完（已过期的分享需同时设置新的有效期）。
+// 返回修改后的分享。
+func (s *ShareService) UpdateShare(shareID uuid.UUID, userID uuid.UUID, req *UpdateShareRequest, audit AuditContext) (*models.ShareSession, error) {
+	if err := s.validateShareUpdate(req); err != nil {
+		return nil, err
+	}
+
+	// 在事务外计算密码哈希，避免长时间持有事务
+	var passwordHash string
+	if req.Password != nil && *req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		passwordHash = string(hash)
+	}
+
+	var session models.ShareSession
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ? AND creator_id = ?", shareID, userID).First(&session).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrShareNotFound
+			}
+			return fmt.Errorf("failed to get share: %w", err)
+		}
+
+		policy, err := s.policyFor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if req.ExpiresIn != nil {
+			if err := policy.CheckExpiry(*req.ExpiresIn); err != nil {
+				return err
+			}
+		}
+		wasActive := session.IsActive()
+
+		updates := map[string]interface{}{}
+		changes := map[string]interface{}{}
+
+		if req.ExpiresIn != nil {
+			expiresAt := time.Now().Add(*req.ExpiresIn)
+			changes["expires_at"] = map[string]interface{}{"from": session.ExpiresAt, "to": expiresAt}
+			updates["expires_at"] = expiresAt
+			session.ExpiresAt = expiresAt
+		}
+		if req.MaxDownloads != nil && *req.MaxDownloads != session.MaxDownloads {
+			changes["max_downloads"] = map[string]interface{}{"from": session.MaxDownloads, "to": *req.MaxDownloads}
+			updates["max_downloads"] = *req.MaxDownloads
+			session.MaxDownloads = *req.MaxDownloads
+		}
+		if req.Password != nil {
+			switch {
+			case passwordHash == "" && !session.HasPassword():
+				// 本来就没有密码
+			case passwordHash == "":
+				changes["password"] = "removed"
+			case session.HasPassword():
+				changes["password"] = "changed"
+			default:
+				changes["password"] = "set"
+			}
+			if _, ok := changes["password"]; ok {
+				updates["password_hash"] = passwordHash
+				session.PasswordHash = passwordHash
+			}
+		}
+		if req.Reactivate && session.StoppedAt != nil {
+			changes["reactivated"] = map[string]interface{}{"stopped_at": *session.StoppedAt}
+			updates["stopped_at"] = nil
+			session.StoppedAt = nil
+		}
+		if req.Reactivate {
+			if session.IsExpired() {
+				return fmt.Errorf("%w: share has expired, set a new expiry to reactivate it", ErrInvalidShareUpdate)
+			}
+			if session.IsExhausted() {
+				return fmt.Errorf("%w: download limit reached, raise max_downloads to reactivate it", ErrInvalidShareUpdate)
+			}
+		}
+		// 修改使分享重新生效时计入活跃分享数
+		if !wasActive && session.IsActive() {
+			if err := s.checkActiveShares(tx, userID, policy); err != nil {
+				return err
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&models.ShareSession{}).Where("id = ?", session.ID).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update share: %w", err)
+			}
+		}
+
+		added, removed, err := s.updateShareFiles(tx, &session, policy, req.AddFileIDs, req.RemoveFileIDs)
+		if err != nil {
+			return err
+		}
+		if len(added) > 0 {
+			changes["added_files"] = added
+		}
+		if len(removed) > 0 {
+			changes["removed_files"] = removed
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+		action := models.ActionUpdateShare
+		if _, ok := changes["reactivated"]; ok {
+			action = models.ActionReactivateShare
+		}
+		err = models.CreateLog(tx, &userID, action, models.ResourceTypeShare, session.ID.String(),
+			audit.IPAddress, audit.UserAgent, changes)
+		if err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// validateShareUpdate 检查修改内容
+func (s *ShareService) validateShareUpdate(req *UpdateShareRequest) error {
+	if req.ExpiresIn != nil {
+		if *req.ExpiresIn <= 0 {
+			return fmt.Errorf("%w: expiry must be positive", ErrInvalidShareUpdate)
+		}
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 0 {
+		return fmt.Errorf("%w: max downloads must not be negative", ErrInvalidShareUpdate)
+	}
+	return nil
+}
+
+// updateShareFiles 增删分享中的文件，返回实际加入和移出的文件
+//
+// 加入的文件必须属于分享的创建者且未删除，已在分享中的文件忽略；
+// 移出的文件必须在分享中。修改后分享至少保留一个文件，且不超过单次分享最大文件数。
+func (s *ShareService) updateShareFiles(tx *gorm.DB, session *models.ShareSession, policy SharePolicy, addIDs, removeIDs []uuid.UUID) ([]uuid.UUID, []uuid.UUID, error) {
+	if len(addIDs) == 0 && len(removeIDs) == 0 {
+		return nil, nil, nil
+	}
+
+	var shareFiles []models.ShareFile
+	if err := tx.Where("share_id = ?", session.ID).Find(&shareFiles).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get share files: %w", err)
+	}
+	current := make(map[uuid.UUID]bool, len(shareFiles))
+	for _, sf := range shareFiles {
+		current[sf.FileID] = true
+	}
+
+	var removed []uuid.UUID
+	for _, fileID := range removeIDs {
+		if !current[fileID] {
+			return nil, nil, fmt.Errorf("%w: file %s is not in the share", ErrInvalidShareUpdate, fileID)
+		}
+		if err := tx.Where("share_id = ? AND file_id = ?", session.ID, fileID).Delete(&models.ShareFile{}).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to remove share file: %w", err)
+		}
+		delete(current, fileID)
+		removed = append(removed, fileID)
+	}
+
+	var added []uuid.UUID
+	for _, fileID := range addIDs {
+		if !current[fileID] {
+			added = append(added, fileID)
+			current[fileID] = true
+		}
+	}
+	if err := policy.CheckFileCount(len(current)); err != nil {
+		return nil, nil, err
+	}
+	if len(added) > 0 {
+		var count int64
+		err := tx.Model(&models.FileMetadata{}).
+			Where("id IN ? AND user_id = ? AND deleted_at IS NULL", added, session.CreatorID).
+			Count(&count).Error
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to verify files: %w", err)
+		}
+		if count != int64(len(added)) {
+			return nil, nil, fmt.Errorf("%w: some files not found or access denied", ErrInvalidShareUpdate)
+		}
+		for _, fileID := range added {
+			if err := tx.Create(&models.ShareFile{ShareID: session.ID, FileID: fileID}).Error; err != nil {
+				return nil, nil, fmt.Errorf("failed to add share file: %w", err)
+			}
+		}
+	}
+
+	if len(current) == 0 {
+		return nil, nil, fmt.Errorf("%w: share must contain at least one file", ErrInvalidShareUpdate)
+	}
+	return added, removed, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpdateShare 测试修改分享的有效期、下载次数、访问密码和文件
+func TestUpdateShare(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	shareService.SetSharePolicy(SharePolicy{MaxExpiry: 7 * 24 * time.Hour})
+	audit := AuditContext{IPAddress: "192.0.2.1", UserAgent: "test"}
+
+	var fileIDs []uuid.UUID
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		file, err := fileService.UploadFile(user.ID, name, 4, bytes.NewReader([]byte(name[:1]+"bcd")))
+		require.NoError(t, err)
+		fileIDs = append(fileIDs, file.ID)
+	}
+	share, err := shareService.CreateShare(user.ID, &CreateShareRequest{
+		FileIDs:      fileIDs[:2],
+		ExpiresIn:    time.Hour,
+		MaxDownloads: 5,
+		Password:     "secret",
+	})
+	require.NoError(t, err)
+	ticket, err := shareService.IssueDownloadTicket(share, uuid.Nil, uuid.Nil)
+	require.NoError(t, err)
+
+	expiresIn := 48 * time.Hour
+	maxDownloads := 0
+	noPassword := ""
+	updated, err := shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{
+		ExpiresIn:     &expiresIn,
+		MaxDownloads:  &maxDownloads,
+		Password:      &noPassword,
+		AddFileIDs:    []uuid.UUID{fileIDs[2], fileIDs[1]},
+		RemoveFileIDs: []uuid.UUID{fileIDs[0]},
+	}, audit)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(expiresIn), updated.ExpiresAt, 2*time.Second)
+	assert.Equal(t, 0, updated.MaxDownloads)
+	assert.False(t, updated.HasPassword())
+
+	// 取消密码后可以直接访问，文件已替换，旧凭证失效
+	_, files, err := shareService.GetShareByCode(share.PickupCode, "", uuid.Nil)
+	require.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Filename)
+	}
+	assert.ElementsMatch(t, []string{"b.txt", "c.txt"}, names)
+	_, _, _, err = shareService.GetShareByTicket(share.PickupCode, ticket.Token, uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	// 修改写入审计日志
+	var log models.AuditLog
+	require.NoError(t, db.Where("action = ? AND resource_id = ?", models.ActionUpdateShare, share.ID.String()).First(&log).Error)
+	assert.Equal(t, models.ResourceTypeShare, log.ResourceType)
+	assert.Equal(t, "192.0.2.1", log.IPAddress)
+	var details map[string]interface{}
+	require.NoError(t, json.Unmarshal(log.Details, &details))
+	assert.Equal(t, "removed", details["password"])
+	assert.Contains(t, details, "expires_at")
+	assert.Contains(t, details, "max_downloads")
+	assert.Equal(t, []interface{}{fileIDs[2].String()}, details["added_files"])
+	assert.Equal(t, []interface{}{fileIDs[0].String()}, details["removed_files"])
+
+	// 重新设置密码
+	password := "changed"
+	_, err = shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{Password: &password}, audit)
+	require.NoError(t, err)
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "", uuid.Nil)
+	assert.ErrorIs(t, err, ErrPasswordRequired)
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "changed", uuid.Nil)
+	assert.NoError(t, err)
+}
+
+// TestUpdateShare_Invalid 测试不合法的修改被拒绝且不产生部分修改
+func TestUpdateShare_Invalid(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	shareService.SetSharePolicy(SharePolicy{MaxExpiry: 24 * time.Hour})
+	share, file := createLimitedShare(t, shareService, fileService, user, 3)
+
+	otherUser := &models.User{
+		Email:        "other@example.com",
+		Password:     "password",
+		Role:         models.RoleUser,
+		Status:       models.StatusActive,
+		StorageQuota: 10 * 1024 * 1024 * 1024,
+	}
+	require.NoError(t, db.Create(otherUser).Error)
+	otherFile, err := fileService.UploadFile(otherUser.ID, "other.txt", 5, bytes.NewReader([]byte("other")))
+	require.NoError(t, err)
+
+	tooLong := 48 * time.Hour
+	negative := -time.Minute
+	negativeDownloads := -1
+	maxDownloads := 10
+
+	tests := []struct {
+		name    string
+		shareID uuid.UUID
+		userID  uuid.UUID
+		req     *UpdateShareRequest
+		wantErr error
+	}{
+		{"超过最大有效期", share.ID, user.ID, &UpdateShareRequest{ExpiresIn: &tooLong}, ErrShareExpiryTooLong},
+		{"有效期为负", share.ID, user.ID, &UpdateShareRequest{ExpiresIn: &negative}, ErrInvalidShareUpdate},
+		{"下载次数为负", share.ID, user.ID, &UpdateShareRequest{MaxDownloads: &negativeDownloads}, ErrInvalidShareUpdate},
+		{"加入他人的文件", share.ID, user.ID, &UpdateShareRequest{AddFileIDs: []uuid.UUID{otherFile.ID}}, ErrInvalidShareUpdate},
+		{"移出不在分享中的文件", share.ID, user.ID, &UpdateShareRequest{RemoveFileIDs: []uuid.UUID{otherFile.ID}}, ErrInvalidShareUpdate},
+		{"移出全部文件", share.ID, user.ID, &UpdateShareRequest{MaxDownloads: &maxDownloads, RemoveFileIDs: []uuid.UUID{file.ID}}, ErrInvalidShareUpdate},
+		{"分享不存在", uuid.New(), user.ID, &UpdateShareRequest{MaxDownloads: &maxDownloads}, ErrShareNotFound},
+		{"非创建者修改", share.ID, otherUser.ID, &UpdateShareRequest{MaxDownloads: &maxDownloads}, ErrShareNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := shareService.UpdateShare(tt.shareID, tt.userID, tt.req, AuditContext{})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	// 失败的修改整体回滚
+	fresh := reloadShare(t, shareService, share)
+	assert.Equal(t, 3, fresh.MaxDownloads)
+	var count int64
+	require.NoError(t, db.Model(&models.ShareFile{}).Where("share_id = ?", share.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, db.Model(&models.AuditLog{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+// TestUpdateShare_Reactivate 测试重新启用已停止的分享
+func TestUpdateShare_Reactivate(t *testing.T) {
+	shareService, fileService, user, db := setupShareTestEnv(t)
+	share, file := createLimitedShare(t, shareService, fileService, user, 1)
+
+	// 下载次数用完后由生命周期检查停止
+	slot, err := shareService.ClaimDownload(share, file.ID, DownloadRequest{})
+	require.NoError(t, err)
+	_, err = shareService.FinishDownload(slot, file.Size, file.Size, true)
+	require.NoError(t, err)
+	require.NoError(t, shareService.StopShare(share.ID, user.ID))
+
+	// 次数用完时不能直接重新启用
+	_, err = shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{Reactivate: true}, AuditContext{})
+	assert.ErrorIs(t, err, ErrInvalidShareUpdate)
+	assert.True(t, reloadShare(t, shareService, share).IsStopped())
+
+	// 同时提高下载次数上限后可以重新启用
+	maxDownloads := 2
+	updated, err := shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{
+		MaxDownloads: &maxDownloads,
+		Reactivate:   true,
+	}, AuditContext{})
+	require.NoError(t, err)
+	assert.True(t, updated.IsActive())
+	assert.False(t, reloadShare(t, shareService, share).IsStopped())
+	_, _, err = shareService.GetShareByCode(share.PickupCode, "", uuid.Nil)
+	assert.NoError(t, err)
+
+	var count int64
+	require.NoError(t, db.Model(&models.AuditLog{}).
+		Where("action = ? AND resource_id = ?", models.ActionReactivateShare, share.ID.String()).
+		Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// 已过期的分享需要同时设置新的有效期
+	require.NoError(t, db.Model(&models.ShareSession{}).Where("id = ?", share.ID).
+		Updates(map[string]interface{}{"expires_at": time.Now().Add(-time.Hour), "stopped_at": time.Now()}).Error)
+	_, err = shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{Reactivate: true}, AuditContext{})
+	assert.ErrorIs(t, err, ErrInvalidShareUpdate)
+	expiresIn := time.Hour
+	updated, err = shareService.UpdateShare(share.ID, user.ID, &UpdateShareRequest{
+		ExpiresIn:  &expiresIn,
+		Reactivate: true,
+	}, AuditContext{})
+	require.NoError(t, err)
+	assert.True(t, updated.IsActive())
+}
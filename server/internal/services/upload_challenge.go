@@ -0,0 +1,206 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// ChallengeRangeCount 每个秒传挑战要求证明的区间数
+	ChallengeRangeCount = 3
+	// ChallengeRangeSize 每个区间的最大长度（字节）
+	ChallengeRangeSize = 4096
+	// ChallengeTTL 秒传挑战有效期
+	ChallengeTTL = 5 * time.Minute
+)
+
+var (
+	// ErrChallengeNotFound 挑战不存在、已使用或已过期
+	ErrChallengeNotFound = errors.New("upload challenge not found or expired")
+	// ErrProofMismatch 持有证明校验失败
+	ErrProofMismatch = errors.New("proof of possession failed")
+)
+
+// IssueUploadChallenge 生成秒传持有证明挑战
+//
+// 在客户端声明的文件大小内随机选取 ChallengeRangeCount 个明文区间，客户端需对每个区间计算
+// SHA-256(nonce || 区间明文) 并通过 ClaimInstantUpload 提交。
+// 无论物理文件是否存在都下发挑战（不查询 file_blobs），避免仅凭哈希探测他人是否存有某个文件；
+// 文件不存在时挑战只是诱饵，提交后与证明错误一样被拒绝。
+func (s *FileService) IssueUploadChallenge(userID uuid.UUID, hash string, size int64) (*models.UploadChallenge, error) {
+	if err := storage.ValidateHash(hash); err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid file size: %d", size)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	ranges, err := randomChallengeRanges(size)
+	if err != nil {
+		return nil, err
+	}
+	rawRanges, err := json.Marshal(ranges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode challenge ranges: %w", err)
+	}
+
+	// 顺带清理该用户已过期的挑战
+	now := time.Now()
+	s.db.Where("user_id = ? AND expires_at < ?", userID, now).Delete(&models.UploadChallenge{})
+
+	challenge := &models.UploadChallenge{
+		UserID:    userID,
+		Hash:      hash,
+		Size:      size,
+		Nonce:     hex.EncodeToString(nonce),
+		Ranges:    rawRanges,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ChallengeTTL),
+	}
+	if err := s.db.Create(challenge).Error; err != nil {
+		return nil, fmt.Errorf("failed to create upload challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// ClaimInstantUpload 校验持有证明并完成秒传
+//
+// 挑战单次有效：无论校验成功与否都会被删除，防止对同一挑战反复猜测。
+// 物理文件不存在、已被封禁或大小与挑战不符时同样返回 ErrProofMismatch，
+// 客户端只有提交正确的证明后才能得知文件已存在。
+// proofs 需按挑战区间顺序给出 HEX 编码的 SHA-256(nonce || 区间明文)。
+// 文件大小以物理文件记录为准，不信任客户端上报的值。
+func (s *FileService) ClaimInstantUpload(userID uuid.UUID, challengeID uuid.UUID, hash string, filename string, proofs []string) (*models.FileMetadata, error) {
+	var challenge models.UploadChallenge
+	err := s.db.Where("id = ? AND user_id = ?", challengeID, userID).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload challenge: %w", err)
+	}
+
+	// 先删除再校验，并发提交同一挑战时只有一个请求能继续
+	result := s.db.Where("id = ?", challenge.ID).Delete(&models.UploadChallenge{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume upload challenge: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || challenge.IsExpired() {
+		return nil, ErrChallengeNotFound
+	}
+
+	if !strings.EqualFold(challenge.Hash, hash) {
+		return nil, ErrProofMismatch
+	}
+
+	var ranges []models.ChallengeRange
+	if err := json.Unmarshal(challenge.Ranges, &ranges); err != nil {
+		return nil, fmt.Errorf("failed to decode challenge ranges: %w", err)
+	}
+	if len(proofs) != len(ranges) {
+		return nil, ErrProofMismatch
+	}
+
+	var blob models.FileBlob
+	if err := s.db.Where("hash = ?", challenge.Hash).First(&blob).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProofMismatch
+		}
+		return nil, fmt.Errorf("failed to get file blob: %w", err)
+	}
+	// 大小不符时挑战区间不是按该文件选取的（越界区间或空文件挑战不能证明持有）
+	if blob.IsBanned || blob.Size != challenge.Size {
+		return nil, ErrProofMismatch
+	}
+
+	nonce, err := hex.DecodeString(challenge.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid challenge nonce: %w", err)
+	}
+	if err := s.verifyPossession(&blob, nonce, ranges, proofs); err != nil {
+		return nil, err
+	}
+
+	return s.CreateFileMetadata(userID, blob.Hash, filename, blob.Size)
+}
+
+// verifyPossession 读取物理文件的挑战区间并与客户端提交的证明比对
+func (s *FileService) verifyPossession(blob *models.FileBlob, nonce []byte, ranges []models.ChallengeRange, proofs []string) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	plaintext, closer, err := s.openBlob(blob)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if plaintext.Size() != blob.Size {
+		return fmt.Errorf("file size mismatch: expected %d bytes, got %d bytes", blob.Size, plaintext.Size())
+	}
+
+	for i, r := range ranges {
+		data := make([]byte, r.Length)
+		if _, err := plaintext.ReadAt(data, r.Offset); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read challenge range: %w", err)
+		}
+		expected := ChallengeProof(nonce, data)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(proofs[i]))) != 1 {
+			return ErrProofMismatch
+		}
+	}
+
+	return nil
+}
+
+// ChallengeProof 计算单个挑战区间的持有证明（客户端算法的参考实现）
+func ChallengeProof(nonce []byte, data []byte) string {
+	hasher := sha256.New()
+	hasher.Write(nonce)
+	hasher.Write(data)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// randomChallengeRanges 在 [0, size) 内随机选取挑战区间
+//
+// 文件不超过一个区间长度时只需证明整个文件；空文件无需证明。
+func randomChallengeRanges(size int64) ([]models.ChallengeRange, error) {
+	if size <= 0 {
+		return []models.ChallengeRange{}, nil
+	}
+	if size <= ChallengeRangeSize {
+		return []models.ChallengeRange{{Offset: 0, Length: size}}, nil
+	}
+
+	span := big.NewInt(size - ChallengeRangeSize + 1)
+	ranges := make([]models.ChallengeRange, ChallengeRangeCount)
+	for i := range ranges {
+		offset, err := rand.Int(rand.Reader, span)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate challenge range: %w", err)
+		}
+		ranges[i] = models.ChallengeRange{Offset: offset.Int64(), Length: ChallengeRangeSize}
+	}
+	return ranges, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// answerChallenge 按挑战区间从明文计算持有证明
+func answerChallenge(t *testing.T, challenge *models.UploadChallenge, content []byte) []string {
+	nonce, err := hex.DecodeString(challenge.Nonce)
+	require.NoError(t, err)
+
+	var ranges []models.ChallengeRange
+	require.NoError(t, json.Unmarshal(challenge.Ranges, &ranges))
+
+	proofs := make([]string, len(ranges))
+	for i, r := range ranges {
+		proofs[i] = ChallengeProof(nonce, content[r.Offset:r.Offset+r.Length])
+	}
+	return proofs
+}
+
+// TestInstantUploadChallenge 测试秒传持有证明
+//
+// 测试场景：
+//  1. 正确回答挑战 - 秒传成功，大小以服务端记录为准
+//  2. 仅知道哈希（伪造证明）- 拒绝
+//  3. 挑战单次有效 - 失败后不能重试
+//  4. 挑战绑定用户 - 其他用户无法使用
+//  5. 挑战过期
+//  6. 文件不存在、大小不符或已封禁 - 同样下发挑战，提交后与伪造证明一样被拒绝
+func TestInstantUploadChallenge(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewFileService(db, storage.NewMemoryEngine(), []byte("test-master-key-1234567890123456"))
+	owner := createTestUser(t, db)
+
+	claimer := &models.User{
+		Email:        "claimer@example.com",
+		Password:     "hashed_password",
+		StorageQuota: 10 * 1024 * 1024 * 1024,
+	}
+	require.NoError(t, db.Create(claimer).Error)
+
+	// 多个分段大小的文件，挑战区间随机分布
+	content := make([]byte, 200*1024+17)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	uploaded, err := service.UploadFile(owner.ID, "secret.bin", int64(len(content)), bytes.NewReader(content))
+	require.NoError(t, err)
+
+	hash, size := uploaded.FileBlobHash, int64(len(content))
+
+	t.Run("正确回答挑战", func(t *testing.T) {
+		challenge, err := service.IssueUploadChallenge(claimer.ID, hash, size)
+		require.NoError(t, err)
+
+		var ranges []models.ChallengeRange
+		require.NoError(t, json.Unmarshal(challenge.Ranges, &ranges))
+		assert.Len(t, ranges, ChallengeRangeCount)
+
+		metadata, err := service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "mine.bin", answerChallenge(t, challenge, content))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), metadata.Size)
+		assert.Equal(t, claimer.ID, metadata.UserID)
+
+		var updated models.FileBlob
+		require.NoError(t, db.First(&updated, "hash = ?", hash).Error)
+		assert.Equal(t, 2, updated.RefCount)
+
+		// 挑战已被消费
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "again.bin", answerChallenge(t, challenge, content))
+		assert.ErrorIs(t, err, ErrChallengeNotFound)
+	})
+
+	t.Run("伪造证明被拒绝且不能重试", func(t *testing.T) {
+		challenge, err := service.IssueUploadChallenge(claimer.ID, hash, size)
+		require.NoError(t, err)
+
+		forged := answerChallenge(t, challenge, make([]byte, len(content)))
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "forged.bin", forged)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "forged.bin", answerChallenge(t, challenge, content))
+		assert.ErrorIs(t, err, ErrChallengeNotFound)
+	})
+
+	t.Run("缺少证明", func(t *testing.T) {
+		challenge, err := service.IssueUploadChallenge(claimer.ID, hash, size)
+		require.NoError(t, err)
+
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "empty.bin", nil)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+	})
+
+	t.Run("挑战绑定用户", func(t *testing.T) {
+		challenge, err := service.IssueUploadChallenge(owner.ID, hash, size)
+		require.NoError(t, err)
+
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "stolen.bin", answerChallenge(t, challenge, content))
+		assert.ErrorIs(t, err, ErrChallengeNotFound)
+	})
+
+	t.Run("挑战过期", func(t *testing.T) {
+		challenge, err := service.IssueUploadChallenge(claimer.ID, hash, size)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(challenge).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "late.bin", answerChallenge(t, challenge, content))
+		assert.ErrorIs(t, err, ErrChallengeNotFound)
+	})
+
+	t.Run("文件不存在时下发诱饵挑战", func(t *testing.T) {
+		missing := append([]byte{}, content...)
+		missing[0] ^= 0xff
+		sum := sha256.Sum256(missing)
+		missingHash := hex.EncodeToString(sum[:])
+
+		challenge, err := service.IssueUploadChallenge(claimer.ID, missingHash, size)
+		require.NoError(t, err)
+		var ranges []models.ChallengeRange
+		require.NoError(t, json.Unmarshal(challenge.Ranges, &ranges))
+		assert.Len(t, ranges, ChallengeRangeCount)
+
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, missingHash, "missing.bin", answerChallenge(t, challenge, missing))
+		assert.ErrorIs(t, err, ErrProofMismatch)
+	})
+
+	t.Run("声明的大小与文件不符", func(t *testing.T) {
+		// 声明为空文件时挑战没有区间，不能借此绕过持有证明
+		challenge, err := service.IssueUploadChallenge(claimer.ID, hash, 0)
+		require.NoError(t, err)
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "empty.bin", nil)
+		assert.ErrorIs(t, err, ErrProofMismatch)
+
+		_, err = service.IssueUploadChallenge(claimer.ID, hash, -1)
+		assert.Error(t, err)
+	})
+
+	t.Run("已封禁的文件", func(t *testing.T) {
+		challenge, err := service.IssueUploadChallenge(claimer.ID, hash, size)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(&models.FileBlob{}).Where("hash = ?", hash).Update("is_banned", true).Error)
+		defer db.Model(&models.FileBlob{}).Where("hash = ?", hash).Update("is_banned", false)
+
+		_, err = service.ClaimInstantUpload(claimer.ID, challenge.ID, hash, "banned.bin", answerChallenge(t, challenge, content))
+		assert.ErrorIs(t, err, ErrProofMismatch)
+	})
+
+	t.Run("未知挑战", func(t *testing.T) {
+		_, err := service.ClaimInstantUpload(claimer.ID, uuid.New(), hash, "unknown.bin", nil)
+		assert.ErrorIs(t, err, ErrChallengeNotFound)
+	})
+}
+
+// TestRandomChallengeRanges 测试挑战区间选取
+func TestRandomChallengeRanges(t *testing.T) {
+	ranges, err := randomChallengeRanges(0)
+	require.NoError(t, err)
+	assert.Empty(t, ranges)
+
+	ranges, err = randomChallengeRanges(100)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ChallengeRange{{Offset: 0, Length: 100}}, ranges)
+
+	const size = ChallengeRangeSize + 10
+	for i := 0; i < 50; i++ {
+		ranges, err = randomChallengeRanges(size)
+		require.NoError(t, err)
+		require.Len(t, ranges, ChallengeRangeCount)
+		for _, r := range ranges {
+			assert.GreaterOrEqual(t, r.Offset, int64(0))
+			assert.LessOrEqual(t, r.Offset+r.Length, int64(size))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package services 提供业务逻辑服务
+//
+// 本文件实现上传准入策略：
+//   - 单文件大小上限（MAX_FILE_SIZE）
+//   - MIME 类型白名单（ALLOWED_MIME_TYPES，支持 image/* 形式的通配和 ! 前缀的黑名单）
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package services
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrFileTooLarge 文件超出单文件大小上限
+	ErrFileTooLarge = errors.New("file exceeds maximum allowed size")
+	// ErrMimeTypeNotAllowed 文件类型不在允许列表中
+	ErrMimeTypeNotAllowed = errors.New("file type is not allowed")
+)
+
+// sniffLength http.DetectContentType 最多读取的字节数
+const sniffLength = 512
+
+// UploadPolicy 上传准入策略
+//
+// 零值表示不限制大小和类型。
+type UploadPolicy struct {
+	MaxFileSize      int64    // 单文件大小上限（字节），0 表示不限制
+	AllowedMimeTypes []string // 允许的 MIME 类型，空表示不限制
+}
+
+// CheckSize 检查文件大小是否超出上限
+func (p UploadPolicy) CheckSize(size int64) error {
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return fmt.Errorf("%w: %d bytes (limit %d bytes)", ErrFileTooLarge, size, p.MaxFileSize)
+	}
+	return nil
+}
+
+// CheckMimeType 检查 MIME 类型是否符合允许/禁止列表
+//
+// 类型参数（如 charset）会被忽略。列表项支持通配："image/*" 匹配所有 image 子类型，
+// "*/*" 或 "*" 匹配任意类型；以 "!" 开头的项为禁止规则（如 "!image/svg+xml"），
+// 优先于允许规则。列表中只有禁止规则时，其余类型均允许。
+func (p UploadPolicy) CheckMimeType(mimeType string) error {
+	mediaType := normalizeMimeType(mimeType)
+
+	hasAllowRules, allowed := false, false
+	for _, rule := range p.AllowedMimeTypes {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if deny, ok := strings.CutPrefix(rule, "!"); ok {
+			if matchMimeType(strings.TrimSpace(deny), mediaType) {
+				return fmt.Errorf("%w: %s", ErrMimeTypeNotAllowed, mediaType)
+			}
+			continue
+		}
+		if rule == "" {
+			continue
+		}
+		hasAllowRules = true
+		if matchMimeType(rule, mediaType) {
+			allowed = true
+		}
+	}
+
+	if hasAllowRules && !allowed {
+		return fmt.Errorf("%w: %s", ErrMimeTypeNotAllowed, mediaType)
+	}
+	return nil
+}
+
+// matchMimeType 检查类型是否匹配列表项（支持通配）
+func matchMimeType(pattern, mediaType string) bool {
+	switch {
+	case pattern == "*" || pattern == "*/*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+	default:
+		return pattern == mediaType
+	}
+}
+
+// DeclaredMimeType 返回客户端声明的文件类型
+//
+// 优先使用声明的 MIME 类型，其次根据文件扩展名推断，都无法确定时返回
+// application/octet-stream。
+func DeclaredMimeType(declared, filename string) string {
+	if declared = normalizeMimeType(declared); declared != "" {
+		return declared
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(filename)); byExt != "" {
+		return normalizeMimeType(byExt)
+	}
+	return "application/octet-stream"
+}
+
+// normalizeMimeType 去掉类型参数并转为小写
+func normalizeMimeType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0])
+	}
+	return strings.ToLower(mediaType)
+}
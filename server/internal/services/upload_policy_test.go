@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadPolicy_CheckSize(t *testing.T) {
+	policy := UploadPolicy{MaxFileSize: 1024}
+	assert.NoError(t, policy.CheckSize(1024))
+	assert.ErrorIs(t, policy.CheckSize(1025), ErrFileTooLarge)
+
+	// 零值不限制
+	assert.NoError(t, UploadPolicy{}.CheckSize(1<<40))
+}
+
+func TestUploadPolicy_CheckMimeType(t *testing.T) {
+	policy := UploadPolicy{AllowedMimeTypes: []string{"image/*", "application/pdf"}}
+
+	tests := []struct {
+		mimeType string
+		allowed  bool
+	}{
+		{"image/png", true},
+		{"IMAGE/JPEG", true},
+		{"application/pdf", true},
+		{"text/plain; charset=utf-8", false},
+		{"application/octet-stream", false},
+		{"imagex/png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := policy.CheckMimeType(tt.mimeType)
+		if tt.allowed {
+			assert.NoError(t, err, tt.mimeType)
+		} else {
+			assert.ErrorIs(t, err, ErrMimeTypeNotAllowed, tt.mimeType)
+		}
+	}
+
+	assert.NoError(t, UploadPolicy{}.CheckMimeType("application/x-anything"))
+	assert.NoError(t, UploadPolicy{AllowedMimeTypes: []string{"*/*"}}.CheckMimeType("text/plain"))
+}
+
+func TestUploadPolicy_CheckMimeTypeDenyRules(t *testing.T) {
+	// 禁止规则优先于通配的允许规则
+	policy := UploadPolicy{AllowedMimeTypes: []string{"image/*", "!image/svg+xml"}}
+	assert.NoError(t, policy.CheckMimeType("image/png"))
+	assert.ErrorIs(t, policy.CheckMimeType("image/svg+xml"), ErrMimeTypeNotAllowed)
+	assert.ErrorIs(t, policy.CheckMimeType("application/pdf"), ErrMimeTypeNotAllowed)
+
+	// 只有禁止规则时其余类型均允许
+	denyOnly := UploadPolicy{AllowedMimeTypes: []string{"!application/x-msdownload", "! text/*"}}
+	assert.NoError(t, denyOnly.CheckMimeType("application/pdf"))
+	assert.ErrorIs(t, denyOnly.CheckMimeType("application/x-msdownload"), ErrMimeTypeNotAllowed)
+	assert.ErrorIs(t, denyOnly.CheckMimeType("text/html"), ErrMimeTypeNotAllowed)
+}
+
+func TestDeclaredMimeType(t *testing.T) {
+	assert.Equal(t, "image/png", DeclaredMimeType("image/png", "photo.jpg"))
+	assert.Equal(t, "application/pdf", DeclaredMimeType("", "report.pdf"))
+	assert.Equal(t, "application/octet-stream", DeclaredMimeType("", "noext"))
+}
+
+func TestSniffMimeType(t *testing.T) {
+	dir := t.TempDir()
+
+	pdf := filepath.Join(dir, "doc")
+	require.NoError(t, os.WriteFile(pdf, []byte("%PDF-1.4\n..."), 0600))
+	mimeType, err := SniffMimeType(pdf, "")
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", mimeType)
+
+	text := filepath.Join(dir, "text")
+	require.NoError(t, os.WriteFile(text, []byte("just some text"), 0600))
+	mimeType, err = SniffMimeType(text, "")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", mimeType)
+
+	_, err = SniffMimeType(filepath.Join(dir, "missing"), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUploadNotFound 上传会话不存在
+	ErrUploadNotFound = errors.New("upload session not found")
+	// ErrUploadNotActive 上传会话已完成或已失败
+	ErrUploadNotActive = errors.New("upload session is no longer active")
+	// ErrUploadOffsetMismatch 分片偏移量与服务端记录不一致
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrUploadExceedsLength 分片数据超出声明的文件大小
+	ErrUploadExceedsLength = errors.New("chunk exceeds declared upload length")
+)
+
+// UploadService 分片上传会话服务
+//
+// 会话状态保存在 upload_sessions 表，已接收的数据追加写入 uploadDir 下的会话文件，
+// 服务重启后客户端可通过 HEAD 查询偏移量并从断点继续上传。
+// 数据库中的 upload_offset 是唯一可信的进度，会话文件中超出该偏移量的部分
+// （例如写入中途进程崩溃）会在下一次写入前被截断。
+type UploadService struct {
+	db          *gorm.DB
+	fileService *FileService
+	uploadDir   string
+
+	locks sync.Map // 会话 ID -> *sync.Mutex，串行化同一会话的写入
+}
+
+// NewUploadService 创建分片上传服务
+func NewUploadService(db *gorm.DB, fileService *FileService, uploadDir string) *UploadService {
+	return &UploadService{
+		db:          db,
+		fileService: fileService,
+		uploadDir:   uploadDir,
+	}
+}
+
+// CreateSession 创建上传会话
+func (s *UploadService) CreateSession(userID uuid.UUID, filename string, size int64, hash string) (*models.UploadSession, error) {
+	if err := storage.ValidateHash(hash); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, errors.New("upload length must be positive")
+	}
+
+	if err := os.MkdirAll(s.uploadDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	session := &models.UploadSession{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Status:       models.UploadStatusUploading,
+		UploadLength: size,
+		Filename:     filename,
+		Hash:         strings.ToLower(hash),
+	}
+	session.TempPath = filepath.Join(s.uploadDir, session.ID.String())
+
+	// 预占配额，完成入库时转为已用空间
+	if _, err := s.fileService.ReserveStorage(userID, session.ID.String(), size, DefaultReservationTTL); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(session.TempPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		s.fileService.ReleaseReservation(session.ID.String())
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+
+	if err := s.db.Create(session).Error; err != nil {
+		os.Remove(session.TempPath)
+		s.fileService.ReleaseReservation(session.ID.String())
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSession 获取用户的上传会话
+func (s *UploadService) GetSession(sessionID uuid.UUID, userID uuid.UUID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := s.db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+	return &session, nil
+}
+
+// ListSessions 列出用户进行中的上传会话（最近更新的在前）
+func (s *UploadService) ListSessions(userID uuid.UUID) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	err := s.db.Where("user_id = ? AND status = ?", userID, models.UploadStatusUploading).
+		Order("updated_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// WriteChunk 在 offset 处追加分片数据
+//
+// offset 必须等于服务端记录的已上传字节数，否则返回 ErrUploadOffsetMismatch。
+// 数据部分写入时（如连接中断）已落盘的字节会计入进度，客户端可从新的偏移量续传。
+// 接收完全部数据后校验哈希并加密入库，返回创建的文件元数据；
+// 入库因临时错误失败时会话保持进行中，可在 offset 等于文件大小时发送空分片重试。
+func (s *UploadService) WriteChunk(sessionID uuid.UUID, userID uuid.UUID, offset int64, reader io.Reader) (*models.UploadSession, *models.FileMetadata, error) {
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session, err := s.GetSession(sessionID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !session.IsUploading() {
+		return session, nil, ErrUploadNotActive
+	}
+	if offset != session.UploadOffset {
+		return session, nil, ErrUploadOffsetMismatch
+	}
+
+	file, err := os.OpenFile(session.TempPath, os.O_RDWR, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.fail(session)
+			return session, nil, fmt.Errorf("upload data lost: %w", err)
+		}
+		return session, nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	// 丢弃上次写入中超出已确认偏移量的数据
+	if err := file.Truncate(offset); err != nil {
+		return session, nil, fmt.Errorf("failed to truncate upload file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return session, nil, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	// 多读 1 字节用于检测超出声明大小的数据
+	remaining := session.RemainingBytes()
+	written, copyErr := io.Copy(file, io.LimitReader(reader, remaining+1))
+	if written > remaining {
+		file.Truncate(offset)
+		return session, nil, ErrUploadExceedsLength
+	}
+
+	if written > 0 {
+		if err := file.Sync(); err != nil {
+			return session, nil, fmt.Errorf("failed to sync upload file: %w", err)
+		}
+		if err := s.advance(session, offset+written); err != nil {
+			return session, nil, err
+		}
+	}
+	if copyErr != nil {
+		return session, nil, fmt.Errorf("failed to receive chunk: %w", copyErr)
+	}
+
+	if session.UploadOffset < session.UploadLength {
+		return session, nil, nil
+	}
+
+	metadata, err := s.complete(session, file)
+	return session, metadata, err
+}
+
+// CancelSession 取消上传会话并删除已接收的数据
+func (s *UploadService) CancelSession(sessionID uuid.UUID, userID uuid.UUID) error {
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session, err := s.GetSession(sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Delete(session).Error; err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+	s.locks.Delete(sessionID)
+	s.fileService.ReleaseReservation(sessionID.String())
+
+	if session.TempPath != "" {
+		os.Remove(session.TempPath)
+	}
+	return nil
+}
+
+// advance 更新已确认的上传偏移量
+//
+// 以旧偏移量作为条件更新，防止多个实例并发写入同一会话时相互覆盖。
+func (s *UploadService) advance(session *models.UploadSession, offset int64) error {
+	result := s.db.Model(&models.UploadSession{}).
+		Where("id = ? AND upload_offset = ? AND status = ?", session.ID, session.UploadOffset, models.UploadStatusUploading).
+		Updates(map[string]interface{}{
+			"upload_offset": offset,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update upload offset: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUploadOffsetMismatch
+	}
+
+	session.UploadOffset = offset
+	return nil
+}
+
+// complete 校验哈希并将上传文件加密入库
+func (s *UploadService) complete(session *models.UploadSession, file *os.File) (*models.FileMetadata, error) {
+	metadata, err := s.fileService.ImportUploadedFile(session.UserID, session.Filename, file, session.Hash, session.ID.String())
+	if err != nil {
+		// 内容与声明的哈希不一致、类型不允许或空间不足，无法通过重试恢复
+		if errors.Is(err, ErrHashMismatch) || errors.Is(err, ErrMimeTypeNotAllowed) || errors.Is(err, ErrInsufficientStorage) {
+			s.fail(session)
+		}
+		return nil, err
+	}
+
+	if err := session.MarkCompleted(s.db); err != nil {
+		return nil, fmt.Errorf("failed to mark upload completed: %w", err)
+	}
+	s.locks.Delete(session.ID)
+	os.Remove(session.TempPath)
+
+	return metadata, nil
+}
+
+// fail 将会话标记为失败，释放预占的配额并删除已接收的数据
+func (s *UploadService) fail(session *models.UploadSession) {
+	session.MarkFailed(s.db)
+	s.fileService.ReleaseReservation(session.ID.String())
+	s.locks.Delete(session.ID)
+	os.Remove(session.TempPath)
+}
+
+// sessionLock 获取会话的写入锁
+func (s *UploadService) sessionLock(sessionID uuid.UUID) *sync.Mutex {
+	lock, _ := s.locks.LoadOrStore(sessionID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
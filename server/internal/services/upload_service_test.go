@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestUploadService_ResumeAfterRestart 测试服务重启后从断点续传
+//
+// 测试场景：
+//  1. 上传部分分片后重建服务实例（共享数据库和会话目录）
+//  2. 会话文件中超出已确认偏移量的残留数据被丢弃
+//  3. 续传完成后校验哈希并入库，会话标记为已完成
+func TestUploadService_ResumeAfterRestart(t *testing.T) {
+	db := setupTestDB(t)
+	kek := []byte("test-master-key-1234567890123456")
+	dir := t.TempDir()
+	fileService := NewFileService(db, storage.NewMemoryEngine(), kek)
+	user := createTestUser(t, db)
+
+	content := bytes.Repeat([]byte("resumable "), 4096)
+	service := NewUploadService(db, fileService, dir)
+	session, err := service.CreateSession(user.ID, "resume.txt", int64(len(content)), sha256Hex(content))
+	require.NoError(t, err)
+
+	session, metadata, err := service.WriteChunk(session.ID, user.ID, 0, bytes.NewReader(content[:15000]))
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+	assert.Equal(t, int64(15000), session.UploadOffset)
+
+	// 模拟写入中途崩溃：会话文件中有未确认的数据
+	f, err := os.OpenFile(session.TempPath, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("garbage"))
+	require.NoError(t, err)
+	f.Close()
+
+	// 重启后的新实例
+	restarted := NewUploadService(db, fileService, dir)
+	sessions, err := restarted.ListSessions(user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, int64(15000), sessions[0].UploadOffset)
+
+	session, metadata, err = restarted.WriteChunk(session.ID, user.ID, 15000, bytes.NewReader(content[15000:]))
+	require.NoError(t, err)
+	require.NotNil(t, metadata)
+	assert.Equal(t, sha256Hex(content), metadata.FileBlobHash)
+	assert.Equal(t, int64(len(content)), metadata.Size)
+	assert.True(t, session.IsCompleted())
+	assert.NotNil(t, session.CompletedAt)
+
+	_, err = os.Stat(session.TempPath)
+	assert.True(t, os.IsNotExist(err), "session file should be removed after completion")
+
+	sessions, err = restarted.ListSessions(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+// TestUploadService_RetryCompletion 测试入库临时失败后重试
+func TestUploadService_RetryCompletion(t *testing.T) {
+	db := setupTestDB(t)
+	kek := []byte("test-master-key-1234567890123456")
+	dir := t.TempDir()
+	user := createTestUser(t, db)
+
+	content := make([]byte, 8192)
+	broken := NewUploadService(db, NewFileService(db, failingEngine{storage.NewMemoryEngine()}, kek), dir)
+	session, err := broken.CreateSession(user.ID, "retry.bin", int64(len(content)), sha256Hex(content))
+	require.NoError(t, err)
+
+	session, _, err = broken.WriteChunk(session.ID, user.ID, 0, bytes.NewReader(content))
+	require.Error(t, err)
+	assert.True(t, session.IsUploading())
+	assert.Equal(t, int64(len(content)), session.UploadOffset)
+
+	// 存储恢复后发送空分片重试入库
+	healthy := NewUploadService(db, NewFileService(db, storage.NewMemoryEngine(), kek), dir)
+	session, metadata, err := healthy.WriteChunk(session.ID, user.ID, int64(len(content)), bytes.NewReader(nil))
+	require.NoError(t, err)
+	require.NotNil(t, metadata)
+	assert.True(t, session.IsCompleted())
+}
+
+// TestUploadService_Errors 测试会话错误状态
+func TestUploadService_Errors(t *testing.T) {
+	db := setupTestDB(t)
+	kek := []byte("test-master-key-1234567890123456")
+	service := NewUploadService(db, NewFileService(db, storage.NewMemoryEngine(), kek), t.TempDir())
+	user := createTestUser(t, db)
+
+	content := []byte("declared content")
+
+	t.Run("配额不足", func(t *testing.T) {
+		_, err := service.CreateSession(user.ID, "huge.bin", 1<<40, sha256Hex(content))
+		assert.ErrorIs(t, err, ErrInsufficientStorage)
+	})
+
+	t.Run("哈希不一致", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "mismatch.txt", int64(len(content)), sha256Hex(content))
+		require.NoError(t, err)
+
+		session, _, err = service.WriteChunk(session.ID, user.ID, 0, bytes.NewReader([]byte("tampered content")))
+		assert.ErrorIs(t, err, ErrHashMismatch)
+		assert.True(t, session.IsFailed())
+
+		_, _, err = service.WriteChunk(session.ID, user.ID, session.UploadOffset, bytes.NewReader(nil))
+		assert.ErrorIs(t, err, ErrUploadNotActive)
+
+		var count int64
+		db.Model(&models.FileBlob{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("其他用户的会话", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "private.txt", int64(len(content)), sha256Hex(content))
+		require.NoError(t, err)
+
+		other := &models.User{Email: "other@example.com", Password: "hashed_password", StorageQuota: 1 << 30}
+		require.NoError(t, db.Create(other).Error)
+
+		_, _, err = service.WriteChunk(session.ID, other.ID, 0, bytes.NewReader(content))
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+		assert.ErrorIs(t, service.CancelSession(session.ID, other.ID), ErrUploadNotFound)
+	})
+
+	t.Run("取消会话", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "cancel.txt", int64(len(content)), sha256Hex(content))
+		require.NoError(t, err)
+
+		require.NoError(t, service.CancelSession(session.ID, user.ID))
+		_, err = os.Stat(session.TempPath)
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = service.GetSession(session.ID, user.ID)
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+	})
+}
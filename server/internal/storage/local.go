@@ -110,6 +110,25 @@ func (e *LocalEngine) Get(hash string) (io.ReadCloser, error) {
 	return file, nil
 }
 
+// GetRange 按区间读取文件，length < 0 表示读到文件末尾
+func (e *LocalEngine) GetRange(hash string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := e.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	file := rc.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
 // Delete 删除文件
 func (e *LocalEngine) Delete(hash string) error {
 	// 验证哈希
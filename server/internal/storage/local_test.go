@@ -60,6 +60,45 @@ func TestLocalEnginePutGet(t *testing.T) {
 	}
 }
 
+// TestLocalEngineGetRange 测试区间读取
+func TestLocalEngineGetRange(t *testing.T) {
+	engine, _ := NewLocalEngine(t.TempDir())
+
+	hash := "aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff"
+	data := []byte("0123456789abcdef")
+	if err := engine.Put(hash, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{"固定长度", 2, 5, "23456"},
+		{"读到末尾", 10, -1, "abcdef"},
+		{"超出末尾的长度", 14, 100, "ef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := engine.GetRange(hash, tt.offset, tt.length)
+			if err != nil {
+				t.Fatalf("GetRange() error = %v", err)
+			}
+			defer reader.Close()
+
+			got, _ := io.ReadAll(reader)
+			if string(got) != tt.want {
+				t.Errorf("GetRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := engine.GetRange("1122334455667788990011223344556677889900aabbccddeeffaabbccddeeff", 0, 1); err == nil {
+		t.Error("GetRange() should fail for missing file")
+	}
+}
+
 // TestLocalEngineExists 测试文件存在性检查
 func TestLocalEngineExists(t *testing.T) {
 	tempDir := t.TempDir()
@@ -11,19 +11,22 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 )
 
 // MemoryEngine 内存存储引擎（用于测试）
 type MemoryEngine struct {
-	mu    sync.RWMutex
-	files map[string][]byte // hash -> file content
+	mu          sync.RWMutex
+	files       map[string][]byte // hash -> file content
+	quarantined map[string][]byte // 隔离位置 -> file content
 }
 
 // NewMemoryEngine 创建内存存储引擎实例
 func NewMemoryEngine() *MemoryEngine {
 	return &MemoryEngine{
-		files: make(map[string][]byte),
+		files:       make(map[string][]byte),
+		quarantined: make(map[string][]byte),
 	}
 }
 
@@ -78,6 +81,35 @@ func (e *MemoryEngine) Get(hash string) (io.ReadCloser, error) {
 	return io.NopCloser(bytes.NewReader(copyData)), nil
 }
 
+// GetRange 按区间读取内存中的文件，length < 0 表示读到文件末尾
+func (e *MemoryEngine) GetRange(hash string, offset, length int64) (io.ReadCloser, error) {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	data, exists := e.files[hash]
+	if !exists {
+		return nil, fmt.Errorf("file not found: %s", hash)
+	}
+
+	if offset < 0 || offset > int64(len(data)) {
+		return nil, fmt.Errorf("invalid range offset: %d", offset)
+	}
+	end := int64(len(data))
+	if length >= 0 && offset+length < end {
+		end = offset + length
+	}
+
+	copyData := make([]byte, end-offset)
+	copy(copyData, data[offset:end])
+
+	return io.NopCloser(bytes.NewReader(copyData)), nil
+}
+
 // Delete 从内存删除文件
 func (e *MemoryEngine) Delete(hash string) error {
 	// 验证哈希
@@ -138,6 +170,7 @@ func (e *MemoryEngine) Clear() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.files = make(map[string][]byte)
+	e.quarantined = make(map[string][]byte)
 }
 
 // Count 返回存储的文件数量（测试辅助方法）
@@ -146,3 +179,44 @@ func (e *MemoryEngine) Count() int {
 	defer e.mu.RUnlock()
 	return len(e.files)
 }
+
+// Walk 遍历所有文件（按哈希排序）
+func (e *MemoryEngine) Walk(fn func(entry BlobEntry) error) error {
+	e.mu.RLock()
+	entries := make([]BlobEntry, 0, len(e.files))
+	for hash, data := range e.files {
+		entries = append(entries, BlobEntry{Hash: hash, Size: int64(len(data))})
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Hash < entries[j].Hash })
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quarantine 将文件移入隔离区
+func (e *MemoryEngine) Quarantine(hash string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	data, exists := e.files[hash]
+	if !exists {
+		return "", fmt.Errorf("file not found: %s", hash)
+	}
+
+	location := fmt.Sprintf("%s/%s.%d", QuarantineDir, hash, len(e.quarantined))
+	e.quarantined[location] = data
+	delete(e.files, hash)
+	return location, nil
+}
+
+// QuarantinedCount 返回隔离区中的文件数量（测试辅助方法）
+func (e *MemoryEngine) QuarantinedCount() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.quarantined)
+}
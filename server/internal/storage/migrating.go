@@ -0,0 +1,119 @@
+// Package storage 提供存储引擎抽象层
+//
+// 本文件实现迁移期间使用的双读存储引擎：
+//   - 写入只进入目标引擎
+//   - 读取优先目标引擎，不存在时回退到源引擎
+//   - 删除同时作用于两个引擎
+//
+// 配合 tasks.StorageMigrator 在线迁移存储后端，迁移过程中服务无需停机。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package storage
+
+import (
+	"fmt"
+	"io"
+)
+
+// MigratingEngine 迁移期间的双读存储引擎
+type MigratingEngine struct {
+	target Engine // 迁移目标（新写入）
+	source Engine // 迁移源（只读回退）
+}
+
+// NewMigratingEngine 创建双读存储引擎
+func NewMigratingEngine(target, source Engine) *MigratingEngine {
+	return &MigratingEngine{
+		target: target,
+		source: source,
+	}
+}
+
+// Target 返回迁移目标引擎
+func (e *MigratingEngine) Target() Engine {
+	return e.target
+}
+
+// Source 返回迁移源引擎
+func (e *MigratingEngine) Source() Engine {
+	return e.source
+}
+
+// Put 存储文件到目标引擎
+func (e *MigratingEngine) Put(hash string, reader io.Reader) error {
+	return e.target.Put(hash, reader)
+}
+
+// Get 读取文件，目标引擎不存在时从源引擎读取
+func (e *MigratingEngine) Get(hash string) (io.ReadCloser, error) {
+	engine, err := e.locate(hash)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Get(hash)
+}
+
+// GetRange 按区间读取文件，目标引擎不存在时从源引擎读取
+func (e *MigratingEngine) GetRange(hash string, offset, length int64) (io.ReadCloser, error) {
+	engine, err := e.locate(hash)
+	if err != nil {
+		return nil, err
+	}
+	return GetRange(engine, hash, offset, length)
+}
+
+// Delete 从两个引擎中删除文件，任一引擎中存在即视为成功
+func (e *MigratingEngine) Delete(hash string) error {
+	deleted := false
+	for _, engine := range []Engine{e.target, e.source} {
+		exists, err := engine.Exists(hash)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err := engine.Delete(hash); err != nil {
+			return err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		return fmt.Errorf("file not found: %s", hash)
+	}
+	return nil
+}
+
+// Exists 检查文件是否存在于任一引擎
+func (e *MigratingEngine) Exists(hash string) (bool, error) {
+	exists, err := e.target.Exists(hash)
+	if err != nil || exists {
+		return exists, err
+	}
+	return e.source.Exists(hash)
+}
+
+// Stat 获取文件信息，目标引擎不存在时从源引擎获取
+func (e *MigratingEngine) Stat(hash string) (*FileInfo, error) {
+	engine, err := e.locate(hash)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Stat(hash)
+}
+
+// locate 返回文件所在的引擎（优先目标引擎）
+//
+// 两个引擎都不存在时返回源引擎，由其返回对应的 not found 错误。
+func (e *MigratingEngine) locate(hash string) (Engine, error) {
+	exists, err := e.target.Exists(hash)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return e.target, nil
+	}
+	return e.source, nil
+}
@@ -0,0 +1,141 @@
+// Package storage 提供存储引擎抽象层
+//
+// 本文件定义按区间读取的可选接口，以及基于它的随机访问适配器，
+// 供分段加密文件按需读取覆盖目标区间的密文。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RangeReader 支持按字节区间读取的存储引擎（可选接口）
+type RangeReader interface {
+	// GetRange 读取从 offset 开始的 length 个字节，length < 0 表示读到文件末尾
+	GetRange(hash string, offset, length int64) (io.ReadCloser, error)
+}
+
+// GetRange 按区间读取文件
+//
+// 引擎实现了 RangeReader 时直接使用；否则退化为顺序读取并丢弃 offset 之前的数据。
+func GetRange(engine Engine, hash string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid range offset: %d", offset)
+	}
+
+	if rr, ok := engine.(RangeReader); ok {
+		return rr.GetRange(hash, offset, length)
+	}
+
+	rc, err := engine.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	if length < 0 {
+		return rc, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(rc, length), Closer: rc}, nil
+}
+
+// limitedReadCloser 限制读取长度并保留底层 Closer
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// BlobReaderAt 基于存储引擎的随机访问读取器
+//
+// 为减少远端存储的请求次数，读取器会保持一个打开到文件末尾的读取流：
+// 连续的 ReadAt 直接沿用该流，只有发生跳转时才重新发起区间读取。
+// 因此顺序读取一个区间只需一次请求。使用完毕后必须调用 Close。
+type BlobReaderAt struct {
+	engine Engine
+	hash   string
+	size   int64
+
+	mu     sync.Mutex
+	stream io.ReadCloser
+	pos    int64 // stream 当前对应的文件偏移
+}
+
+// NewReaderAt 创建文件的随机访问读取器，size 为文件总长度
+func NewReaderAt(engine Engine, hash string, size int64) *BlobReaderAt {
+	return &BlobReaderAt{
+		engine: engine,
+		hash:   hash,
+		size:   size,
+	}
+}
+
+// Size 返回文件总长度
+func (r *BlobReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt 读取指定偏移的数据
+func (r *BlobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	want := len(p)
+	if remaining := r.size - off; int64(want) > remaining {
+		want = int(remaining)
+	}
+
+	if r.stream == nil || r.pos != off {
+		r.closeStream()
+		stream, err := GetRange(r.engine, r.hash, off, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.stream = stream
+		r.pos = off
+	}
+
+	n, err := io.ReadFull(r.stream, p[:want])
+	r.pos += int64(n)
+	if err != nil {
+		r.closeStream()
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return n, io.ErrUnexpectedEOF
+		}
+		return n, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if want < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close 关闭当前打开的读取流
+func (r *BlobReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeStream()
+	return nil
+}
+
+// closeStream 关闭读取流（调用方需持有锁）
+func (r *BlobReaderAt) closeStream() {
+	if r.stream != nil {
+		r.stream.Close()
+		r.stream = nil
+	}
+}
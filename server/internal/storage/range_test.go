@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// countingEngine 记录区间读取次数的存储引擎
+type countingEngine struct {
+	*MemoryEngine
+	rangeCalls int
+}
+
+func (e *countingEngine) GetRange(hash string, offset, length int64) (io.ReadCloser, error) {
+	e.rangeCalls++
+	return e.MemoryEngine.GetRange(hash, offset, length)
+}
+
+// plainEngine 隐藏 GetRange，用于测试退化路径
+type plainEngine struct {
+	Engine
+}
+
+// TestGetRangeFallback 测试引擎未实现 RangeReader 时的退化读取
+func TestGetRangeFallback(t *testing.T) {
+	mem := NewMemoryEngine()
+	hash := "aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff"
+	mem.Put(hash, bytes.NewReader([]byte("0123456789")))
+
+	reader, err := GetRange(plainEngine{mem}, hash, 3, 4)
+	if err != nil {
+		t.Fatalf("GetRange() error = %v", err)
+	}
+	defer reader.Close()
+
+	got, _ := io.ReadAll(reader)
+	if string(got) != "3456" {
+		t.Errorf("GetRange() = %q, want %q", got, "3456")
+	}
+
+	if _, err := GetRange(plainEngine{mem}, hash, 20, -1); err == nil {
+		t.Error("GetRange() should fail for offset beyond end")
+	}
+}
+
+// TestBlobReaderAt 测试随机访问读取器
+func TestBlobReaderAt(t *testing.T) {
+	engine := &countingEngine{MemoryEngine: NewMemoryEngine()}
+	hash := "aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff"
+	data := []byte("0123456789abcdefghij")
+	engine.Put(hash, bytes.NewReader(data))
+
+	r := NewReaderAt(engine, hash, int64(len(data)))
+	defer r.Close()
+
+	// 连续读取只发起一次区间请求
+	buf := make([]byte, 5)
+	for off := int64(0); off < 15; off += 5 {
+		if _, err := r.ReadAt(buf, off); err != nil {
+			t.Fatalf("ReadAt(%d) error = %v", off, err)
+		}
+		if !bytes.Equal(buf, data[off:off+5]) {
+			t.Errorf("ReadAt(%d) = %q, want %q", off, buf, data[off:off+5])
+		}
+	}
+	if engine.rangeCalls != 1 {
+		t.Errorf("sequential reads issued %d range requests, want 1", engine.rangeCalls)
+	}
+
+	// 跳转后重新发起请求
+	if _, err := r.ReadAt(buf, 2); err != nil {
+		t.Fatalf("ReadAt(2) error = %v", err)
+	}
+	if engine.rangeCalls != 2 {
+		t.Errorf("range requests = %d, want 2 after seek", engine.rangeCalls)
+	}
+
+	// 读取越过末尾
+	n, err := r.ReadAt(buf, 18)
+	if n != 2 || err != io.EOF {
+		t.Errorf("ReadAt(18) = (%d, %v), want (2, EOF)", n, err)
+	}
+	if _, err := r.ReadAt(buf, 20); err != io.EOF {
+		t.Errorf("ReadAt(20) error = %v, want EOF", err)
+	}
+}
+
+// TestBlobReaderAtShortObject 测试实际对象比声明长度短的情况
+func TestBlobReaderAtShortObject(t *testing.T) {
+	engine := NewMemoryEngine()
+	hash := "aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff"
+	engine.Put(hash, bytes.NewReader([]byte("0123")))
+
+	r := NewReaderAt(engine, hash, 10)
+	defer r.Close()
+
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf, 0); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadAt() error = %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,774 @@
+// Package storage 提供存储引擎抽象层
+//
+// 本文件实现 S3 兼容存储引擎，支持：
+//   - AWS S3、MinIO、阿里云 OSS 等任意 S3 兼容服务
+//   - Path-Style（endpoint/bucket/key）与 Virtual-Host-Style（bucket.endpoint/key）寻址
+//   - 大文件自动切换为分片上传（Multipart Upload）
+//   - AWS Signature Version 4 请求签名（仅依赖标准库）
+//
+// 对象键与本地引擎保持一致，使用 GeneratePath 生成的两级目录结构，
+// 便于在不同存储后端之间迁移。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-02-10
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultS3PartSize 默认分片大小（同时也是切换为分片上传的阈值）
+	DefaultS3PartSize int64 = 16 * 1024 * 1024 // 16MB
+
+	// MinS3PartSize S3 协议要求的最小分片大小（最后一个分片除外）
+	MinS3PartSize int64 = 5 * 1024 * 1024 // 5MB
+
+	// s3EmptyPayloadHash 空请求体的 SHA-256
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// 默认 HTTP 客户端的超时：只限制建立连接和等待响应头，不限制整体耗时，
+	// 大文件上传下载不会被中断，但无响应的服务端不会让请求永久挂起
+	s3DialTimeout           = 10 * time.Second
+	s3TLSHandshakeTimeout   = 10 * time.Second
+	s3ResponseHeaderTimeout = 60 * time.Second
+
+	s3TimeFormat  = "20060102T150405Z"
+	s3DateFormat  = "20060102"
+	s3SignAlgo    = "AWS4-HMAC-SHA256"
+	s3ServiceName = "s3"
+)
+
+// S3Config S3 存储引擎配置
+type S3Config struct {
+	Endpoint  string // 服务地址，如 s3.amazonaws.com、minio:9000，可带 http(s):// 前缀
+	Region    string // 区域，如 us-east-1
+	Bucket    string // 存储桶名称
+	AccessKey string
+	SecretKey string
+	UseSSL    bool // Endpoint 未带协议前缀时，是否使用 HTTPS
+	PathStyle bool // true: Path-Style；false: Virtual-Host-Style
+	PartSize  int64
+
+	// HTTPClient 自定义 HTTP 客户端（可选，主要用于测试）
+	HTTPClient *http.Client
+}
+
+// S3Engine S3 兼容存储引擎
+type S3Engine struct {
+	scheme    string // http 或 https
+	host      string // endpoint 主机名（含端口）
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	partSize  int64
+	client    *http.Client
+
+	// now 返回当前时间（测试时可替换）
+	now func() time.Time
+}
+
+// NewS3Engine 创建 S3 存储引擎实例
+func NewS3Engine(cfg S3Config) (*S3Engine, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3 access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = DefaultS3PartSize
+	}
+
+	// 解析 endpoint
+	scheme := "http"
+	if cfg.UseSSL {
+		scheme = "https"
+	}
+	host := strings.TrimSuffix(cfg.Endpoint, "/")
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+		}
+		scheme = u.Scheme
+		host = u.Host
+	}
+	if host == "" {
+		host = fmt.Sprintf("s3.%s.amazonaws.com", cfg.Region)
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = newS3HTTPClient()
+	}
+
+	return &S3Engine{
+		scheme:    scheme,
+		host:      host,
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		pathStyle: cfg.PathStyle,
+		partSize:  cfg.PartSize,
+		client:    client,
+		now:       time.Now,
+	}, nil
+}
+
+// newS3HTTPClient 创建带连接、TLS 握手和响应头超时的默认 HTTP 客户端
+func newS3HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   s3DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = s3TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = s3ResponseHeaderTimeout
+	return &http.Client{Transport: transport}
+}
+
+// EnsureBucket 检查存储桶是否存在，不存在时自动创建
+func (e *S3Engine) EnsureBucket() error {
+	resp, err := e.do(http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket: %w", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		// 继续创建
+	default:
+		return fmt.Errorf("failed to check bucket: unexpected status %d", resp.StatusCode)
+	}
+
+	// us-east-1 以外的区域需要显式指定 LocationConstraint
+	var body []byte
+	if e.region != "us-east-1" {
+		body = []byte(fmt.Sprintf(
+			`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>%s</LocationConstraint></CreateBucketConfiguration>`,
+			e.region,
+		))
+	}
+
+	resp, err = e.do(http.MethodPut, "", nil, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to create bucket: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to create bucket: %w", parseS3Error(resp))
+	}
+	return nil
+}
+
+// Put 存储文件
+//
+// 数据量小于分片大小时使用单次 PUT，否则使用分片上传；
+// 任一时刻最多只在内存中缓冲一个分片。
+func (e *S3Engine) Put(hash string, reader io.Reader) error {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return fmt.Errorf("invalid hash: %w", err)
+	}
+
+	key, err := GeneratePath(hash)
+	if err != nil {
+		return err
+	}
+
+	// 检查文件是否已存在
+	exists, err := e.Exists(hash)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("file already exists: %s", hash)
+	}
+
+	// 读取第一个分片，判断上传方式
+	buf := make([]byte, e.partSize)
+	n, err := io.ReadFull(reader, buf)
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("no data written")
+	case err == io.ErrUnexpectedEOF:
+		return e.putObject(key, buf[:n])
+	case err != nil:
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+
+	return e.putMultipart(key, buf, reader)
+}
+
+// putObject 单次上传对象
+func (e *S3Engine) putObject(key string, data []byte) error {
+	resp, err := e.do(http.MethodPut, key, nil, nil, data)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write file: %w", parseS3Error(resp))
+	}
+	return nil
+}
+
+// s3CompletedPart 已完成的分片
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putMultipart 分片上传对象，first 为已读取的第一个完整分片
+func (e *S3Engine) putMultipart(key string, first []byte, reader io.Reader) error {
+	uploadID, err := e.createMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+
+	parts, err := e.uploadParts(key, uploadID, first, reader)
+	if err == nil {
+		err = e.completeMultipartUpload(key, uploadID, parts)
+	}
+	if err != nil {
+		// 放弃未完成的分片上传，避免残留分片占用存储
+		e.abortMultipartUpload(key, uploadID)
+		return err
+	}
+
+	return nil
+}
+
+// uploadParts 依次上传所有分片
+func (e *S3Engine) uploadParts(key, uploadID string, buf []byte, reader io.Reader) ([]s3CompletedPart, error) {
+	parts := make([]s3CompletedPart, 0)
+	data := buf
+
+	for partNumber := 1; ; partNumber++ {
+		query := url.Values{}
+		query.Set("partNumber", strconv.Itoa(partNumber))
+		query.Set("uploadId", uploadID)
+
+		resp, err := e.do(http.MethodPut, key, query, nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to upload part %d: %w", partNumber, parseS3Error(resp))
+		}
+
+		parts = append(parts, s3CompletedPart{
+			PartNumber: partNumber,
+			ETag:       resp.Header.Get("ETag"),
+		})
+
+		// 读取下一个分片
+		n, err := io.ReadFull(reader, buf)
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("failed to read data: %w", err)
+		}
+		data = buf[:n]
+	}
+}
+
+// createMultipartUpload 初始化分片上传
+func (e *S3Engine) createMultipartUpload(key string) (string, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+
+	resp, err := e.do(http.MethodPost, key, query, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to create multipart upload: %w", parseS3Error(resp))
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode multipart upload response: %w", err)
+	}
+	if result.UploadID == "" {
+		return "", fmt.Errorf("empty upload id in multipart upload response")
+	}
+
+	return result.UploadID, nil
+}
+
+// completeMultipartUpload 完成分片上传
+func (e *S3Engine) completeMultipartUpload(key, uploadID string, parts []s3CompletedPart) error {
+	payload := struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts}
+
+	body, err := xml.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode complete request: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+
+	resp, err := e.do(http.MethodPost, key, query, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to complete multipart upload: %w", parseS3Error(resp))
+	}
+
+	// S3 可能返回 200 但响应体中包含错误
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read complete response: %w", err)
+	}
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		return fmt.Errorf("failed to complete multipart upload: %w", decodeS3Error(resp.StatusCode, respBody))
+	}
+
+	return nil
+}
+
+// abortMultipartUpload 放弃分片上传（忽略错误）
+func (e *S3Engine) abortMultipartUpload(key, uploadID string) {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+
+	resp, err := e.do(http.MethodDelete, key, query, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// Get 读取文件
+func (e *S3Engine) Get(hash string) (io.ReadCloser, error) {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	key, err := GeneratePath(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("file not found: %s", hash)
+	default:
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to open file: %w", parseS3Error(resp))
+	}
+}
+
+// GetRange 按区间读取文件，length < 0 表示读到文件末尾
+func (e *S3Engine) GetRange(hash string, offset, length int64) (io.ReadCloser, error) {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid range offset: %d", offset)
+	}
+	if length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	key, err := GeneratePath(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	rangeSpec := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		rangeSpec += strconv.FormatInt(offset+length-1, 10)
+	}
+	header := http.Header{}
+	header.Set("Range", rangeSpec)
+
+	resp, err := e.do(http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// 服务端忽略了 Range 头，手动跳过前面的数据
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to seek file: %w", err)
+		}
+		if length < 0 {
+			return resp.Body, nil
+		}
+		return &limitedReadCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid range offset: %d", offset)
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("file not found: %s", hash)
+	default:
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to open file: %w", parseS3Error(resp))
+	}
+}
+
+// Delete 删除文件
+func (e *S3Engine) Delete(hash string) error {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return fmt.Errorf("invalid hash: %w", err)
+	}
+
+	key, err := GeneratePath(hash)
+	if err != nil {
+		return err
+	}
+
+	// S3 删除不存在的对象也会返回成功，这里保持与本地引擎一致的语义
+	exists, err := e.Exists(hash)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("file not found: %s", hash)
+	}
+
+	resp, err := e.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete file: %w", parseS3Error(resp))
+	}
+	return nil
+}
+
+// Exists 检查文件是否存在
+func (e *S3Engine) Exists(hash string) (bool, error) {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return false, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	resp, err := e.head(hash)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to stat file: unexpected status %d", resp.StatusCode)
+	}
+}
+
+// Stat 获取文件信息
+func (e *S3Engine) Stat(hash string) (*FileInfo, error) {
+	// 验证哈希
+	if err := ValidateHash(hash); err != nil {
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	resp, err := e.head(hash)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("file not found: %s", hash)
+	default:
+		return nil, fmt.Errorf("failed to stat file: unexpected status %d", resp.StatusCode)
+	}
+
+	key, _ := GeneratePath(hash)
+	return &FileInfo{
+		Hash:      hash,
+		Size:      resp.ContentLength,
+		StorePath: key,
+	}, nil
+}
+
+// head 发送 HEAD Object 请求
+func (e *S3Engine) head(hash string) (*http.Response, error) {
+	key, err := GeneratePath(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return resp, nil
+}
+
+// GetBucket 获取存储桶名称
+func (e *S3Engine) GetBucket() string {
+	return e.bucket
+}
+
+// ==========================================
+// 请求构造与签名
+// ==========================================
+
+// objectURL 生成对象 URL，key 为空时表示存储桶本身
+func (e *S3Engine) objectURL(key string, query url.Values) *url.URL {
+	u := &url.URL{Scheme: e.scheme}
+
+	path := "/"
+	if e.pathStyle {
+		u.Host = e.host
+		path += e.bucket
+		if key != "" {
+			path += "/" + key
+		}
+	} else {
+		u.Host = e.bucket + "." + e.host
+		path += key
+	}
+
+	u.Path = path
+	u.RawPath = s3EncodePath(path)
+	if len(query) > 0 {
+		u.RawQuery = s3CanonicalQuery(query)
+	}
+	return u
+}
+
+// do 构造、签名并发送请求
+func (e *S3Engine) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, e.objectURL(key, query).String(), bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	e.sign(req, body)
+
+	return e.client.Do(req)
+}
+
+// sign 使用 AWS Signature Version 4 为请求签名
+//
+// 签名的请求头包括 host、content-md5、content-type、range 以及所有 x-amz-* 头。
+func (e *S3Engine) sign(req *http.Request, body []byte) {
+	now := e.now().UTC()
+	amzDate := now.Format(s3TimeFormat)
+	date := now.Format(s3DateFormat)
+
+	payloadHash := s3EmptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 规范化请求头
+	headers := map[string]string{"host": req.URL.Host}
+	for k, values := range req.Header {
+		lower := strings.ToLower(k)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-md5" ||
+			lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name)
+		canonicalHeaders.WriteByte(':')
+		canonicalHeaders.WriteString(headers[name])
+		canonicalHeaders.WriteByte('\n')
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, e.region, s3ServiceName, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3SignAlgo,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	// 派生签名密钥
+	signingKey := s3HMAC([]byte("AWS4"+e.secretKey), date)
+	signingKey = s3HMAC(signingKey, e.region)
+	signingKey = s3HMAC(signingKey, s3ServiceName)
+	signingKey = s3HMAC(signingKey, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgo, e.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+// s3HMAC 计算 HMAC-SHA256
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3URIEncode 按 SigV4 规则进行 URI 编码（RFC 3986 非保留字符不编码）
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// s3EncodePath 编码路径（保留 /）
+func s3EncodePath(path string) string {
+	return s3URIEncode(path, false)
+}
+
+// s3CanonicalQuery 生成按键排序的规范化查询字符串
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3URIEncode(k, true)+"="+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// ==========================================
+// 错误处理
+// ==========================================
+
+// S3Error S3 服务返回的错误
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+// Error 实现 error 接口
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 error: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3 error: %s (%s, status %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// IsS3ErrorCode 检查错误是否为指定的 S3 错误码
+func IsS3ErrorCode(err error, code string) bool {
+	var s3Err *S3Error
+	return errors.As(err, &s3Err) && s3Err.Code == code
+}
+
+// parseS3Error 从响应中解析 S3 错误
+func parseS3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return decodeS3Error(resp.StatusCode, body)
+}
+
+// decodeS3Error 解析 S3 错误响应体
+func decodeS3Error(statusCode int, body []byte) error {
+	s3Err := &S3Error{StatusCode: statusCode}
+	if len(body) > 0 {
+		_ = xml.Unmarshal(body, s3Err)
+	}
+	return s3Err
+}
@@ -0,0 +1,107 @@
+// Package storage 提供存储引擎抽象层
+//
+// 本文件定义遍历与隔离的可选接口，供存储巡检任务使用：
+//   - Walker: 枚举存储中的所有 blob
+//   - Quarantiner: 将可疑的 blob 移出正常存储区（不删除，便于人工确认）
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QuarantineDir 本地存储中隔离区目录名（位于基础路径下）
+const QuarantineDir = ".quarantine"
+
+// BlobEntry 存储中的一个 blob
+type BlobEntry struct {
+	Hash    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Walker 支持遍历所有 blob 的存储引擎（可选接口）
+type Walker interface {
+	// Walk 依次对每个 blob 调用 fn，fn 返回错误时停止遍历并返回该错误
+	Walk(fn func(entry BlobEntry) error) error
+}
+
+// Quarantiner 支持隔离 blob 的存储引擎（可选接口）
+type Quarantiner interface {
+	// Quarantine 将 blob 移入隔离区，返回隔离后的位置
+	Quarantine(hash string) (string, error)
+}
+
+// Walk 遍历本地存储的两级哈希目录
+//
+// 只返回路径与 GeneratePath 一致的文件，忽略上传中的 .tmp 文件和隔离区。
+func (e *LocalEngine) Walk(fn func(entry BlobEntry) error) error {
+	return filepath.WalkDir(e.basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == QuarantineDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		hash := d.Name()
+		if ValidateHash(hash) != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(e.basePath, path)
+		if err != nil {
+			return nil
+		}
+		if expected, _ := GeneratePath(hash); filepath.ToSlash(rel) != expected {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // 遍历期间被删除
+			}
+			return err
+		}
+		return fn(BlobEntry{Hash: hash, Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+// Quarantine 将文件移动到 <basePath>/.quarantine/<hash>.<时间戳>
+func (e *LocalEngine) Quarantine(hash string) (string, error) {
+	relativePath, err := GeneratePath(hash)
+	if err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(e.basePath, relativePath)
+
+	dir := filepath.Join(e.basePath, QuarantineDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	target := filepath.Join(dir, fmt.Sprintf("%s.%d", hash, time.Now().UnixNano()))
+	if err := os.Rename(fullPath, target); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("file not found: %s", hash)
+		}
+		return "", fmt.Errorf("failed to quarantine file: %w", err)
+	}
+
+	// 尝试删除空目录（忽略错误）
+	parent := filepath.Dir(fullPath)
+	os.Remove(parent)
+	os.Remove(filepath.Dir(parent))
+
+	return filepath.ToSlash(strings.TrimPrefix(target, e.basePath+string(filepath.Separator))), nil
+}
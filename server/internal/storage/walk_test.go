@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestLocalEngineWalk 测试遍历本地存储
+func TestLocalEngineWalk(t *testing.T) {
+	tempDir := t.TempDir()
+	engine, _ := NewLocalEngine(tempDir)
+
+	hashes := []string{
+		"aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff",
+		"1122334455667788990011223344556677889900aabbccddeeff001122334455",
+	}
+	for _, hash := range hashes {
+		if err := engine.Put(hash, bytes.NewReader([]byte(hash))); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// 不应被遍历到的文件：上传中的临时文件、位置错误的文件、隔离区文件
+	stray := "ffeeddccbbaa00998877665544332211ffeeddccbbaa00998877665544332211"
+	os.WriteFile(filepath.Join(tempDir, "aa", "bb", hashes[0]+".tmp"), []byte("tmp"), 0644)
+	os.WriteFile(filepath.Join(tempDir, stray), []byte("misplaced"), 0644)
+	os.MkdirAll(filepath.Join(tempDir, QuarantineDir, "ff", "ee"), 0755)
+	os.WriteFile(filepath.Join(tempDir, QuarantineDir, "ff", "ee", stray), []byte("q"), 0644)
+
+	var got []string
+	err := engine.Walk(func(entry BlobEntry) error {
+		if entry.Size != int64(len(entry.Hash)) {
+			t.Errorf("Walk() size for %s = %d, want %d", entry.Hash, entry.Size, len(entry.Hash))
+		}
+		if entry.ModTime.IsZero() {
+			t.Errorf("Walk() returned zero ModTime for %s", entry.Hash)
+		}
+		got = append(got, entry.Hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	sort.Strings(got)
+	sort.Strings(hashes)
+	if len(got) != 2 || got[0] != hashes[0] || got[1] != hashes[1] {
+		t.Errorf("Walk() = %v, want %v", got, hashes)
+	}
+}
+
+// TestLocalEngineQuarantine 测试隔离本地文件
+func TestLocalEngineQuarantine(t *testing.T) {
+	tempDir := t.TempDir()
+	engine, _ := NewLocalEngine(tempDir)
+
+	hash := "aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff"
+	engine.Put(hash, bytes.NewReader([]byte("suspicious")))
+
+	location, err := engine.Quarantine(hash)
+	if err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+
+	if exists, _ := engine.Exists(hash); exists {
+		t.Error("Quarantine() did not remove file from storage")
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, filepath.FromSlash(location)))
+	if err != nil || string(data) != "suspicious" {
+		t.Errorf("quarantined file at %s not readable: %v", location, err)
+	}
+
+	// 隔离后的文件不会再被遍历到
+	engine.Walk(func(entry BlobEntry) error {
+		t.Errorf("Walk() returned quarantined file %s", entry.Hash)
+		return nil
+	})
+
+	if _, err := engine.Quarantine(hash); err == nil {
+		t.Error("Quarantine() should fail for missing file")
+	}
+}
+
+// TestMemoryEngineQuarantine 测试内存存储的遍历与隔离
+func TestMemoryEngineQuarantine(t *testing.T) {
+	engine := NewMemoryEngine()
+	hash := "aabbccddeeff1122334455667788990011223344556677889900aabbccddeeff"
+	engine.Put(hash, bytes.NewReader([]byte("data")))
+
+	count := 0
+	engine.Walk(func(entry BlobEntry) error {
+		count++
+		return nil
+	})
+	if count != 1 {
+		t.Errorf("Walk() visited %d entries, want 1", count)
+	}
+
+	if _, err := engine.Quarantine(hash); err != nil {
+		t.Fatalf("Quarantine() error = %v", err)
+	}
+	if engine.Count() != 0 || engine.QuarantinedCount() != 1 {
+		t.Errorf("Count() = %d, QuarantinedCount() = %d", engine.Count(), engine.QuarantinedCount())
+	}
+}
@@ -4,6 +4,10 @@
 //   - 清理 ref_count = 0 的 file_blobs
 //   - 删除对应的 CAS 物理文件
 //   - 清理过期的 share_sessions
+//   - 清理过期的秒传挑战
+//   - 释放过期的配额预占
+//   - 清理过期的下载会话（归还异常退出时未释放的下载名额）
+//   - 清理超过保留时间的未完成上传（分片会话与 Tus 上传）
 //   - 清理软删除超过 7 天的 files_metadata
 //
 // 作者: AhaVault Team
@@ -11,7 +15,12 @@
 package tasks
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"ahavault/server/internal/models"
@@ -19,16 +28,27 @@ import (
 	"gorm.io/gorm"
 )
 
+// defaultFragmentRetention 未完成上传的默认保留时间
+const defaultFragmentRetention = 24 * time.Hour
+
 // GarbageCollector 垃圾回收器
 type GarbageCollector struct {
 	db      *gorm.DB
 	storage storage.Engine
+
+	fragmentRetention time.Duration // 未完成上传自最后一次写入起的保留时间
+	tusDir            string        // Tus 上传目录，为空时不清理 Tus 上传
 }
 
 // GCResult 垃圾回收结果
 type GCResult struct {
 	OrphanBlobsDeleted   int   // 删除的孤儿文件数
 	ExpiredSharesDeleted int   // 删除的过期分享数
+	ChallengesDeleted    int   // 删除的过期秒传挑战数
+	ReservationsReleased int   // 释放的过期配额预占数
+	DownloadSlotsExpired int   // 清理的过期下载会话数
+	FragmentsDeleted     int   // 删除的未完成上传数
+	FragmentBytes        int64 // 未完成上传释放的临时空间 (bytes)
 	SoftDeletedCleaned   int   // 清理的软删除文件数
 	SpaceReclaimed       int64 // 释放的存储空间 (bytes)
 	Duration             time.Duration
@@ -38,9 +58,21 @@ type GCResult struct {
 // NewGarbageCollector 创建垃圾回收器
 func NewGarbageCollector(db *gorm.DB, storageEngine storage.Engine) *GarbageCollector {
 	return &GarbageCollector{
-		db:      db,
-		storage: storageEngine,
+		db:                db,
+		storage:           storageEngine,
+		fragmentRetention: defaultFragmentRetention,
+	}
+}
+
+// SetFragmentCleanup 设置未完成上传的清理参数
+//
+// retention 为 0 时使用默认值（24 小时）；tusDir 为空时只清理分片上传会话。
+func (gc *GarbageCollector) SetFragmentCleanup(tusDir string, retention time.Duration) {
+	if retention <= 0 {
+		retention = defaultFragmentRetention
 	}
+	gc.tusDir = tusDir
+	gc.fragmentRetention = retention
 }
 
 // Run 执行垃圾回收
@@ -49,6 +81,10 @@ func NewGarbageCollector(db *gorm.DB, storageEngine storage.Engine) *GarbageColl
 //  1. 清理软删除超过 7 天的 files_metadata（触发引用计数减少）
 //  2. 清理 ref_count = 0 的 file_blobs 和物理文件
 //  3. 清理过期的 share_sessions
+//  4. 清理过期的秒传挑战
+//  5. 释放过期的配额预占
+//  6. 清理过期的下载会话
+//  7. 清理超过保留时间的未完成上传
 func (gc *GarbageCollector) Run() *GCResult {
 	startTime := time.Now()
 	result := &GCResult{
@@ -88,6 +124,46 @@ func (gc *GarbageCollector) Run() *GCResult {
 		log.Printf("[GC] Cleaned %d expired shares", expiredCount)
 	}
 
+	// 4. 清理过期的秒传挑战
+	challengeCount, err := gc.cleanExpiredChallenges()
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		log.Printf("[GC] Error cleaning expired upload challenges: %v", err)
+	} else {
+		result.ChallengesDeleted = challengeCount
+		log.Printf("[GC] Cleaned %d expired upload challenges", challengeCount)
+	}
+
+	// 5. 释放过期的配额预占
+	reservationCount, err := gc.releaseExpiredReservations()
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		log.Printf("[GC] Error releasing expired quota reservations: %v", err)
+	} else {
+		result.ReservationsReleased = reservationCount
+		log.Printf("[GC] Released %d expired quota reservations", reservationCount)
+	}
+
+	// 6. 清理过期的下载会话
+	slotCount, err := gc.cleanExpiredDownloadSlots()
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		log.Printf("[GC] Error cleaning expired download sessions: %v", err)
+	} else {
+		result.DownloadSlotsExpired = slotCount
+		log.Printf("[GC] Cleaned %d expired download sessions", slotCount)
+	}
+
+	// 7. 清理未完成的上传
+	fragmentCount, fragmentBytes, err := gc.CleanUploadFragments()
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		log.Printf("[GC] Error cleaning upload fragments: %v", err)
+	}
+	result.FragmentsDeleted = fragmentCount
+	result.FragmentBytes = fragmentBytes
+	log.Printf("[GC] Cleaned %d abandoned uploads, reclaimed %d bytes", fragmentCount, fragmentBytes)
+
 	result.Duration = time.Since(startTime)
 	log.Printf("[GC] Garbage collection completed in %v", result.Duration)
 
@@ -202,3 +278,230 @@ func (gc *GarbageCollector) cleanExpiredShares() (int, error) {
 
 	return count, nil
 }
+
+// cleanExpiredChallenges 清理过期的秒传挑战
+func (gc *GarbageCollector) cleanExpiredChallenges() (int, error) {
+	result := gc.db.Where("expires_at < ?", time.Now()).Delete(&models.UploadChallenge{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return int(result.RowsAffected), nil
+}
+
+// releaseExpiredReservations 释放过期的配额预占
+//
+// 逐条释放以便归还对应用户的预占空间；与入库提交并发时只有一方生效。
+func (gc *GarbageCollector) releaseExpiredReservations() (int, error) {
+	var reservations []models.QuotaReservation
+	if err := gc.db.Where("expires_at < ?", time.Now()).Find(&reservations).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range reservations {
+		released, err := gc.releaseReservation(&reservations[i])
+		if err != nil {
+			return count, err
+		}
+		if released {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// releaseReservation 在事务中释放单个配额预占
+func (gc *GarbageCollector) releaseReservation(reservation *models.QuotaReservation) (bool, error) {
+	var released bool
+	err := gc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		released, err = reservation.Release(tx)
+		return err
+	})
+	return released, err
+}
+
+// releaseUploadReservation 释放上传 ID 对应的配额预占（不存在时忽略）
+func (gc *GarbageCollector) releaseUploadReservation(uploadID string) error {
+	var reservation models.QuotaReservation
+	err := gc.db.Where("id = ?", uploadID).Limit(1).Find(&reservation).Error
+	if err != nil || reservation.ID == "" {
+		return err
+	}
+	_, err = gc.releaseReservation(&reservation)
+	return err
+}
+
+// cleanExpiredDownloadSlots 清理过期的下载会话
+//
+// 仍占用名额的会话（进程在传输中退出）先归还名额，再删除所有过期会话。
+func (gc *GarbageCollector) cleanExpiredDownloadSlots() (int, error) {
+	now := time.Now()
+
+	var claimed []models.DownloadSlot
+	err := gc.db.Where("expires_at < ? AND status = ?", now, models.DownloadSlotClaimed).Find(&claimed).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range claimed {
+		err := gc.db.Transaction(func(tx *gorm.DB) error {
+			_, err := claimed[i].Release(tx)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result := gc.db.Where("expires_at < ? AND status <> ?", now, models.DownloadSlotClaimed).Delete(&models.DownloadSlot{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return int(result.RowsAffected), nil
+}
+
+// CleanUploadFragments 清理超过保留时间未写入的未完成上传
+//
+// 分片上传会话标记为 failed 并删除会话文件；Tus 上传删除数据文件和 .info 文件。
+// 两者预占的配额都会被释放。返回清理的上传数和释放的临时空间。
+func (gc *GarbageCollector) CleanUploadFragments() (int, int64, error) {
+	threshold := time.Now().Add(-gc.fragmentRetention)
+
+	count, reclaimed, err := gc.cleanStaleSessions(threshold)
+	if err != nil {
+		return count, reclaimed, err
+	}
+
+	if gc.tusDir != "" {
+		tusCount, tusReclaimed, err := gc.cleanStaleTusUploads(threshold)
+		count += tusCount
+		reclaimed += tusReclaimed
+		if err != nil {
+			return count, reclaimed, err
+		}
+	}
+	return count, reclaimed, nil
+}
+
+// cleanStaleSessions 清理陈旧的分片上传会话
+func (gc *GarbageCollector) cleanStaleSessions(threshold time.Time) (int, int64, error) {
+	var sessions []models.UploadSession
+	err := gc.db.Where("status = ? AND updated_at < ?", models.UploadStatusUploading, threshold).
+		Find(&sessions).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count := 0
+	var reclaimed int64
+	for _, session := range sessions {
+		// 以状态和更新时间为条件标记失败，期间有新的写入时放弃清理
+		result := gc.db.Model(&models.UploadSession{}).
+			Where("id = ? AND status = ? AND updated_at < ?", session.ID, models.UploadStatusUploading, threshold).
+			Updates(map[string]interface{}{
+				"status":     models.UploadStatusFailed,
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			log.Printf("[GC] Failed to expire upload session %s: %v", session.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if session.TempPath != "" {
+			reclaimed += removeFragment(session.TempPath)
+		}
+		if err := gc.releaseUploadReservation(session.ID.String()); err != nil {
+			log.Printf("[GC] Failed to release reservation for upload session %s: %v", session.ID, err)
+		}
+		count++
+	}
+
+	return count, reclaimed, nil
+}
+
+// cleanStaleTusUploads 清理陈旧的 Tus 上传
+//
+// 上传已完成且入库任务仍在排队或处理中时保留文件，由 TusProcessor 负责清理。
+func (gc *GarbageCollector) cleanStaleTusUploads(threshold time.Time) (int, int64, error) {
+	infos, err := filepath.Glob(filepath.Join(gc.tusDir, "*.info"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count := 0
+	var reclaimed int64
+	for _, infoPath := range infos {
+		uploadID := strings.TrimSuffix(filepath.Base(infoPath), ".info")
+		dataPath := filepath.Join(gc.tusDir, uploadID)
+
+		// 以数据文件的最后写入时间判断（数据文件不存在时使用 .info）
+		lastWrite, err := fragmentModTime(dataPath, infoPath)
+		if err != nil || lastWrite.After(threshold) {
+			continue
+		}
+
+		if !isTusUploadInfo(infoPath, uploadID) {
+			continue
+		}
+
+		var pending int64
+		err = gc.db.Model(&models.TusUploadJob{}).
+			Where("id = ? AND status IN ?", uploadID, []string{models.TusJobPending, models.TusJobProcessing}).
+			Count(&pending).Error
+		if err != nil {
+			return count, reclaimed, err
+		}
+		if pending > 0 {
+			continue
+		}
+
+		reclaimed += removeFragment(dataPath)
+		reclaimed += removeFragment(infoPath)
+		if err := gc.releaseUploadReservation(uploadID); err != nil {
+			log.Printf("[GC] Failed to release reservation for tus upload %s: %v", uploadID, err)
+		}
+		count++
+	}
+
+	return count, reclaimed, nil
+}
+
+// fragmentModTime 返回上传的最后写入时间
+func fragmentModTime(dataPath, infoPath string) (time.Time, error) {
+	stat, err := os.Stat(dataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		stat, err = os.Stat(infoPath)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return stat.ModTime(), nil
+}
+
+// isTusUploadInfo 检查文件是否为 tusd 写入的上传信息，避免误删目录中的其他文件
+func isTusUploadInfo(path string, uploadID string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var info struct {
+		ID string
+	}
+	return json.Unmarshal(data, &info) == nil && info.ID == uploadID
+}
+
+// removeFragment 删除临时文件，返回释放的字节数
+func removeFragment(path string) int64 {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("[GC] Failed to remove %s: %v", path, err)
+		return 0
+	}
+	return stat.Size()
+}
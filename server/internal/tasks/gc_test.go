@@ -4,12 +4,15 @@
 //   - 清理孤儿 blobs
 //   - 清理过期分享
 //   - 清理软删除文件
+//   - 清理废弃的上传分片
 //
 // 作者: AhaVault Team
 // 创建时间: 2026-02-06
 package tasks
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -38,6 +41,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			status TEXT NOT NULL DEFAULT 'active',
 			storage_quota INTEGER NOT NULL DEFAULT 10737418240,
 			storage_used INTEGER NOT NULL DEFAULT 0,
+			storage_reserved INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			last_login_at DATETIME
@@ -47,6 +51,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 			hash TEXT PRIMARY KEY,
 			store_path TEXT NOT NULL,
 			encrypted_dek TEXT NOT NULL,
+			key_id TEXT NOT NULL DEFAULT 'default',
 			size INTEGER NOT NULL,
 			mime_type TEXT,
 			ref_count INTEGER NOT NULL DEFAULT 1,
@@ -72,15 +77,118 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		CREATE TABLE share_sessions (
 			id TEXT PRIMARY KEY,
 			pickup_code TEXT NOT NULL UNIQUE,
+			link_token TEXT UNIQUE,
 			creator_id TEXT NOT NULL,
 			password_hash TEXT,
+			restricted BOOLEAN NOT NULL DEFAULT 0,
 			max_downloads INTEGER NOT NULL DEFAULT 0,
 			current_downloads INTEGER NOT NULL DEFAULT 0,
+			reserved_downloads INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			expires_at DATETIME NOT NULL,
 			stopped_at DATETIME,
 			FOREIGN KEY (creator_id) REFERENCES users(id)
 		);
+
+		CREATE TABLE scrub_reports (
+			id TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			triggered_by TEXT NOT NULL,
+			quarantine INTEGER NOT NULL DEFAULT 0,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			blobs_checked INTEGER NOT NULL DEFAULT 0,
+			bytes_verified INTEGER NOT NULL DEFAULT 0,
+			files_scanned INTEGER NOT NULL DEFAULT 0,
+			missing_count INTEGER NOT NULL DEFAULT 0,
+			orphan_count INTEGER NOT NULL DEFAULT 0,
+			corrupted_count INTEGER NOT NULL DEFAULT 0,
+			error_count INTEGER NOT NULL DEFAULT 0,
+			quarantined_count INTEGER NOT NULL DEFAULT 0,
+			orphan_scan_skipped INTEGER NOT NULL DEFAULT 0,
+			issues TEXT,
+			error TEXT
+		);
+
+		CREATE TABLE storage_migrations (
+			id TEXT PRIMARY KEY,
+			source TEXT NOT NULL,
+			target TEXT NOT NULL,
+			status TEXT NOT NULL,
+			last_hash TEXT NOT NULL DEFAULT '',
+			started_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at DATETIME,
+			total_blobs INTEGER NOT NULL DEFAULT 0,
+			copied INTEGER NOT NULL DEFAULT 0,
+			skipped INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			bytes_copied INTEGER NOT NULL DEFAULT 0,
+			failures TEXT,
+			error TEXT
+		);
+
+		CREATE TABLE upload_sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'uploading',
+			upload_offset INTEGER NOT NULL DEFAULT 0,
+			upload_length INTEGER NOT NULL,
+			filename TEXT NOT NULL,
+			mime_type TEXT,
+			hash TEXT,
+			temp_path TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		);
+
+		CREATE TABLE tus_upload_jobs (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT,
+			file_id TEXT,
+			locked_by TEXT,
+			lease_expires_at DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		);
+
+		CREATE TABLE upload_challenges (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			nonce TEXT NOT NULL,
+			ranges TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE quota_reservations (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE download_slots (
+			id TEXT PRIMARY KEY,
+			share_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			bytes_sent INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
 	`).Error
 	require.NoError(t, err)
 
@@ -233,3 +341,181 @@ func TestGarbageCollector_CleanSoftDeletedFiles(t *testing.T) {
 	db.First(&updatedBlob, "hash = ?", blobHash)
 	assert.Equal(t, 0, updatedBlob.RefCount)
 }
+
+func TestGarbageCollector_ReleaseExpiredReservations(t *testing.T) {
+	db := setupTestDB(t)
+	gc := NewGarbageCollector(db, storage.NewMemoryEngine())
+
+	user := &models.User{
+		Email:           "reserve@test.com",
+		Password:        "hashed_password",
+		StorageQuota:    1000,
+		StorageReserved: 300,
+	}
+	require.NoError(t, db.Create(user).Error)
+
+	require.NoError(t, db.Create(&models.QuotaReservation{
+		ID:        "expired-upload",
+		UserID:    user.ID,
+		Size:      200,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}).Error)
+	require.NoError(t, db.Create(&models.QuotaReservation{
+		ID:        "active-upload",
+		UserID:    user.ID,
+		Size:      100,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}).Error)
+
+	result := gc.Run()
+	assert.Equal(t, 1, result.ReservationsReleased)
+	assert.Empty(t, result.Errors)
+
+	// 只归还过期预占的空间
+	var updated models.User
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(100), updated.StorageReserved)
+
+	var count int64
+	db.Model(&models.QuotaReservation{}).Where("id = ?", "active-upload").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestGarbageCollector_CleanUploadFragments(t *testing.T) {
+	db := setupTestDB(t)
+	tusDir := t.TempDir()
+	sessionDir := t.TempDir()
+	gc := NewGarbageCollector(db, storage.NewMemoryEngine())
+	gc.SetFragmentCleanup(tusDir, time.Hour)
+
+	user := &models.User{
+		Email:           "fragments@test.com",
+		Password:        "hashed_password",
+		StorageQuota:    1 << 20,
+		StorageReserved: 3000,
+	}
+	require.NoError(t, db.Create(user).Error)
+
+	stale := time.Now().Add(-2 * time.Hour)
+	reserve := func(id string, size int64) {
+		require.NoError(t, db.Create(&models.QuotaReservation{
+			ID: id, UserID: user.ID, Size: size, ExpiresAt: time.Now().Add(time.Hour),
+		}).Error)
+	}
+
+	// 分片上传会话：一个陈旧，一个仍在上传
+	newSession := func(name string, updatedAt time.Time) *models.UploadSession {
+		session := &models.UploadSession{
+			ID:           uuid.New(),
+			UserID:       user.ID,
+			Status:       models.UploadStatusUploading,
+			UploadOffset: 100,
+			UploadLength: 1000,
+			Filename:     name,
+		}
+		session.TempPath = filepath.Join(sessionDir, session.ID.String())
+		require.NoError(t, os.WriteFile(session.TempPath, make([]byte, 100), 0600))
+		require.NoError(t, db.Create(session).Error)
+		require.NoError(t, db.Model(session).UpdateColumn("updated_at", updatedAt).Error)
+		reserve(session.ID.String(), 1000)
+		return session
+	}
+	staleSession := newSession("stale.bin", stale)
+	activeSession := newSession("active.bin", time.Now())
+
+	// Tus 上传：一个陈旧，一个陈旧但已完成等待入库，外加一个无关文件
+	newTusUpload := func(id string, size int, modTime time.Time) {
+		dataPath := filepath.Join(tusDir, id)
+		infoPath := dataPath + ".info"
+		require.NoError(t, os.WriteFile(dataPath, make([]byte, size), 0600))
+		require.NoError(t, os.WriteFile(infoPath, []byte(`{"ID":"`+id+`","Size":1000}`), 0600))
+		require.NoError(t, os.Chtimes(dataPath, modTime, modTime))
+		require.NoError(t, os.Chtimes(infoPath, modTime, modTime))
+	}
+	newTusUpload("abandoned", 200, stale)
+	reserve("abandoned", 1000)
+	newTusUpload("queued", 1000, stale)
+	require.NoError(t, db.Create(&models.TusUploadJob{
+		ID: "queued", UserID: user.ID, Filename: "queued.bin", Size: 1000,
+		Status: models.TusJobPending, NextAttemptAt: time.Now(),
+	}).Error)
+	unrelated := filepath.Join(tusDir, "notes.info")
+	require.NoError(t, os.WriteFile(unrelated, []byte("not a tus upload"), 0600))
+	require.NoError(t, os.Chtimes(unrelated, stale, stale))
+
+	result := gc.Run()
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.FragmentsDeleted)
+
+	var failed, active models.UploadSession
+	require.NoError(t, db.First(&failed, "id = ?", staleSession.ID).Error)
+	assert.True(t, failed.IsFailed())
+	_, err := os.Stat(staleSession.TempPath)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, db.First(&active, "id = ?", activeSession.ID).Error)
+	assert.True(t, active.IsUploading())
+	_, err = os.Stat(activeSession.TempPath)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(tusDir, "abandoned"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(tusDir, "abandoned.info"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(tusDir, "queued"))
+	assert.NoError(t, err, "uploads waiting to be stored must be kept")
+	_, err = os.Stat(unrelated)
+	assert.NoError(t, err)
+
+	// 释放的临时空间：会话文件 100 字节 + Tus 数据 200 字节 + .info
+	assert.Greater(t, result.FragmentBytes, int64(300))
+
+	// 只有仍在上传的会话保留预占
+	var updated models.User
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(1000), updated.StorageReserved)
+}
+
+func TestGarbageCollector_ExpiredDownloadSlots(t *testing.T) {
+	db := setupTestDB(t)
+	gc := NewGarbageCollector(db, storage.NewMemoryEngine())
+
+	user := &models.User{Email: "slots@test.com", Password: "hashed_password"}
+	require.NoError(t, db.Create(user).Error)
+	share := &models.ShareSession{
+		PickupCode:        "SLOTS234",
+		CreatorID:         user.ID,
+		MaxDownloads:      1,
+		ReservedDownloads: 1,
+		ExpiresAt:         time.Now().Add(time.Hour),
+	}
+	require.NoError(t, db.Create(share).Error)
+
+	newSlot := func(status models.DownloadSlotStatus, expiresAt time.Time) *models.DownloadSlot {
+		slot := &models.DownloadSlot{
+			ID:        uuid.New(),
+			ShareID:   share.ID,
+			Status:    status,
+			ExpiresAt: expiresAt,
+		}
+		require.NoError(t, db.Create(slot).Error)
+		return slot
+	}
+	// 进程在传输中退出遗留的名额
+	newSlot(models.DownloadSlotClaimed, time.Now().Add(-time.Minute))
+	newSlot(models.DownloadSlotCommitted, time.Now().Add(-time.Minute))
+	active := newSlot(models.DownloadSlotCommitted, time.Now().Add(time.Hour))
+
+	result := gc.Run()
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.DownloadSlotsExpired)
+
+	var fresh models.ShareSession
+	require.NoError(t, db.First(&fresh, "id = ?", share.ID).Error)
+	assert.Equal(t, 0, fresh.ReservedDownloads)
+
+	var remaining []models.DownloadSlot
+	require.NoError(t, db.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, active.ID, remaining[0].ID)
+}
@@ -0,0 +1,276 @@
+// Package tasks 提供后台任务服务
+//
+// 本文件实现 KEK 轮换任务：
+//   - 将旧 KEK 加密的 DEK 解密后改用主密钥重新加密
+//   - 只修改 file_blobs 中的 encrypted_dek / key_id，不读写物理文件
+//   - 按哈希顺序分批处理，可随时中断，再次执行时自动从未完成的 blob 继续
+//   - 统计各 KEK 的引用数量，无引用的旧 KEK 即可从配置中移除
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ahavault/server/internal/crypto"
+	"ahavault/server/internal/models"
+	"gorm.io/gorm"
+)
+
+// defaultRewrapBatchSize 每批处理的 blob 数量
+const defaultRewrapBatchSize = 500
+
+// ErrRewrapRunning 轮换任务正在执行
+var ErrRewrapRunning = errors.New("key rewrap is already running")
+
+// KeyRotator KEK 轮换任务
+type KeyRotator struct {
+	db        *gorm.DB
+	keyring   *crypto.Keyring
+	batchSize int
+
+	mu       sync.Mutex
+	progress RewrapProgress
+}
+
+// RewrapResult 轮换任务结果
+type RewrapResult struct {
+	Rewrapped int   // 重新加密的 DEK 数
+	Failed    int   // 失败的 blob 数（如密钥缺失）
+	Remaining int64 // 仍由旧 KEK 加密的 blob 数
+	Duration  time.Duration
+	Errors    []error
+}
+
+// RewrapProgress 轮换任务进度
+type RewrapProgress struct {
+	Running    bool       `json:"running"`
+	PrimaryID  string     `json:"primary_key_id"`
+	Total      int64      `json:"total"`     // 本次开始时待处理的 blob 数
+	Processed  int64      `json:"processed"` // 已处理数（含失败）
+	Failed     int64      `json:"failed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// KeyUsage 单个 KEK 的使用情况
+type KeyUsage struct {
+	KeyID     string `json:"key_id"`
+	BlobCount int64  `json:"blob_count"`
+	Primary   bool   `json:"primary"`
+	Loaded    bool   `json:"loaded"`    // 是否已在密钥环中配置
+	Removable bool   `json:"removable"` // 非主密钥且没有 blob 引用，可从配置中移除
+}
+
+// NewKeyRotator 创建 KEK 轮换任务
+func NewKeyRotator(db *gorm.DB, keyring *crypto.Keyring) *KeyRotator {
+	return &KeyRotator{
+		db:        db,
+		keyring:   keyring,
+		batchSize: defaultRewrapBatchSize,
+		progress:  RewrapProgress{PrimaryID: keyring.PrimaryID()},
+	}
+}
+
+// Run 执行 KEK 轮换
+//
+// 将所有 key_id 不是主密钥的 blob 改用主密钥重新加密。
+// 同一时间只允许一个轮换任务执行，重复调用返回 ErrRewrapRunning。
+func (r *KeyRotator) Run() *RewrapResult {
+	startTime := time.Now()
+	result := &RewrapResult{
+		Errors: make([]error, 0),
+	}
+
+	primary := r.keyring.PrimaryID()
+	total, err := r.countPending(primary)
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		return result
+	}
+
+	if !r.begin(total, startTime) {
+		result.Errors = append(result.Errors, ErrRewrapRunning)
+		return result
+	}
+	defer r.finish()
+
+	log.Printf("[Rewrap] Starting key rewrap to %q, %d blobs pending...", primary, total)
+
+	// 以哈希为游标分批处理，失败的 blob 不会在本次任务中被反复重试
+	cursor := ""
+	for {
+		var blobs []models.FileBlob
+		err := r.db.Select("hash", "encrypted_dek", "key_id").
+			Where("key_id <> ? AND hash > ?", primary, cursor).
+			Order("hash ASC").
+			Limit(r.batchSize).
+			Find(&blobs).Error
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to list blobs: %w", err))
+			r.recordError(err)
+			break
+		}
+		if len(blobs) == 0 {
+			break
+		}
+
+		for _, blob := range blobs {
+			if err := r.rewrapBlob(&blob); err != nil {
+				result.Failed++
+				result.Errors = append(result.Errors, err)
+				r.recordError(err)
+				log.Printf("[Rewrap] %v", err)
+			} else {
+				result.Rewrapped++
+			}
+			r.advance(err != nil)
+		}
+		cursor = blobs[len(blobs)-1].Hash
+	}
+
+	if remaining, err := r.countPending(primary); err == nil {
+		result.Remaining = remaining
+	}
+	result.Duration = time.Since(startTime)
+	log.Printf("[Rewrap] Key rewrap completed in %v: rewrapped=%d, failed=%d, remaining=%d",
+		result.Duration, result.Rewrapped, result.Failed, result.Remaining)
+
+	return result
+}
+
+// rewrapBlob 重新加密单个 blob 的 DEK
+//
+// 更新时校验原 key_id，避免覆盖并发修改。
+func (r *KeyRotator) rewrapBlob(blob *models.FileBlob) error {
+	keyID, encryptedDEK, err := r.keyring.RewrapDEK(blob.KeyID, blob.EncryptedDEK)
+	if err != nil {
+		return fmt.Errorf("failed to rewrap blob %s (key %q): %w", blob.Hash, blob.KeyID, err)
+	}
+
+	err = r.db.Model(&models.FileBlob{}).
+		Where("hash = ? AND key_id = ?", blob.Hash, blob.KeyID).
+		Updates(map[string]interface{}{
+			"encrypted_dek": encryptedDEK,
+			"key_id":        keyID,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update blob %s: %w", blob.Hash, err)
+	}
+	return nil
+}
+
+// countPending 统计仍由非主密钥加密的 blob 数
+func (r *KeyRotator) countPending(primary string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.FileBlob{}).Where("key_id <> ?", primary).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending blobs: %w", err)
+	}
+	return count, nil
+}
+
+// KeyUsage 统计各 KEK 的引用情况
+//
+// 包含密钥环中所有密钥，以及数据库中引用了但未配置的密钥（这些 blob 无法解密）。
+func (r *KeyRotator) KeyUsage() ([]KeyUsage, error) {
+	var rows []struct {
+		KeyID string
+		Count int64
+	}
+	err := r.db.Model(&models.FileBlob{}).
+		Select("key_id, COUNT(*) AS count").
+		Group("key_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count key usage: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.KeyID] = row.Count
+	}
+
+	usage := make([]KeyUsage, 0, len(counts))
+	for _, id := range r.keyring.IDs() {
+		primary := id == r.keyring.PrimaryID()
+		usage = append(usage, KeyUsage{
+			KeyID:     id,
+			BlobCount: counts[id],
+			Primary:   primary,
+			Loaded:    true,
+			Removable: !primary && counts[id] == 0,
+		})
+		delete(counts, id)
+	}
+	for id, count := range counts {
+		usage = append(usage, KeyUsage{KeyID: id, BlobCount: count})
+	}
+
+	return usage, nil
+}
+
+// Progress 返回当前（或最近一次）轮换任务的进度
+func (r *KeyRotator) Progress() RewrapProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress
+}
+
+// IsRunning 检查轮换任务是否正在执行
+func (r *KeyRotator) IsRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress.Running
+}
+
+// begin 标记任务开始，已有任务执行时返回 false
+func (r *KeyRotator) begin(total int64, startedAt time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.progress.Running {
+		return false
+	}
+	r.progress = RewrapProgress{
+		Running:   true,
+		PrimaryID: r.keyring.PrimaryID(),
+		Total:     total,
+		StartedAt: &startedAt,
+	}
+	return true
+}
+
+// advance 记录一个 blob 处理完成
+func (r *KeyRotator) advance(failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress.Processed++
+	if failed {
+		r.progress.Failed++
+	}
+}
+
+// recordError 记录最近一次错误
+func (r *KeyRotator) recordError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.LastError = err.Error()
+}
+
+// finish 标记任务结束
+func (r *KeyRotator) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.progress.Running = false
+	r.progress.FinishedAt = &now
+}
@@ -0,0 +1,150 @@
+// Package tasks 提供后台任务测试
+//
+// 本文件测试 KEK 轮换任务：
+//   - 旧 KEK 加密的 DEK 被主密钥重新加密
+//   - 缺失密钥的 blob 被跳过且不影响其他 blob
+//   - 密钥使用统计
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"ahavault/server/internal/crypto"
+	"ahavault/server/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// createWrappedBlob 使用指定密钥环创建一个 blob，返回其明文 DEK
+func createWrappedBlob(t *testing.T, rotator *KeyRotator, keyring *crypto.Keyring, hash string) []byte {
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+
+	keyID, encryptedDEK, err := keyring.WrapDEK(dek)
+	require.NoError(t, err)
+
+	blob := &models.FileBlob{
+		Hash:         hash,
+		StorePath:    hash,
+		EncryptedDEK: encryptedDEK,
+		KeyID:        keyID,
+		Size:         1,
+		RefCount:     1,
+	}
+	require.NoError(t, rotator.db.Create(blob).Error)
+	return dek
+}
+
+func TestKeyRotator_Run(t *testing.T) {
+	db := setupTestDB(t)
+
+	oldRing, err := crypto.NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	require.NoError(t, err)
+	newRing, err := crypto.NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	require.NoError(t, err)
+
+	rotator := NewKeyRotator(db, newRing)
+	rotator.batchSize = 2 // 强制多批处理
+
+	deks := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		hash := fmt.Sprintf("hash-%d", i)
+		deks[hash] = createWrappedBlob(t, rotator, oldRing, hash)
+	}
+	// 已使用主密钥的 blob 不应被处理
+	deks["hash-new"] = createWrappedBlob(t, rotator, newRing, "hash-new")
+
+	result := rotator.Run()
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 5, result.Rewrapped)
+	assert.Equal(t, int64(0), result.Remaining)
+
+	var blobs []models.FileBlob
+	require.NoError(t, db.Find(&blobs).Error)
+	require.Len(t, blobs, 6)
+	for _, blob := range blobs {
+		assert.Equal(t, "k2", blob.KeyID)
+		dek, err := newRing.UnwrapDEK(blob.KeyID, blob.EncryptedDEK)
+		require.NoError(t, err)
+		assert.Equal(t, deks[blob.Hash], dek)
+	}
+
+	progress := rotator.Progress()
+	assert.False(t, progress.Running)
+	assert.Equal(t, int64(5), progress.Total)
+	assert.Equal(t, int64(5), progress.Processed)
+	assert.NotNil(t, progress.FinishedAt)
+
+	// 再次执行无事可做
+	result = rotator.Run()
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 0, result.Rewrapped)
+}
+
+func TestKeyRotator_UnknownKey(t *testing.T) {
+	db := setupTestDB(t)
+
+	lostRing, err := crypto.NewKeyring("lost", map[string][]byte{"lost": testKey(9)})
+	require.NoError(t, err)
+	oldRing, err := crypto.NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	require.NoError(t, err)
+	ring, err := crypto.NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	require.NoError(t, err)
+
+	rotator := NewKeyRotator(db, ring)
+	createWrappedBlob(t, rotator, lostRing, "hash-a")
+	createWrappedBlob(t, rotator, oldRing, "hash-b")
+
+	result := rotator.Run()
+	assert.Equal(t, 1, result.Rewrapped)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, int64(1), result.Remaining)
+	require.Len(t, result.Errors, 1)
+	assert.ErrorIs(t, result.Errors[0], crypto.ErrUnknownKeyID)
+
+	var blob models.FileBlob
+	require.NoError(t, db.First(&blob, "hash = ?", "hash-a").Error)
+	assert.Equal(t, "lost", blob.KeyID)
+}
+
+func TestKeyRotator_KeyUsage(t *testing.T) {
+	db := setupTestDB(t)
+
+	oldRing, err := crypto.NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	require.NoError(t, err)
+	ring, err := crypto.NewKeyring("k2", map[string][]byte{"k0": testKey(3), "k1": testKey(1), "k2": testKey(2)})
+	require.NoError(t, err)
+
+	rotator := NewKeyRotator(db, ring)
+	createWrappedBlob(t, rotator, oldRing, "hash-a")
+	createWrappedBlob(t, rotator, ring, "hash-b")
+	createWrappedBlob(t, rotator, ring, "hash-c")
+
+	usage, err := rotator.KeyUsage()
+	require.NoError(t, err)
+
+	byID := make(map[string]KeyUsage)
+	for _, u := range usage {
+		byID[u.KeyID] = u
+	}
+	require.Len(t, byID, 3)
+
+	assert.True(t, byID["k2"].Primary)
+	assert.Equal(t, int64(2), byID["k2"].BlobCount)
+	assert.False(t, byID["k2"].Removable)
+
+	assert.Equal(t, int64(1), byID["k1"].BlobCount)
+	assert.False(t, byID["k1"].Removable)
+
+	assert.Equal(t, int64(0), byID["k0"].BlobCount)
+	assert.True(t, byID["k0"].Removable)
+}
@@ -12,6 +12,7 @@ package tasks
 import (
 	"log"
 	"sync"
+	"time"
 
 	"ahavault/server/internal/storage"
 	"github.com/robfig/cron/v3"
@@ -25,6 +26,8 @@ type Scheduler struct {
 	storage   storage.Engine
 	gc        *GarbageCollector
 	lifecycle *LifecycleChecker
+	scrubber  *Scrubber
+	scrubSpec string
 	running   bool
 	mu        sync.Mutex
 }
@@ -40,6 +43,23 @@ func NewScheduler(db *gorm.DB, storageEngine storage.Engine) *Scheduler {
 	}
 }
 
+// SetScrubber 设置存储巡检任务及其 cron 表达式（需在 Start 之前调用）
+//
+// spec 为空时不定时执行，巡检仍可手动触发。
+func (s *Scheduler) SetScrubber(scrubber *Scrubber, spec string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scrubber = scrubber
+	s.scrubSpec = spec
+}
+
+// SetFragmentCleanup 设置未完成上传的清理参数（需在 Start 之前调用）
+func (s *Scheduler) SetFragmentCleanup(tusDir string, retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gc.SetFragmentCleanup(tusDir, retention)
+}
+
 // Start 启动调度器
 func (s *Scheduler) Start() error {
 	s.mu.Lock()
@@ -66,6 +86,19 @@ func (s *Scheduler) Start() error {
 		return err
 	}
 
+	// 每小时清理未完成的上传（完整 GC 每天执行一次，碎片需要更及时地释放配额和磁盘）
+	_, err = s.cron.AddFunc("30 * * * *", func() {
+		count, reclaimed, err := s.gc.CleanUploadFragments()
+		if err != nil {
+			log.Printf("[Scheduler] Upload fragment cleanup failed: %v", err)
+			return
+		}
+		log.Printf("[Scheduler] Upload fragment cleanup completed: uploads=%d, space=%d bytes", count, reclaimed)
+	})
+	if err != nil {
+		return err
+	}
+
 	// 每小时执行生命周期检查
 	_, err = s.cron.AddFunc("@hourly", func() {
 		log.Println("[Scheduler] Running scheduled lifecycle check...")
@@ -80,6 +113,20 @@ func (s *Scheduler) Start() error {
 		return err
 	}
 
+	// 按配置定时执行存储巡检
+	if s.scrubber != nil && s.scrubSpec != "" {
+		scrubber := s.scrubber
+		_, err = s.cron.AddFunc(s.scrubSpec, func() {
+			log.Println("[Scheduler] Running scheduled storage scrub...")
+			if _, err := scrubber.Run(ScrubTriggerScheduled, scrubber.DefaultQuarantine()); err != nil {
+				log.Printf("[Scheduler] Storage scrub failed: %v", err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	s.cron.Start()
 	s.running = true
 	log.Println("[Scheduler] Background task scheduler started")
@@ -0,0 +1,404 @@
+// Package tasks 提供后台任务服务
+//
+// 本文件实现存储巡检（Scrub）任务：
+//   - 缺失文件：file_blobs 有记录但存储中不存在
+//   - 孤儿文件：存储中存在但 file_blobs 无记录（需存储引擎支持遍历）
+//   - 内容损坏：无法解密，或解密后 SHA-256 与 hash 不一致（位衰减）
+//
+// 读取速率受限，避免占满磁盘 I/O；每次执行都会持久化一份报告。
+// 开启隔离后，缺失/损坏的 blob 会被标记为禁止（不再参与秒传与分享），
+// 孤儿文件会被移入存储隔离区，均不会直接删除数据。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"ahavault/server/internal/crypto"
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultScrubBatchSize 每批检查的 blob 数量
+	defaultScrubBatchSize = 200
+	// maxScrubIssues 报告中保存的异常明细上限（统计数不受影响）
+	maxScrubIssues = 1000
+)
+
+// 巡检触发方式
+const (
+	ScrubTriggerScheduled = "scheduled"
+	ScrubTriggerManual    = "manual"
+)
+
+// ErrScrubRunning 巡检任务正在执行
+var ErrScrubRunning = errors.New("storage scrub is already running")
+
+// ScrubOptions 巡检配置
+type ScrubOptions struct {
+	RateLimit   int64         // 读取速率上限（字节/秒），0 表示不限速
+	Quarantine  bool          // 是否默认隔离异常条目
+	OrphanGrace time.Duration // 修改时间在宽限期内的存储文件不视为孤儿
+}
+
+// Scrubber 存储巡检任务
+type Scrubber struct {
+	db        *gorm.DB
+	storage   storage.Engine
+	keyring   *crypto.Keyring
+	opts      ScrubOptions
+	batchSize int
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewScrubber 创建存储巡检任务
+func NewScrubber(db *gorm.DB, storageEngine storage.Engine, keyring *crypto.Keyring, opts ScrubOptions) *Scrubber {
+	return &Scrubber{
+		db:        db,
+		storage:   storageEngine,
+		keyring:   keyring,
+		opts:      opts,
+		batchSize: defaultScrubBatchSize,
+	}
+}
+
+// DefaultQuarantine 返回是否默认隔离异常条目
+func (s *Scrubber) DefaultQuarantine() bool {
+	return s.opts.Quarantine
+}
+
+// IsRunning 检查巡检任务是否正在执行
+func (s *Scrubber) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// scrubRun 单次巡检的执行状态
+type scrubRun struct {
+	report  *models.ScrubReport
+	issues  []models.ScrubIssue
+	limiter *byteRateLimiter
+}
+
+// addIssue 记录异常条目并更新统计
+func (r *scrubRun) addIssue(issue models.ScrubIssue) {
+	switch issue.Kind {
+	case models.ScrubIssueMissing:
+		r.report.MissingCount++
+	case models.ScrubIssueOrphan:
+		r.report.OrphanCount++
+	case models.ScrubIssueCorrupted:
+		r.report.CorruptedCount++
+	default:
+		r.report.ErrorCount++
+	}
+	if issue.Quarantined {
+		r.report.QuarantinedCount++
+	}
+	if len(r.issues) < maxScrubIssues {
+		r.issues = append(r.issues, issue)
+	}
+	log.Printf("[Scrub] %s: %s %s", issue.Kind, issue.Hash, issue.Detail)
+}
+
+// Run 执行存储巡检并持久化报告
+//
+// 同一时间只允许一个巡检任务执行，重复调用返回 ErrScrubRunning。
+func (s *Scrubber) Run(triggeredBy string, quarantine bool) (*models.ScrubReport, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, ErrScrubRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	startTime := time.Now()
+	run := &scrubRun{
+		report: &models.ScrubReport{
+			Status:      models.ScrubStatusRunning,
+			TriggeredBy: triggeredBy,
+			Quarantine:  quarantine,
+			StartedAt:   startTime,
+		},
+		issues:  make([]models.ScrubIssue, 0),
+		limiter: newByteRateLimiter(s.opts.RateLimit),
+	}
+	if err := s.db.Create(run.report).Error; err != nil {
+		return nil, fmt.Errorf("failed to create scrub report: %w", err)
+	}
+
+	log.Printf("[Scrub] Starting storage scrub (trigger=%s, quarantine=%v)...", triggeredBy, quarantine)
+
+	err := s.checkBlobs(run, quarantine)
+	if err == nil {
+		err = s.checkOrphans(run, startTime, quarantine)
+	}
+
+	finishedAt := time.Now()
+	run.report.FinishedAt = &finishedAt
+	run.report.Status = models.ScrubStatusCompleted
+	if err != nil {
+		run.report.Status = models.ScrubStatusFailed
+		run.report.Error = err.Error()
+		log.Printf("[Scrub] Storage scrub failed: %v", err)
+	}
+	if issues, jsonErr := json.Marshal(run.issues); jsonErr == nil {
+		run.report.Issues = issues
+	}
+	if saveErr := s.db.Save(run.report).Error; saveErr != nil {
+		return run.report, fmt.Errorf("failed to save scrub report: %w", saveErr)
+	}
+
+	log.Printf("[Scrub] Storage scrub finished in %v: checked=%d, missing=%d, orphans=%d, corrupted=%d, errors=%d, quarantined=%d",
+		finishedAt.Sub(startTime),
+		run.report.BlobsChecked,
+		run.report.MissingCount,
+		run.report.OrphanCount,
+		run.report.CorruptedCount,
+		run.report.ErrorCount,
+		run.report.QuarantinedCount)
+
+	return run.report, err
+}
+
+// checkBlobs 按哈希顺序分批检查数据库中的所有 blob
+func (s *Scrubber) checkBlobs(run *scrubRun, quarantine bool) error {
+	cursor := ""
+	for {
+		var blobs []models.FileBlob
+		err := s.db.Where("hash > ?", cursor).
+			Order("hash ASC").
+			Limit(s.batchSize).
+			Find(&blobs).Error
+		if err != nil {
+			return fmt.Errorf("failed to list blobs: %w", err)
+		}
+		if len(blobs) == 0 {
+			return nil
+		}
+
+		for i := range blobs {
+			s.checkBlob(run, &blobs[i], quarantine)
+		}
+		cursor = blobs[len(blobs)-1].Hash
+	}
+}
+
+// checkBlob 检查单个 blob 是否存在且内容完整
+func (s *Scrubber) checkBlob(run *scrubRun, blob *models.FileBlob, quarantine bool) {
+	run.report.BlobsChecked++
+
+	exists, err := s.storage.Exists(blob.Hash)
+	if err != nil {
+		run.addIssue(models.ScrubIssue{Kind: models.ScrubIssueError, Hash: blob.Hash, Size: blob.Size, Detail: err.Error()})
+		return
+	}
+	if !exists {
+		issue := models.ScrubIssue{Kind: models.ScrubIssueMissing, Hash: blob.Hash, Size: blob.Size, Detail: "blob not found in storage"}
+		if quarantine {
+			issue.Quarantined = s.banBlob(blob, "scrub: missing from storage")
+		}
+		run.addIssue(issue)
+		return
+	}
+
+	kind, detail := s.verifyContent(run, blob)
+	if kind == "" {
+		return
+	}
+	issue := models.ScrubIssue{Kind: kind, Hash: blob.Hash, Size: blob.Size, Detail: detail}
+	if kind == models.ScrubIssueCorrupted && quarantine {
+		issue.Quarantined = s.banBlob(blob, "scrub: content corrupted")
+	}
+	run.addIssue(issue)
+}
+
+// verifyContent 解密 blob 并校验明文的 SHA-256 与大小
+//
+// 返回空 kind 表示校验通过；存储读取失败或密钥缺失视为 error，
+// 解密失败或哈希/大小不一致视为 corrupted。
+func (s *Scrubber) verifyContent(run *scrubRun, blob *models.FileBlob) (string, string) {
+	dek, err := s.keyring.UnwrapDEK(blob.KeyID, blob.EncryptedDEK)
+	if err != nil {
+		return models.ScrubIssueError, fmt.Sprintf("failed to decrypt DEK: %v", err)
+	}
+	defer crypto.ZeroBytes(dek)
+
+	rc, err := s.storage.Get(blob.Hash)
+	if err != nil {
+		return models.ScrubIssueError, fmt.Sprintf("failed to open blob: %v", err)
+	}
+	defer rc.Close()
+
+	source := &trackingReader{r: rc, limiter: run.limiter}
+	plaintext, err := crypto.NewDecryptStreamReader(source, dek)
+	if err != nil {
+		if source.err != nil {
+			return models.ScrubIssueError, fmt.Sprintf("failed to read blob: %v", source.err)
+		}
+		return models.ScrubIssueCorrupted, fmt.Sprintf("failed to decrypt: %v", err)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, plaintext)
+	run.report.BytesVerified += source.n
+	if err != nil {
+		if source.err != nil {
+			return models.ScrubIssueError, fmt.Sprintf("failed to read blob: %v", source.err)
+		}
+		return models.ScrubIssueCorrupted, fmt.Sprintf("failed to decrypt: %v", err)
+	}
+
+	if size != blob.Size {
+		return models.ScrubIssueCorrupted, fmt.Sprintf("size mismatch: expected %d, got %d", blob.Size, size)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != blob.Hash {
+		return models.ScrubIssueCorrupted, fmt.Sprintf("hash mismatch: got %s", actual)
+	}
+	return "", ""
+}
+
+// checkOrphans 遍历存储，找出数据库中没有记录的文件
+func (s *Scrubber) checkOrphans(run *scrubRun, startTime time.Time, quarantine bool) error {
+	walker, ok := s.storage.(storage.Walker)
+	if !ok {
+		run.report.OrphanScanSkipped = true
+		log.Println("[Scrub] Storage engine does not support listing, orphan scan skipped")
+		return nil
+	}
+	quarantiner, canQuarantine := s.storage.(storage.Quarantiner)
+
+	err := walker.Walk(func(entry storage.BlobEntry) error {
+		run.report.FilesScanned++
+
+		// 刚写入的文件可能还没来得及创建数据库记录
+		if !entry.ModTime.IsZero() && startTime.Sub(entry.ModTime) < s.opts.OrphanGrace {
+			return nil
+		}
+
+		var count int64
+		if err := s.db.Model(&models.FileBlob{}).Where("hash = ?", entry.Hash).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check blob %s: %w", entry.Hash, err)
+		}
+		if count > 0 {
+			return nil
+		}
+
+		issue := models.ScrubIssue{Kind: models.ScrubIssueOrphan, Hash: entry.Hash, Size: entry.Size, Detail: "no database record"}
+		if quarantine && canQuarantine {
+			location, err := quarantiner.Quarantine(entry.Hash)
+			if err != nil {
+				issue.Detail = fmt.Sprintf("no database record; quarantine failed: %v", err)
+			} else {
+				issue.Quarantined = true
+				issue.Location = location
+			}
+		}
+		run.addIssue(issue)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk storage: %w", err)
+	}
+	return nil
+}
+
+// banBlob 将 blob 标记为禁止，已禁止的 blob 不重复处理
+func (s *Scrubber) banBlob(blob *models.FileBlob, reason string) bool {
+	if blob.IsBanned {
+		return false
+	}
+	if err := blob.Ban(s.db, reason); err != nil {
+		log.Printf("[Scrub] Failed to quarantine blob %s: %v", blob.Hash, err)
+		return false
+	}
+	return true
+}
+
+// LatestReports 返回最近的巡检报告（不含异常明细）
+func (s *Scrubber) LatestReports(limit int) ([]models.ScrubReport, error) {
+	var reports []models.ScrubReport
+	err := s.db.Omit("issues").
+		Order("started_at DESC").
+		Limit(limit).
+		Find(&reports).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scrub reports: %w", err)
+	}
+	return reports, nil
+}
+
+// GetReport 获取巡检报告详情
+func (s *Scrubber) GetReport(id string) (*models.ScrubReport, error) {
+	var report models.ScrubReport
+	if err := s.db.First(&report, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// trackingReader 统计读取字节数、限速，并记录底层读取错误
+//
+// 用于区分存储 I/O 错误与解密失败。
+type trackingReader struct {
+	r       io.Reader
+	limiter *byteRateLimiter
+	n       int64
+	err     error
+}
+
+func (t *trackingReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	t.limiter.wait(n)
+	if err != nil && err != io.EOF {
+		t.err = err
+	}
+	return n, err
+}
+
+// byteRateLimiter 简单的字节速率限制器
+//
+// 按累计读取量计算应耗时间，读取过快时休眠补齐。
+type byteRateLimiter struct {
+	rate     int64
+	start    time.Time
+	consumed int64
+}
+
+func newByteRateLimiter(rate int64) *byteRateLimiter {
+	return &byteRateLimiter{rate: rate, start: time.Now()}
+}
+
+// wait 记录读取了 n 个字节，必要时阻塞
+func (l *byteRateLimiter) wait(n int) {
+	if l.rate <= 0 || n <= 0 {
+		return
+	}
+	l.consumed += int64(n)
+	expected := time.Duration(float64(l.consumed) / float64(l.rate) * float64(time.Second))
+	if sleep := expected - time.Since(l.start); sleep > 0 {
+		time.Sleep(sleep)
+	}
+}
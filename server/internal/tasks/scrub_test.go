@@ -0,0 +1,236 @@
+// Package tasks 提供后台任务测试
+//
+// 本文件测试存储巡检功能：
+//   - 缺失文件、孤儿文件、内容损坏的检测
+//   - 隔离异常条目
+//   - 报告持久化
+//   - 读取限速
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/crypto"
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// putEncryptedBlob 加密内容并写入存储与数据库，返回 blob 哈希
+func putEncryptedBlob(t *testing.T, db *gorm.DB, engine storage.Engine, keyring *crypto.Keyring, content []byte) string {
+	hash := crypto.CalculateSHA256(content)
+	dek, err := crypto.GenerateDEK()
+	require.NoError(t, err)
+
+	ciphertext, err := crypto.EncryptFile(content, dek)
+	require.NoError(t, err)
+	require.NoError(t, engine.Put(hash, bytes.NewReader(ciphertext)))
+
+	keyID, encryptedDEK, err := keyring.WrapDEK(dek)
+	require.NoError(t, err)
+	storePath, _ := storage.GeneratePath(hash)
+	require.NoError(t, db.Create(&models.FileBlob{
+		Hash:         hash,
+		StorePath:    storePath,
+		EncryptedDEK: encryptedDEK,
+		KeyID:        keyID,
+		Size:         int64(len(content)),
+		RefCount:     1,
+	}).Error)
+	return hash
+}
+
+// scrubFixture 创建包含健康、缺失、损坏、孤儿文件的存储
+type scrubFixture struct {
+	db        *gorm.DB
+	engine    *storage.MemoryEngine
+	keyring   *crypto.Keyring
+	healthy   string
+	missing   string
+	corrupted string
+	orphan    string
+}
+
+func newScrubFixture(t *testing.T) *scrubFixture {
+	f := &scrubFixture{
+		db:      setupTestDB(t),
+		engine:  storage.NewMemoryEngine(),
+		keyring: crypto.NewSingleKeyring(testKey(7)),
+	}
+
+	f.healthy = putEncryptedBlob(t, f.db, f.engine, f.keyring, []byte("healthy blob content"))
+
+	f.missing = putEncryptedBlob(t, f.db, f.engine, f.keyring, []byte("blob removed from storage"))
+	require.NoError(t, f.engine.Delete(f.missing))
+
+	// 翻转密文中的一个比特，模拟位衰减
+	f.corrupted = putEncryptedBlob(t, f.db, f.engine, f.keyring, bytes.Repeat([]byte("rot"), 1000))
+	rc, _ := f.engine.Get(f.corrupted)
+	ciphertext := new(bytes.Buffer)
+	ciphertext.ReadFrom(rc)
+	rc.Close()
+	damaged := ciphertext.Bytes()
+	damaged[len(damaged)/2] ^= 0x01
+	require.NoError(t, f.engine.Delete(f.corrupted))
+	require.NoError(t, f.engine.Put(f.corrupted, bytes.NewReader(damaged)))
+
+	f.orphan = crypto.CalculateSHA256([]byte("no database row"))
+	require.NoError(t, f.engine.Put(f.orphan, bytes.NewReader([]byte("garbage"))))
+
+	return f
+}
+
+func issuesByKind(t *testing.T, report *models.ScrubReport) map[string]models.ScrubIssue {
+	var issues []models.ScrubIssue
+	require.NoError(t, json.Unmarshal(report.Issues, &issues))
+	byKind := make(map[string]models.ScrubIssue)
+	for _, issue := range issues {
+		byKind[issue.Kind] = issue
+	}
+	return byKind
+}
+
+func TestScrubber_DetectsIssues(t *testing.T) {
+	f := newScrubFixture(t)
+	scrubber := NewScrubber(f.db, f.engine, f.keyring, ScrubOptions{})
+
+	report, err := scrubber.Run(ScrubTriggerManual, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ScrubStatusCompleted, report.Status)
+	assert.Equal(t, 3, report.BlobsChecked)
+	assert.Equal(t, 1, report.MissingCount)
+	assert.Equal(t, 1, report.CorruptedCount)
+	assert.Equal(t, 1, report.OrphanCount)
+	assert.Equal(t, 0, report.ErrorCount)
+	assert.Equal(t, 0, report.QuarantinedCount)
+	assert.Equal(t, 3, report.FilesScanned)
+	assert.NotNil(t, report.FinishedAt)
+
+	issues := issuesByKind(t, report)
+	assert.Equal(t, f.missing, issues[models.ScrubIssueMissing].Hash)
+	assert.Equal(t, f.corrupted, issues[models.ScrubIssueCorrupted].Hash)
+	assert.Equal(t, f.orphan, issues[models.ScrubIssueOrphan].Hash)
+
+	// 未开启隔离时不修改任何数据
+	var banned int64
+	f.db.Model(&models.FileBlob{}).Where("is_banned = ?", true).Count(&banned)
+	assert.Equal(t, int64(0), banned)
+	assert.Equal(t, 0, f.engine.QuarantinedCount())
+
+	// 报告已持久化
+	saved, err := scrubber.GetReport(report.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, models.ScrubStatusCompleted, saved.Status)
+	assert.Equal(t, 1, saved.CorruptedCount)
+
+	reports, err := scrubber.LatestReports(10)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, report.ID, reports[0].ID)
+}
+
+func TestScrubber_Quarantine(t *testing.T) {
+	f := newScrubFixture(t)
+	scrubber := NewScrubber(f.db, f.engine, f.keyring, ScrubOptions{})
+
+	report, err := scrubber.Run(ScrubTriggerManual, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.QuarantinedCount)
+
+	for _, hash := range []string{f.missing, f.corrupted} {
+		var blob models.FileBlob
+		require.NoError(t, f.db.First(&blob, "hash = ?", hash).Error)
+		assert.True(t, blob.IsBanned, hash)
+		assert.Contains(t, blob.BanReason, "scrub")
+	}
+
+	var healthy models.FileBlob
+	require.NoError(t, f.db.First(&healthy, "hash = ?", f.healthy).Error)
+	assert.False(t, healthy.IsBanned)
+
+	// 孤儿文件被移入隔离区而不是删除
+	exists, _ := f.engine.Exists(f.orphan)
+	assert.False(t, exists)
+	assert.Equal(t, 1, f.engine.QuarantinedCount())
+	assert.NotEmpty(t, issuesByKind(t, report)[models.ScrubIssueOrphan].Location)
+
+	// 再次执行：已禁止的 blob 不重复隔离，孤儿文件已不存在
+	report, err = scrubber.Run(ScrubTriggerManual, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.QuarantinedCount)
+	assert.Equal(t, 0, report.OrphanCount)
+}
+
+func TestScrubber_OrphanGrace(t *testing.T) {
+	db := setupTestDB(t)
+	engine, err := storage.NewLocalEngine(t.TempDir())
+	require.NoError(t, err)
+	keyring := crypto.NewSingleKeyring(testKey(7))
+
+	putEncryptedBlob(t, db, engine, keyring, []byte("tracked"))
+	orphan := crypto.CalculateSHA256([]byte("upload in progress"))
+	require.NoError(t, engine.Put(orphan, bytes.NewReader([]byte("partial"))))
+
+	// 新写入的文件在宽限期内，不视为孤儿
+	scrubber := NewScrubber(db, engine, keyring, ScrubOptions{OrphanGrace: time.Hour})
+	report, err := scrubber.Run(ScrubTriggerScheduled, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.OrphanCount)
+	assert.Equal(t, 2, report.FilesScanned)
+
+	scrubber = NewScrubber(db, engine, keyring, ScrubOptions{})
+	report, err = scrubber.Run(ScrubTriggerScheduled, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.OrphanCount)
+	assert.Equal(t, 1, report.QuarantinedCount)
+}
+
+func TestScrubber_UnknownKeyIsNotCorruption(t *testing.T) {
+	db := setupTestDB(t)
+	engine := storage.NewMemoryEngine()
+	lost := crypto.NewSingleKeyring(testKey(1))
+	putEncryptedBlob(t, db, engine, lost, []byte("encrypted with a key we no longer have"))
+
+	keyring, err := crypto.NewKeyring("k2", map[string][]byte{"k2": testKey(2)})
+	require.NoError(t, err)
+	scrubber := NewScrubber(db, engine, keyring, ScrubOptions{})
+
+	report, err := scrubber.Run(ScrubTriggerManual, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.ErrorCount)
+	assert.Equal(t, 0, report.CorruptedCount)
+	assert.Equal(t, 0, report.QuarantinedCount)
+}
+
+func TestScrubber_RateLimit(t *testing.T) {
+	db := setupTestDB(t)
+	engine := storage.NewMemoryEngine()
+	keyring := crypto.NewSingleKeyring(testKey(7))
+	putEncryptedBlob(t, db, engine, keyring, bytes.Repeat([]byte("x"), 64*1024))
+
+	// 约 64KB 数据，限速 256KB/s，至少需要约 250ms
+	scrubber := NewScrubber(db, engine, keyring, ScrubOptions{RateLimit: 256 * 1024})
+	start := time.Now()
+	report, err := scrubber.Run(ScrubTriggerManual, false)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Greater(t, report.BytesVerified, int64(64*1024))
+}
+
+func TestScrubber_Running(t *testing.T) {
+	db := setupTestDB(t)
+	scrubber := NewScrubber(db, storage.NewMemoryEngine(), crypto.NewSingleKeyring(testKey(7)), ScrubOptions{})
+
+	scrubber.running = true
+	_, err := scrubber.Run(ScrubTriggerManual, false)
+	assert.ErrorIs(t, err, ErrScrubRunning)
+}
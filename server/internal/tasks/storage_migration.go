@@ -0,0 +1,336 @@
+// Package tasks 提供后台任务服务
+//
+// 本文件实现存储后端在线迁移任务：
+//   - 将 file_blobs 中的每个 blob 从源引擎复制到目标引擎
+//   - 复制后回读目标引擎，校验大小和 SHA-256
+//   - 进度记录在 storage_migrations 表中，中断后从上次位置继续
+//
+// 迁移期间服务端使用 storage.MigratingEngine 双读，新文件直接写入目标引擎，
+// 因此迁移无需停机。
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultMigrationBatchSize 每批迁移的 blob 数量（每批结束时保存一次进度）
+	defaultMigrationBatchSize = 100
+	// maxMigrationFailures 保存的失败明细上限
+	maxMigrationFailures = 1000
+)
+
+// StorageMigrator 存储后端迁移任务
+type StorageMigrator struct {
+	db         *gorm.DB
+	source     storage.Engine
+	target     storage.Engine
+	sourceName string
+	targetName string
+	batchSize  int
+	onProgress func(*models.StorageMigration)
+}
+
+// NewStorageMigrator 创建存储迁移任务
+//
+// sourceName / targetName 为存储类型（如 local、s3），用于识别可续传的迁移记录。
+func NewStorageMigrator(db *gorm.DB, source, target storage.Engine, sourceName, targetName string) *StorageMigrator {
+	return &StorageMigrator{
+		db:         db,
+		source:     source,
+		target:     target,
+		sourceName: sourceName,
+		targetName: targetName,
+		batchSize:  defaultMigrationBatchSize,
+	}
+}
+
+// SetProgressFunc 设置进度回调（每批完成后调用）
+func (m *StorageMigrator) SetProgressFunc(fn func(*models.StorageMigration)) {
+	m.onProgress = fn
+}
+
+// Latest 返回该源/目标组合最近一次的迁移记录，不存在时返回 nil
+func (m *StorageMigrator) Latest() (*models.StorageMigration, error) {
+	var migration models.StorageMigration
+	err := m.db.Where("source = ? AND target = ?", m.sourceName, m.targetName).
+		Order("started_at DESC").
+		First(&migration).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query storage migration: %w", err)
+	}
+	return &migration, nil
+}
+
+// Run 执行迁移
+//
+// 存在未完成（running/failed）的迁移记录时从其 LastHash 继续，否则新建一次迁移。
+// 单个 blob 失败不会中断迁移，失败数记录在结果中；重新执行会再次处理全部 blob，
+// 已迁移且校验一致的 blob 会被跳过。
+func (m *StorageMigrator) Run() (*models.StorageMigration, error) {
+	migration, failures, err := m.resumeOrCreate()
+	if err != nil {
+		return nil, err
+	}
+
+	if migration.LastHash != "" {
+		log.Printf("[Migrate] Resuming storage migration %s -> %s after %s", m.sourceName, m.targetName, migration.LastHash)
+	} else {
+		log.Printf("[Migrate] Starting storage migration %s -> %s, %d blobs", m.sourceName, m.targetName, migration.TotalBlobs)
+	}
+
+	for {
+		var blobs []models.FileBlob
+		err := m.db.Select("hash", "size").
+			Where("hash > ?", migration.LastHash).
+			Order("hash ASC").
+			Limit(m.batchSize).
+			Find(&blobs).Error
+		if err != nil {
+			return migration, m.fail(migration, failures, fmt.Errorf("failed to list blobs: %w", err))
+		}
+		if len(blobs) == 0 {
+			break
+		}
+
+		for _, blob := range blobs {
+			copied, n, err := m.migrateBlob(blob.Hash)
+			switch {
+			case err != nil:
+				migration.Failed++
+				if len(failures) < maxMigrationFailures {
+					failures = append(failures, models.StorageMigrationFailure{Hash: blob.Hash, Error: err.Error()})
+				}
+				log.Printf("[Migrate] Failed to migrate %s: %v", blob.Hash, err)
+			case copied:
+				migration.Copied++
+				migration.BytesCopied += n
+			default:
+				migration.Skipped++
+			}
+		}
+
+		migration.LastHash = blobs[len(blobs)-1].Hash
+		if err := m.save(migration, failures); err != nil {
+			return migration, err
+		}
+		if m.onProgress != nil {
+			m.onProgress(migration)
+		}
+	}
+
+	now := time.Now()
+	migration.Status = models.StorageMigrationCompleted
+	migration.FinishedAt = &now
+	if err := m.save(migration, failures); err != nil {
+		return migration, err
+	}
+
+	log.Printf("[Migrate] Storage migration %s -> %s completed: copied=%d, skipped=%d, failed=%d, bytes=%d",
+		m.sourceName, m.targetName, migration.Copied, migration.Skipped, migration.Failed, migration.BytesCopied)
+	return migration, nil
+}
+
+// resumeOrCreate 获取可续传的迁移记录或新建一条
+func (m *StorageMigrator) resumeOrCreate() (*models.StorageMigration, []models.StorageMigrationFailure, error) {
+	latest, err := m.Latest()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	failures := make([]models.StorageMigrationFailure, 0)
+	if latest != nil && latest.Status != models.StorageMigrationCompleted {
+		if len(latest.Failures) > 0 {
+			if err := json.Unmarshal(latest.Failures, &failures); err != nil {
+				failures = make([]models.StorageMigrationFailure, 0)
+			}
+		}
+		latest.Status = models.StorageMigrationRunning
+		latest.Error = ""
+		return latest, failures, nil
+	}
+
+	var total int64
+	if err := m.db.Model(&models.FileBlob{}).Count(&total).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count blobs: %w", err)
+	}
+
+	migration := &models.StorageMigration{
+		Source:     m.sourceName,
+		Target:     m.targetName,
+		Status:     models.StorageMigrationRunning,
+		StartedAt:  time.Now(),
+		TotalBlobs: total,
+	}
+	if err := m.db.Create(migration).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create storage migration: %w", err)
+	}
+	return migration, failures, nil
+}
+
+// migrateBlob 迁移单个 blob
+//
+// 返回是否发生了复制以及复制的字节数。目标中已存在且与源一致时跳过；
+// 源中不存在但目标中存在（迁移期间新上传的文件）时同样跳过。
+func (m *StorageMigrator) migrateBlob(hash string) (bool, int64, error) {
+	inSource, err := m.source.Exists(hash)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to check source: %w", err)
+	}
+	inTarget, err := m.target.Exists(hash)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to check target: %w", err)
+	}
+
+	if !inSource {
+		if inTarget {
+			return false, 0, nil
+		}
+		return false, 0, errors.New("blob not found in source or target")
+	}
+
+	if inTarget {
+		// 目标中已有副本（上次迁移中断前已完成，或迁移期间重新上传）
+		srcSum, srcSize, err := m.checksum(m.source, hash)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to read source: %w", err)
+		}
+		dstSum, dstSize, err := m.checksum(m.target, hash)
+		if err == nil && dstSum == srcSum && dstSize == srcSize {
+			return false, 0, nil
+		}
+		// 目标副本不完整或损坏，删除后重新复制
+		if err := m.target.Delete(hash); err != nil {
+			return false, 0, fmt.Errorf("failed to remove invalid target copy: %w", err)
+		}
+	}
+
+	n, err := m.copyBlob(hash)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, n, nil
+}
+
+// copyBlob 复制 blob 并回读校验，校验失败时删除目标副本
+func (m *StorageMigrator) copyBlob(hash string) (int64, error) {
+	info, err := m.source.Stat(hash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	rc, err := m.source.Get(hash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source: %w", err)
+	}
+	defer rc.Close()
+
+	counter := &countingHashReader{r: rc, h: sha256.New()}
+	if err := m.target.Put(hash, counter); err != nil {
+		return 0, fmt.Errorf("failed to write target: %w", err)
+	}
+	srcSum := hex.EncodeToString(counter.h.Sum(nil))
+
+	verifyErr := func() error {
+		if counter.n != info.Size {
+			return fmt.Errorf("source size mismatch: expected %d, read %d", info.Size, counter.n)
+		}
+		dstInfo, err := m.target.Stat(hash)
+		if err != nil {
+			return fmt.Errorf("failed to stat target: %w", err)
+		}
+		if dstInfo.Size != info.Size {
+			return fmt.Errorf("size mismatch: expected %d, target has %d", info.Size, dstInfo.Size)
+		}
+		dstSum, _, err := m.checksum(m.target, hash)
+		if err != nil {
+			return fmt.Errorf("failed to read back target: %w", err)
+		}
+		if dstSum != srcSum {
+			return errors.New("checksum mismatch after copy")
+		}
+		return nil
+	}()
+	if verifyErr != nil {
+		if err := m.target.Delete(hash); err != nil {
+			log.Printf("[Migrate] Failed to remove unverified copy %s: %v", hash, err)
+		}
+		return 0, verifyErr
+	}
+
+	return counter.n, nil
+}
+
+// checksum 计算引擎中 blob（密文）的 SHA-256 和大小
+func (m *StorageMigrator) checksum(engine storage.Engine, hash string) (string, int64, error) {
+	rc, err := engine.Get(hash)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// save 保存迁移进度
+func (m *StorageMigrator) save(migration *models.StorageMigration, failures []models.StorageMigrationFailure) error {
+	data, err := json.Marshal(failures)
+	if err != nil {
+		return err
+	}
+	migration.Failures = data
+	migration.UpdatedAt = time.Now()
+	if err := m.db.Save(migration).Error; err != nil {
+		return fmt.Errorf("failed to save storage migration: %w", err)
+	}
+	return nil
+}
+
+// fail 将迁移标记为失败并保存（LastHash 保留，可续传）
+func (m *StorageMigrator) fail(migration *models.StorageMigration, failures []models.StorageMigrationFailure, cause error) error {
+	migration.Status = models.StorageMigrationFailed
+	migration.Error = cause.Error()
+	if err := m.save(migration, failures); err != nil {
+		log.Printf("[Migrate] %v", err)
+	}
+	return cause
+}
+
+// countingHashReader 读取时同时计算字节数和哈希
+type countingHashReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func (c *countingHashReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.h.Write(p[:n])
+		c.n += int64(n)
+	}
+	return n, err
+}
@@ -0,0 +1,194 @@
+// Package tasks 提供后台任务测试
+//
+// 本文件测试存储后端迁移：
+//   - 复制并校验所有 blob
+//   - 中断后续传
+//   - 跳过已迁移的 blob、修复损坏的目标副本
+//   - 失败的 blob 不影响其他 blob
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/crypto"
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedSourceBlobs 在源引擎和数据库中创建 n 个 blob，返回按 hash 排序的列表
+func seedSourceBlobs(t *testing.T, db *gorm.DB, source storage.Engine, n int) []string {
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		content := []byte(fmt.Sprintf("ciphertext-%d", i))
+		hash := crypto.CalculateSHA256(content)
+		require.NoError(t, source.Put(hash, bytes.NewReader(content)))
+		require.NoError(t, db.Create(&models.FileBlob{
+			Hash:         hash,
+			StorePath:    hash,
+			EncryptedDEK: "dek",
+			Size:         int64(len(content)),
+			RefCount:     1,
+		}).Error)
+		hashes = append(hashes, hash)
+	}
+
+	var sorted []string
+	db.Model(&models.FileBlob{}).Order("hash ASC").Pluck("hash", &sorted)
+	return sorted
+}
+
+func readBlob(t *testing.T, engine storage.Engine, hash string) []byte {
+	rc, err := engine.Get(hash)
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return data
+}
+
+func TestStorageMigrator_Run(t *testing.T) {
+	db := setupTestDB(t)
+	source, target := storage.NewMemoryEngine(), storage.NewMemoryEngine()
+	hashes := seedSourceBlobs(t, db, source, 5)
+
+	migrator := NewStorageMigrator(db, source, target, "local", "s3")
+	migrator.batchSize = 2
+	progressCalls := 0
+	migrator.SetProgressFunc(func(*models.StorageMigration) { progressCalls++ })
+
+	migration, err := migrator.Run()
+	require.NoError(t, err)
+	assert.Equal(t, models.StorageMigrationCompleted, migration.Status)
+	assert.Equal(t, int64(5), migration.TotalBlobs)
+	assert.Equal(t, int64(5), migration.Copied)
+	assert.Equal(t, int64(0), migration.Failed)
+	assert.Equal(t, hashes[4], migration.LastHash)
+	assert.NotNil(t, migration.FinishedAt)
+	assert.Equal(t, 3, progressCalls)
+
+	for _, hash := range hashes {
+		assert.Equal(t, readBlob(t, source, hash), readBlob(t, target, hash))
+	}
+
+	// 进度已持久化
+	latest, err := migrator.Latest()
+	require.NoError(t, err)
+	assert.Equal(t, migration.ID, latest.ID)
+	assert.Equal(t, int64(5), latest.Copied)
+
+	// 完成后再次执行会新建一次迁移，全部跳过
+	again, err := migrator.Run()
+	require.NoError(t, err)
+	assert.NotEqual(t, migration.ID, again.ID)
+	assert.Equal(t, int64(0), again.Copied)
+	assert.Equal(t, int64(5), again.Skipped)
+}
+
+func TestStorageMigrator_Resume(t *testing.T) {
+	db := setupTestDB(t)
+	source, target := storage.NewMemoryEngine(), storage.NewMemoryEngine()
+	hashes := seedSourceBlobs(t, db, source, 4)
+
+	// 模拟进程在处理完前两个 blob 后崩溃
+	for _, hash := range hashes[:2] {
+		require.NoError(t, target.Put(hash, bytes.NewReader(readBlob(t, source, hash))))
+	}
+	crashed := &models.StorageMigration{
+		Source:     "local",
+		Target:     "s3",
+		Status:     models.StorageMigrationRunning,
+		LastHash:   hashes[1],
+		StartedAt:  time.Now().Add(-time.Hour),
+		TotalBlobs: 4,
+		Copied:     2,
+	}
+	require.NoError(t, db.Create(crashed).Error)
+
+	migration, err := NewStorageMigrator(db, source, target, "local", "s3").Run()
+	require.NoError(t, err)
+	assert.Equal(t, crashed.ID, migration.ID)
+	assert.Equal(t, int64(4), migration.Copied)
+	assert.Equal(t, int64(0), migration.Skipped)
+	assert.Equal(t, models.StorageMigrationCompleted, migration.Status)
+	assert.Equal(t, 4, target.Count())
+
+	// 不同的源/目标组合不会续传该记录
+	other, err := NewStorageMigrator(db, target, source, "s3", "local").Run()
+	require.NoError(t, err)
+	assert.NotEqual(t, crashed.ID, other.ID)
+}
+
+func TestStorageMigrator_RepairsAndSkips(t *testing.T) {
+	db := setupTestDB(t)
+	source, target := storage.NewMemoryEngine(), storage.NewMemoryEngine()
+	hashes := seedSourceBlobs(t, db, source, 3)
+
+	// hashes[0]: 已正确迁移；hashes[1]: 目标副本损坏
+	require.NoError(t, target.Put(hashes[0], bytes.NewReader(readBlob(t, source, hashes[0]))))
+	require.NoError(t, target.Put(hashes[1], bytes.NewReader([]byte("truncated"))))
+
+	// 迁移期间上传的新文件只存在于目标中
+	fresh := crypto.CalculateSHA256([]byte("uploaded during migration"))
+	require.NoError(t, target.Put(fresh, bytes.NewReader([]byte("uploaded during migration"))))
+	require.NoError(t, db.Create(&models.FileBlob{Hash: fresh, StorePath: fresh, EncryptedDEK: "dek", Size: 1, RefCount: 1}).Error)
+
+	migration, err := NewStorageMigrator(db, source, target, "local", "s3").Run()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), migration.Copied)
+	assert.Equal(t, int64(2), migration.Skipped)
+	assert.Equal(t, int64(0), migration.Failed)
+	assert.Equal(t, readBlob(t, source, hashes[1]), readBlob(t, target, hashes[1]))
+}
+
+// corruptingEngine 写入时篡改数据，用于验证回读校验
+type corruptingEngine struct {
+	*storage.MemoryEngine
+}
+
+func (e corruptingEngine) Put(hash string, reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	data[0] ^= 0xFF
+	return e.MemoryEngine.Put(hash, bytes.NewReader(data))
+}
+
+func TestStorageMigrator_Failures(t *testing.T) {
+	db := setupTestDB(t)
+	source := storage.NewMemoryEngine()
+	target := corruptingEngine{storage.NewMemoryEngine()}
+	seedSourceBlobs(t, db, source, 2)
+
+	lost := crypto.CalculateSHA256([]byte("lost"))
+	require.NoError(t, db.Create(&models.FileBlob{Hash: lost, StorePath: lost, EncryptedDEK: "dek", Size: 4, RefCount: 1}).Error)
+
+	migration, err := NewStorageMigrator(db, source, target, "local", "s3").Run()
+	require.NoError(t, err)
+	assert.Equal(t, models.StorageMigrationCompleted, migration.Status)
+	assert.Equal(t, int64(0), migration.Copied)
+	assert.Equal(t, int64(3), migration.Failed)
+
+	var failures []models.StorageMigrationFailure
+	require.NoError(t, json.Unmarshal(migration.Failures, &failures))
+	require.Len(t, failures, 3)
+	byHash := make(map[string]string)
+	for _, f := range failures {
+		byHash[f.Hash] = f.Error
+	}
+	assert.Contains(t, byHash[lost], "not found")
+
+	// 校验失败的副本已被删除
+	assert.Equal(t, 0, target.Count())
+}
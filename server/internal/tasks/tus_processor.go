@@ -0,0 +1,403 @@
+// Package tasks 提供后台任务服务
+//
+// 本文件实现 Tus 上传完成后的入库任务队列：
+//   - 每个完成的上传持久化一条 tus_upload_jobs 记录
+//   - 后台 worker 将临时文件加密入库，失败按指数退避重试
+//   - 处理中的任务由实例以租约持有并定期续期，租约过期（实例崩溃）后重新排队
+//   - 完成状态与文件元数据、配额在同一事务内提交，任务不会被重复入库
+//   - 成功或最终失败后删除 Tus 临时文件，避免残留
+//   - 入库时提交创建上传时预占的配额，最终失败时释放预占
+//
+// 作者: AhaVault Team
+// 创建时间: 2026-10-16
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// defaultTusMaxAttempts 默认最大尝试次数
+	defaultTusMaxAttempts = 5
+	// defaultTusBackoff 默认首次重试间隔，之后每次翻倍
+	defaultTusBackoff = 10 * time.Second
+	// maxTusBackoff 重试间隔上限
+	maxTusBackoff = 10 * time.Minute
+	// tusPollInterval 没有新任务通知时轮询到期任务的间隔
+	tusPollInterval = 5 * time.Second
+	// defaultTusJobLease 处理中任务的租约时长，持有实例每 1/3 租约续期一次
+	defaultTusJobLease = 2 * time.Minute
+)
+
+var (
+	// ErrTusJobNotFound 入库任务不存在
+	ErrTusJobNotFound = errors.New("upload job not found")
+	// errTusLeaseLost 任务的租约已过期并被其他实例接手
+	errTusLeaseLost = errors.New("upload job lease lost")
+)
+
+// TusProcessorOptions 入库任务配置
+type TusProcessorOptions struct {
+	MaxAttempts int           // 最大尝试次数（含首次），0 使用默认值
+	Backoff     time.Duration // 首次重试间隔，0 使用默认值
+}
+
+// TusProcessor Tus 上传入库任务队列
+type TusProcessor struct {
+	db          *gorm.DB
+	fileService *services.FileService
+	uploadDir   string
+	opts        TusProcessorOptions
+	owner       string        // 本实例的租约持有者标识
+	lease       time.Duration // 任务租约时长
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewTusProcessor 创建入库任务队列
+func NewTusProcessor(db *gorm.DB, fileService *services.FileService, uploadDir string, opts TusProcessorOptions) *TusProcessor {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultTusMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultTusBackoff
+	}
+	return &TusProcessor{
+		db:          db,
+		fileService: fileService,
+		uploadDir:   uploadDir,
+		opts:        opts,
+		owner:       uuid.NewString(),
+		lease:       defaultTusJobLease,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// UploadDir 返回 Tus 临时文件目录
+func (p *TusProcessor) UploadDir() string {
+	return p.uploadDir
+}
+
+// Start 恢复租约已过期的任务并启动后台 worker
+func (p *TusProcessor) Start() error {
+	recovered, err := p.Recover()
+	if err != nil {
+		return err
+	}
+	if recovered > 0 {
+		log.Printf("[Tus] Re-queued %d interrupted upload jobs", recovered)
+	}
+
+	go p.loop()
+	return nil
+}
+
+// Stop 停止后台 worker（等待当前任务完成）
+func (p *TusProcessor) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+	})
+}
+
+// Recover 将租约已过期的 processing 任务重新排队
+//
+// 其他实例正在处理（租约仍在续期）的任务不受影响，多实例部署时任一实例
+// 重启都不会抢走其他实例的任务。
+func (p *TusProcessor) Recover() (int, error) {
+	now := time.Now()
+	result := p.db.Model(&models.TusUploadJob{}).
+		Where("status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", models.TusJobProcessing, now).
+		Updates(map[string]interface{}{
+			"status":           models.TusJobPending,
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+			"next_attempt_at":  now,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to recover upload jobs: %w", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// Enqueue 为完成的 Tus 上传创建入库任务
+//
+// 同一上传 ID 重复提交时保留已有任务（tusd 可能重复通知）。
+func (p *TusProcessor) Enqueue(uploadID string, userID uuid.UUID, filename string, size int64) (*models.TusUploadJob, error) {
+	now := time.Now()
+	job := &models.TusUploadJob{
+		ID:            uploadID,
+		UserID:        userID,
+		Filename:      filename,
+		Size:          size,
+		Status:        models.TusJobPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := p.db.Clauses(clause.OnConflict{DoNothing: true}).Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create upload job: %w", err)
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// GetJob 获取用户的入库任务
+func (p *TusProcessor) GetJob(uploadID string, userID uuid.UUID) (*models.TusUploadJob, error) {
+	var job models.TusUploadJob
+	err := p.db.Where("id = ? AND user_id = ?", uploadID, userID).First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTusJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload job: %w", err)
+	}
+	return &job, nil
+}
+
+// RunPending 处理所有到期的任务，返回处理的任务数
+func (p *TusProcessor) RunPending() int {
+	processed := 0
+	for {
+		var job models.TusUploadJob
+		err := p.db.Where("status = ? AND next_attempt_at <= ?", models.TusJobPending, time.Now()).
+			Order("next_attempt_at").
+			First(&job).Error
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("[Tus] Failed to fetch pending jobs: %v", err)
+			}
+			return processed
+		}
+
+		// 以状态为条件抢占任务并取得租约，多实例部署时只有一个实例会处理
+		now := time.Now()
+		result := p.db.Model(&models.TusUploadJob{}).
+			Where("id = ? AND status = ?", job.ID, models.TusJobPending).
+			Updates(map[string]interface{}{
+				"status":           models.TusJobProcessing,
+				"attempts":         gorm.Expr("attempts + 1"),
+				"locked_by":        p.owner,
+				"lease_expires_at": now.Add(p.lease),
+				"updated_at":       now,
+			})
+		if result.Error != nil {
+			log.Printf("[Tus] Failed to claim job %s: %v", job.ID, result.Error)
+			return processed
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		job.Attempts++
+		p.process(&job)
+		processed++
+	}
+}
+
+// loop 后台 worker：收到新任务通知或定时轮询时处理到期任务
+func (p *TusProcessor) loop() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(tusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// 接手租约过期（持有实例崩溃）的任务
+		if recovered, err := p.Recover(); err != nil {
+			log.Printf("[Tus] %v", err)
+		} else if recovered > 0 {
+			log.Printf("[Tus] Re-queued %d upload jobs with expired leases", recovered)
+		}
+		p.RunPending()
+
+		select {
+		case <-p.stop:
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// process 执行单个入库任务
+//
+// 完成状态在入库事务内写入（见 store），入库与完成标记要么都提交、要么都回滚，
+// 临时文件只在状态写入成功后删除。状态写入失败时任务保持 processing，
+// 临时文件和配额预占保持不变，租约过期后任务被重新排队。
+func (p *TusProcessor) process(job *models.TusUploadJob) {
+	stopLease := p.keepLease(job.ID)
+	metadata, err := p.store(job)
+	stopLease()
+
+	if errors.Is(err, errTusLeaseLost) {
+		log.Printf("[Tus] Upload %s: lease lost, leaving the job to its new owner", job.ID)
+		return
+	}
+	if err == nil {
+		p.removeUploadFiles(job.ID)
+		log.Printf("[Tus] Stored upload %s as file %s", job.ID, metadata.ID)
+		return
+	}
+
+	if isPermanentUploadError(err) || job.Attempts >= p.opts.MaxAttempts {
+		now := time.Now()
+		if updateErr := p.finish(p.db, job.ID, map[string]interface{}{
+			"status":       models.TusJobFailed,
+			"last_error":   err.Error(),
+			"completed_at": now,
+			"updated_at":   now,
+		}); updateErr != nil {
+			log.Printf("[Tus] Failed to mark upload %s as failed: %v", job.ID, updateErr)
+			return
+		}
+		p.removeUploadFiles(job.ID)
+		if err := p.fileService.ReleaseReservation(job.ID); err != nil {
+			log.Printf("[Tus] Warning: failed to release reservation for %s: %v", job.ID, err)
+		}
+		log.Printf("[Tus] Upload %s failed permanently after %d attempts: %v", job.ID, job.Attempts, err)
+		return
+	}
+
+	next := time.Now().Add(p.backoff(job.Attempts))
+	if updateErr := p.finish(p.db, job.ID, map[string]interface{}{
+		"status":          models.TusJobPending,
+		"last_error":      err.Error(),
+		"next_attempt_at": next,
+		"updated_at":      time.Now(),
+	}); updateErr != nil {
+		log.Printf("[Tus] Failed to reschedule upload %s: %v", job.ID, updateErr)
+		return
+	}
+	log.Printf("[Tus] Upload %s failed (attempt %d/%d), retrying at %s: %v",
+		job.ID, job.Attempts, p.opts.MaxAttempts, next.Format(time.RFC3339), err)
+}
+
+// store 将 Tus 临时文件加密入库，并提交以上传 ID 预占的配额
+//
+// 任务的完成状态在入库事务内写入：任务已不由本实例持有（租约过期后被其他实例
+// 接手或已完成）时入库回滚，避免同一上传被重复入库、重复计入配额。
+func (p *TusProcessor) store(job *models.TusUploadJob) (*models.FileMetadata, error) {
+	file, err := os.Open(p.uploadPath(job.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	return p.fileService.UploadReservedFile(job.UserID, job.Filename, job.Size, file, job.ID,
+		func(tx *gorm.DB, metadata *models.FileMetadata) error {
+			now := time.Now()
+			return p.finish(tx, job.ID, map[string]interface{}{
+				"status":       models.TusJobCompleted,
+				"file_id":      metadata.ID,
+				"last_error":   "",
+				"completed_at": now,
+				"updated_at":   now,
+			})
+		})
+}
+
+// finish 更新本实例持有的任务状态并释放租约
+//
+// 任务已不是本实例持有的 processing 任务时返回 errTusLeaseLost。
+func (p *TusProcessor) finish(db *gorm.DB, jobID string, updates map[string]interface{}) error {
+	updates["locked_by"] = nil
+	updates["lease_expires_at"] = nil
+	result := db.Model(&models.TusUploadJob{}).
+		Where("id = ? AND status = ? AND locked_by = ?", jobID, models.TusJobProcessing, p.owner).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update upload job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errTusLeaseLost
+	}
+	return nil
+}
+
+// keepLease 处理期间定期续期任务租约，返回停止续期的函数
+func (p *TusProcessor) keepLease(jobID string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(p.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				result := p.db.Model(&models.TusUploadJob{}).
+					Where("id = ? AND status = ? AND locked_by = ?", jobID, models.TusJobProcessing, p.owner).
+					Update("lease_expires_at", time.Now().Add(p.lease))
+				if result.Error != nil {
+					log.Printf("[Tus] Warning: failed to renew lease for %s: %v", jobID, result.Error)
+				} else if result.RowsAffected == 0 {
+					log.Printf("[Tus] Warning: lease for %s was lost while processing", jobID)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// backoff 第 attempt 次失败后的重试间隔
+func (p *TusProcessor) backoff(attempt int) time.Duration {
+	delay := p.opts.Backoff
+	for i := 1; i < attempt && delay < maxTusBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxTusBackoff {
+		delay = maxTusBackoff
+	}
+	return delay
+}
+
+// uploadPath 返回 Tus 上传的数据文件路径
+func (p *TusProcessor) uploadPath(uploadID string) string {
+	return filepath.Join(p.uploadDir, uploadID)
+}
+
+// removeUploadFiles 删除 Tus 上传的数据文件和 .info 文件
+func (p *TusProcessor) removeUploadFiles(uploadID string) {
+	for _, path := range []string{p.uploadPath(uploadID), p.uploadPath(uploadID) + ".info"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Tus] Warning: failed to remove %s: %v", path, err)
+		}
+	}
+}
+
+// isPermanentUploadError 判断是否为重试也无法恢复的错误
+func isPermanentUploadError(err error) bool {
+	return errors.Is(err, os.ErrNotExist) ||
+		errors.Is(err, services.ErrInsufficientStorage) ||
+		errors.Is(err, services.ErrMimeTypeNotAllowed)
+}
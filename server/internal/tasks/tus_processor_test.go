@@ -0,0 +1,284 @@
+package tasks
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ahavault/server/internal/models"
+	"ahavault/server/internal/services"
+	"ahavault/server/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var tusTestKEK = []byte("test-master-key-1234567890123456")
+
+// unavailableEngine 写入总是失败的存储引擎
+type unavailableEngine struct {
+	storage.Engine
+}
+
+func (unavailableEngine) Put(hash string, reader io.Reader) error {
+	io.Copy(io.Discard, reader)
+	return errors.New("storage unavailable")
+}
+
+// setupTusProcessor 创建入库任务队列和一个已完成的 Tus 上传文件
+func setupTusProcessor(t *testing.T, engine storage.Engine, content []byte) (*TusProcessor, *gorm.DB, *models.User, string) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	user := &models.User{Email: "tus@test.com", Password: "hash", StorageQuota: 1 << 30}
+	require.NoError(t, db.Create(user).Error)
+
+	uploadID := "a1b2c3d4e5f6"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, uploadID), content, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, uploadID+".info"), []byte("{}"), 0600))
+
+	fileService := services.NewFileService(db, engine, tusTestKEK)
+	processor := NewTusProcessor(db, fileService, dir, TusProcessorOptions{MaxAttempts: 3, Backoff: time.Minute})
+	return processor, db, user, uploadID
+}
+
+func TestTusProcessor_Completes(t *testing.T) {
+	content := []byte("tus upload content")
+	processor, db, user, uploadID := setupTusProcessor(t, storage.NewMemoryEngine(), content)
+	_, err := processor.fileService.ReserveStorage(user.ID, uploadID, int64(len(content)), time.Hour)
+	require.NoError(t, err)
+
+	_, err = processor.Enqueue(uploadID, user.ID, "tus.txt", int64(len(content)))
+	require.NoError(t, err)
+	// 重复通知不会创建新任务
+	_, err = processor.Enqueue(uploadID, user.ID, "tus.txt", int64(len(content)))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, processor.RunPending())
+
+	job, err := processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobCompleted, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	require.NotNil(t, job.FileID)
+	assert.NotNil(t, job.CompletedAt)
+
+	var metadata models.FileMetadata
+	require.NoError(t, db.First(&metadata, "id = ?", *job.FileID).Error)
+	assert.Equal(t, "tus.txt", metadata.Filename)
+
+	// 创建上传时预占的配额转为已用空间
+	var updated models.User
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(len(content)), updated.StorageUsed)
+	assert.Equal(t, int64(0), updated.StorageReserved)
+
+	// 临时文件已删除
+	_, err = os.Stat(filepath.Join(processor.UploadDir(), uploadID))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(processor.UploadDir(), uploadID+".info"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTusProcessor_RetryWithBackoff(t *testing.T) {
+	content := []byte("retry content")
+	processor, db, user, uploadID := setupTusProcessor(t, unavailableEngine{storage.NewMemoryEngine()}, content)
+
+	_, err := processor.Enqueue(uploadID, user.ID, "retry.txt", int64(len(content)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, processor.RunPending())
+
+	job, err := processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobPending, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Contains(t, job.LastError, "storage unavailable")
+	assert.True(t, job.NextAttemptAt.After(time.Now().Add(50*time.Second)))
+
+	// 未到重试时间不会处理
+	assert.Equal(t, 0, processor.RunPending())
+
+	// 存储恢复且到达重试时间后完成
+	processor.fileService = services.NewFileService(db, storage.NewMemoryEngine(), tusTestKEK)
+	require.NoError(t, db.Model(job).Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+	assert.Equal(t, 1, processor.RunPending())
+
+	job, err = processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobCompleted, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Empty(t, job.LastError)
+}
+
+func TestTusProcessor_FailsAfterMaxAttempts(t *testing.T) {
+	content := []byte("doomed content")
+	processor, db, user, uploadID := setupTusProcessor(t, unavailableEngine{storage.NewMemoryEngine()}, content)
+	_, err := processor.fileService.ReserveStorage(user.ID, uploadID, int64(len(content)), time.Hour)
+	require.NoError(t, err)
+
+	_, err = processor.Enqueue(uploadID, user.ID, "doomed.txt", int64(len(content)))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Model(&models.TusUploadJob{}).Where("id = ?", uploadID).
+			Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+		assert.Equal(t, 1, processor.RunPending())
+	}
+
+	job, err := processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobFailed, job.Status)
+	assert.Equal(t, 3, job.Attempts)
+	assert.Contains(t, job.LastError, "storage unavailable")
+	assert.Nil(t, job.FileID)
+
+	_, err = os.Stat(filepath.Join(processor.UploadDir(), uploadID))
+	assert.True(t, os.IsNotExist(err))
+
+	// 最终失败释放预占
+	var updated models.User
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(0), updated.StorageReserved)
+}
+
+func TestTusProcessor_MissingFileIsPermanent(t *testing.T) {
+	processor, _, user, _ := setupTusProcessor(t, storage.NewMemoryEngine(), []byte("x"))
+
+	_, err := processor.Enqueue("missing", user.ID, "missing.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, processor.RunPending())
+
+	job, err := processor.GetJob("missing", user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobFailed, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+}
+
+func TestTusProcessor_RecoverInterrupted(t *testing.T) {
+	content := []byte("interrupted content")
+	processor, db, user, uploadID := setupTusProcessor(t, storage.NewMemoryEngine(), content)
+
+	// 模拟进程在处理中途退出
+	require.NoError(t, db.Create(&models.TusUploadJob{
+		ID:            uploadID,
+		UserID:        user.ID,
+		Filename:      "interrupted.txt",
+		Size:          int64(len(content)),
+		Status:        models.TusJobProcessing,
+		Attempts:      1,
+		NextAttemptAt: time.Now().Add(-time.Hour),
+	}).Error)
+	assert.Equal(t, 0, processor.RunPending())
+
+	recovered, err := processor.Recover()
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	assert.Equal(t, 1, processor.RunPending())
+
+	job, err := processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobCompleted, job.Status)
+}
+
+func TestTusProcessor_Backoff(t *testing.T) {
+	processor := NewTusProcessor(nil, nil, "", TusProcessorOptions{Backoff: time.Second})
+	assert.Equal(t, time.Second, processor.backoff(1))
+	assert.Equal(t, 2*time.Second, processor.backoff(2))
+	assert.Equal(t, 8*time.Second, processor.backoff(4))
+	assert.Equal(t, maxTusBackoff, processor.backoff(100))
+	assert.Equal(t, defaultTusMaxAttempts, processor.opts.MaxAttempts)
+}
+
+func TestTusProcessor_RecoverOnlyExpiredLeases(t *testing.T) {
+	content := []byte("leased content")
+	processor, db, user, uploadID := setupTusProcessor(t, storage.NewMemoryEngine(), content)
+
+	// 其他实例正在处理（租约有效）
+	other := "other-instance"
+	leaseExpiresAt := time.Now().Add(time.Minute)
+	require.NoError(t, db.Create(&models.TusUploadJob{
+		ID:             uploadID,
+		UserID:         user.ID,
+		Filename:       "leased.txt",
+		Size:           int64(len(content)),
+		Status:         models.TusJobProcessing,
+		Attempts:       1,
+		NextAttemptAt:  time.Now().Add(-time.Hour),
+		LockedBy:       &other,
+		LeaseExpiresAt: &leaseExpiresAt,
+	}).Error)
+
+	recovered, err := processor.Recover()
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+	assert.Equal(t, 0, processor.RunPending())
+
+	// 租约过期（实例崩溃）后才会被接手
+	require.NoError(t, db.Model(&models.TusUploadJob{}).Where("id = ?", uploadID).
+		Update("lease_expires_at", time.Now().Add(-time.Second)).Error)
+	recovered, err = processor.Recover()
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	assert.Equal(t, 1, processor.RunPending())
+
+	job, err := processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobCompleted, job.Status)
+	assert.Nil(t, job.LockedBy)
+	assert.Nil(t, job.LeaseExpiresAt)
+}
+
+func TestTusProcessor_LostLeaseRollsBack(t *testing.T) {
+	content := []byte("contended content")
+	processor, db, user, uploadID := setupTusProcessor(t, storage.NewMemoryEngine(), content)
+	_, err := processor.fileService.ReserveStorage(user.ID, uploadID, int64(len(content)), time.Hour)
+	require.NoError(t, err)
+
+	_, err = processor.Enqueue(uploadID, user.ID, "contended.txt", int64(len(content)))
+	require.NoError(t, err)
+
+	// 另一实例接手同一任务并完成入库
+	rival := NewTusProcessor(db, processor.fileService, processor.UploadDir(), TusProcessorOptions{})
+	var job models.TusUploadJob
+	require.NoError(t, db.First(&job, "id = ?", uploadID).Error)
+	require.NoError(t, db.Model(&job).Updates(map[string]interface{}{
+		"status":           models.TusJobProcessing,
+		"attempts":         1,
+		"locked_by":        rival.owner,
+		"lease_expires_at": time.Now().Add(time.Minute),
+	}).Error)
+
+	// 原持有者的入库因租约丢失而回滚：不新增文件、不重复计入配额、不删除临时文件
+	processor.process(&job)
+
+	var files int64
+	require.NoError(t, db.Model(&models.FileMetadata{}).Count(&files).Error)
+	assert.Zero(t, files)
+	var updated models.User
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(0), updated.StorageUsed)
+	assert.Equal(t, int64(len(content)), updated.StorageReserved)
+	_, err = os.Stat(filepath.Join(processor.UploadDir(), uploadID))
+	assert.NoError(t, err)
+
+	// 新持有者完成入库，配额只计入一次
+	rival.process(&job)
+	got, err := processor.GetJob(uploadID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TusJobCompleted, got.Status)
+	require.NoError(t, db.Model(&models.FileMetadata{}).Count(&files).Error)
+	assert.Equal(t, int64(1), files)
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(len(content)), updated.StorageUsed)
+	assert.Equal(t, int64(0), updated.StorageReserved)
+
+	// 已完成的任务被旧持有者重跑同样回滚
+	processor.process(&job)
+	require.NoError(t, db.Model(&models.FileMetadata{}).Count(&files).Error)
+	assert.Equal(t, int64(1), files)
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.Equal(t, int64(len(content)), updated.StorageUsed)
+}
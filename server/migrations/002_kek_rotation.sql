@@ -0,0 +1,14 @@
+-- AhaVault Database Migration
+-- Version: 1.1.0
+-- Created: 2026-10-16
+-- Description: 支持 KEK 轮换，为每个物理文件记录加密 DEK 所用的密钥 ID
+
+-- ==========================================
+-- 物理文件表 (file_blobs) 增加 key_id
+-- ==========================================
+-- 已有数据均由原 APP_MASTER_KEY 加密，对应默认密钥 ID 'default'
+ALTER TABLE file_blobs ADD COLUMN IF NOT EXISTS key_id VARCHAR(64) DEFAULT 'default' NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_file_blobs_key_id ON file_blobs(key_id);
+
+COMMENT ON COLUMN file_blobs.key_id IS '加密 DEK 所用 KEK 的 ID，轮换完成且无引用后旧 KEK 可移除';
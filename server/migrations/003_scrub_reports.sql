@@ -0,0 +1,34 @@
+-- AhaVault Database Migration
+-- Version: 1.2.0
+-- Created: 2026-10-16
+-- Description: 存储巡检报告
+
+-- ==========================================
+-- 存储巡检报告表 (scrub_reports)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS scrub_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    status VARCHAR(20) NOT NULL,
+    triggered_by VARCHAR(20) NOT NULL,
+    quarantine BOOLEAN DEFAULT FALSE NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+
+    blobs_checked INT DEFAULT 0 NOT NULL,
+    bytes_verified BIGINT DEFAULT 0 NOT NULL,
+    files_scanned INT DEFAULT 0 NOT NULL,
+    missing_count INT DEFAULT 0 NOT NULL,
+    orphan_count INT DEFAULT 0 NOT NULL,
+    corrupted_count INT DEFAULT 0 NOT NULL,
+    error_count INT DEFAULT 0 NOT NULL,
+    quarantined_count INT DEFAULT 0 NOT NULL,
+    orphan_scan_skipped BOOLEAN DEFAULT FALSE NOT NULL,
+
+    issues JSONB,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_scrub_reports_status ON scrub_reports(status);
+CREATE INDEX IF NOT EXISTS idx_scrub_reports_started_at ON scrub_reports(started_at DESC);
+
+COMMENT ON TABLE scrub_reports IS '存储巡检报告：缺失文件、孤儿文件、内容损坏（位衰减）';
@@ -0,0 +1,32 @@
+-- AhaVault Database Migration
+-- Version: 1.3.0
+-- Created: 2026-10-16
+-- Description: 存储后端在线迁移任务
+
+-- ==========================================
+-- 存储迁移任务表 (storage_migrations)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS storage_migrations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    source VARCHAR(20) NOT NULL,
+    target VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    last_hash VARCHAR(64) DEFAULT '' NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+
+    total_blobs BIGINT DEFAULT 0 NOT NULL,
+    copied BIGINT DEFAULT 0 NOT NULL,
+    skipped BIGINT DEFAULT 0 NOT NULL,
+    failed BIGINT DEFAULT 0 NOT NULL,
+    bytes_copied BIGINT DEFAULT 0 NOT NULL,
+
+    failures JSONB,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_storage_migrations_pair ON storage_migrations(source, target);
+CREATE INDEX IF NOT EXISTS idx_storage_migrations_status ON storage_migrations(status);
+
+COMMENT ON TABLE storage_migrations IS '存储后端迁移任务，last_hash 为已完成的最后一个 blob hash，用于断点续传';
@@ -0,0 +1,22 @@
+-- AhaVault Database Migration
+-- Version: 1.4.0
+-- Created: 2026-10-16
+-- Description: 秒传持有证明挑战
+
+-- ==========================================
+-- 秒传挑战表 (upload_challenges)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS upload_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash VARCHAR(64) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    ranges JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_challenges_user ON upload_challenges(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_challenges_expires ON upload_challenges(expires_at);
+
+COMMENT ON TABLE upload_challenges IS '秒传持有证明挑战，单次有效，验证后删除';
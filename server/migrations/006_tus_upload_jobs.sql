@@ -0,0 +1,29 @@
+-- AhaVault Database Migration
+-- Version: 1.5.0
+-- Created: 2026-10-16
+-- Description: Tus 上传入库任务队列
+
+-- ==========================================
+-- Tus 入库任务表 (tus_upload_jobs)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS tus_upload_jobs (
+    id VARCHAR(64) PRIMARY KEY,  -- Tus 上传 ID
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+
+    status VARCHAR(20) NOT NULL,  -- pending/processing/completed/failed
+    attempts INT DEFAULT 0 NOT NULL,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_error TEXT,
+    file_id UUID REFERENCES files_metadata(id) ON DELETE SET NULL,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tus_upload_jobs_user ON tus_upload_jobs(user_id);
+CREATE INDEX IF NOT EXISTS idx_tus_upload_jobs_due ON tus_upload_jobs(status, next_attempt_at);
+
+COMMENT ON TABLE tus_upload_jobs IS 'Tus 上传完成后的加密入库任务，支持重试与重启恢复';
@@ -0,0 +1,27 @@
+-- AhaVault Database Migration
+-- Version: 1.6.0
+-- Created: 2026-10-16
+-- Description: 上传配额预占
+
+-- ==========================================
+-- 用户预占配额
+-- ==========================================
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_reserved BIGINT DEFAULT 0 NOT NULL;
+
+COMMENT ON COLUMN users.storage_reserved IS '进行中上传预占的配额，与 storage_used 之和不超过 storage_quota';
+
+-- ==========================================
+-- 配额预占表 (quota_reservations)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS quota_reservations (
+    id VARCHAR(64) PRIMARY KEY,  -- 上传 ID（分片上传会话 ID / Tus 上传 ID）
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_user ON quota_reservations(user_id);
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_expires ON quota_reservations(expires_at);
+
+COMMENT ON TABLE quota_reservations IS '进行中上传的配额预占，入库时转为已用空间，失败、取消或过期时释放';
@@ -0,0 +1,30 @@
+-- AhaVault Database Migration
+-- Version: 1.7.0
+-- Created: 2026-10-16
+-- Description: 分享下载名额与下载会话
+
+-- ==========================================
+-- 分享传输中占用的下载名额
+-- ==========================================
+ALTER TABLE share_sessions ADD COLUMN IF NOT EXISTS reserved_downloads INTEGER DEFAULT 0 NOT NULL;
+
+COMMENT ON COLUMN share_sessions.reserved_downloads IS '传输中占用的下载名额，与 current_downloads 之和不超过 max_downloads';
+
+-- ==========================================
+-- 下载会话表 (download_slots)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS download_slots (
+    id UUID PRIMARY KEY,  -- 下载会话 ID，续传时由客户端带回
+    share_id UUID NOT NULL REFERENCES share_sessions(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL,  -- 打包下载或转存时为全零 UUID
+    status VARCHAR(20) NOT NULL,  -- claimed / committed / released
+    bytes_sent BIGINT DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_download_slots_share ON download_slots(share_id);
+CREATE INDEX IF NOT EXISTS idx_download_slots_expires ON download_slots(expires_at);
+
+COMMENT ON TABLE download_slots IS '分享下载会话：传输中占用名额，完成或达到计数阈值时计入下载次数，中断时归还';
@@ -0,0 +1,18 @@
+-- AhaVault Database Migration
+-- Version: 1.8.0
+-- Created: 2026-10-16
+-- Description: 按用户覆盖的分享限制
+
+-- ==========================================
+-- 分享限制覆盖表 (share_policy_overrides)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS share_policy_overrides (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    max_share_expiry BIGINT,  -- 最大分享有效期（秒），NULL 使用全局配置，0 不限制
+    max_files_per_share INTEGER,  -- 单次分享最大文件数，NULL 使用全局配置，0 不限制
+    max_active_shares INTEGER,  -- 最大活跃分享数，NULL 使用全局配置，0 不限制
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+COMMENT ON TABLE share_policy_overrides IS '管理员为单个用户设置的分享限制，覆盖 MAX_SHARE_EXPIRY / MAX_FILES_PER_SHARE / MAX_ACTIVE_SHARES_USER';
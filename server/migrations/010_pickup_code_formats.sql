@@ -0,0 +1,54 @@
+-- AhaVault Database Migration
+-- Version: 1.9.0
+-- Created: 2026-10-17
+-- Description: 可配置长度的取件码、单词组合取件码与自定义取件码
+
+-- ==========================================
+-- 取件码列加宽（活跃分享视图依赖该列，需先删除再重建）
+-- ==========================================
+DROP VIEW IF EXISTS active_shares;
+
+ALTER TABLE share_sessions DROP CONSTRAINT IF EXISTS chk_pickup_code_format;
+ALTER TABLE share_sessions ALTER COLUMN pickup_code TYPE VARCHAR(32);
+
+-- 随机字符取件码：6-12 位，字符集 [2-9A-Z] 排除 O 和 I
+-- 单词组合与自定义取件码：6-32 位小写字母和数字，可用单个连字符分隔
+ALTER TABLE share_sessions ADD CONSTRAINT chk_pickup_code_format CHECK (
+    pickup_code ~ '^[2-9A-HJ-NP-Z]{6,12}$'
+    OR (pickup_code ~ '^[a-z0-9]+(-[a-z0-9]+)*$' AND length(pickup_code) BETWEEN 6 AND 32)
+);
+
+COMMENT ON COLUMN share_sessions.pickup_code IS '取件码（不区分大小写，保存规范化形式）：6-12 位随机字符（大写），或单词组合 / 自定义取件码（小写）';
+
+CREATE OR REPLACE VIEW active_shares AS
+SELECT
+    ss.id,
+    ss.pickup_code,
+    ss.creator_id,
+    u.email AS creator_email,
+    ss.created_at,
+    ss.expires_at,
+    ss.max_downloads,
+    ss.current_downloads,
+    COUNT(sf.file_id) AS file_count,
+    CASE
+        WHEN ss.stopped_at IS NOT NULL THEN 'stopped'
+        WHEN ss.expires_at < NOW() THEN 'expired'
+        WHEN ss.max_downloads > 0 AND ss.current_downloads >= ss.max_downloads THEN 'exhausted'
+        ELSE 'active'
+    END AS status
+FROM share_sessions ss
+JOIN users u ON u.id = ss.creator_id
+LEFT JOIN share_files sf ON sf.share_id = ss.id
+GROUP BY ss.id, ss.pickup_code, ss.creator_id, u.email, ss.created_at, ss.expires_at, ss.max_downloads, ss.current_downloads, ss.stopped_at;
+
+COMMENT ON VIEW active_shares IS '活跃分享统计视图';
+
+-- ==========================================
+-- 取件码长度系统设置
+-- ==========================================
+-- 初始化时写入的默认值 8 会覆盖 SHARE_CODE_LENGTH，清空后使用启动配置；
+-- 管理员修改过的值保留，并优先于 SHARE_CODE_LENGTH
+UPDATE system_settings
+SET value = '', description = '取件码长度（6-12，为空时使用 SHARE_CODE_LENGTH；仅对随机字符格式生效）', updated_at = NOW()
+WHERE key = 'share_code_length' AND value = '8';
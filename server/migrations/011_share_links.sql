@@ -0,0 +1,15 @@
+-- AhaVault Database Migration
+-- Version: 1.10.0
+-- Created: 2026-10-17
+-- Description: 分享链接（取件码之外的第二种分享地址）
+
+-- ==========================================
+-- 分享链接令牌
+-- ==========================================
+-- 256 位随机数的 base64url 编码（43 个字符），NULL 表示未启用分享链接。
+-- 与取件码相互独立：撤销或重新生成链接不影响取件码。
+ALTER TABLE share_sessions ADD COLUMN IF NOT EXISTS link_token VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_share_sessions_link_token ON share_sessions(link_token);
+
+COMMENT ON COLUMN share_sessions.link_token IS '分享链接令牌（不可猜测的长随机串），NULL 表示未启用分享链接';
@@ -0,0 +1,30 @@
+-- AhaVault Database Migration
+-- Version: 1.11.0
+-- Created: 2026-10-17
+-- Description: 指定接收人的分享
+
+-- ==========================================
+-- 仅限接收人访问的分享
+-- ==========================================
+ALTER TABLE share_sessions ADD COLUMN IF NOT EXISTS restricted BOOLEAN DEFAULT FALSE NOT NULL;
+
+COMMENT ON COLUMN share_sessions.restricted IS '是否仅限指定的接收人（登录后）访问';
+
+-- ==========================================
+-- 分享接收人表 (share_recipients)
+-- ==========================================
+CREATE TABLE IF NOT EXISTS share_recipients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    share_id UUID NOT NULL REFERENCES share_sessions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,  -- 创建分享时接收人的邮箱（小写），仅用于展示
+    access_count INTEGER DEFAULT 0 NOT NULL,
+    first_accessed_at TIMESTAMP WITH TIME ZONE,
+    last_accessed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT idx_share_recipient UNIQUE (share_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_recipients_user_id ON share_recipients(user_id);
+
+COMMENT ON TABLE share_recipients IS '指定接收人分享的接收人及其访问记录';
@@ -0,0 +1,12 @@
+-- AhaVault Database Migration
+-- Version: 1.12.0
+-- Created: 2026-10-17
+-- Description: 秒传挑战记录声明的文件大小
+
+-- ==========================================
+-- 秒传挑战不再依赖物理文件是否存在：挑战区间按客户端声明的大小选取，
+-- 提交证明时大小与物理文件不符即视为校验失败
+-- ==========================================
+ALTER TABLE upload_challenges ADD COLUMN IF NOT EXISTS size BIGINT DEFAULT 0 NOT NULL;
+
+COMMENT ON COLUMN upload_challenges.size IS '客户端声明的文件大小，挑战区间据此选取';
@@ -0,0 +1,14 @@
+-- AhaVault Database Migration
+-- Version: 1.13.0
+-- Created: 2026-10-17
+-- Description: Tus 入库任务租约
+
+-- ==========================================
+-- 处理中的任务由实例以租约持有：持有实例定期续期，
+-- 只有租约过期（实例崩溃）的任务才会被重新排队
+-- ==========================================
+ALTER TABLE tus_upload_jobs ADD COLUMN IF NOT EXISTS locked_by VARCHAR(64);
+ALTER TABLE tus_upload_jobs ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+COMMENT ON COLUMN tus_upload_jobs.locked_by IS '持有处理中任务的实例标识';
+COMMENT ON COLUMN tus_upload_jobs.lease_expires_at IS '任务租约到期时间，过期后任务可被其他实例恢复';